@@ -0,0 +1,150 @@
+package cipherio
+
+import "sync"
+
+// AsyncRequest is a request to (en|de)crypt blocks, submitted to an AsyncBlockEngine.
+type AsyncRequest struct {
+	// Dst receives the (en|de)crypted blocks of Src. Both have the same length, a multiple of the
+	// block size, and may overlap exactly.
+	Dst, Src []byte
+
+	// Done must be called exactly once by the engine when the request completes, with the error
+	// that occurred, if any. It may be called from any goroutine.
+	Done func(err error)
+}
+
+// AsyncBlockEngine (en|de)crypts blocks asynchronously, as hardware accelerators and offload
+// engines do: requests are submitted, and complete later, so that several of them can be in
+// flight to hide the latency of each one.
+//
+// The engine holds the state of the mode, such as the CBC chaining value, like a cipher.BlockMode.
+// Requests must thus be processed as if they were (en|de)crypted one after another in submission
+// order, although they may complete in any order.
+type AsyncBlockEngine interface {
+	BlockSize() int
+
+	// Submit queues the given request. It should not wait for its completion. If an error is
+	// returned, Done must not be called.
+	Submit(req *AsyncRequest) error
+}
+
+// AsyncOptions configures an AsyncBlockMode. The zero value is valid.
+type AsyncOptions struct {
+	// RequestSize is the maximum number of bytes per request, rounded down to the block size.
+	// Defaults to 64 KiB.
+	RequestSize int
+
+	// Depth is the maximum number of requests in flight. Defaults to 8.
+	Depth int
+}
+
+// AsyncBlockMode presents an AsyncBlockEngine as a FallibleBlockMode, so that it can be used with
+// BlockReader, BlockWriter and the other helpers of this package.
+//
+// Each call to CryptBlocks is split into requests, up to Depth of which are in flight at once, and
+// returns when all of them have completed. The latency of the engine is thus hidden for large
+// calls, such as the large writes of BlockWriter. To also overlap (en|de)cryption with IO, combine
+// it with a PrefetchReader.
+//
+// An AsyncBlockMode is not safe for concurrent use, like any BlockMode.
+type AsyncBlockMode struct {
+	engine      AsyncBlockEngine
+	requestSize int
+	depth       int
+	err         error
+}
+
+// NewAsyncBlockMode returns an AsyncBlockMode submitting requests to the given engine.
+func NewAsyncBlockMode(engine AsyncBlockEngine, opts AsyncOptions) *AsyncBlockMode {
+	blockSize := engine.BlockSize()
+	requestSize := opts.RequestSize
+	if requestSize <= 0 {
+		requestSize = 64 << 10
+	}
+	requestSize = requestSize / blockSize * blockSize
+	if requestSize == 0 {
+		requestSize = blockSize
+	}
+	depth := opts.Depth
+	if depth <= 0 {
+		depth = 8
+	}
+	return &AsyncBlockMode{
+		engine:      engine,
+		requestSize: requestSize,
+		depth:       depth,
+	}
+}
+
+// BlockSize returns the block size of the engine.
+func (m *AsyncBlockMode) BlockSize() int {
+	return m.engine.BlockSize()
+}
+
+// CryptBlocks (en|de)crypts src into dst with the engine, and waits for completion. Any error is
+// reported by Err.
+func (m *AsyncBlockMode) CryptBlocks(dst, src []byte) {
+	if len(src)%m.engine.BlockSize() != 0 {
+		panic("cipherio: input not full blocks")
+	}
+	if len(dst) < len(src) {
+		panic("cipherio: output smaller than input")
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	slots := make(chan struct{}, m.depth)
+	for offset := 0; offset < len(src); offset += m.requestSize {
+		end := offset + m.requestSize
+		if end > len(src) {
+			end = len(src)
+		}
+
+		slots <- struct{}{}
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			// The state of the engine is unknown after an error: stop submitting.
+			break
+		}
+
+		wg.Add(1)
+		req := &AsyncRequest{
+			Dst: dst[offset:end],
+			Src: src[offset:end],
+			Done: func(err error) {
+				if err != nil {
+					fail(err)
+				}
+				<-slots
+				wg.Done()
+			},
+		}
+		if err := m.engine.Submit(req); err != nil {
+			fail(err)
+			<-slots
+			wg.Done()
+			break
+		}
+	}
+	wg.Wait()
+
+	m.err = firstErr
+}
+
+// Err returns the first error encountered by the last call to CryptBlocks, if any.
+func (m *AsyncBlockMode) Err() error {
+	return m.err
+}
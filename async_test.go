@@ -0,0 +1,146 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// queueEngine emulates an offload engine: requests are queued, then processed in order by a
+// separate goroutine, which completes them from there.
+type queueEngine struct {
+	blockMode cipher.BlockMode
+	queue     chan *cipherio.AsyncRequest
+	failAfter int // number of requests to complete before failing, or -1
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func newQueueEngine(blockMode cipher.BlockMode, failAfter int) *queueEngine {
+	e := &queueEngine{
+		blockMode: blockMode,
+		queue:     make(chan *cipherio.AsyncRequest, 64),
+		failAfter: failAfter,
+	}
+	go e.run()
+	return e
+}
+
+func (e *queueEngine) BlockSize() int {
+	return e.blockMode.BlockSize()
+}
+
+func (e *queueEngine) Submit(req *cipherio.AsyncRequest) error {
+	e.mu.Lock()
+	e.inFlight++
+	if e.inFlight > e.maxInFlight {
+		e.maxInFlight = e.inFlight
+	}
+	e.mu.Unlock()
+
+	e.queue <- req
+	return nil
+}
+
+func (e *queueEngine) run() {
+	completed := 0
+	for req := range e.queue {
+		var err error
+		if completed == e.failAfter {
+			err = errors.New("device failure")
+		} else {
+			e.blockMode.CryptBlocks(req.Dst, req.Src)
+		}
+		completed++
+
+		e.mu.Lock()
+		e.inFlight--
+		e.mu.Unlock()
+		req.Done(err)
+	}
+}
+
+func TestAsyncBlockMode(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 100000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := cipherio.EncryptBytes(nil, plaintext, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	engine := newQueueEngine(cipher.NewCBCEncrypter(aesCipher, iv), -1)
+	defer close(engine.queue)
+	blockMode := cipherio.NewAsyncBlockMode(engine, cipherio.AsyncOptions{RequestSize: 1000, Depth: 4})
+
+	var buf bytes.Buffer
+	writer := cipherio.NewBlockWriterWithPadding(&buf, blockMode, cipherio.ZeroPadding)
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatal("encrypted data does not match")
+	}
+
+	engine.mu.Lock()
+	maxInFlight := engine.maxInFlight
+	engine.mu.Unlock()
+	if maxInFlight < 1 || maxInFlight > 4 {
+		t.Fatalf("unexpected requests in flight: %d", maxInFlight)
+	}
+}
+
+func TestAsyncBlockModeFailure(t *testing.T) {
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := newQueueEngine(cipher.NewCBCEncrypter(aesCipher, make([]byte, 16)), 3)
+	defer close(engine.queue)
+	blockMode := cipherio.NewAsyncBlockMode(engine, cipherio.AsyncOptions{RequestSize: 16, Depth: 2})
+
+	var buf bytes.Buffer
+	writer := cipherio.NewBlockWriter(&buf, blockMode)
+	_, err = writer.Write(make([]byte, 32*16))
+	if err == nil || err.Error() != "device failure" {
+		t.Fatalf("unexpected err: %v != %v", err, "device failure")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output: %d bytes", buf.Len())
+	}
+}
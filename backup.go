@@ -0,0 +1,369 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// backupMagic identifies the header of a backup written by BackupWriter.
+var backupMagic = []byte("CIOBKUP\x01")
+
+const (
+	backupSaltSize    = 16
+	backupHeaderSize  = 8 + backupSaltSize // magic and salt
+	backupTrailerSize = 16                 // index offset and number of chunks
+	backupEntrySize   = 12                 // ciphertext offset and plaintext length of a chunk
+)
+
+// ErrInvalidBackup is returned when opening data that is not a valid backup.
+var ErrInvalidBackup = errors.New("cipherio: invalid backup")
+
+// BackupOptions configures a BackupWriter. The zero value is valid.
+type BackupOptions struct {
+	// ChunkSize is the number of plaintext bytes per chunk, which is the granularity of partial
+	// restores. Defaults to 1 MiB.
+	ChunkSize int
+
+	// Rand is the source of the random salt. Defaults to crypto/rand.Reader.
+	Rand io.Reader
+}
+
+// BackupWriter encrypts a backup as a sequence of independent chunks followed by an encrypted
+// index, so that BackupReader can restore any byte range without decrypting the whole backup.
+//
+// A random salt is written first, from which distinct keys are derived for chunks and IVs. Each
+// chunk is encrypted with AES-CBC and an IV derived from its index, as ESSIV does, and is
+// zero-padded to the block size. The index records the offset and length of each chunk, and is
+// located by a small trailer. Chunks are not authenticated.
+//
+// The index is only written by Close: a backup is unreadable until then.
+type BackupWriter struct {
+	dst       io.Writer
+	block     cipher.Block
+	essiv     cipher.Block
+	chunkSize int
+	buf       []byte // plaintext of the pending chunk
+	offset    int64  // number of bytes written to dst so far
+	index     []byte // plaintext of the index
+	chunks    uint64
+	err       error
+}
+
+// NewBackupWriter returns a BackupWriter encrypting to dst with the given AES key, and writes
+// the header of the backup.
+func NewBackupWriter(dst io.Writer, key []byte, opts BackupOptions) (*BackupWriter, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < 0 || uint64(chunkSize) > 1<<32-1 {
+		return nil, fmt.Errorf("cipherio: invalid backup chunk size: %d", chunkSize)
+	}
+
+	salt := make([]byte, backupSaltSize)
+	if _, err := io.ReadFull(randOrDefault(opts.Rand), salt); err != nil {
+		return nil, err
+	}
+	block, essiv, err := newBackupCiphers(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte(nil), backupMagic...), salt...)
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &BackupWriter{
+		dst:       dst,
+		block:     block,
+		essiv:     essiv,
+		chunkSize: chunkSize,
+		offset:    int64(len(header)),
+	}, nil
+}
+
+// newBackupCiphers derives the chunk and IV ciphers of a backup.
+func newBackupCiphers(key, salt []byte) (cipher.Block, cipher.Block, error) {
+	if err := checkPolicy("backup", true, false); err != nil {
+		return nil, nil, err
+	}
+	if _, err := newAESCipher(key); err != nil {
+		return nil, nil, err
+	}
+	block, err := newAESCipher(hkdf(key, salt, []byte("cipherio backup chunk"), len(key)))
+	if err != nil {
+		return nil, nil, err
+	}
+	essiv, err := newAESCipher(hkdf(key, salt, []byte("cipherio backup iv"), len(key)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, essiv, nil
+}
+
+func (w *BackupWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.buf == nil {
+		w.buf = make([]byte, 0, w.chunkSize)
+	}
+
+	count := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):w.chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		count += n
+
+		if len(w.buf) == w.chunkSize {
+			if w.err = w.writeChunk(); w.err != nil {
+				return count, w.err
+			}
+		}
+	}
+	return count, nil
+}
+
+// writeChunk encrypts and writes the pending chunk, and records it in the index.
+func (w *BackupWriter) writeChunk() error {
+	var entry [backupEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:8], uint64(w.offset))
+	binary.BigEndian.PutUint32(entry[8:], uint32(len(w.buf)))
+
+	if err := w.writeEncrypted(w.buf, w.chunks); err != nil {
+		return err
+	}
+	w.index = append(w.index, entry[:]...)
+	w.chunks++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// writeEncrypted encrypts p, zero-padded to the block size, with the IV of the given chunk index.
+func (w *BackupWriter) writeEncrypted(p []byte, chunkIndex uint64) error {
+	ciphertext := make([]byte, alignedSize(int64(len(p)), 16))
+	copy(ciphertext, p)
+	cipher.NewCBCEncrypter(w.block, backupIV(w.essiv, chunkIndex)).CryptBlocks(ciphertext, ciphertext)
+
+	n, err := w.dst.Write(ciphertext)
+	w.offset += int64(n)
+	return err
+}
+
+// Close writes any pending chunk, followed by the index and the trailer. The wrapped Writer is not
+// closed.
+func (w *BackupWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf) > 0 {
+		if w.err = w.writeChunk(); w.err != nil {
+			return w.err
+		}
+	}
+
+	var trailer [backupTrailerSize]byte
+	binary.BigEndian.PutUint64(trailer[:8], uint64(w.offset))
+	binary.BigEndian.PutUint64(trailer[8:], w.chunks)
+
+	// The index uses the IV following those of chunks.
+	if w.err = w.writeEncrypted(w.index, w.chunks); w.err != nil {
+		return w.err
+	}
+	if _, w.err = w.dst.Write(trailer[:]); w.err != nil {
+		return w.err
+	}
+	w.err = errors.New("cipherio: write to closed BackupWriter")
+	return nil
+}
+
+// backupIV returns the IV of the given chunk index: its encryption with the IV cipher.
+func backupIV(essiv cipher.Block, chunkIndex uint64) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint64(iv[8:], chunkIndex)
+	essiv.Encrypt(iv, iv)
+	return iv
+}
+
+// backupChunk locates a chunk of a backup.
+type backupChunk struct {
+	offset int64 // offset of the ciphertext in the backup
+	start  int64 // offset of the plaintext in the restored data
+	length int   // number of plaintext bytes
+}
+
+// BackupReader restores any byte range of a backup written by BackupWriter, only reading and
+// decrypting the blocks needed, thanks to its index.
+//
+// It implements io.ReaderAt, so a range can be restored with io.NewSectionReader. It is safe for
+// concurrent use if the underlying ReaderAt is.
+type BackupReader struct {
+	src    io.ReaderAt
+	block  cipher.Block
+	essiv  cipher.Block
+	chunks []backupChunk
+	size   int64
+}
+
+// NewBackupReader opens the backup of the given size stored in src, with the given AES key, and
+// loads its index.
+func NewBackupReader(src io.ReaderAt, size int64, key []byte) (*BackupReader, error) {
+	if size < backupHeaderSize+backupTrailerSize {
+		return nil, ErrInvalidBackup
+	}
+	header := make([]byte, backupHeaderSize)
+	if _, err := src.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(backupMagic)], backupMagic) {
+		return nil, ErrInvalidBackup
+	}
+	block, essiv, err := newBackupCiphers(key, header[len(backupMagic):])
+	if err != nil {
+		return nil, err
+	}
+
+	var trailer [backupTrailerSize]byte
+	if _, err := src.ReadAt(trailer[:], size-backupTrailerSize); err != nil {
+		return nil, err
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(trailer[:8]))
+	count := binary.BigEndian.Uint64(trailer[8:])
+	if count > uint64(size)/backupEntrySize {
+		return nil, ErrInvalidBackup
+	}
+	indexLen := int64(count) * backupEntrySize
+	if indexOffset < backupHeaderSize || indexOffset+alignedSize(indexLen, 16) != size-backupTrailerSize {
+		return nil, ErrInvalidBackup
+	}
+
+	index := make([]byte, alignedSize(indexLen, 16))
+	if _, err := src.ReadAt(index, indexOffset); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCDecrypter(block, backupIV(essiv, count)).CryptBlocks(index, index)
+
+	r := &BackupReader{
+		src:    src,
+		block:  block,
+		essiv:  essiv,
+		chunks: make([]backupChunk, count),
+	}
+	// Chunks must be contiguous, which detects a wrong key with high probability.
+	offset := int64(backupHeaderSize)
+	for i := range r.chunks {
+		entry := index[i*backupEntrySize:]
+		chunk := backupChunk{
+			offset: int64(binary.BigEndian.Uint64(entry[:8])),
+			start:  r.size,
+			length: int(binary.BigEndian.Uint32(entry[8:12])),
+		}
+		if chunk.offset != offset || chunk.length == 0 {
+			return nil, ErrInvalidBackup
+		}
+		offset += alignedSize(int64(chunk.length), 16)
+		r.size += int64(chunk.length)
+		r.chunks[i] = chunk
+	}
+	if offset != indexOffset {
+		return nil, ErrInvalidBackup
+	}
+	return r, nil
+}
+
+// Size returns the number of plaintext bytes of the backup.
+func (r *BackupReader) Size() int64 {
+	return r.size
+}
+
+// Chunks returns the number of chunks of the backup.
+func (r *BackupReader) Chunks() int {
+	return len(r.chunks)
+}
+
+// ReadAt restores len(p) bytes starting at the given offset, as defined by io.ReaderAt.
+func (r *BackupReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("cipherio: negative offset: %d", off)
+	}
+
+	// Find the chunk containing off.
+	i := sort.Search(len(r.chunks), func(i int) bool {
+		return r.chunks[i].start+int64(r.chunks[i].length) > off
+	})
+
+	count := 0
+	for ; len(p) > 0 && i < len(r.chunks); i++ {
+		n, err := r.readChunk(p, i, off-r.chunks[i].start)
+		p = p[n:]
+		off += int64(n)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	if len(p) > 0 {
+		return count, io.EOF
+	}
+	return count, nil
+}
+
+// readChunk decrypts the blocks of the chunk at the given index needed to fill p from the given
+// position within the chunk.
+func (r *BackupReader) readChunk(p []byte, chunkIndex int, pos int64) (int, error) {
+	chunk := r.chunks[chunkIndex]
+	if remaining := int64(chunk.length) - pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	iv := backupIV(r.essiv, uint64(chunkIndex))
+	if err := decryptCBCRange(p, r.src, chunk.offset, r.block, iv, pos); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Salvage restores as much of the backup as possible to dst, for forensics and recovery. When a
+// chunk cannot be read, for example because of a bad sector, onError is called with the plaintext
+// offset of the chunk and the error, the chunk is replaced by zeroes so that the following chunks
+// keep their offsets, and restoration continues with the next chunk.
+//
+// onError only reports errors returned by the ReaderAt. Chunks carry no authentication tag, so
+// corrupted ciphertext is not detected: it is decrypted to garbled blocks, which are written to dst
+// without any call to onError. Backups needing such detection must be authenticated separately,
+// for example with a MAC of the whole file. The index must be intact, since NewBackupReader fails
+// otherwise.
+//
+// Salvage returns the number of bytes written to dst, and only fails if dst does.
+func (r *BackupReader) Salvage(dst io.Writer, onError func(offset int64, err error)) (int64, error) {
+	var buf []byte
+	var written int64
+	for i, chunk := range r.chunks {
+		if cap(buf) < chunk.length {
+			buf = make([]byte, chunk.length)
+		}
+		p := buf[:chunk.length]
+
+		if _, err := r.readChunk(p, i, 0); err != nil {
+			if onError != nil {
+				onError(chunk.start, err)
+			}
+			for j := range p {
+				p[j] = 0
+			}
+		}
+
+		n, err := dst.Write(p)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
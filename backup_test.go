@@ -0,0 +1,232 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func writeBackup(t *testing.T, key, plaintext []byte, chunkSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer, err := cipherio.NewBackupWriter(&buf, key, cipherio.BackupOptions{ChunkSize: chunkSize})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	// Write in odd pieces, to cross chunk boundaries.
+	for remaining := plaintext; len(remaining) > 0; {
+		n := 777
+		if n > len(remaining) {
+			n = len(remaining)
+		}
+		_, err = writer.Write(remaining[:n])
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		remaining = remaining[n:]
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	return buf.Bytes()
+}
+
+func TestBackup(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 10000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := writeBackup(t, key, plaintext, 1000)
+
+	reader, err := cipherio.NewBackupReader(bytes.NewReader(backup), int64(len(backup)), key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if reader.Size() != int64(len(plaintext)) {
+		t.Fatalf("unexpected size: %d != %d", reader.Size(), len(plaintext))
+	}
+	if reader.Chunks() != 10 {
+		t.Fatalf("unexpected chunks: %d != %d", reader.Chunks(), 10)
+	}
+
+	testCases := []struct {
+		Name   string
+		Offset int64
+		Length int64
+	}{
+		{"All", 0, 10000},
+		{"Start", 0, 5},
+		{"WithinBlock", 3, 5},
+		{"WithinChunk", 1017, 500},
+		{"AcrossChunks", 990, 2020},
+		{"End", 9990, 10},
+		{"Empty", 5000, 0},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			result, err := ioutil.ReadAll(io.NewSectionReader(reader, testCase.Offset, testCase.Length))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			expected := plaintext[testCase.Offset : testCase.Offset+testCase.Length]
+			if !bytes.Equal(result, expected) {
+				t.Fatal("restored data does not match plaintext")
+			}
+		})
+	}
+
+	p := make([]byte, 20)
+	n, err := reader.ReadAt(p, 9990)
+	if err != io.EOF || n != 10 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+}
+
+func TestBackupEmpty(t *testing.T) {
+	key := make([]byte, 16)
+	backup := writeBackup(t, key, nil, 0)
+
+	reader, err := cipherio.NewBackupReader(bytes.NewReader(backup), int64(len(backup)), key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if reader.Size() != 0 || reader.Chunks() != 0 {
+		t.Fatalf("unexpected backup: %d bytes, %d chunks", reader.Size(), reader.Chunks())
+	}
+}
+
+func TestBackupInvalid(t *testing.T) {
+	key := make([]byte, 16)
+	backup := writeBackup(t, key, make([]byte, 5000), 1000)
+
+	otherKey := make([]byte, 16)
+	otherKey[0] = 1
+	testCases := []struct {
+		Name   string
+		Backup []byte
+		Key    []byte
+	}{
+		{"WrongKey", backup, otherKey},
+		{"Truncated", backup[:len(backup)-1], key},
+		{"TooShort", backup[:10], key},
+		{"BadMagic", append([]byte("garbage!"), backup[8:]...), key},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			_, err := cipherio.NewBackupReader(bytes.NewReader(testCase.Backup), int64(len(testCase.Backup)), testCase.Key)
+			if err != cipherio.ErrInvalidBackup {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidBackup)
+			}
+		})
+	}
+}
+
+// faultyReaderAt fails to read the given range, like a bad sector.
+type faultyReaderAt struct {
+	src        io.ReaderAt
+	start, end int64
+}
+
+var errBadSector = errors.New("bad sector")
+
+func (r faultyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < r.end && off+int64(len(p)) > r.start {
+		return 0, errBadSector
+	}
+	return r.src.ReadAt(p, off)
+}
+
+func TestBackupSalvage(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 4*1000+123)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := writeBackup(t, key, plaintext, 1000)
+
+	// Damage the second and third chunks, which start after the 24-byte header and the first
+	// chunk of 1008 bytes.
+	src := faultyReaderAt{src: bytes.NewReader(backup), start: 24 + 1008 + 100, end: 24 + 2*1008 + 1}
+	reader, err := cipherio.NewBackupReader(src, int64(len(backup)), key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	var offsets []int64
+	var buf bytes.Buffer
+	n, err := reader.Salvage(&buf, func(offset int64, err error) {
+		if err != errBadSector {
+			t.Errorf("unexpected err: %v != %v", err, errBadSector)
+		}
+		offsets = append(offsets, offset)
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if n != int64(len(plaintext)) {
+		t.Fatalf("unexpected length: %d != %d", n, len(plaintext))
+	}
+	if !reflect.DeepEqual(offsets, []int64{1000, 2000}) {
+		t.Fatalf("unexpected offsets: %v", offsets)
+	}
+
+	expected := append([]byte(nil), plaintext...)
+	for i := 1000; i < 3000; i++ {
+		expected[i] = 0
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatal("salvaged data does not match plaintext")
+	}
+
+	t.Run("Corrupted", func(t *testing.T) {
+		// Corrupted ciphertext is not detected, and only garbles the blocks it affects.
+		corrupted := append([]byte(nil), backup...)
+		corrupted[24+1008+100] ^= 1
+		reader, err := cipherio.NewBackupReader(bytes.NewReader(corrupted), int64(len(corrupted)), key)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		var buf bytes.Buffer
+		_, err = reader.Salvage(&buf, func(offset int64, err error) {
+			t.Errorf("unexpected error at %d: %v", offset, err)
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(buf.Bytes()[:1096], plaintext[:1096]) || !bytes.Equal(buf.Bytes()[1128:], plaintext[1128:]) {
+			t.Fatal("salvaged data does not match plaintext outside of the corrupted blocks")
+		}
+		if bytes.Equal(buf.Bytes()[1096:1112], plaintext[1096:1112]) {
+			t.Fatal("corrupted block decrypted to plaintext")
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package cipherio
+
+import (
+	"sort"
+)
+
+// CipherDescriptor describes a block cipher available in this build.
+type CipherDescriptor struct {
+	ID   CipherID
+	Name string
+}
+
+// ModeDescriptor describes a mode of operation provided by this package.
+type ModeDescriptor struct {
+	Name string
+
+	// ID identifies the mode in a StreamHeader, or is zero if StreamHeader cannot describe it.
+	ID ModeID
+
+	// BlockAligned means that data must be aligned to the block size, or padded. Other modes are
+	// stream modes, which (en|de)crypt any number of bytes.
+	BlockAligned bool
+
+	// Authenticated means that tampering is detected by the mode itself.
+	Authenticated bool
+
+	// Insecure means that the mode is only provided for interoperability with legacy systems.
+	Insecure bool
+}
+
+// PaddingDescriptor describes a padding provided by this package.
+type PaddingDescriptor struct {
+	ID      PaddingID
+	Name    string
+	Padding Padding // nil for PaddingNone
+
+	// Removable means that the padding can be removed unambiguously without knowing the length
+	// of the plaintext.
+	Removable bool
+}
+
+// FormatDescriptor describes a binary format written and parsed by this package.
+type FormatDescriptor struct {
+	Name  string
+	Magic []byte // prefix of every encoded value, including the format version if any
+
+	// Authenticated means that the format detects tampering of the data it describes.
+	Authenticated bool
+}
+
+// SupportedCiphers returns the block ciphers available for StreamHeader, including those added
+// with RegisterCipher, sorted by ID.
+func SupportedCiphers() []CipherDescriptor {
+	ciphersMu.RLock()
+	descriptors := make([]CipherDescriptor, 0, len(ciphers))
+	for id, registered := range ciphers {
+		descriptors = append(descriptors, CipherDescriptor{id, registered.name})
+	}
+	ciphersMu.RUnlock()
+
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].ID < descriptors[j].ID
+	})
+	return descriptors
+}
+
+// SupportedModes returns the modes of operation provided by this package, in addition to those of
+// crypto/cipher, which can all be used with BlockReader and BlockWriter.
+func SupportedModes() []ModeDescriptor {
+	return []ModeDescriptor{
+		{Name: "CBC", ID: ModeCBC, BlockAligned: true},
+		{Name: "ECB", BlockAligned: true, Insecure: true},
+		{Name: "CFB"},
+		{Name: "CFB8"},
+		{Name: "OFB"},
+		{Name: "CTR"},
+		{Name: "ChaCha20"},
+		{Name: "XChaCha20"},
+	}
+}
+
+// SupportedPaddings returns the paddings provided by this package, sorted by ID.
+func SupportedPaddings() []PaddingDescriptor {
+	return []PaddingDescriptor{
+		{ID: PaddingNone, Name: "none"},
+		{ID: PaddingZero, Name: "zero", Padding: ZeroPadding},
+		{ID: PaddingBit, Name: "bit", Padding: BitPadding, Removable: true},
+		{ID: PaddingPKCS7, Name: "PKCS#7", Padding: PKCS7Padding, Removable: true},
+	}
+}
+
+// SupportedFormats returns the binary formats written and parsed by this package, followed by
+// those added with RegisterFormat.
+func SupportedFormats() []FormatDescriptor {
+	builtin := []FormatDescriptor{
+		{Name: "stream", Magic: appendVersion(streamHeaderMagic, StreamHeaderVersion)},
+		{Name: "multipart-manifest", Magic: append([]byte(nil), multipartManifestMagic...)},
+		{Name: "shard-manifest", Magic: append([]byte(nil), shardManifestMagic...)},
+		{Name: "encrypted-file", Magic: append([]byte(nil), encryptedFileMagic...)},
+		{Name: "backup", Magic: append([]byte(nil), backupMagic...)},
+		{Name: "openssl-enc", Magic: append([]byte(nil), openSSLMagic...)},
+		{Name: "indexed", Magic: append([]byte(nil), indexedMagic...)},
+	}
+	return append(builtin, registeredFormats()...)
+}
+
+// appendVersion returns a copy of magic followed by the given version byte.
+func appendVersion(magic []byte, version byte) []byte {
+	return append(append([]byte(nil), magic...), version)
+}
@@ -0,0 +1,70 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestSupportedCiphers(t *testing.T) {
+	ciphers := cipherio.SupportedCiphers()
+	if len(ciphers) == 0 || ciphers[0].ID != cipherio.CipherAES || ciphers[0].Name != "AES" {
+		t.Fatalf("unexpected ciphers: %v", ciphers)
+	}
+	for i := 1; i < len(ciphers); i++ {
+		if ciphers[i-1].ID >= ciphers[i].ID {
+			t.Fatalf("unsorted ciphers: %v", ciphers)
+		}
+	}
+}
+
+func TestSupportedModes(t *testing.T) {
+	for _, mode := range cipherio.SupportedModes() {
+		if mode.ID == cipherio.ModeCBC && (mode.Name != "CBC" || !mode.BlockAligned) {
+			t.Fatalf("unexpected CBC descriptor: %+v", mode)
+		}
+		if mode.Name == "ECB" && !mode.Insecure {
+			t.Fatalf("ECB is not marked as insecure: %+v", mode)
+		}
+	}
+}
+
+func TestSupportedPaddings(t *testing.T) {
+	for _, descriptor := range cipherio.SupportedPaddings() {
+		padding, err := descriptor.ID.Padding()
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if (padding == nil) != (descriptor.Padding == nil) {
+			t.Fatalf("unexpected padding for %s", descriptor.Name)
+		}
+	}
+}
+
+func TestSupportedFormats(t *testing.T) {
+	var buf bytes.Buffer
+	header := &cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		IV:           make([]byte, 16),
+		PlaintextLen: -1,
+	}
+	writer, err := cipherio.NewStreamWriter(&buf, header, make([]byte, 16))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	for _, format := range cipherio.SupportedFormats() {
+		if format.Name == "stream" {
+			if !bytes.HasPrefix(buf.Bytes(), format.Magic) {
+				t.Fatalf("unexpected magic: %q", format.Magic)
+			}
+			return
+		}
+	}
+	t.Fatal("stream format not found")
+}
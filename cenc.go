@@ -0,0 +1,141 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"fmt"
+)
+
+// Subsample describes a range of a sample for Common Encryption (ISO/IEC 23001-7), as found in the
+// subsample encryption information of a sample: clear bytes followed by protected bytes.
+type Subsample struct {
+	Clear     int // BytesOfClearData
+	Protected int // BytesOfProtectedData
+}
+
+// Pattern is the encryption pattern of the cbcs and cens schemes of Common Encryption: within
+// protected ranges, Crypt blocks are encrypted, then Skip blocks are left clear, and so on. For
+// example, video usually uses 1:9. The zero value encrypts all blocks, like the cenc and cbc1
+// schemes.
+type Pattern struct {
+	Crypt int // crypt_byte_block, at most 15
+	Skip  int // skip_byte_block, at most 15
+}
+
+// EncryptSampleCBCS encrypts a sample in place with the cbcs scheme of Common Encryption: AES-CBC
+// with the given pattern, over the protected ranges of the given subsamples. The IV, usually the
+// constant IV of the track, is used at the start of each subsample. Trailing bytes of a protected
+// range that do not form a whole block are left clear.
+//
+// If subsamples is empty, the whole sample is protected. Otherwise, their sizes must add up to the
+// length of the sample.
+func EncryptSampleCBCS(sample []byte, block cipher.Block, iv []byte, pattern Pattern, subsamples []Subsample) error {
+	return cryptSampleCBCS(sample, block, iv, pattern, subsamples, cipher.NewCBCEncrypter)
+}
+
+// DecryptSampleCBCS decrypts in place a sample encrypted by EncryptSampleCBCS.
+func DecryptSampleCBCS(sample []byte, block cipher.Block, iv []byte, pattern Pattern, subsamples []Subsample) error {
+	return cryptSampleCBCS(sample, block, iv, pattern, subsamples, cipher.NewCBCDecrypter)
+}
+
+func cryptSampleCBCS(sample []byte, block cipher.Block, iv []byte, pattern Pattern, subsamples []Subsample, newCBC func(cipher.Block, []byte) cipher.BlockMode) error {
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return err
+	}
+	ranges, err := protectedRanges(sample, pattern, subsamples)
+	if err != nil {
+		return err
+	}
+
+	blockSize := block.BlockSize()
+	for _, protected := range ranges {
+		// Skipped blocks do not take part in the CBC chain.
+		blockMode := newCBC(block, iv)
+		forEachPatternRun(len(protected)/blockSize, pattern, func(first, count int) {
+			run := protected[first*blockSize : (first+count)*blockSize]
+			blockMode.CryptBlocks(run, run)
+		})
+	}
+	return nil
+}
+
+// CryptSampleCENS encrypts or decrypts a sample in place with the cens scheme of Common
+// Encryption: AES-CTR with the given pattern, over the protected ranges of the given subsamples.
+// The key stream continues from one protected range to the next, and skipped blocks do not
+// consume it.
+//
+// With a pattern, trailing bytes of a protected range that do not form a whole block are left
+// clear. With the zero Pattern, all protected bytes are (en|de)crypted, as the cenc scheme does.
+//
+// If subsamples is empty, the whole sample is protected. Otherwise, their sizes must add up to the
+// length of the sample.
+func CryptSampleCENS(sample []byte, block cipher.Block, iv []byte, pattern Pattern, subsamples []Subsample) error {
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return err
+	}
+	ranges, err := protectedRanges(sample, pattern, subsamples)
+	if err != nil {
+		return err
+	}
+
+	stream := cipher.NewCTR(block, iv)
+	blockSize := block.BlockSize()
+	for _, protected := range ranges {
+		if pattern == (Pattern{}) {
+			stream.XORKeyStream(protected, protected)
+			continue
+		}
+		forEachPatternRun(len(protected)/blockSize, pattern, func(first, count int) {
+			run := protected[first*blockSize : (first+count)*blockSize]
+			stream.XORKeyStream(run, run)
+		})
+	}
+	return nil
+}
+
+// protectedRanges checks the pattern and the subsamples, and returns the protected ranges of the
+// sample.
+func protectedRanges(sample []byte, pattern Pattern, subsamples []Subsample) ([][]byte, error) {
+	if pattern.Crypt < 0 || pattern.Crypt > 15 || pattern.Skip < 0 || pattern.Skip > 15 {
+		return nil, fmt.Errorf("cipherio: invalid encryption pattern: %d:%d", pattern.Crypt, pattern.Skip)
+	}
+	if pattern.Crypt == 0 && pattern.Skip != 0 {
+		return nil, fmt.Errorf("cipherio: encryption pattern skips all blocks: %d:%d", pattern.Crypt, pattern.Skip)
+	}
+	if len(subsamples) == 0 {
+		return [][]byte{sample}, nil
+	}
+
+	ranges := make([][]byte, 0, len(subsamples))
+	offset := 0
+	for _, subsample := range subsamples {
+		if subsample.Clear < 0 || subsample.Protected < 0 || subsample.Clear+subsample.Protected > len(sample)-offset {
+			return nil, fmt.Errorf("cipherio: subsamples do not match sample size: %d", len(sample))
+		}
+		offset += subsample.Clear
+		ranges = append(ranges, sample[offset:offset+subsample.Protected])
+		offset += subsample.Protected
+	}
+	if offset != len(sample) {
+		return nil, fmt.Errorf("cipherio: subsamples do not match sample size: %d != %d", offset, len(sample))
+	}
+	return ranges, nil
+}
+
+// forEachPatternRun calls fn with the index and the number of each run of consecutive blocks to
+// (en|de)crypt among the given number of blocks. A final run shorter than pattern.Crypt is still
+// (en|de)crypted.
+func forEachPatternRun(blocks int, pattern Pattern, fn func(first, count int)) {
+	if pattern.Crypt == 0 {
+		if blocks > 0 {
+			fn(0, blocks)
+		}
+		return
+	}
+	for first := 0; first < blocks; first += pattern.Crypt + pattern.Skip {
+		count := pattern.Crypt
+		if count > blocks-first {
+			count = blocks - first
+		}
+		fn(first, count)
+	}
+}
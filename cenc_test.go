@@ -0,0 +1,159 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestSampleCBCS(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, 16)
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second subsample has 25 whole blocks and a partial one: blocks 0, 10 and 20 are encrypted.
+	subsamples := []cipherio.Subsample{{Clear: 5, Protected: 40}, {Clear: 3, Protected: 25*16 + 7}}
+	plaintext := make([]byte, 5+40+3+25*16+7)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sample := append([]byte(nil), plaintext...)
+	err = cipherio.EncryptSampleCBCS(sample, block, iv, cipherio.Pattern{Crypt: 1, Skip: 9}, subsamples)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// Compute the expected result block by block.
+	expected := append([]byte(nil), plaintext...)
+	first := expected[5:37]
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(first[:16], first[:16])
+	second := expected[48:]
+	blockMode := cipher.NewCBCEncrypter(block, iv)
+	for _, index := range []int{0, 10, 20} {
+		encrypted := second[index*16 : (index+1)*16]
+		blockMode.CryptBlocks(encrypted, encrypted)
+	}
+	if !bytes.Equal(sample, expected) {
+		t.Fatal("unexpected encrypted sample")
+	}
+
+	err = cipherio.DecryptSampleCBCS(sample, block, iv, cipherio.Pattern{Crypt: 1, Skip: 9}, subsamples)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(sample, plaintext) {
+		t.Fatal("decrypted sample does not match plaintext")
+	}
+}
+
+func TestSampleCENS(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, 16)
+	subsamples := []cipherio.Subsample{{Clear: 10, Protected: 100}, {Clear: 0, Protected: 50}}
+	plaintext := make([]byte, 160)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without pattern, this is CTR over the concatenation of protected ranges.
+	sample := append([]byte(nil), plaintext...)
+	err = cipherio.CryptSampleCENS(sample, block, iv, cipherio.Pattern{}, subsamples)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	protected := append([]byte(nil), plaintext[10:]...)
+	cipher.NewCTR(block, iv).XORKeyStream(protected, protected)
+	if !bytes.Equal(sample[:10], plaintext[:10]) || !bytes.Equal(sample[10:], protected) {
+		t.Fatal("unexpected encrypted sample")
+	}
+
+	// With a pattern, skipped blocks and partial blocks are left clear.
+	sample = append([]byte(nil), plaintext...)
+	pattern := cipherio.Pattern{Crypt: 2, Skip: 1}
+	err = cipherio.CryptSampleCENS(sample, block, iv, pattern, subsamples)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	for _, clear := range [][2]int{{0, 10}, {42, 58}, {106, 110}, {142, 160}} {
+		if !bytes.Equal(sample[clear[0]:clear[1]], plaintext[clear[0]:clear[1]]) {
+			t.Fatalf("bytes %d to %d have been modified", clear[0], clear[1])
+		}
+	}
+	err = cipherio.CryptSampleCENS(sample, block, iv, pattern, subsamples)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(sample, plaintext) {
+		t.Fatal("decrypted sample does not match plaintext")
+	}
+}
+
+func TestSampleErrors(t *testing.T) {
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, 16)
+	sample := make([]byte, 64)
+
+	testCases := []struct {
+		Name       string
+		Pattern    cipherio.Pattern
+		Subsamples []cipherio.Subsample
+	}{
+		{"PatternTooLarge", cipherio.Pattern{Crypt: 16}, nil},
+		{"SkipOnly", cipherio.Pattern{Skip: 9}, nil},
+		{"SubsamplesTooShort", cipherio.Pattern{}, []cipherio.Subsample{{Clear: 10, Protected: 10}}},
+		{"SubsamplesTooLong", cipherio.Pattern{}, []cipherio.Subsample{{Clear: 10, Protected: 100}}},
+		{"NegativeSubsample", cipherio.Pattern{}, []cipherio.Subsample{{Clear: -1, Protected: 65}}},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			err := cipherio.EncryptSampleCBCS(sample, block, iv, testCase.Pattern, testCase.Subsamples)
+			if err == nil {
+				t.Fatal("invalid parameters have been accepted")
+			}
+			err = cipherio.CryptSampleCENS(sample, block, iv, testCase.Pattern, testCase.Subsamples)
+			if err == nil {
+				t.Fatal("invalid parameters have been accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// cfb8 implements CFB mode with 8-bit feedback: each byte is XORed with the first byte of the
+// encrypted shift register, which is then shifted by one ciphertext byte.
+type cfb8 struct {
+	block    cipher.Block
+	register []byte
+	out      []byte
+	decrypt  bool
+}
+
+// NewCFB8Encrypter returns a Stream encrypting with the given block cipher in CFB mode with 8-bit
+// feedback, as required by some legacy protocols such as SNMPv3. The IV must be as long as a
+// block.
+//
+// CFB8 requires one block encryption per byte, hence it is much slower than CFB128.
+func NewCFB8Encrypter(block cipher.Block, iv []byte) (cipher.Stream, error) {
+	return newCFB8(block, iv, false)
+}
+
+// NewCFB8Decrypter returns a Stream decrypting with the given block cipher in CFB mode with 8-bit
+// feedback. The IV must be as long as a block.
+func NewCFB8Decrypter(block cipher.Block, iv []byte) (cipher.Stream, error) {
+	return newCFB8(block, iv, true)
+}
+
+func newCFB8(block cipher.Block, iv []byte, decrypt bool) (cipher.Stream, error) {
+	if err := checkPolicy("CFB8", true, false); err != nil {
+		return nil, err
+	}
+	blockSize := block.BlockSize()
+	if err := checkIV(iv, blockSize); err != nil {
+		return nil, err
+	}
+	return &cfb8{
+		block:    block,
+		register: append([]byte(nil), iv...),
+		out:      make([]byte, blockSize),
+		decrypt:  decrypt,
+	}, nil
+}
+
+func (x *cfb8) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("cipherio: output smaller than input")
+	}
+	last := len(x.register) - 1
+	for i, in := range src {
+		x.block.Encrypt(x.out, x.register)
+		out := in ^ x.out[0]
+		dst[i] = out
+
+		copy(x.register, x.register[1:])
+		if x.decrypt {
+			x.register[last] = in
+		} else {
+			x.register[last] = out
+		}
+	}
+}
+
+// NewCFBReader returns a Reader decrypting src with the given block cipher in CFB mode with full
+// block feedback (CFB128 for AES). The IV must be as long as a block.
+func NewCFBReader(src io.Reader, block cipher.Block, iv []byte) (io.Reader, error) {
+	if err := checkPolicy("CFB", true, false); err != nil {
+		return nil, err
+	}
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	return cipher.StreamReader{S: cipher.NewCFBDecrypter(block, iv), R: src}, nil
+}
+
+// NewCFBWriter returns a WriteCloser encrypting data with the given block cipher in CFB mode with
+// full block feedback (CFB128 for AES), and writing it to dst. The IV must be as long as a block.
+//
+// Since CFB is a stream mode, there is neither buffering nor padding. Close closes dst if it
+// implements io.Closer.
+func NewCFBWriter(dst io.Writer, block cipher.Block, iv []byte) (io.WriteCloser, error) {
+	if err := checkPolicy("CFB", true, false); err != nil {
+		return nil, err
+	}
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	return cipher.StreamWriter{S: cipher.NewCFBEncrypter(block, iv), W: dst}, nil
+}
+
+// NewCFB8Reader is similar to NewCFBReader, except that CFB8 is used.
+func NewCFB8Reader(src io.Reader, block cipher.Block, iv []byte) (io.Reader, error) {
+	stream, err := NewCFB8Decrypter(block, iv)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamReader{S: stream, R: src}, nil
+}
+
+// NewCFB8Writer is similar to NewCFBWriter, except that CFB8 is used.
+func NewCFB8Writer(dst io.Writer, block cipher.Block, iv []byte) (io.WriteCloser, error) {
+	stream, err := NewCFB8Encrypter(block, iv)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamWriter{S: stream, W: dst}, nil
+}
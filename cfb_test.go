@@ -0,0 +1,109 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// streamModeTest describes a known-answer test of a stream mode, from NIST SP 800-38A.
+type streamModeTest struct {
+	Name       string
+	NewReader  func(io.Reader, cipher.Block, []byte) (io.Reader, error)
+	NewWriter  func(io.Writer, cipher.Block, []byte) (io.WriteCloser, error)
+	Key        string
+	IV         string
+	Plaintext  string
+	Ciphertext string
+}
+
+var cfbTests = []streamModeTest{
+	{
+		Name:       "CFB128",
+		NewReader:  cipherio.NewCFBReader,
+		NewWriter:  cipherio.NewCFBWriter,
+		Key:        "2b7e151628aed2a6abf7158809cf4f3c",
+		IV:         "000102030405060708090a0b0c0d0e0f",
+		Plaintext:  "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51",
+		Ciphertext: "3b3fd92eb72dad20333449f8e83cfb4ac8a64537a0b3a93fcde3cdad9f1ce58b",
+	},
+	{
+		Name:       "CFB8",
+		NewReader:  cipherio.NewCFB8Reader,
+		NewWriter:  cipherio.NewCFB8Writer,
+		Key:        "2b7e151628aed2a6abf7158809cf4f3c",
+		IV:         "000102030405060708090a0b0c0d0e0f",
+		Plaintext:  "6bc1bee22e409f96e93d7e117393172aae2d",
+		Ciphertext: "3b79424c9c0dd436bace9e0ed4586a4f32b9",
+	},
+}
+
+func runStreamModeTests(t *testing.T, tests []streamModeTest) {
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			key, _ := hex.DecodeString(test.Key)
+			iv, _ := hex.DecodeString(test.IV)
+			plaintext, _ := hex.DecodeString(test.Plaintext)
+			ciphertext, _ := hex.DecodeString(test.Ciphertext)
+
+			// Initialize the AES cipher
+			aesCipher, err := aes.NewCipher(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Write byte by byte, to check that the state is carried between writes.
+			var encrypted bytes.Buffer
+			writer, err := test.NewWriter(&encrypted, aesCipher, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range plaintext {
+				_, err = writer.Write(plaintext[i : i+1])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encrypted.Bytes(), ciphertext) {
+				t.Fatalf("unexpected ciphertext: %x != %x", encrypted.Bytes(), ciphertext)
+			}
+
+			reader, err := test.NewReader(bytes.NewReader(ciphertext), aesCipher, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decrypted, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("unexpected plaintext: %x != %x", decrypted, plaintext)
+			}
+
+			_, err = test.NewReader(bytes.NewReader(ciphertext), aesCipher, iv[:8])
+			if !errors.Is(err, cipherio.ErrInvalidIV) {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidIV)
+			}
+			_, err = test.NewWriter(&encrypted, aesCipher, iv[:8])
+			if !errors.Is(err, cipherio.ErrInvalidIV) {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidIV)
+			}
+		})
+	}
+}
+
+func TestCFB(t *testing.T) {
+	runStreamModeTests(t, cfbTests)
+}
@@ -0,0 +1,248 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+const (
+	// ChaCha20KeySize is the size of ChaCha20 keys.
+	ChaCha20KeySize = 32
+	// ChaCha20NonceSize is the size of ChaCha20 nonces, as defined by RFC 8439.
+	ChaCha20NonceSize = 12
+	// XChaCha20NonceSize is the size of XChaCha20 nonces.
+	XChaCha20NonceSize = 24
+
+	chachaBlockSize = 64
+	// chachaMaxOffset is the size of the key stream, limited by the 32-bit block counter.
+	chachaMaxOffset = 1 << 32 * chachaBlockSize
+)
+
+// ErrKeyStreamExhausted is returned when seeking beyond the 256 GiB key stream of ChaCha20.
+var ErrKeyStreamExhausted = errors.New("cipherio: ChaCha20 key stream exhausted")
+
+// ChaCha20 is a cipher.Stream implementing ChaCha20 as defined by RFC 8439, or XChaCha20 when
+// created with a 24-byte nonce. Unlike cipher.Stream in general, its position in the key stream
+// can be set with SetOffset, which allows random access into encrypted data.
+type ChaCha20 struct {
+	key       [8]uint32
+	nonce     [3]uint32
+	offset    int64
+	keyStream [chachaBlockSize]byte
+}
+
+// NewChaCha20 returns a ChaCha20 stream starting at the beginning of the key stream, with block
+// counter 0. The nonce must be either 12 bytes long for ChaCha20, or 24 bytes long for XChaCha20.
+// A nonce must never be reused with the same key.
+func NewChaCha20(key, nonce []byte) (*ChaCha20, error) {
+	if err := checkPolicy("ChaCha20", false, false); err != nil {
+		return nil, err
+	}
+	if len(key) != ChaCha20KeySize {
+		return nil, fmt.Errorf("%w: ChaCha20 requires %d bytes: %d", ErrInvalidKeySize, ChaCha20KeySize, len(key))
+	}
+
+	c := &ChaCha20{}
+	switch len(nonce) {
+	case ChaCha20NonceSize:
+		for i := range c.key {
+			c.key[i] = binary.LittleEndian.Uint32(key[4*i:])
+		}
+	case XChaCha20NonceSize:
+		subKey := hChaCha20(key, nonce[:16])
+		for i := range c.key {
+			c.key[i] = binary.LittleEndian.Uint32(subKey[4*i:])
+		}
+		nonce = append(make([]byte, 4), nonce[16:]...)
+	default:
+		return nil, fmt.Errorf("%w: length must equal %d or %d: %d", ErrInvalidIV, ChaCha20NonceSize, XChaCha20NonceSize, len(nonce))
+	}
+	for i := range c.nonce {
+		c.nonce[i] = binary.LittleEndian.Uint32(nonce[4*i:])
+	}
+	return c, nil
+}
+
+// Offset returns the current position in the key stream.
+func (c *ChaCha20) Offset() int64 {
+	return c.offset
+}
+
+// SetOffset sets the position in the key stream, so that the next byte is (en|de)crypted as if it
+// was at the given offset of the data.
+func (c *ChaCha20) SetOffset(offset int64) error {
+	if offset < 0 {
+		return fmt.Errorf("cipherio: negative offset: %d", offset)
+	}
+	if offset > chachaMaxOffset {
+		return ErrKeyStreamExhausted
+	}
+	c.offset = offset
+	if offset%chachaBlockSize != 0 && offset < chachaMaxOffset {
+		c.generate(uint32(offset / chachaBlockSize))
+	}
+	return nil
+}
+
+// XORKeyStream XORs each byte of src with a byte of the key stream, as defined by cipher.Stream.
+// It panics if the key stream is exhausted.
+func (c *ChaCha20) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("cipherio: output smaller than input")
+	}
+	if chachaMaxOffset-c.offset < int64(len(src)) {
+		panic(ErrKeyStreamExhausted)
+	}
+	for len(src) > 0 {
+		position := int(c.offset % chachaBlockSize)
+		if position == 0 {
+			c.generate(uint32(c.offset / chachaBlockSize))
+		}
+		n := len(src)
+		if available := chachaBlockSize - position; n > available {
+			n = available
+		}
+		for i := 0; i < n; i++ {
+			dst[i] = src[i] ^ c.keyStream[position+i]
+		}
+		c.offset += int64(n)
+		dst = dst[n:]
+		src = src[n:]
+	}
+}
+
+// generate computes the key stream block with the given counter.
+func (c *ChaCha20) generate(counter uint32) {
+	state := [16]uint32{
+		0x61707865, 0x3320646e, 0x79622d32, 0x6b206574,
+		c.key[0], c.key[1], c.key[2], c.key[3],
+		c.key[4], c.key[5], c.key[6], c.key[7],
+		counter, c.nonce[0], c.nonce[1], c.nonce[2],
+	}
+	working := state
+	chachaRounds(&working)
+	for i := range working {
+		binary.LittleEndian.PutUint32(c.keyStream[4*i:], working[i]+state[i])
+	}
+}
+
+// hChaCha20 derives the XChaCha20 subkey from the key and the first 16 bytes of the nonce.
+func hChaCha20(key, nonce []byte) []byte {
+	var state [16]uint32
+	state[0], state[1], state[2], state[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		state[4+i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	for i := 0; i < 4; i++ {
+		state[12+i] = binary.LittleEndian.Uint32(nonce[4*i:])
+	}
+	chachaRounds(&state)
+
+	subKey := make([]byte, ChaCha20KeySize)
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint32(subKey[4*i:], state[i])
+		binary.LittleEndian.PutUint32(subKey[16+4*i:], state[12+i])
+	}
+	return subKey
+}
+
+// chachaRounds applies the 20 rounds of ChaCha to the given state.
+func chachaRounds(s *[16]uint32) {
+	for i := 0; i < 10; i++ {
+		quarterRound(s, 0, 4, 8, 12)
+		quarterRound(s, 1, 5, 9, 13)
+		quarterRound(s, 2, 6, 10, 14)
+		quarterRound(s, 3, 7, 11, 15)
+		quarterRound(s, 0, 5, 10, 15)
+		quarterRound(s, 1, 6, 11, 12)
+		quarterRound(s, 2, 7, 8, 13)
+		quarterRound(s, 3, 4, 9, 14)
+	}
+}
+
+func quarterRound(s *[16]uint32, a, b, c, d int) {
+	s[a] += s[b]
+	s[d] = bits.RotateLeft32(s[d]^s[a], 16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], 12)
+	s[a] += s[b]
+	s[d] = bits.RotateLeft32(s[d]^s[a], 8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], 7)
+}
+
+// NewChaCha20Writer returns a WriteCloser encrypting data with ChaCha20, or XChaCha20 with a
+// 24-byte nonce, and writing it to dst. Close closes dst if it implements io.Closer.
+func NewChaCha20Writer(dst io.Writer, key, nonce []byte) (io.WriteCloser, error) {
+	stream, err := NewChaCha20(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamWriter{S: stream, W: dst}, nil
+}
+
+// ChaCha20ReadSeeker decrypts a ChaCha20-encrypted source with random access: seeking moves both
+// the source and the key stream.
+type ChaCha20ReadSeeker struct {
+	src    io.ReadSeeker
+	base   int64 // position of src at the start of the encrypted data
+	stream *ChaCha20
+}
+
+// NewChaCha20ReadSeeker returns a ChaCha20ReadSeeker decrypting src, whose current position is
+// the start of the encrypted data. Offsets are relative to this position.
+func NewChaCha20ReadSeeker(src io.ReadSeeker, key, nonce []byte) (*ChaCha20ReadSeeker, error) {
+	stream, err := NewChaCha20(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	base, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return &ChaCha20ReadSeeker{src: src, base: base, stream: stream}, nil
+}
+
+func (r *ChaCha20ReadSeeker) Read(p []byte) (int, error) {
+	if remaining := chachaMaxOffset - r.stream.Offset(); int64(len(p)) > remaining {
+		if remaining == 0 {
+			return 0, ErrKeyStreamExhausted
+		}
+		p = p[:remaining]
+	}
+	n, err := r.src.Read(p)
+	r.stream.XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+// Seek sets the offset of the next Read, as defined by io.Seeker, on both the source and the key
+// stream.
+func (r *ChaCha20ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.stream.Offset()
+	case io.SeekEnd:
+		end, err := r.src.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		offset += end - r.base
+	default:
+		return 0, fmt.Errorf("cipherio: invalid whence: %d", whence)
+	}
+
+	if err := r.stream.SetOffset(offset); err != nil {
+		// Restore the position of the source, which may have been moved to find its end.
+		r.src.Seek(r.base+r.stream.Offset(), io.SeekStart)
+		return 0, err
+	}
+	if _, err := r.src.Seek(r.base+offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
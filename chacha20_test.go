@@ -0,0 +1,205 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestChaCha20Vector(t *testing.T) {
+	// RFC 8439, section 2.4.2: the block counter starts at 1.
+	key := mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce := mustDecodeHex(t, "000000000000004a00000000")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	expected := mustDecodeHex(t, "6e2e359a2568f98041ba0728dd0d6981e97e7aec1d4360c20a27afccfd9fae0bf91b65c5524733ab8f593dabcd62b3571639d624e65152ab8f530c359f0861d807ca0dbf500d6a6156a38e088a22b65e52bc514d16ccf806818ce91ab77937365af90bbf74a35be6b40b8eedf2785e42874d")
+
+	stream, err := cipherio.NewChaCha20(key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.SetOffset(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make([]byte, len(plaintext))
+	stream.XORKeyStream(result[:10], plaintext[:10])
+	stream.XORKeyStream(result[10:], plaintext[10:])
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected ciphertext: %x != %x", result, expected)
+	}
+}
+
+func TestXChaCha20(t *testing.T) {
+	// Generate a random key and nonce
+	key := make([]byte, cipherio.ChaCha20KeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, cipherio.XChaCha20NonceSize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 300)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encrypted bytes.Buffer
+	writer, err := cipherio.NewChaCha20Writer(&encrypted, key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(encrypted.Bytes(), plaintext) {
+		t.Fatal("data has not been encrypted")
+	}
+
+	// Changing the first half of the nonce must change the subkey.
+	otherNonce := append([]byte(nil), nonce...)
+	otherNonce[0] ^= 1
+	other, err := cipherio.NewChaCha20(key, otherNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherResult := make([]byte, len(plaintext))
+	other.XORKeyStream(otherResult, plaintext)
+	if bytes.Equal(otherResult, encrypted.Bytes()) {
+		t.Fatal("the subkey does not depend on the nonce")
+	}
+
+	reader, err := cipherio.NewChaCha20ReadSeeker(bytes.NewReader(encrypted.Bytes()), key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatal("decrypted data does not match plaintext")
+	}
+}
+
+func TestChaCha20ReadSeeker(t *testing.T) {
+	// Generate a random key and nonce
+	key := make([]byte, cipherio.ChaCha20KeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, cipherio.ChaCha20NonceSize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 1000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Prefix the encrypted data, to check that offsets are relative to its start.
+	encrypted := []byte("prefix")
+	stream, err := cipherio.NewChaCha20(key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, len(plaintext))
+	stream.XORKeyStream(body, plaintext)
+	encrypted = append(encrypted, body...)
+
+	src := bytes.NewReader(encrypted)
+	_, err = src.Seek(6, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := cipherio.NewChaCha20ReadSeeker(src, key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seeks := []struct {
+		offset   int64
+		whence   int
+		expected int64
+	}{
+		{100, io.SeekStart, 100},
+		{-50, io.SeekCurrent, 90},
+		{0, io.SeekStart, 0},
+		{-64, io.SeekEnd, 936},
+		{63, io.SeekStart, 63},
+		{-1, io.SeekEnd, 999},
+	}
+	for _, seek := range seeks {
+		position, err := reader.Seek(seek.offset, seek.whence)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if position != seek.expected {
+			t.Fatalf("unexpected position: %d != %d", position, seek.expected)
+		}
+		part := make([]byte, 40)
+		n, err := io.ReadFull(reader, part)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(part[:n], plaintext[position:position+int64(n)]) {
+			t.Fatalf("unexpected data at offset %d", position)
+		}
+	}
+
+	_, err = reader.Seek(-1, io.SeekStart)
+	if err == nil {
+		t.Fatal("expected an error for a negative offset")
+	}
+	_, err = reader.Seek(1<<40, io.SeekStart)
+	if err != cipherio.ErrKeyStreamExhausted {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrKeyStreamExhausted)
+	}
+}
+
+func TestChaCha20Invalid(t *testing.T) {
+	_, err := cipherio.NewChaCha20(make([]byte, 16), make([]byte, cipherio.ChaCha20NonceSize))
+	if !errors.Is(err, cipherio.ErrInvalidKeySize) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidKeySize)
+	}
+	_, err = cipherio.NewChaCha20(make([]byte, cipherio.ChaCha20KeySize), make([]byte, 8))
+	if !errors.Is(err, cipherio.ErrInvalidIV) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidIV)
+	}
+}
+
+func TestHChaCha20Vector(t *testing.T) {
+	// draft-irtf-cfrg-xchacha, section 2.2.1
+	key := mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce := mustDecodeHex(t, "000000090000004a0000000031415927")
+	expected := mustDecodeHex(t, "82413b4227b27bfed30e42508a877d73a0f9e4d58a74a853c12ec41326d3ecdc")
+
+	subKey := cipherio.HChaCha20(key, nonce)
+	if !bytes.Equal(subKey, expected) {
+		t.Fatalf("unexpected subkey: %x != %x", subKey, expected)
+	}
+}
@@ -0,0 +1,322 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxChunkSize is the default value of ChunkedOptions.MaxChunkSize.
+const DefaultMaxChunkSize = 16 << 20
+
+// ChunkedOptions configures ChunkedWriter and ChunkedReader. The zero value is valid.
+type ChunkedOptions struct {
+	// ChunkSize is the number of plaintext bytes per chunk. If zero, each call to Write produces
+	// its own chunk, so that chunks follow the writes of the application, like HTTP chunks.
+	ChunkSize int
+
+	// Boundary, if not nil, ends chunks at content-defined cut points in addition to the above.
+	Boundary ChunkBoundaryFunc
+
+	// MaxChunkSize is the largest number of plaintext bytes per chunk. A ChunkedWriter splits
+	// larger writes, and a ChunkedReader rejects larger chunks before allocating them, which bounds
+	// the memory a peer can make it allocate. Defaults to DefaultMaxChunkSize.
+	MaxChunkSize int
+}
+
+// maxChunkSize returns the effective MaxChunkSize.
+func (o ChunkedOptions) maxChunkSize() (int, error) {
+	if o.MaxChunkSize == 0 {
+		return DefaultMaxChunkSize, nil
+	}
+	if o.MaxChunkSize < 0 || uint64(o.MaxChunkSize) > 1<<32-1 {
+		return 0, fmt.Errorf("cipherio: invalid maximum chunk size: %d", o.MaxChunkSize)
+	}
+	return o.MaxChunkSize, nil
+}
+
+// ChunkBoundaryFunc finds content-defined chunk boundaries, for example with a rolling hash. Since
+// cut points then only depend on the surrounding content, they stay in place when data is inserted
+// or removed elsewhere, so that unchanged chunks can be matched across versions of a stream, as
+// deduplicating storage backends do with convergent per-chunk keys.
+//
+// The function is called with the plaintext following the data already scanned, in order. It
+// returns the number of leading bytes of p which complete the current chunk, or 0 if p contains no
+// cut point. Bytes following a cut point are passed again by the next call. Chunks may still be
+// ended independently of the function, for example when reaching the maximum chunk size.
+type ChunkBoundaryFunc func(p []byte) int
+
+// nextCut returns the number of leading bytes of p belonging to the current chunk, and whether
+// they complete it according to the given function, which may be nil.
+func nextCut(boundary ChunkBoundaryFunc, p []byte) (int, bool) {
+	if boundary != nil {
+		if n := boundary(p); n > 0 && n <= len(p) {
+			return n, true
+		}
+	}
+	return len(p), false
+}
+
+// chunkHeaderSize is the size of the plaintext length preceding each chunk.
+const chunkHeaderSize = 4
+
+// ChunkedWriter encrypts a stream as a sequence of independent chunks, each one with its own IV
+// derived from a base nonce and the chunk counter. A peer can thus decrypt each chunk as soon as
+// it arrives, without waiting for the end of the stream, which suits streaming proxies.
+//
+// Each chunk is written with a single call to the wrapped Writer, made of the plaintext length as
+// a big-endian uint32, followed by the CBC ciphertext, zero-padded to the block size. The IV of
+// chunk i is the encryption of the base nonce XORed with i. Close writes an empty chunk, which
+// marks the end of the stream.
+//
+// If the wrapped Writer has a Flush method, like http.ResponseWriter, it is called after each
+// chunk.
+type ChunkedWriter struct {
+	dst      io.Writer
+	block    cipher.Block
+	nonce    []byte
+	size     int
+	boundary ChunkBoundaryFunc
+	max      int
+	buf      []byte // plaintext of the pending chunk, if ChunkSize is set
+	counter  uint64
+	err      error
+}
+
+// NewChunkedWriter returns a ChunkedWriter encrypting chunks with the given block cipher. The base
+// nonce must be as long as a block, and must never be reused with the same key.
+func NewChunkedWriter(dst io.Writer, block cipher.Block, baseNonce []byte, opts ChunkedOptions) (*ChunkedWriter, error) {
+	if err := checkPolicy("chunked stream", true, false); err != nil {
+		return nil, err
+	}
+	if err := checkIV(baseNonce, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	maxSize, err := opts.maxChunkSize()
+	if err != nil {
+		return nil, err
+	}
+	if opts.ChunkSize < 0 || opts.ChunkSize > maxSize {
+		return nil, fmt.Errorf("cipherio: invalid chunk size: %d", opts.ChunkSize)
+	}
+	return &ChunkedWriter{
+		dst:      dst,
+		block:    block,
+		nonce:    append([]byte(nil), baseNonce...),
+		size:     opts.ChunkSize,
+		boundary: opts.Boundary,
+		max:      maxSize,
+	}, nil
+}
+
+func (w *ChunkedWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if w.size == 0 {
+		count := 0
+		for len(p) > 0 {
+			available := p
+			if len(available) > w.max {
+				available = available[:w.max]
+			}
+			n, _ := nextCut(w.boundary, available)
+			if w.err = w.writeChunk(p[:n]); w.err != nil {
+				return count, w.err
+			}
+			p = p[n:]
+			count += n
+		}
+		return count, nil
+	}
+
+	if w.buf == nil {
+		w.buf = make([]byte, 0, w.size)
+	}
+
+	count := 0
+	for len(p) > 0 {
+		available := p
+		if len(available) > w.size-len(w.buf) {
+			available = available[:w.size-len(w.buf)]
+		}
+		n, cut := nextCut(w.boundary, available)
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		count += n
+
+		if cut || len(w.buf) == w.size {
+			if w.err = w.writeChunk(w.buf); w.err != nil {
+				return count, w.err
+			}
+			w.buf = w.buf[:0]
+		}
+	}
+	return count, nil
+}
+
+// Flush writes any pending plaintext as a shorter chunk. This is only useful with ChunkSize.
+func (w *ChunkedWriter) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf) > 0 {
+		if w.err = w.writeChunk(w.buf); w.err != nil {
+			return w.err
+		}
+		w.buf = w.buf[:0]
+	}
+	return nil
+}
+
+// Close flushes any pending plaintext, then writes the empty chunk marking the end of the stream.
+// The wrapped Writer is not closed.
+func (w *ChunkedWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.err = w.writeChunk(nil)
+	if w.err == nil {
+		w.err = errors.New("cipherio: write to closed ChunkedWriter")
+		return nil
+	}
+	return w.err
+}
+
+// writeChunk encrypts and writes the given plaintext as a single chunk.
+func (w *ChunkedWriter) writeChunk(p []byte) error {
+	if uint64(len(p)) > 1<<32-1 {
+		return fmt.Errorf("cipherio: chunk is too large: %d", len(p))
+	}
+
+	blockSize := w.block.BlockSize()
+	padded := (len(p) + blockSize - 1) / blockSize * blockSize
+	chunk := make([]byte, chunkHeaderSize+padded)
+	binary.BigEndian.PutUint32(chunk, uint32(len(p)))
+	copy(chunk[chunkHeaderSize:], p)
+
+	body := chunk[chunkHeaderSize:]
+	cipher.NewCBCEncrypter(w.block, chunkIV(w.block, w.nonce, w.counter)).CryptBlocks(body, body)
+	w.counter++
+
+	if _, err := w.dst.Write(chunk); err != nil {
+		return err
+	}
+	switch flusher := w.dst.(type) {
+	case interface{ Flush() error }:
+		return flusher.Flush()
+	case interface{ Flush() }:
+		flusher.Flush()
+	}
+	return nil
+}
+
+// chunkIV returns the IV of the given chunk: the encryption of the base nonce XORed with the
+// counter, so that IVs are unpredictable as CBC requires.
+func chunkIV(block cipher.Block, nonce []byte, counter uint64) []byte {
+	iv := append([]byte(nil), nonce...)
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], counter)
+	for i, b := range encoded {
+		iv[len(iv)-len(encoded)+i] ^= b
+	}
+	block.Encrypt(iv, iv)
+	return iv
+}
+
+// ChunkedReader decrypts a stream written by a ChunkedWriter. Each chunk is decrypted as soon as
+// it has been entirely received.
+type ChunkedReader struct {
+	src     io.Reader
+	block   cipher.Block
+	nonce   []byte
+	counter uint64
+	max     int
+	chunk   []byte // remaining plaintext of the current chunk
+	err     error
+}
+
+// NewChunkedReader returns a ChunkedReader decrypting src with the given block cipher and base
+// nonce, which must match those of the ChunkedWriter. Chunks larger than DefaultMaxChunkSize are
+// rejected.
+func NewChunkedReader(src io.Reader, block cipher.Block, baseNonce []byte) (*ChunkedReader, error) {
+	return NewChunkedReaderWithOptions(src, block, baseNonce, ChunkedOptions{})
+}
+
+// NewChunkedReaderWithOptions is similar to NewChunkedReader, except that chunks are limited to
+// the MaxChunkSize of the given options. Other options only apply to ChunkedWriter.
+func NewChunkedReaderWithOptions(src io.Reader, block cipher.Block, baseNonce []byte, opts ChunkedOptions) (*ChunkedReader, error) {
+	if err := checkPolicy("chunked stream", true, false); err != nil {
+		return nil, err
+	}
+	if err := checkIV(baseNonce, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	maxSize, err := opts.maxChunkSize()
+	if err != nil {
+		return nil, err
+	}
+	return &ChunkedReader{
+		src:   src,
+		block: block,
+		nonce: append([]byte(nil), baseNonce...),
+		max:   maxSize,
+	}, nil
+}
+
+func (r *ChunkedReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.chunk, r.err = r.ReadChunk()
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// ReadChunk reads and decrypts the next chunk, and returns its plaintext. It returns io.EOF once
+// the end of the stream has been reached, or io.ErrUnexpectedEOF if the stream is truncated.
+//
+// ReadChunk must not be mixed with Read.
+func (r *ChunkedReader) ReadChunk() ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var header [chunkHeaderSize]byte
+	if _, err := io.ReadFull(r.src, header[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = err
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length == 0 {
+		r.err = io.EOF
+		return nil, io.EOF
+	}
+	if uint64(length) > uint64(r.max) {
+		r.err = fmt.Errorf("cipherio: chunk is too large: %d > %d", length, r.max)
+		return nil, r.err
+	}
+
+	blockSize := r.block.BlockSize()
+	body := make([]byte, (int(length)+blockSize-1)/blockSize*blockSize)
+	if _, err := io.ReadFull(r.src, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = err
+		return nil, err
+	}
+
+	cipher.NewCBCDecrypter(r.block, chunkIV(r.block, r.nonce, r.counter)).CryptBlocks(body, body)
+	r.counter++
+	return body[:length], nil
+}
@@ -0,0 +1,348 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// flushRecorder records the chunks written between flushes, like an HTTP response would.
+type flushRecorder struct {
+	bytes.Buffer
+	chunks []int
+}
+
+func (f *flushRecorder) Flush() {
+	f.chunks = append(f.chunks, f.Len())
+}
+
+func TestChunked(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 1000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name      string
+		chunkSize int
+		writes    []int
+		chunks    []int
+	}{
+		{"PerWrite", 0, []int{1, 16, 0, 300, 683}, []int{1, 16, 300, 683}},
+		{"FixedSize", 256, []int{1, 16, 300, 683}, []int{256, 256, 256, 232}},
+		{"Aligned", 500, []int{1000}, []int{500, 500}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			var dst flushRecorder
+			writer, err := cipherio.NewChunkedWriter(&dst, aesCipher, nonce, cipherio.ChunkedOptions{ChunkSize: testCase.chunkSize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			offset := 0
+			for _, size := range testCase.writes {
+				n, err := writer.Write(plaintext[offset : offset+size])
+				if err != nil {
+					t.Fatalf("unexpected err: %v != %v", err, nil)
+				}
+				if n != size {
+					t.Fatalf("unexpected write length: %d != %d", n, size)
+				}
+				offset += size
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dst.chunks) != len(testCase.chunks)+1 {
+				t.Fatalf("unexpected number of flushes: %d != %d", len(dst.chunks), len(testCase.chunks)+1)
+			}
+
+			// Each chunk must be decrypted as soon as it is available.
+			reader, err := cipherio.NewChunkedReader(bytes.NewReader(dst.Bytes()), aesCipher, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result []byte
+			for _, size := range testCase.chunks {
+				chunk, err := reader.ReadChunk()
+				if err != nil {
+					t.Fatalf("unexpected err: %v != %v", err, nil)
+				}
+				if len(chunk) != size {
+					t.Fatalf("unexpected chunk length: %d != %d", len(chunk), size)
+				}
+				result = append(result, chunk...)
+			}
+			_, err = reader.ReadChunk()
+			if err != io.EOF {
+				t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatal("decrypted chunks do not match plaintext")
+			}
+
+			reader, err = cipherio.NewChunkedReader(bytes.NewReader(dst.Bytes()), aesCipher, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err = ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatal("decrypted stream does not match plaintext")
+			}
+		})
+	}
+}
+
+func TestChunkedReaderTruncated(t *testing.T) {
+	aesCipher, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aesCipher.BlockSize())
+
+	var dst bytes.Buffer
+	writer, err := cipherio.NewChunkedWriter(&dst, aesCipher, nonce, cipherio.ChunkedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write([]byte("hello, world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without Close, the terminating chunk is missing.
+	reader, err := cipherio.NewChunkedReader(bytes.NewReader(dst.Bytes()), aesCipher, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ioutil.ReadAll(reader)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected err: %v != %v", err, io.ErrUnexpectedEOF)
+	}
+	if string(result) != "hello, world" {
+		t.Fatalf("unexpected result: %q", result)
+	}
+
+	// A partial chunk is never returned.
+	reader, err = cipherio.NewChunkedReader(bytes.NewReader(dst.Bytes()[:dst.Len()-1]), aesCipher, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reader.ReadChunk()
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected err: %v != %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestChunkedMaxChunkSize(t *testing.T) {
+	aesCipher, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aesCipher.BlockSize())
+	opts := cipherio.ChunkedOptions{MaxChunkSize: 100}
+
+	// A large write is split into chunks of at most MaxChunkSize bytes.
+	plaintext := make([]byte, 250)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dst bytes.Buffer
+	writer, err := cipherio.NewChunkedWriter(&dst, aesCipher, nonce, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := cipherio.NewChunkedReaderWithOptions(bytes.NewReader(dst.Bytes()), aesCipher, nonce, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for {
+		chunk, err := reader.ReadChunk()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		sizes = append(sizes, len(chunk))
+	}
+	if len(sizes) != 3 || sizes[0] != 100 || sizes[1] != 100 || sizes[2] != 50 {
+		t.Fatalf("unexpected chunk sizes: %v != %v", sizes, []int{100, 100, 50})
+	}
+
+	// A forged length is rejected before allocating the chunk.
+	forged := []byte{0xff, 0xff, 0xff, 0xff}
+	reader, err = cipherio.NewChunkedReader(bytes.NewReader(forged), aesCipher, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reader.ReadChunk()
+	expectedErr := fmt.Sprintf("cipherio: chunk is too large: %d > %d", uint32(1<<32-1), cipherio.DefaultMaxChunkSize)
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+	}
+
+	// Chunks cannot exceed the limit.
+	_, err = cipherio.NewChunkedWriter(ioutil.Discard, aesCipher, nonce, cipherio.ChunkedOptions{ChunkSize: 200, MaxChunkSize: 100})
+	if err == nil {
+		t.Fatal("expected an error for a chunk size above the limit")
+	}
+	_, err = cipherio.NewChunkedReaderWithOptions(bytes.NewReader(nil), aesCipher, nonce, cipherio.ChunkedOptions{MaxChunkSize: -1})
+	if err == nil {
+		t.Fatal("expected an error for a negative limit")
+	}
+}
+
+func TestChunkedWrongNonce(t *testing.T) {
+	aesCipher, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cipherio.NewChunkedWriter(ioutil.Discard, aesCipher, make([]byte, 8), cipherio.ChunkedOptions{})
+	if err == nil {
+		t.Fatal("expected an error for a short nonce")
+	}
+	_, err = cipherio.NewChunkedReader(bytes.NewReader(nil), aesCipher, make([]byte, 8))
+	if err == nil {
+		t.Fatal("expected an error for a short nonce")
+	}
+}
+
+// cutAfterZero is a ChunkBoundaryFunc ending chunks after each zero byte, in place of a rolling
+// hash.
+func cutAfterZero(p []byte) int {
+	return bytes.IndexByte(p, 0) + 1
+}
+
+// plaintextWithZeros returns random bytes which are only zero at the given offsets.
+func plaintextWithZeros(t *testing.T, size int, zeros ...int) []byte {
+	plaintext := make([]byte, size)
+	_, err := rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range plaintext {
+		plaintext[i] |= 1
+	}
+	for _, offset := range zeros {
+		plaintext[offset] = 0
+	}
+	return plaintext
+}
+
+func TestChunkedBoundary(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aesCipher.BlockSize())
+
+	plaintext := plaintextWithZeros(t, 1000, 99, 100, 599)
+
+	testCases := []struct {
+		name      string
+		chunkSize int
+		writes    []int
+		chunks    []int
+	}{
+		{"PerWrite", 0, []int{50, 300, 650}, []int{50, 50, 1, 249, 250, 400}},
+		{"FixedSize", 256, []int{50, 300, 650}, []int{100, 1, 256, 243, 256, 144}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			var dst bytes.Buffer
+			opts := cipherio.ChunkedOptions{ChunkSize: testCase.chunkSize, Boundary: cutAfterZero}
+			writer, err := cipherio.NewChunkedWriter(&dst, aesCipher, nonce, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offset := 0
+			for _, size := range testCase.writes {
+				_, err := writer.Write(plaintext[offset : offset+size])
+				if err != nil {
+					t.Fatalf("unexpected err: %v != %v", err, nil)
+				}
+				offset += size
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := cipherio.NewChunkedReader(&dst, aesCipher, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result []byte
+			for _, size := range testCase.chunks {
+				chunk, err := reader.ReadChunk()
+				if err != nil {
+					t.Fatalf("unexpected err: %v != %v", err, nil)
+				}
+				if len(chunk) != size {
+					t.Fatalf("unexpected chunk length: %d != %d", len(chunk), size)
+				}
+				result = append(result, chunk...)
+			}
+			_, err = reader.ReadChunk()
+			if err != io.EOF {
+				t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatal("decrypted chunks do not match plaintext")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// ChunkKeys derives an independent key and IV for each chunk from a master secret, with HKDF and
+// the chunk index as a counter. Its factories can be used with CopyParallel and EncryptFile.
+//
+// Since HKDF is one-way, the compromise of a chunk key does not expose the master secret nor any
+// other chunk. Since each chunk only depends on its index, chunks can be decrypted independently,
+// for example to serve random accesses.
+type ChunkKeys struct {
+	// Master is the secret from which all chunk keys are derived.
+	Master []byte
+
+	// Salt is an optional random value, typically stored alongside the stream.
+	Salt []byte
+
+	// NewCipher creates the block cipher of each chunk from its derived key. Defaults to
+	// aes.NewCipher.
+	NewCipher func(key []byte) (cipher.Block, error)
+
+	// KeySize is the length of the key derived for each chunk. Defaults to 32.
+	KeySize int
+}
+
+// Encrypter returns a factory of CBC encrypters, one per chunk.
+func (k *ChunkKeys) Encrypter() BlockModeFactory {
+	return func(chunkIndex int64) (cipher.BlockMode, error) {
+		block, iv, err := k.chunkBlock(chunkIndex)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewCBCEncrypter(block, iv), nil
+	}
+}
+
+// Decrypter returns a factory of CBC decrypters, one per chunk.
+func (k *ChunkKeys) Decrypter() BlockModeFactory {
+	return func(chunkIndex int64) (cipher.BlockMode, error) {
+		block, iv, err := k.chunkBlock(chunkIndex)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewCBCDecrypter(block, iv), nil
+	}
+}
+
+// chunkBlock derives the key and IV of the given chunk, then returns the corresponding cipher and
+// IV.
+func (k *ChunkKeys) chunkBlock(chunkIndex int64) (cipher.Block, []byte, error) {
+	newCipher := k.NewCipher
+	if newCipher == nil {
+		newCipher = newAESCipher
+	}
+	keySize := k.KeySize
+	if keySize <= 0 {
+		keySize = 32
+	}
+
+	block, err := newCipher(hkdf(k.Master, k.Salt, chunkInfo("key", chunkIndex), keySize))
+	if err != nil {
+		return nil, nil, err
+	}
+	iv := hkdf(k.Master, k.Salt, chunkInfo("iv", chunkIndex), block.BlockSize())
+	return block, iv, nil
+}
+
+// chunkInfo returns the HKDF info used to derive the given kind of chunk secret.
+func chunkInfo(kind string, chunkIndex int64) []byte {
+	info := []byte("cipherio chunk " + kind + " ")
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(chunkIndex))
+	return append(info, counter[:]...)
+}
@@ -0,0 +1,88 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestChunkKeys(t *testing.T) {
+	master := make([]byte, 32)
+	_, err := rand.Read(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &cipherio.ChunkKeys{Master: master, Salt: []byte("salt")}
+
+	const chunkSize = 64
+
+	plaintext := make([]byte, 10*chunkSize)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ciphertext bytes.Buffer
+	_, err = cipherio.CopyParallel(context.Background(), &ciphertext, bytes.NewReader(plaintext), keys.Encrypter(), cipherio.ParallelOptions{
+		ChunkSize: chunkSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Identical plaintext chunks must not lead to identical ciphertext chunks.
+	encrypter, err := keys.Encrypter()(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := keys.Encrypter()(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := make([]byte, chunkSize)
+	second := make([]byte, chunkSize)
+	encrypter.CryptBlocks(first, plaintext[:chunkSize])
+	other.CryptBlocks(second, plaintext[:chunkSize])
+	if bytes.Equal(first, second) {
+		t.Fatalf("chunks share the same key and IV")
+	}
+
+	t.Run("Sequential", func(t *testing.T) {
+		var result bytes.Buffer
+		_, err := cipherio.CopyParallel(context.Background(), &result, bytes.NewReader(ciphertext.Bytes()), keys.Decrypter(), cipherio.ParallelOptions{
+			ChunkSize: chunkSize,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result.Bytes(), plaintext) {
+			t.Fatalf("unexpected decrypted bytes")
+		}
+	})
+
+	t.Run("RandomAccess", func(t *testing.T) {
+		// Each chunk can be decrypted on its own.
+		for _, index := range []int64{7, 2, 9, 0} {
+			decrypter, err := keys.Decrypter()(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunk := make([]byte, chunkSize)
+			decrypter.CryptBlocks(chunk, ciphertext.Bytes()[index*chunkSize:(index+1)*chunkSize])
+			if !bytes.Equal(chunk, plaintext[index*chunkSize:(index+1)*chunkSize]) {
+				t.Fatalf("unexpected decrypted chunk %d", index)
+			}
+		}
+	})
+
+	t.Run("InvalidKeySize", func(t *testing.T) {
+		invalid := &cipherio.ChunkKeys{Master: master, KeySize: 20}
+		_, err := invalid.Encrypter()(0)
+		if err == nil {
+			t.Fatal("invalid key size accepted")
+		}
+	})
+}
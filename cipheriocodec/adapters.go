@@ -0,0 +1,110 @@
+package cipheriocodec
+
+// Codec has the same method set as the Codec interface of google.golang.org/grpc/encoding, so that
+// implementations can be used interchangeably without depending on gRPC.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	Name() string
+}
+
+// GRPCCodec wraps a Codec to encrypt each marshaled message with a Sealer. It implements the Codec
+// interface of google.golang.org/grpc/encoding.
+type GRPCCodec struct {
+	codec  Codec
+	sealer *Sealer
+}
+
+// NewGRPCCodec returns a GRPCCodec marshaling messages with the given Codec, then sealing them with
+// the given Sealer.
+//
+// Its name is the one of the wrapped Codec, so that it can replace it, for example with
+// grpc.ForceCodec on both ends.
+func NewGRPCCodec(codec Codec, sealer *Sealer) *GRPCCodec {
+	return &GRPCCodec{
+		codec:  codec,
+		sealer: sealer,
+	}
+}
+
+// Marshal marshals v with the wrapped Codec, then seals the result.
+func (c *GRPCCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.sealer.Seal(data)
+}
+
+// Unmarshal opens data, then unmarshals the result into v with the wrapped Codec.
+func (c *GRPCCodec) Unmarshal(data []byte, v interface{}) error {
+	payload, err := c.sealer.Open(data)
+	if err != nil {
+		return err
+	}
+	return c.codec.Unmarshal(payload, v)
+}
+
+// Name returns the name of the wrapped Codec.
+func (c *GRPCCodec) Name() string {
+	return c.codec.Name()
+}
+
+// Serializer converts Kafka message values to bytes, like the Serializer interfaces of common Kafka
+// clients.
+type Serializer interface {
+	Serialize(topic string, msg interface{}) ([]byte, error)
+}
+
+// Deserializer converts bytes back to Kafka message values.
+type Deserializer interface {
+	Deserialize(topic string, data []byte) (interface{}, error)
+}
+
+// KafkaSerializer wraps a Serializer to seal each serialized value.
+type KafkaSerializer struct {
+	serializer Serializer
+	sealer     *Sealer
+}
+
+// NewKafkaSerializer returns a KafkaSerializer serializing values with the given Serializer, then
+// sealing them with the given Sealer.
+func NewKafkaSerializer(serializer Serializer, sealer *Sealer) *KafkaSerializer {
+	return &KafkaSerializer{
+		serializer: serializer,
+		sealer:     sealer,
+	}
+}
+
+// Serialize implements Serializer.
+func (s *KafkaSerializer) Serialize(topic string, msg interface{}) ([]byte, error) {
+	data, err := s.serializer.Serialize(topic, msg)
+	if err != nil {
+		return nil, err
+	}
+	return s.sealer.Seal(data)
+}
+
+// KafkaDeserializer wraps a Deserializer to open each value before deserializing it.
+type KafkaDeserializer struct {
+	deserializer Deserializer
+	sealer       *Sealer
+}
+
+// NewKafkaDeserializer returns a KafkaDeserializer opening values with the given Sealer, then
+// deserializing them with the given Deserializer.
+func NewKafkaDeserializer(deserializer Deserializer, sealer *Sealer) *KafkaDeserializer {
+	return &KafkaDeserializer{
+		deserializer: deserializer,
+		sealer:       sealer,
+	}
+}
+
+// Deserialize implements Deserializer.
+func (d *KafkaDeserializer) Deserialize(topic string, data []byte) (interface{}, error) {
+	payload, err := d.sealer.Open(data)
+	if err != nil {
+		return nil, err
+	}
+	return d.deserializer.Deserialize(topic, payload)
+}
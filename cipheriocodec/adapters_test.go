@@ -0,0 +1,95 @@
+package cipheriocodec_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/connesc/cipherio/cipheriocodec"
+)
+
+// stringCodec marshals strings as their bytes.
+type stringCodec struct{}
+
+func (stringCodec) Marshal(v interface{}) ([]byte, error) {
+	s, ok := v.(*string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type: %T", v)
+	}
+	return []byte(*s), nil
+}
+
+func (stringCodec) Unmarshal(data []byte, v interface{}) error {
+	s, ok := v.(*string)
+	if !ok {
+		return fmt.Errorf("unsupported type: %T", v)
+	}
+	*s = string(data)
+	return nil
+}
+
+func (stringCodec) Name() string {
+	return "string"
+}
+
+func (stringCodec) Serialize(topic string, msg interface{}) ([]byte, error) {
+	return []byte(topic + ":" + msg.(string)), nil
+}
+
+func (stringCodec) Deserialize(topic string, data []byte) (interface{}, error) {
+	return string(bytes.TrimPrefix(data, []byte(topic+":"))), nil
+}
+
+func TestGRPCCodec(t *testing.T) {
+	sealer, err := cipheriocodec.NewSealer(make([]byte, 32), cipheriocodec.SealerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := cipheriocodec.NewGRPCCodec(stringCodec{}, sealer)
+
+	if codec.Name() != "string" {
+		t.Fatalf("unexpected name: %q != %q", codec.Name(), "string")
+	}
+
+	msg := "hello"
+	data, err := codec.Marshal(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(msg)) {
+		t.Fatal("message is not encrypted")
+	}
+
+	var decoded string
+	if err := codec.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != msg {
+		t.Fatalf("unexpected message: %q != %q", decoded, msg)
+	}
+
+	if err := codec.Unmarshal(data[:10], &decoded); err != cipheriocodec.ErrInvalidMessage {
+		t.Fatalf("unexpected err: %v != %v", err, cipheriocodec.ErrInvalidMessage)
+	}
+}
+
+func TestKafkaSerializer(t *testing.T) {
+	sealer, err := cipheriocodec.NewSealer(make([]byte, 32), cipheriocodec.SealerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serializer := cipheriocodec.NewKafkaSerializer(stringCodec{}, sealer)
+	deserializer := cipheriocodec.NewKafkaDeserializer(stringCodec{}, sealer)
+
+	data, err := serializer.Serialize("events", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := deserializer.Deserialize("events", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "hello" {
+		t.Fatalf("unexpected message: %v != %q", msg, "hello")
+	}
+}
@@ -0,0 +1,115 @@
+// Package cipheriocodec adapts the one-shot helpers of cipherio to message-oriented transports,
+// such as gRPC codecs and Kafka serializers.
+//
+// Each message is encrypted independently with AES-CBC and PKCS#7 padding, under its own random
+// IV, and framed as a version byte, followed by the IV, followed by the ciphertext.
+//
+// Messages are not authenticated: the transport is expected to ensure their integrity, for example
+// with TLS.
+package cipheriocodec
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/connesc/cipherio"
+)
+
+// messageVersion is the first byte of each sealed message.
+const messageVersion = 1
+
+// ErrInvalidMessage is returned when a message cannot be opened.
+var ErrInvalidMessage = errors.New("cipheriocodec: invalid message")
+
+// SealerOptions configures a Sealer. The zero value is valid.
+type SealerOptions struct {
+	// Rand is the source of the IVs. Defaults to crypto/rand.Reader.
+	Rand io.Reader
+}
+
+// Sealer encrypts and decrypts individual messages with a fixed key. It is safe for concurrent
+// use, as long as its random source is.
+type Sealer struct {
+	key  []byte
+	rand io.Reader
+}
+
+// NewSealer returns a Sealer using the given AES key. An error wrapping cipherio.ErrInvalidKeySize
+// is returned if the key is not 16, 24 or 32 bytes long.
+func NewSealer(key []byte, opts SealerOptions) (*Sealer, error) {
+	s := &Sealer{
+		key:  append([]byte(nil), key...),
+		rand: opts.Rand,
+	}
+	if s.rand == nil {
+		s.rand = rand.Reader
+	}
+
+	// Validate the key once, rather than for each message.
+	if _, err := s.header(make([]byte, aes.BlockSize)).NewEncrypter(s.key); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// header returns the stream header describing a message with the given IV.
+func (s *Sealer) header(iv []byte) *cipherio.StreamHeader {
+	return &cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           iv,
+		PlaintextLen: -1,
+	}
+}
+
+// Seal encrypts the given payload under a new random IV, and returns the framed message.
+func (s *Sealer) Seal(payload []byte) ([]byte, error) {
+	message := make([]byte, 1+aes.BlockSize, 1+aes.BlockSize+len(payload)+aes.BlockSize)
+	message[0] = messageVersion
+	iv := message[1:]
+	if _, err := io.ReadFull(s.rand, iv); err != nil {
+		return nil, err
+	}
+
+	blockMode, err := s.header(iv).NewEncrypter(s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unlike the Readers and Writers of cipherio, always add padding, so that it can be removed
+	// unambiguously. Then encrypt in place.
+	padded := append(message, payload...)
+	padding := aes.BlockSize - len(payload)%aes.BlockSize
+	padded = padded[:len(padded)+padding]
+	cipherio.PKCS7Padding.Fill(padded[len(padded)-padding:])
+	plaintext := padded[1+aes.BlockSize:]
+	return cipherio.EncryptBytes(padded[:1+aes.BlockSize], plaintext, blockMode, nil)
+}
+
+// Open decrypts a message returned by Seal, and returns its payload. ErrInvalidMessage is returned
+// if the message is malformed, or if its padding is invalid.
+func (s *Sealer) Open(message []byte) ([]byte, error) {
+	if len(message) < 1+2*aes.BlockSize || (len(message)-1)%aes.BlockSize != 0 || message[0] != messageVersion {
+		return nil, ErrInvalidMessage
+	}
+	iv := message[1 : 1+aes.BlockSize]
+	ciphertext := message[1+aes.BlockSize:]
+
+	blockMode, err := s.header(iv).NewDecrypter(s.key)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := cipherio.DecryptBytes(nil, ciphertext, blockMode)
+	if err != nil {
+		return nil, err
+	}
+
+	padding, ok := cipherio.CheckPKCS7Padding(payload[len(payload)-aes.BlockSize:])
+	if !ok {
+		return nil, ErrInvalidMessage
+	}
+	return payload[:len(payload)-padding], nil
+}
@@ -0,0 +1,115 @@
+package cipheriocodec_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/connesc/cipherio"
+	"github.com/connesc/cipherio/cipheriocodec"
+)
+
+func TestSealer(t *testing.T) {
+	sealer, err := cipheriocodec.NewSealer(make([]byte, 32), cipheriocodec.SealerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, 15, 16, 17, 1000} {
+		payload := bytes.Repeat([]byte{0xaa}, size)
+		message, err := sealer.Seal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(message) != 1+16+(size/16+1)*16 {
+			t.Fatalf("unexpected message length for %d bytes: %d", size, len(message))
+		}
+
+		opened, err := sealer.Open(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(opened, payload) {
+			t.Fatalf("unexpected payload for %d bytes", size)
+		}
+	}
+
+	// Each message has its own IV.
+	first, _ := sealer.Seal([]byte("same"))
+	second, _ := sealer.Seal([]byte("same"))
+	if bytes.Equal(first, second) {
+		t.Fatal("messages share the same IV")
+	}
+}
+
+func TestSealerDeterministic(t *testing.T) {
+	newSealer := func() *cipheriocodec.Sealer {
+		sealer, err := cipheriocodec.NewSealer(make([]byte, 16), cipheriocodec.SealerOptions{
+			Rand: bytes.NewReader(bytes.Repeat([]byte{0x42}, 16)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sealer
+	}
+
+	first, err := newSealer().Seal([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newSealer().Seal([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("output is not deterministic")
+	}
+}
+
+func TestSealerErrors(t *testing.T) {
+	_, err := cipheriocodec.NewSealer(make([]byte, 20), cipheriocodec.SealerOptions{})
+	if !errors.Is(err, cipherio.ErrInvalidKeySize) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidKeySize)
+	}
+
+	// Use a fixed IV, so that decrypting with the wrong key deterministically breaks the padding.
+	sealer, err := cipheriocodec.NewSealer(make([]byte, 32), cipheriocodec.SealerOptions{
+		Rand: bytes.NewReader(make([]byte, 16)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := sealer.Seal([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := cipheriocodec.NewSealer(bytes.Repeat([]byte{1}, 32), cipheriocodec.SealerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badVersion := append([]byte(nil), message...)
+	badVersion[0] = 2
+
+	tests := []struct {
+		Name    string
+		Sealer  *cipheriocodec.Sealer
+		Message []byte
+	}{
+		{Name: "Empty", Sealer: sealer, Message: nil},
+		{Name: "Truncated", Sealer: sealer, Message: message[:len(message)-1]},
+		{Name: "NoCiphertext", Sealer: sealer, Message: message[:17]},
+		{Name: "BadVersion", Sealer: sealer, Message: badVersion},
+		{Name: "WrongKey", Sealer: other, Message: message},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := test.Sealer.Open(test.Message)
+			if err != cipheriocodec.ErrInvalidMessage {
+				t.Fatalf("unexpected err: %v != %v", err, cipheriocodec.ErrInvalidMessage)
+			}
+		})
+	}
+}
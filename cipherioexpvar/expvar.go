@@ -0,0 +1,43 @@
+// Package cipherioexpvar publishes the counters of a cipherio.Stats with expvar, for applications
+// which do not run a full metrics stack. They are then served as JSON by the /debug/vars handler,
+// along with the other variables of the process.
+//
+// This is a separate package, since importing expvar registers that handler on
+// http.DefaultServeMux.
+package cipherioexpvar
+
+import (
+	"expvar"
+
+	"github.com/connesc/cipherio"
+)
+
+// Publish publishes the counters of the given Stats as expvar variables named after the given
+// prefix:
+//
+//	<prefix>.encryption_streams
+//	<prefix>.decryption_streams
+//	<prefix>.bytes_encrypted
+//	<prefix>.bytes_decrypted
+//	<prefix>.errors
+//
+// The last one is a map from kinds of errors to counts, as in cipherio.StatsSnapshot. Values are
+// read from the Stats each time the variables are exported.
+//
+// Like expvar.Publish, it panics if any of these names is already taken, so that it is meant to be
+// called once per prefix, typically at initialization.
+func Publish(prefix string, stats *cipherio.Stats) {
+	vars := map[string]func(cipherio.StatsSnapshot) interface{}{
+		"encryption_streams": func(s cipherio.StatsSnapshot) interface{} { return s.EncryptionStreams },
+		"decryption_streams": func(s cipherio.StatsSnapshot) interface{} { return s.DecryptionStreams },
+		"bytes_encrypted":    func(s cipherio.StatsSnapshot) interface{} { return s.BytesEncrypted },
+		"bytes_decrypted":    func(s cipherio.StatsSnapshot) interface{} { return s.BytesDecrypted },
+		"errors":             func(s cipherio.StatsSnapshot) interface{} { return s.Errors },
+	}
+	for name, value := range vars {
+		value := value
+		expvar.Publish(prefix+"."+name, expvar.Func(func() interface{} {
+			return value(stats.Snapshot())
+		}))
+	}
+}
@@ -0,0 +1,67 @@
+package cipherioexpvar_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"expvar"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+	"github.com/connesc/cipherio/cipherioexpvar"
+)
+
+func TestPublish(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	stats := new(cipherio.Stats)
+	cipherioexpvar.Publish("test", stats)
+
+	writer := cipherio.NewBlockWriter(ioutil.Discard, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithWriteStats(stats, cipherio.Encryption))
+	_, err = writer.Write(make([]byte, 100))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err == nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := map[string]string{
+		"test.encryption_streams": "1",
+		"test.decryption_streams": "0",
+		"test.bytes_encrypted":    "96",
+		"test.bytes_decrypted":    "0",
+		"test.errors":             `{"alignment":1}`,
+	}
+	for name, value := range expected {
+		v := expvar.Get(name)
+		if v == nil {
+			t.Fatalf("missing variable: %s", name)
+		}
+		if v.String() != value {
+			t.Fatalf("unexpected value of %s: %s != %s", name, v.String(), value)
+		}
+	}
+
+	// The variables can be exported as JSON, as done by the /debug/vars handler.
+	var decoded map[string]int64
+	err = json.Unmarshal([]byte(expvar.Get("test.errors").String()), &decoded)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+}
@@ -0,0 +1,130 @@
+// Package cipheriootel instruments the Readers and Writers of cipherio with OpenTelemetry: each
+// stream gets its own span, and counters track the streams, the (en|de)crypted bytes and the
+// errors.
+//
+// This is a separate module, so that the core package does not depend on OpenTelemetry.
+package cipheriootel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/connesc/cipherio"
+)
+
+// instrumentationName identifies this package to tracer and meter providers.
+const instrumentationName = "github.com/connesc/cipherio/cipheriootel"
+
+// Options configures an Observer. The zero value is valid.
+type Options struct {
+	// TracerProvider creates the spans of streams. Defaults to the global one.
+	TracerProvider trace.TracerProvider
+
+	// MeterProvider creates the counters. Defaults to the global one.
+	MeterProvider metric.MeterProvider
+}
+
+// Observer is a cipherio.Observer reporting streams with OpenTelemetry. Attach it with
+// cipherio.WithObserver and cipherio.WithWriteObserver: the span of each stream is a child of the
+// span found in the given context, if any.
+//
+// Spans are named "cipherio.encryption" or "cipherio.decryption", and end with the stream. Their
+// status is set to Error if the stream fails, and the error is recorded. The following counters
+// are updated, with a "cipherio.operation" attribute:
+//
+//	cipherio.streams  number of streams opened
+//	cipherio.bytes    number of bytes (en|de)crypted, including any padding
+//	cipherio.errors   number of failed streams, with an "error.type" attribute from ErrorKind
+type Observer struct {
+	tracer  trace.Tracer
+	streams metric.Int64Counter
+	bytes   metric.Int64Counter
+	errors  metric.Int64Counter
+}
+
+// NewObserver returns an Observer with the given providers.
+func NewObserver(opts Options) (*Observer, error) {
+	tracerProvider := opts.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	meterProvider := opts.MeterProvider
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+	meter := meterProvider.Meter(instrumentationName)
+
+	streams, err := meter.Int64Counter("cipherio.streams",
+		metric.WithDescription("Number of streams opened."), metric.WithUnit("{stream}"))
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := meter.Int64Counter("cipherio.bytes",
+		metric.WithDescription("Number of bytes (en|de)crypted, including any padding."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	errors, err := meter.Int64Counter("cipherio.errors",
+		metric.WithDescription("Number of failed streams."), metric.WithUnit("{stream}"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Observer{
+		tracer:  tracerProvider.Tracer(instrumentationName),
+		streams: streams,
+		bytes:   bytes,
+		errors:  errors,
+	}, nil
+}
+
+// ObserveStream starts the span of a new stream and counts it.
+func (o *Observer) ObserveStream(ctx context.Context, op cipherio.Operation) cipherio.StreamObserver {
+	operation := attribute.String("cipherio.operation", op.String())
+	ctx, span := o.tracer.Start(ctx, "cipherio."+op.String(), trace.WithAttributes(operation))
+	o.streams.Add(ctx, 1, metric.WithAttributes(operation))
+	return &stream{
+		observer:  o,
+		ctx:       ctx,
+		span:      span,
+		operation: operation,
+		attrs:     metric.WithAttributeSet(attribute.NewSet(operation)),
+	}
+}
+
+// stream reports a single stream.
+type stream struct {
+	observer  *Observer
+	ctx       context.Context
+	span      trace.Span
+	operation attribute.KeyValue
+	attrs     metric.MeasurementOption // computed once, since Crypted is called often
+	crypted   int64
+}
+
+func (s *stream) Crypted(n int) {
+	s.crypted += int64(n)
+	s.observer.bytes.Add(s.ctx, int64(n), s.attrs)
+}
+
+func (s *stream) Failed(err error) {
+	kind := cipherio.ErrorKind(err)
+	s.observer.errors.Add(s.ctx, 1, metric.WithAttributes(s.operation, attribute.String("error.type", kind)))
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+	s.end()
+}
+
+func (s *stream) Ended() {
+	s.end()
+}
+
+func (s *stream) end() {
+	s.span.SetAttributes(attribute.Int64("cipherio.bytes", s.crypted))
+	s.span.End()
+}
@@ -0,0 +1,122 @@
+package cipheriootel_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/connesc/cipherio"
+	"github.com/connesc/cipherio/cipheriootel"
+)
+
+func TestObserver(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	spans := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	observer, err := cipheriootel.NewObserver(cipheriootel.Options{
+		TracerProvider: tracerProvider,
+		MeterProvider:  meterProvider,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	ctx, parent := tracerProvider.Tracer("test").Start(context.Background(), "request")
+
+	var encrypted bytes.Buffer
+	writer := cipherio.NewBlockWriterWithPadding(&encrypted, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding,
+		cipherio.WithWriteObserver(ctx, observer, cipherio.Encryption))
+	_, err = writer.Write(make([]byte, 40))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// The ciphertext is truncated, so that decryption fails.
+	decrypter := cipherio.NewBlockReader(bytes.NewReader(encrypted.Bytes()[:40]), cipher.NewCBCDecrypter(aesCipher, iv),
+		cipherio.WithObserver(ctx, observer, cipherio.Decryption))
+	_, err = ioutil.ReadAll(decrypter)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected err: %v != %v", err, io.ErrUnexpectedEOF)
+	}
+	parent.End()
+
+	ended := spans.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("unexpected number of spans: %d != %d", len(ended), 3)
+	}
+	for i, name := range []string{"cipherio.encryption", "cipherio.decryption"} {
+		span := ended[i]
+		if span.Name() != name {
+			t.Fatalf("unexpected span name: %s != %s", span.Name(), name)
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("unexpected parent of %s", name)
+		}
+	}
+	if ended[0].Status().Code != codes.Unset {
+		t.Fatalf("unexpected status: %v", ended[0].Status())
+	}
+	if ended[1].Status().Code != codes.Error {
+		t.Fatalf("unexpected status: %v", ended[1].Status())
+	}
+
+	var metrics metricdata.ResourceMetrics
+	err = reader.Collect(context.Background(), &metrics)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	values := make(map[string]int64)
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				operation, _ := point.Attributes.Value(attribute.Key("cipherio.operation"))
+				values[m.Name+" "+operation.AsString()] = point.Value
+			}
+		}
+	}
+	expected := map[string]int64{
+		"cipherio.streams encryption": 1,
+		"cipherio.streams decryption": 1,
+		"cipherio.bytes encryption":   48,
+		"cipherio.bytes decryption":   32,
+		"cipherio.errors decryption":  1,
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Fatalf("unexpected value of %s: %d != %d", name, values[name], value)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package cipheriosmime
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// BER tags used by EnvelopedData.
+const (
+	tagOctetString     = 0x04
+	tagSequence        = 0x30
+	tagSet             = 0x31
+	tagContextSpecific = 0xa0 // [0], constructed
+	tagImplicitContent = 0x80 // [0] IMPLICIT OCTET STRING, primitive
+)
+
+// indefinite is the length of an element encoded with the indefinite form.
+const indefinite = -1
+
+// endOfContents terminates an element encoded with the indefinite length form.
+var endOfContents = []byte{0, 0}
+
+// appendHeader appends the identifier and the definite length of an element.
+func appendHeader(dst []byte, tag byte, length int) []byte {
+	dst = append(dst, tag)
+	if length < 0x80 {
+		return append(dst, byte(length))
+	}
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], uint64(length))
+	i := 0
+	for encoded[i] == 0 {
+		i++
+	}
+	dst = append(dst, 0x80|byte(len(encoded)-i))
+	return append(dst, encoded[i:]...)
+}
+
+// appendElement appends an element with the given tag and content.
+func appendElement(dst []byte, tag byte, content []byte) []byte {
+	return append(appendHeader(dst, tag, len(content)), content...)
+}
+
+// header is the identifier and length of a BER element.
+type header struct {
+	tag    byte
+	length int // or indefinite
+	raw    []byte
+}
+
+// readHeader reads the header of the next element. Only low tag numbers are supported, which is
+// enough for CMS.
+func readHeader(r *bufio.Reader) (header, error) {
+	var h header
+	tag, err := r.ReadByte()
+	if err != nil {
+		return h, unexpectedEOF(err)
+	}
+	if tag&0x1f == 0x1f {
+		return h, fmt.Errorf("%w: unsupported high tag number", ErrInvalidMessage)
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return h, unexpectedEOF(err)
+	}
+	h.tag = tag
+	h.raw = []byte{tag, first}
+
+	switch {
+	case first < 0x80:
+		h.length = int(first)
+	case first == 0x80:
+		if tag&0x20 == 0 {
+			return h, fmt.Errorf("%w: indefinite length of a primitive element", ErrInvalidMessage)
+		}
+		h.length = indefinite
+	default:
+		size := int(first & 0x7f)
+		if size > 4 {
+			return h, fmt.Errorf("%w: element is too large", ErrInvalidMessage)
+		}
+		encoded := make([]byte, size)
+		if _, err := io.ReadFull(r, encoded); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		h.raw = append(h.raw, encoded...)
+		for _, b := range encoded {
+			h.length = h.length<<8 | int(b)
+		}
+		if h.length < 0 {
+			return h, fmt.Errorf("%w: element is too large", ErrInvalidMessage)
+		}
+	}
+	return h, nil
+}
+
+// expectHeader reads the header of the next element, and checks its tag.
+func expectHeader(r *bufio.Reader, tag byte, name string) (header, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return h, err
+	}
+	if h.tag != tag {
+		return h, fmt.Errorf("%w: unexpected tag for %s: %#x != %#x", ErrInvalidMessage, name, h.tag, tag)
+	}
+	return h, nil
+}
+
+// readElement reads the next element, which must have a definite length, and returns its whole
+// encoding, as expected by encoding/asn1.
+func readElement(r *bufio.Reader, name string) ([]byte, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.length == indefinite {
+		return nil, fmt.Errorf("%w: unsupported indefinite length for %s", ErrInvalidMessage, name)
+	}
+	element := make([]byte, len(h.raw)+h.length)
+	copy(element, h.raw)
+	if _, err := io.ReadFull(r, element[len(h.raw):]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return element, nil
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF, since a message never ends between
+// elements.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// octetStringWriter writes each call to Write as an OCTET STRING, to stream the segments of a
+// constructed OCTET STRING.
+type octetStringWriter struct {
+	dst io.Writer
+}
+
+func (w octetStringWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := w.dst.Write(appendHeader(nil, tagOctetString, len(p))); err != nil {
+		return 0, err
+	}
+	return w.dst.Write(p)
+}
+
+// octetStringReader reads the content of a constructed OCTET STRING, segment by segment.
+type octetStringReader struct {
+	src       *bufio.Reader
+	remaining int // number of bytes left in the current segment
+	err       error
+}
+
+func (r *octetStringReader) Read(p []byte) (int, error) {
+	for r.remaining == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.remaining, r.err = r.nextSegment()
+	}
+	if len(p) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.src.Read(p)
+	r.remaining -= n
+	if err != nil {
+		r.err = unexpectedEOF(err)
+	}
+	return n, nil
+}
+
+// nextSegment reads the header of the next segment, and returns its length, or io.EOF at the end
+// of the OCTET STRING.
+func (r *octetStringReader) nextSegment() (int, error) {
+	h, err := readHeader(r.src)
+	if err == io.ErrUnexpectedEOF && len(h.raw) == 0 {
+		// The OCTET STRING had a definite length, and the source has been limited to it.
+		return 0, io.EOF
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case h.tag == 0 && h.length == 0:
+		return 0, io.EOF
+	case h.tag != tagOctetString:
+		return 0, fmt.Errorf("%w: unexpected tag in encrypted content: %#x", ErrInvalidMessage, h.tag)
+	}
+	return h.length, nil
+}
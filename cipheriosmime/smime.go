@@ -0,0 +1,419 @@
+// Package cipheriosmime encrypts and decrypts S/MIME messages (RFC 8551) with the streaming
+// Readers and Writers of cipherio, so that mail gateways can process large attachments without
+// buffering them.
+//
+// Messages are CMS EnvelopedData structures (RFC 5652) whose content is encrypted with AES-CBC, and
+// whose content key is encrypted for each recipient with RSA (PKCS #1 v1.5), as supported by
+// common mail clients. The content is streamed as a constructed OCTET STRING with indefinite
+// lengths, as allowed by BER.
+package cipheriosmime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/connesc/cipherio"
+)
+
+// ErrInvalidMessage is returned, possibly wrapped, when a message is not a supported
+// EnvelopedData structure.
+var ErrInvalidMessage = errors.New("cipheriosmime: invalid message")
+
+// ErrNoRecipient is returned when a message is not encrypted for the given certificate.
+var ErrNoRecipient = errors.New("cipheriosmime: message is not encrypted for this certificate")
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidAES128CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RecipientIdentifier    issuerAndSerialNumber
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+// Options configures the encryption of a message. The zero value is valid.
+type Options struct {
+	// KeySize is the size of the AES content key: 16, 24 or 32 bytes. Defaults to 32.
+	KeySize int
+
+	// Rand is the source of the content key, the IV, and the randomness of RSA. Defaults to
+	// crypto/rand.Reader.
+	Rand io.Reader
+}
+
+// mimeHeader introduces an S/MIME enveloped message.
+const mimeHeader = "MIME-Version: 1.0\r\n" +
+	"Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=\"smime.p7m\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-Disposition: attachment; filename=\"smime.p7m\"\r\n" +
+	"\r\n"
+
+// NewWriter returns a WriteCloser encrypting a MIME entity for the given recipients, and writing
+// the resulting S/MIME entity to dst: its headers, followed by the base64-encoded EnvelopedData.
+//
+// The plaintext must be a whole MIME entity, including its own headers, such as the body of the
+// original mail. Close must be called to write the end of the message. The wrapped Writer is not
+// closed.
+func NewWriter(dst io.Writer, recipients []*x509.Certificate, opts Options) (io.WriteCloser, error) {
+	if _, err := io.WriteString(dst, mimeHeader); err != nil {
+		return nil, err
+	}
+	lines := &lineWriter{dst: dst}
+	encoder := base64.NewEncoder(base64.StdEncoding, lines)
+	enveloped, err := NewEnvelopedWriter(encoder, recipients, opts)
+	if err != nil {
+		return nil, err
+	}
+	return closers{enveloped, encoder, lines}, nil
+}
+
+// NewEnvelopedWriter is similar to NewWriter, except that the binary EnvelopedData is written to
+// dst, without MIME headers nor base64 encoding, as in a .p7m file.
+func NewEnvelopedWriter(dst io.Writer, recipients []*x509.Certificate, opts Options) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("cipheriosmime: no recipient")
+	}
+	keySize := opts.KeySize
+	if keySize == 0 {
+		keySize = 32
+	}
+	algorithm, ok := map[int]asn1.ObjectIdentifier{16: oidAES128CBC, 24: oidAES192CBC, 32: oidAES256CBC}[keySize]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", cipherio.ErrInvalidKeySize, keySize)
+	}
+	random := opts.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+
+	key := make([]byte, keySize+aes.BlockSize)
+	if _, err := io.ReadFull(random, key); err != nil {
+		return nil, err
+	}
+	key, iv := key[:keySize], key[keySize:]
+
+	var infos []byte
+	for _, certificate := range recipients {
+		info, err := newRecipientInfo(random, certificate, key)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info...)
+	}
+
+	encodedAlgorithm, err := marshalContentAlgorithm(algorithm, iv)
+	if err != nil {
+		return nil, err
+	}
+	encodedVersion, _ := asn1.Marshal(0)
+	encodedData, _ := asn1.Marshal(oidData)
+	encodedEnveloped, _ := asn1.Marshal(oidEnvelopedData)
+
+	// ContentInfo, EnvelopedData and EncryptedContentInfo have indefinite lengths, so that the
+	// encrypted content can be streamed.
+	var start []byte
+	start = append(start, tagSequence, 0x80)
+	start = append(start, encodedEnveloped...)
+	start = append(start, tagContextSpecific, 0x80, tagSequence, 0x80)
+	start = append(start, encodedVersion...)
+	start = appendElement(start, tagSet, infos)
+	start = append(start, tagSequence, 0x80)
+	start = append(start, encodedData...)
+	start = append(start, encodedAlgorithm...)
+	start = append(start, tagContextSpecific, 0x80)
+	if _, err := dst.Write(start); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &envelopedWriter{
+		dst:    dst,
+		writer: cipherio.NewPKCS7Writer(octetStringWriter{dst}, cipher.NewCBCEncrypter(block, iv)),
+	}, nil
+}
+
+// newRecipientInfo returns the KeyTransRecipientInfo encrypting the content key for the given
+// certificate.
+func newRecipientInfo(random io.Reader, certificate *x509.Certificate, key []byte) ([]byte, error) {
+	publicKey, ok := certificate.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("cipheriosmime: unsupported public key type: %T", certificate.PublicKey)
+	}
+	encryptedKey, err := rsa.EncryptPKCS1v15(random, publicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(keyTransRecipientInfo{
+		RecipientIdentifier: issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: certificate.RawIssuer},
+			SerialNumber: certificate.SerialNumber,
+		},
+		KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidRSAEncryption,
+			Parameters: asn1.NullRawValue,
+		},
+		EncryptedKey: encryptedKey,
+	})
+}
+
+// marshalContentAlgorithm encodes the AlgorithmIdentifier of AES-CBC with the given IV.
+func marshalContentAlgorithm(algorithm asn1.ObjectIdentifier, iv []byte) ([]byte, error) {
+	encodedIV, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkix.AlgorithmIdentifier{
+		Algorithm:  algorithm,
+		Parameters: asn1.RawValue{FullBytes: encodedIV},
+	})
+}
+
+// envelopedWriter encrypts the content of an EnvelopedData, then terminates it on Close.
+type envelopedWriter struct {
+	dst    io.Writer
+	writer *cipherio.PKCS7Writer
+}
+
+func (w *envelopedWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+func (w *envelopedWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		return err
+	}
+	// Terminate the encrypted content, EncryptedContentInfo, EnvelopedData, the explicit tag of
+	// ContentInfo, and ContentInfo.
+	_, err := w.dst.Write(bytes.Repeat(endOfContents, 5))
+	return err
+}
+
+// NewReader returns a Reader decrypting an S/MIME enveloped message with the given certificate
+// and its private key. The source must be the base64-encoded body of the application/pkcs7-mime
+// entity, following its headers. The result is the original MIME entity.
+//
+// ErrNoRecipient is returned if the message is not encrypted for the certificate.
+// cipherio.ErrInvalidPadding is returned at the end of the content if it cannot be decrypted,
+// which also happens if the encrypted content key has been tampered with.
+func NewReader(src io.Reader, certificate *x509.Certificate, key *rsa.PrivateKey) (io.Reader, error) {
+	return NewEnvelopedReader(base64.NewDecoder(base64.StdEncoding, src), certificate, key)
+}
+
+// NewEnvelopedReader is similar to NewReader, except that the source is a binary EnvelopedData,
+// as in a .p7m file. It may be encoded with BER or DER.
+//
+// The source is read through a bufio.Reader, so it may be consumed beyond the message.
+func NewEnvelopedReader(src io.Reader, certificate *x509.Certificate, key *rsa.PrivateKey) (io.Reader, error) {
+	r := bufio.NewReader(src)
+
+	// ContentInfo
+	if _, err := expectHeader(r, tagSequence, "ContentInfo"); err != nil {
+		return nil, err
+	}
+	if err := expectOID(r, oidEnvelopedData, "content type"); err != nil {
+		return nil, err
+	}
+	if _, err := expectHeader(r, tagContextSpecific, "content"); err != nil {
+		return nil, err
+	}
+
+	// EnvelopedData
+	if _, err := expectHeader(r, tagSequence, "EnvelopedData"); err != nil {
+		return nil, err
+	}
+	if _, err := readElement(r, "version"); err != nil {
+		return nil, err
+	}
+	infos, err := readElement(r, "RecipientInfos")
+	if err != nil {
+		return nil, err
+	}
+	if infos[0] == tagContextSpecific {
+		// Skip OriginatorInfo.
+		if infos, err = readElement(r, "RecipientInfos"); err != nil {
+			return nil, err
+		}
+	}
+	encryptedKey, err := findRecipient(infos, certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	// EncryptedContentInfo
+	if _, err := expectHeader(r, tagSequence, "EncryptedContentInfo"); err != nil {
+		return nil, err
+	}
+	if err := expectOID(r, oidData, "encrypted content type"); err != nil {
+		return nil, err
+	}
+	encodedAlgorithm, err := readElement(r, "content encryption algorithm")
+	if err != nil {
+		return nil, err
+	}
+	var algorithm pkix.AlgorithmIdentifier
+	if rest, err := asn1.Unmarshal(encodedAlgorithm, &algorithm); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid content encryption algorithm", ErrInvalidMessage)
+	}
+	var keySize int
+	switch {
+	case algorithm.Algorithm.Equal(oidAES128CBC):
+		keySize = 16
+	case algorithm.Algorithm.Equal(oidAES192CBC):
+		keySize = 24
+	case algorithm.Algorithm.Equal(oidAES256CBC):
+		keySize = 32
+	default:
+		return nil, fmt.Errorf("cipheriosmime: unsupported content encryption algorithm: %v", algorithm.Algorithm)
+	}
+	var iv []byte
+	if rest, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &iv); err != nil || len(rest) > 0 || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: invalid IV", ErrInvalidMessage)
+	}
+
+	// A random content key is used if decryption fails, so that the failure is only detected once
+	// the padding is checked, as recommended against Bleichenbacher's attack.
+	contentKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, contentKey); err != nil {
+		return nil, err
+	}
+	if err := rsa.DecryptPKCS1v15SessionKey(nil, key, encryptedKey, contentKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	var ciphertext io.Reader
+	switch {
+	case content.tag == tagImplicitContent:
+		ciphertext = io.LimitReader(r, int64(content.length))
+	case content.tag == tagContextSpecific && content.length == indefinite:
+		ciphertext = &octetStringReader{src: r}
+	case content.tag == tagContextSpecific:
+		ciphertext = &octetStringReader{src: bufio.NewReader(io.LimitReader(r, int64(content.length)))}
+	default:
+		return nil, fmt.Errorf("%w: missing encrypted content", ErrInvalidMessage)
+	}
+	return cipherio.NewPKCS7Reader(ciphertext, cipher.NewCBCDecrypter(block, iv)), nil
+}
+
+// expectOID reads the next element, and checks that it is the given OBJECT IDENTIFIER.
+func expectOID(r *bufio.Reader, expected asn1.ObjectIdentifier, name string) error {
+	element, err := readElement(r, name)
+	if err != nil {
+		return err
+	}
+	var oid asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(element, &oid); err != nil || len(rest) > 0 {
+		return fmt.Errorf("%w: invalid %s", ErrInvalidMessage, name)
+	}
+	if !oid.Equal(expected) {
+		return fmt.Errorf("cipheriosmime: unsupported %s: %v", name, oid)
+	}
+	return nil
+}
+
+// findRecipient returns the encrypted content key of the KeyTransRecipientInfo matching the given
+// certificate. Other kinds of RecipientInfo are ignored.
+func findRecipient(encodedInfos []byte, certificate *x509.Certificate) ([]byte, error) {
+	var infos []asn1.RawValue
+	if rest, err := asn1.UnmarshalWithParams(encodedInfos, &infos, "set"); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: invalid RecipientInfos", ErrInvalidMessage)
+	}
+	for _, raw := range infos {
+		var info keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(raw.FullBytes, &info); err != nil {
+			continue
+		}
+		id := info.RecipientIdentifier
+		if info.Version == 0 && info.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAEncryption) &&
+			bytes.Equal(id.Issuer.FullBytes, certificate.RawIssuer) && id.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+			return info.EncryptedKey, nil
+		}
+	}
+	return nil, ErrNoRecipient
+}
+
+// lineWriter splits base64 output into lines of 76 characters, as required by MIME.
+type lineWriter struct {
+	dst    io.Writer
+	column int
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	count := 0
+	for len(p) > 0 {
+		if w.column == 76 {
+			if _, err := io.WriteString(w.dst, "\r\n"); err != nil {
+				return count, err
+			}
+			w.column = 0
+		}
+		n := 76 - w.column
+		if n > len(p) {
+			n = len(p)
+		}
+		n, err := w.dst.Write(p[:n])
+		w.column += n
+		count += n
+		p = p[n:]
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// Close terminates the last line.
+func (w *lineWriter) Close() error {
+	_, err := io.WriteString(w.dst, "\r\n")
+	return err
+}
+
+// closers closes each of its elements in order, stopping at the first error.
+type closers []io.WriteCloser
+
+func (c closers) Write(p []byte) (int, error) {
+	return c[0].Write(p)
+}
+
+func (c closers) Close() error {
+	for _, closer := range c {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package cipheriosmime_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/connesc/cipherio"
+	"github.com/connesc/cipherio/cipheriosmime"
+)
+
+func newCertificate(t *testing.T, serial int64) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate, key
+}
+
+func TestSMIME(t *testing.T) {
+	alice, aliceKey := newCertificate(t, 1)
+	bob, bobKey := newCertificate(t, 2)
+	eve, eveKey := newCertificate(t, 3)
+
+	for _, size := range []int{0, 15, 16, 100000} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		writer, err := cipheriosmime.NewWriter(&buf, []*x509.Certificate{alice, bob}, cipheriosmime.Options{KeySize: 16})
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		_, err = writer.Write(plaintext)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		// Parse the MIME headers, then decrypt the body for each recipient.
+		message := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+		headers, err := textproto.NewReader(message).ReadMIMEHeader()
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if contentType := headers.Get("Content-Type"); contentType != `application/pkcs7-mime; smime-type=enveloped-data; name="smime.p7m"` {
+			t.Fatalf("unexpected content type: %s", contentType)
+		}
+		body, err := ioutil.ReadAll(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, recipient := range []struct {
+			Certificate *x509.Certificate
+			Key         *rsa.PrivateKey
+		}{{alice, aliceKey}, {bob, bobKey}} {
+			reader, err := cipheriosmime.NewReader(bytes.NewReader(body), recipient.Certificate, recipient.Key)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatalf("decrypted data does not match plaintext for %d bytes", size)
+			}
+		}
+
+		_, err = cipheriosmime.NewReader(bytes.NewReader(body), eve, eveKey)
+		if err != cipheriosmime.ErrNoRecipient {
+			t.Fatalf("unexpected err: %v != %v", err, cipheriosmime.ErrNoRecipient)
+		}
+	}
+}
+
+func TestSMIMEWrongKey(t *testing.T) {
+	alice, _ := newCertificate(t, 1)
+
+	// A ciphertext larger than the modulus is rejected by RSA itself, which is public information.
+	// Use a larger modulus, so that only the padding of the content can reveal the wrong key.
+	_, otherKey := newCertificate(t, 1)
+	for otherKey.N.Cmp(alice.PublicKey.(*rsa.PublicKey).N) <= 0 {
+		_, otherKey = newCertificate(t, 1)
+	}
+
+	var buf bytes.Buffer
+	writer, err := cipheriosmime.NewEnvelopedWriter(&buf, []*x509.Certificate{alice}, cipheriosmime.Options{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write([]byte("secret"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// The certificate matches, but the content key cannot be decrypted.
+	reader, err := cipheriosmime.NewEnvelopedReader(&buf, alice, otherKey)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	// The random fallback key usually yields an invalid padding, but about 1/256 of the time the
+	// last block happens to end with a valid one. Either way, the secret is not revealed.
+	result, err := ioutil.ReadAll(reader)
+	if err != nil && err != cipherio.ErrInvalidPadding {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidPadding)
+	}
+	if bytes.Equal(result, []byte("secret")) {
+		t.Fatalf("secret decrypted with the wrong key")
+	}
+}
+
+func TestSMIMEInvalidMessage(t *testing.T) {
+	alice, aliceKey := newCertificate(t, 1)
+
+	for _, message := range [][]byte{
+		nil,
+		[]byte("garbage"),
+		{0x30, 0x80, 0x06, 0x03, 0x2a, 0x03, 0x04},
+	} {
+		_, err := cipheriosmime.NewEnvelopedReader(bytes.NewReader(message), alice, aliceKey)
+		if err == nil {
+			t.Fatalf("invalid message has been accepted: %x", message)
+		}
+	}
+
+	_, err := cipheriosmime.NewEnvelopedReader(bytes.NewReader([]byte("garbage")), alice, aliceKey)
+	if !errors.Is(err, cipheriosmime.ErrInvalidMessage) {
+		t.Fatalf("unexpected err: %v != %v", err, cipheriosmime.ErrInvalidMessage)
+	}
+}
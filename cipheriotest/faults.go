@@ -0,0 +1,187 @@
+// Package cipheriotest provides Readers and Writers injecting faults, in the spirit of
+// testing/iotest, to reproduce the edge cases covered by the tests of cipherio: errors in the
+// middle of a stream, short reads and fragmented writes, and EOF in the middle of a block.
+//
+// Downstream projects wrapping the Readers and Writers of cipherio can use them to check that
+// their own code handles these cases too. All injectors are deterministic for a given input.
+package cipheriotest
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+)
+
+// ErrInjected is a convenient error to inject with ErrAfterReader and ErrAfterWriter.
+var ErrInjected = errors.New("cipheriotest: injected error")
+
+// Distribution returns the number of bytes to transfer out of n requested bytes, with n > 0. The
+// result is clamped between 1 and n.
+type Distribution func(n int) int
+
+// Fixed transfers at most size bytes at a time.
+func Fixed(size int) Distribution {
+	return func(n int) int {
+		return size
+	}
+}
+
+// Sequence transfers at most the given sizes in turn, cycling once all of them have been used.
+func Sequence(sizes ...int) Distribution {
+	i := 0
+	return func(n int) int {
+		size := sizes[i%len(sizes)]
+		i++
+		return size
+	}
+}
+
+// Uniform transfers a uniformly distributed number of bytes between 1 and n, from a pseudo-random
+// source initialized with the given seed, so that failures are reproducible.
+func Uniform(seed int64) Distribution {
+	random := rand.New(rand.NewSource(seed))
+	return func(n int) int {
+		return 1 + random.Intn(n)
+	}
+}
+
+// size applies the distribution to n, with n > 0.
+func (d Distribution) size(n int) int {
+	size := d(n)
+	if size < 1 {
+		return 1
+	}
+	if size > n {
+		return n
+	}
+	return size
+}
+
+// ShortReader returns a Reader whose calls to Read read at most the number of bytes given by the
+// distribution, which allows to exercise incomplete blocks at every offset.
+func ShortReader(r io.Reader, sizes Distribution) io.Reader {
+	return &shortReader{r, sizes}
+}
+
+type shortReader struct {
+	r     io.Reader
+	sizes Distribution
+}
+
+func (r *shortReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return r.r.Read(p)
+	}
+	return r.r.Read(p[:r.sizes.size(len(p))])
+}
+
+// SplitWriter returns a Writer which splits each Write into several calls to the given Writer,
+// with sizes given by the distribution. It is typically used to feed a Writer under test with
+// writes of various sizes. It stops at the first error.
+func SplitWriter(w io.Writer, sizes Distribution) io.Writer {
+	return &splitWriter{w, sizes}
+}
+
+type splitWriter struct {
+	w     io.Writer
+	sizes Distribution
+}
+
+func (w *splitWriter) Write(p []byte) (int, error) {
+	count := 0
+	for len(p) > 0 {
+		n, err := w.w.Write(p[:w.sizes.size(len(p))])
+		count += n
+		p = p[n:]
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// ErrAfterReader returns a Reader which reads at most n bytes from r, then returns the given error
+// instead of reading further. If r ends before, its EOF is returned as usual.
+func ErrAfterReader(r io.Reader, n int64, err error) io.Reader {
+	return &errAfterReader{r, n, err}
+}
+
+type errAfterReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (r *errAfterReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, r.err
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// ErrAfterWriter returns a Writer which writes at most n bytes to w, then fails with the given
+// error. The Write crossing the limit is short: it writes the bytes up to the limit and returns
+// the error along with their count. Injecting io.ErrShortWrite mimics a full device.
+func ErrAfterWriter(w io.Writer, n int64, err error) io.Writer {
+	return &errAfterWriter{w, n, err}
+}
+
+type errAfterWriter struct {
+	w         io.Writer
+	remaining int64
+	err       error
+}
+
+func (w *errAfterWriter) Write(p []byte) (int, error) {
+	short := int64(len(p)) > w.remaining
+	if short {
+		p = p[:w.remaining]
+	}
+	n, err := w.w.Write(p)
+	w.remaining -= int64(n)
+	if err == nil && short {
+		err = w.err
+	}
+	return n, err
+}
+
+// TruncateReader returns a Reader which reads all bytes of r but the last n ones. With data
+// aligned to the block size and 0 < n < BlockSize, EOF is then reached in the middle of the last
+// block, as with a ciphertext truncated in transit.
+func TruncateReader(r io.Reader, n int) io.Reader {
+	return &truncateReader{
+		r:   r,
+		buf: make([]byte, 0, n),
+	}
+}
+
+type truncateReader struct {
+	r   io.Reader
+	buf []byte // last bytes read from r, held back until more bytes follow
+}
+
+func (r *truncateReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	held := cap(r.buf)
+
+	// Read into the end of a combined buffer, after the held back bytes, then return the oldest
+	// bytes while holding back the newest ones.
+	combined := make([]byte, len(r.buf)+len(p))
+	copy(combined, r.buf)
+	n, err := r.r.Read(combined[len(r.buf):])
+	combined = combined[:len(r.buf)+n]
+
+	count := 0
+	if len(combined) > held {
+		count = copy(p, combined[:len(combined)-held])
+	}
+	r.buf = append(r.buf[:0], combined[count:]...)
+	return count, err
+}
@@ -0,0 +1,205 @@
+package cipheriotest_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+	"github.com/connesc/cipherio/cipheriotest"
+)
+
+// recordingWriter records the size of each call to Write.
+type recordingWriter struct {
+	bytes.Buffer
+	sizes []int
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestShortReader(t *testing.T) {
+	data := randomBytes(t, 100)
+
+	t.Run("Sequence", func(t *testing.T) {
+		reader := cipheriotest.ShortReader(bytes.NewReader(data), cipheriotest.Sequence(1, 7, 1000))
+		var sizes []int
+		for {
+			n, err := reader.Read(make([]byte, 32))
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			sizes = append(sizes, n)
+		}
+		expectedSizes := []int{1, 7, 32, 1, 7, 32, 1, 7, 12}
+		if len(sizes) != len(expectedSizes) {
+			t.Fatalf("unexpected sizes: %v != %v", sizes, expectedSizes)
+		}
+		for i := range sizes {
+			if sizes[i] != expectedSizes[i] {
+				t.Fatalf("unexpected sizes: %v != %v", sizes, expectedSizes)
+			}
+		}
+	})
+
+	t.Run("Uniform", func(t *testing.T) {
+		result, err := ioutil.ReadAll(cipheriotest.ShortReader(bytes.NewReader(data), cipheriotest.Uniform(1)))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(result, data) {
+			t.Fatalf("unexpected result")
+		}
+	})
+}
+
+func TestSplitWriter(t *testing.T) {
+	data := randomBytes(t, 20)
+
+	var dst recordingWriter
+	writer := cipheriotest.SplitWriter(&dst, cipheriotest.Fixed(8))
+	n, err := writer.Write(data)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if n != len(data) {
+		t.Fatalf("unexpected count: %d != %d", n, len(data))
+	}
+	if !bytes.Equal(dst.Bytes(), data) {
+		t.Fatalf("unexpected result")
+	}
+	if len(dst.sizes) != 3 || dst.sizes[0] != 8 || dst.sizes[1] != 8 || dst.sizes[2] != 4 {
+		t.Fatalf("unexpected sizes: %v != %v", dst.sizes, []int{8, 8, 4})
+	}
+}
+
+func TestErrAfterReader(t *testing.T) {
+	data := randomBytes(t, 100)
+
+	result, err := ioutil.ReadAll(cipheriotest.ErrAfterReader(bytes.NewReader(data), 40, cipheriotest.ErrInjected))
+	if err != cipheriotest.ErrInjected {
+		t.Fatalf("unexpected err: %v != %v", err, cipheriotest.ErrInjected)
+	}
+	if !bytes.Equal(result, data[:40]) {
+		t.Fatalf("unexpected result")
+	}
+
+	// EOF comes first if the limit is beyond the end.
+	result, err = ioutil.ReadAll(cipheriotest.ErrAfterReader(bytes.NewReader(data), 1000, cipheriotest.ErrInjected))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(result, data) {
+		t.Fatalf("unexpected result")
+	}
+}
+
+func TestErrAfterWriter(t *testing.T) {
+	data := randomBytes(t, 100)
+
+	var dst bytes.Buffer
+	writer := cipheriotest.ErrAfterWriter(&dst, 40, io.ErrShortWrite)
+	n, err := writer.Write(data[:30])
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if n != 30 {
+		t.Fatalf("unexpected count: %d != %d", n, 30)
+	}
+	n, err = writer.Write(data[30:])
+	if err != io.ErrShortWrite {
+		t.Fatalf("unexpected err: %v != %v", err, io.ErrShortWrite)
+	}
+	if n != 10 {
+		t.Fatalf("unexpected count: %d != %d", n, 10)
+	}
+	if !bytes.Equal(dst.Bytes(), data[:40]) {
+		t.Fatalf("unexpected result")
+	}
+}
+
+func TestTruncateReader(t *testing.T) {
+	data := randomBytes(t, 100)
+
+	for _, size := range []int{1, 3, 16, 1000} {
+		result, err := ioutil.ReadAll(cipheriotest.TruncateReader(cipheriotest.ShortReader(bytes.NewReader(data), cipheriotest.Fixed(size)), 5))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(result, data[:95]) {
+			t.Fatalf("unexpected result with reads of %d bytes", size)
+		}
+	}
+}
+
+// TestBlockReader shows the injectors reproducing edge cases of cipherio.
+func TestBlockReader(t *testing.T) {
+	// Generate a random AES key
+	key := randomBytes(t, 32)
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	plaintext := randomBytes(t, 160)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(ciphertext, plaintext)
+
+	t.Run("ShortReads", func(t *testing.T) {
+		src := cipheriotest.ShortReader(bytes.NewReader(ciphertext), cipheriotest.Uniform(1))
+		reader := cipherio.NewBlockReader(src, cipher.NewCBCDecrypter(aesCipher, iv))
+		result, err := ioutil.ReadAll(cipheriotest.ShortReader(reader, cipheriotest.Uniform(2)))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatalf("unexpected result")
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		src := cipheriotest.TruncateReader(bytes.NewReader(ciphertext), 3)
+		reader := cipherio.NewBlockReader(src, cipher.NewCBCDecrypter(aesCipher, iv))
+		result, err := ioutil.ReadAll(reader)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("unexpected err: %v != %v", err, io.ErrUnexpectedEOF)
+		}
+		if !bytes.Equal(result, plaintext[:144]) {
+			t.Fatalf("unexpected result")
+		}
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		src := cipheriotest.ErrAfterReader(bytes.NewReader(ciphertext), 100, cipheriotest.ErrInjected)
+		reader := cipherio.NewBlockReader(src, cipher.NewCBCDecrypter(aesCipher, iv))
+		result, err := ioutil.ReadAll(reader)
+		if !errors.Is(err, cipheriotest.ErrInjected) {
+			t.Fatalf("unexpected err: %v != %v", err, cipheriotest.ErrInjected)
+		}
+		if !bytes.Equal(result, plaintext[:96]) {
+			t.Fatalf("unexpected result")
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package cipheriovectors
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// TestBlockAdapter checks that a third-party cipher.Block implementation, such as Camellia, ARIA
+// or SEED, meets the expectations of cipherio before being used with its Readers and Writers, or
+// registered with cipherio.RegisterCipher:
+//
+//   - the block size is positive and constant;
+//   - Encrypt and Decrypt are inverses, deterministic, and work in place;
+//   - they only write the first block of dst and never modify src;
+//   - CBC built on top of it gives the same result through CryptBlocks, in place or not, and
+//     through a BlockReader and a BlockWriter with reads and writes of various sizes.
+//
+// Known-answer tests are out of scope: they must be provided by the implementation itself.
+func TestBlockAdapter(t *testing.T, newCipher cipherio.NewCipherFunc, keySize int) {
+	// A deterministic source keeps failures reproducible.
+	random := rand.New(rand.NewSource(1))
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		random.Read(b)
+		return b
+	}
+
+	key := randomBytes(keySize)
+	block, err := newCipher(key)
+	if err != nil {
+		t.Fatalf("cannot create cipher: %v", err)
+	}
+	blockSize := block.BlockSize()
+	if blockSize <= 0 {
+		t.Fatalf("invalid block size: %d", blockSize)
+	}
+
+	t.Run("Block", func(t *testing.T) {
+		for i := 0; i < 16; i++ {
+			plaintext := randomBytes(blockSize)
+			src := append([]byte(nil), plaintext...)
+
+			// Write into a larger buffer, to detect writes beyond the first block.
+			dst := bytes.Repeat([]byte{0xa5}, 2*blockSize)
+			block.Encrypt(dst, src)
+			if !bytes.Equal(src, plaintext) {
+				t.Fatal("Encrypt modified its source")
+			}
+			if !bytes.Equal(dst[blockSize:], bytes.Repeat([]byte{0xa5}, blockSize)) {
+				t.Fatal("Encrypt wrote beyond the first block")
+			}
+			ciphertext := append([]byte(nil), dst[:blockSize]...)
+
+			again := make([]byte, blockSize)
+			block.Encrypt(again, plaintext)
+			if !bytes.Equal(again, ciphertext) {
+				t.Fatal("Encrypt is not deterministic")
+			}
+
+			decrypted := make([]byte, blockSize)
+			block.Decrypt(decrypted, ciphertext)
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("Decrypt is not the inverse of Encrypt: %x != %x", decrypted, plaintext)
+			}
+
+			inPlace := append([]byte(nil), plaintext...)
+			block.Encrypt(inPlace, inPlace)
+			if !bytes.Equal(inPlace, ciphertext) {
+				t.Fatal("Encrypt does not work in place")
+			}
+			block.Decrypt(inPlace, inPlace)
+			if !bytes.Equal(inPlace, plaintext) {
+				t.Fatal("Decrypt does not work in place")
+			}
+
+			if block.BlockSize() != blockSize {
+				t.Fatalf("block size changed: %d != %d", block.BlockSize(), blockSize)
+			}
+		}
+
+		// Another instance with the same key must behave identically.
+		other, err := newCipher(key)
+		if err != nil {
+			t.Fatalf("cannot create cipher: %v", err)
+		}
+		plaintext := randomBytes(blockSize)
+		expected := make([]byte, blockSize)
+		block.Encrypt(expected, plaintext)
+		result := make([]byte, blockSize)
+		other.Encrypt(result, plaintext)
+		if !bytes.Equal(result, expected) {
+			t.Fatal("ciphers created with the same key differ")
+		}
+	})
+
+	t.Run("CBC", func(t *testing.T) {
+		iv := randomBytes(blockSize)
+		plaintext := randomBytes(64 * blockSize)
+
+		expected := make([]byte, len(plaintext))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(expected, plaintext)
+
+		inPlace := append([]byte(nil), plaintext...)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(inPlace, inPlace)
+		if !bytes.Equal(inPlace, expected) {
+			t.Fatal("CBC encryption in place differs")
+		}
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(inPlace, inPlace)
+		if !bytes.Equal(inPlace, plaintext) {
+			t.Fatal("CBC decryption in place differs")
+		}
+
+		newEncrypter := func(key, iv []byte) (cipher.BlockMode, error) {
+			block, err := newCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewCBCEncrypter(block, iv), nil
+		}
+		newDecrypter := func(key, iv []byte) (cipher.BlockMode, error) {
+			block, err := newCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewCBCDecrypter(block, iv), nil
+		}
+		keyHex, ivHex := hex.EncodeToString(key), hex.EncodeToString(iv)
+		runBlockMode(t, newEncrypter, keyHex, ivHex, hex.EncodeToString(plaintext), hex.EncodeToString(expected))
+		runBlockMode(t, newDecrypter, keyHex, ivHex, hex.EncodeToString(expected), hex.EncodeToString(plaintext))
+	})
+}
@@ -0,0 +1,18 @@
+package cipheriovectors_test
+
+import (
+	"crypto/aes"
+	"crypto/des"
+	"testing"
+
+	"github.com/connesc/cipherio/cipheriovectors"
+)
+
+func TestBlockAdapter(t *testing.T) {
+	t.Run("AES", func(t *testing.T) {
+		cipheriovectors.TestBlockAdapter(t, aes.NewCipher, 32)
+	})
+	t.Run("DES", func(t *testing.T) {
+		cipheriovectors.TestBlockAdapter(t, des.NewCipher, 8)
+	})
+}
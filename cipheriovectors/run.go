@@ -0,0 +1,189 @@
+// Package cipheriovectors provides known-answer test vectors for block modes and for the stream
+// formats of cipherio, along with a runner.
+//
+// Downstream implementations, such as custom BlockModes or HSM adapters, can validate themselves
+// against the same corpus by calling Run from their own tests. Third-party block ciphers can be
+// validated with TestBlockAdapter before being registered with cipherio.RegisterCipher.
+package cipheriovectors
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// Constructors holds the implementations to be tested. Any nil constructor is skipped.
+type Constructors struct {
+	NewCBCEncrypter func(key, iv []byte) (cipher.BlockMode, error)
+	NewCBCDecrypter func(key, iv []byte) (cipher.BlockMode, error)
+	NewCTR          func(key, iv []byte) (cipher.Stream, error)
+}
+
+// chunkSizes are the sizes of the reads and writes used to exercise the Readers and Writers of
+// cipherio.
+var chunkSizes = []int{1, 15, 16, 17, 64, 1024}
+
+// Run tests the given constructors against CBCVectors and CTRVectors, both directly and through
+// the Readers and Writers of cipherio, then checks StreamFormatVectors.
+func Run(t *testing.T, c Constructors) {
+	for _, vector := range CBCVectors {
+		vector := vector
+		if c.NewCBCEncrypter != nil {
+			t.Run(vector.Name+"/Encrypt", func(t *testing.T) {
+				runBlockMode(t, c.NewCBCEncrypter, vector.Key, vector.IV, vector.Plaintext, vector.Ciphertext)
+			})
+		}
+		if c.NewCBCDecrypter != nil {
+			t.Run(vector.Name+"/Decrypt", func(t *testing.T) {
+				runBlockMode(t, c.NewCBCDecrypter, vector.Key, vector.IV, vector.Ciphertext, vector.Plaintext)
+			})
+		}
+	}
+
+	for _, vector := range CTRVectors {
+		vector := vector
+		if c.NewCTR != nil {
+			t.Run(vector.Name, func(t *testing.T) {
+				runStream(t, c.NewCTR, vector)
+			})
+		}
+	}
+
+	for _, vector := range StreamFormatVectors {
+		vector := vector
+		t.Run(vector.Name, func(t *testing.T) {
+			runStreamFormat(t, vector)
+		})
+	}
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid vector: %v", err)
+	}
+	return b
+}
+
+// runBlockMode checks the given BlockMode constructor with CryptBlocks, a BlockReader and a
+// BlockWriter.
+func runBlockMode(t *testing.T, newBlockMode func(key, iv []byte) (cipher.BlockMode, error), keyHex, ivHex, srcHex, expectedHex string) {
+	key := decodeHex(t, keyHex)
+	iv := decodeHex(t, ivHex)
+	src := decodeHex(t, srcHex)
+	expected := decodeHex(t, expectedHex)
+
+	newMode := func() cipher.BlockMode {
+		t.Helper()
+		blockMode, err := newBlockMode(key, iv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blockMode
+	}
+
+	dst := make([]byte, len(src))
+	newMode().CryptBlocks(dst, src)
+	if !bytes.Equal(dst, expected) {
+		t.Fatalf("CryptBlocks: %x != %x", dst, expected)
+	}
+
+	for _, chunkSize := range chunkSizes {
+		reader := cipherio.NewBlockReader(bytes.NewReader(src), newMode())
+		var result []byte
+		buf := make([]byte, chunkSize)
+		for {
+			n, err := reader.Read(buf)
+			result = append(result, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		if !bytes.Equal(result, expected) {
+			t.Fatalf("BlockReader with reads of %d bytes: %x != %x", chunkSize, result, expected)
+		}
+
+		var written bytes.Buffer
+		writer := cipherio.NewBlockWriter(&written, newMode())
+		for offset := 0; offset < len(src); offset += chunkSize {
+			end := offset + chunkSize
+			if end > len(src) {
+				end = len(src)
+			}
+			if _, err := writer.Write(src[offset:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(written.Bytes(), expected) {
+			t.Fatalf("BlockWriter with writes of %d bytes: %x != %x", chunkSize, written.Bytes(), expected)
+		}
+	}
+}
+
+// runStream checks the given Stream constructor with XORKeyStream, using chunks of various sizes.
+func runStream(t *testing.T, newStream func(key, iv []byte) (cipher.Stream, error), vector BlockModeVector) {
+	key := decodeHex(t, vector.Key)
+	iv := decodeHex(t, vector.IV)
+	plaintext := decodeHex(t, vector.Plaintext)
+	expected := decodeHex(t, vector.Ciphertext)
+
+	for _, chunkSize := range chunkSizes {
+		stream, err := newStream(key, iv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := make([]byte, len(plaintext))
+		for offset := 0; offset < len(plaintext); offset += chunkSize {
+			end := offset + chunkSize
+			if end > len(plaintext) {
+				end = len(plaintext)
+			}
+			stream.XORKeyStream(dst[offset:end], plaintext[offset:end])
+		}
+		if !bytes.Equal(dst, expected) {
+			t.Fatalf("XORKeyStream with chunks of %d bytes: %x != %x", chunkSize, dst, expected)
+		}
+	}
+}
+
+// runStreamFormat checks that the vector is decrypted by NewStreamReader, and produced again by
+// NewStreamWriter.
+func runStreamFormat(t *testing.T, vector StreamFormatVector) {
+	key := decodeHex(t, vector.Key)
+	stream := decodeHex(t, vector.Stream)
+
+	reader, header, err := cipherio.NewStreamReader(bytes.NewReader(stream), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != vector.Plaintext {
+		t.Fatalf("NewStreamReader: %q != %q", plaintext, vector.Plaintext)
+	}
+
+	var written bytes.Buffer
+	writer, err := cipherio.NewStreamWriter(&written, header, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written.Bytes(), stream) {
+		t.Fatalf("NewStreamWriter: %x != %x", written.Bytes(), stream)
+	}
+}
@@ -0,0 +1,35 @@
+package cipheriovectors_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/connesc/cipherio/cipheriovectors"
+)
+
+func TestRun(t *testing.T) {
+	cipheriovectors.Run(t, cipheriovectors.Constructors{
+		NewCBCEncrypter: func(key, iv []byte) (cipher.BlockMode, error) {
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewCBCEncrypter(block, iv), nil
+		},
+		NewCBCDecrypter: func(key, iv []byte) (cipher.BlockMode, error) {
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewCBCDecrypter(block, iv), nil
+		},
+		NewCTR: func(key, iv []byte) (cipher.Stream, error) {
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewCTR(block, iv), nil
+		},
+	})
+}
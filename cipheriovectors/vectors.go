@@ -0,0 +1,130 @@
+package cipheriovectors
+
+// BlockModeVector is a known-answer test for a block mode.
+type BlockModeVector struct {
+	Name       string
+	Key        string // hex
+	IV         string // hex, or initial counter block for CTR
+	Plaintext  string // hex
+	Ciphertext string // hex
+}
+
+// sp80038APlaintext is shared by all the vectors of NIST SP 800-38A, appendix F.
+const sp80038APlaintext = "6bc1bee22e409f96e93d7e117393172a" +
+	"ae2d8a571e03ac9c9eb76fac45af8e51" +
+	"30c81c46a35ce411e5fbc1191a0a52ef" +
+	"f69f2445df4f9b17ad2b417be66c3710"
+
+const (
+	sp80038AKey128 = "2b7e151628aed2a6abf7158809cf4f3c"
+	sp80038AKey192 = "8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b"
+	sp80038AKey256 = "603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4"
+)
+
+// CBCVectors are the AES-CBC vectors of NIST SP 800-38A, appendix F.2.
+var CBCVectors = []BlockModeVector{
+	{
+		Name:      "SP800-38A/F.2.1/CBC-AES128",
+		Key:       sp80038AKey128,
+		IV:        "000102030405060708090a0b0c0d0e0f",
+		Plaintext: sp80038APlaintext,
+		Ciphertext: "7649abac8119b246cee98e9b12e9197d" +
+			"5086cb9b507219ee95db113a917678b2" +
+			"73bed6b8e3c1743b7116e69e22229516" +
+			"3ff1caa1681fac09120eca307586e1a7",
+	},
+	{
+		Name:      "SP800-38A/F.2.3/CBC-AES192",
+		Key:       sp80038AKey192,
+		IV:        "000102030405060708090a0b0c0d0e0f",
+		Plaintext: sp80038APlaintext,
+		Ciphertext: "4f021db243bc633d7178183a9fa071e8" +
+			"b4d9ada9ad7dedf4e5e738763f69145a" +
+			"571b242012fb7ae07fa9baac3df102e0" +
+			"08b0e27988598881d920a9e64f5615cd",
+	},
+	{
+		Name:      "SP800-38A/F.2.5/CBC-AES256",
+		Key:       sp80038AKey256,
+		IV:        "000102030405060708090a0b0c0d0e0f",
+		Plaintext: sp80038APlaintext,
+		Ciphertext: "f58c4c04d6e5f1ba779eabfb5f7bfbd6" +
+			"9cfc4e967edb808d679f777bc6702c7d" +
+			"39f23369a9d9bacfa530e26304231461" +
+			"b2eb05e2c39be9fcda6c19078c6a9d1b",
+	},
+}
+
+// CTRVectors are the AES-CTR vectors of NIST SP 800-38A, appendix F.5.
+var CTRVectors = []BlockModeVector{
+	{
+		Name:      "SP800-38A/F.5.1/CTR-AES128",
+		Key:       sp80038AKey128,
+		IV:        "f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		Plaintext: sp80038APlaintext,
+		Ciphertext: "874d6191b620e3261bef6864990db6ce" +
+			"9806f66b7970fdff8617187bb9fffdff" +
+			"5ae4df3edbd5d35e5b4f09020db03eab" +
+			"1e031dda2fbe03d1792170a0f3009cee",
+	},
+	{
+		Name:      "SP800-38A/F.5.3/CTR-AES192",
+		Key:       sp80038AKey192,
+		IV:        "f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		Plaintext: sp80038APlaintext,
+		Ciphertext: "1abc932417521ca24f2b0459fe7e6e0b" +
+			"090339ec0aa6faefd5ccc2c6f4ce8e94" +
+			"1e36b26bd1ebc670d1bd1d665620abf7" +
+			"4f78a7f6d29809585a97daec58c6b050",
+	},
+	{
+		Name:      "SP800-38A/F.5.5/CTR-AES256",
+		Key:       sp80038AKey256,
+		IV:        "f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		Plaintext: sp80038APlaintext,
+		Ciphertext: "601ec313775789a5b7a7f504bbf3d228" +
+			"f443e3ca4d62b59aca84e990cacaf5c5" +
+			"2b0930daa23de94ce87017ba2d84988d" +
+			"dfc9c58db67aada613c2dd08457941a6",
+	},
+}
+
+// StreamFormatVector is a known-answer test for the StreamHeader format of cipherio: Stream is
+// the whole output of NewStreamWriter, header included.
+type StreamFormatVector struct {
+	Name      string
+	Key       string // hex
+	Plaintext string // raw
+	Stream    string // hex
+}
+
+// StreamFormatVectors pin the StreamHeader format, version 1.
+var StreamFormatVectors = []StreamFormatVector{
+	{
+		Name:      "AES256-CBC-PKCS7-Commitment",
+		Key:       "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		Plaintext: "cipherio stream format test vector",
+		Stream: "43494f5354524d010042010103000000" +
+			"10000102030405060708090a0b0c0d0e" +
+			"0f000000000000002200203cfbda784c" +
+			"2e3deed1e3503cf061fe170f4c505228" +
+			"6fab09a8c61db466cd63f20013255c71" +
+			"2f99870acdaad218cc239977a22e9a78" +
+			"13f0792c63108512c12c9d02ba5779f8" +
+			"c4e982f2baf780f71cbbae3a",
+	},
+	{
+		Name:      "AES256-CBC-PKCS7-HKDF-Commitment",
+		Key:       "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		Plaintext: "cipherio stream format test vector",
+		Stream: "43494f5354524d01004a010103010473" +
+			"616c7404696e666f1000010203040506" +
+			"0708090a0b0c0d0e0f00000000000000" +
+			"22002072e45219e6defa08fa698e5340" +
+			"e9d437219a2b0d1aa9962101623cf516" +
+			"0478a7004a512c6bb5f2509f14a22789" +
+			"b1f49edbbff0496f7ce143a0aa6c17c4" +
+			"2aa7b9eab24a343a258c8b3dc97ae258" +
+			"188b6ae6",
+	},
+}
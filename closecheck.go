@@ -0,0 +1,44 @@
+package cipherio
+
+import (
+	"log"
+	"runtime"
+)
+
+// WithCloseCheck sets a finalizer on the Writer, which reports it if it is garbage collected
+// without having been closed while bytes are still buffered or a padding is still due. Since these
+// bytes are never written, forgetting Close otherwise only shows up as truncated ciphertexts. With
+// a padding, this includes a Writer dropped at a block boundary, since it was never finalized.
+//
+// The given function is called with the number of bytes accepted by Write so far and the number of
+// buffered bytes, from the finalizer goroutine: it must not block. If nil, a message is logged with
+// the standard logger instead.
+//
+// A Writer which failed or was wiped is not reported, since the error has already been returned.
+// Finalizers are not guaranteed to run, and delay the release of the Writer by one garbage
+// collection: this is meant to be enabled in tests and debug builds.
+func WithCloseCheck(fn func(accepted int64, buffered int)) WriterOption {
+	return func(o *writerOptions) {
+		o.closeCheck = true
+		o.closeCheckFn = fn
+	}
+}
+
+// setCloseCheck sets the finalizer of WithCloseCheck on the given Writer. It is cleared by
+// releaseBuf.
+func setCloseCheck(w *BlockWriter, fn func(accepted int64, buffered int)) {
+	if fn == nil {
+		fn = logUnclosed
+	}
+	w.finalizer = true
+	runtime.SetFinalizer(w, func(w *BlockWriter) {
+		if len(w.buf) > 0 || w.padding != nil {
+			fn(w.accepted, len(w.buf))
+		}
+	})
+}
+
+// logUnclosed is the default function of WithCloseCheck.
+func logUnclosed(accepted int64, buffered int) {
+	log.Printf("cipherio: BlockWriter garbage collected without Close: %d buffered bytes lost after %d accepted bytes", buffered, accepted)
+}
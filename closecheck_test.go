@@ -0,0 +1,113 @@
+package cipherio_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestCloseCheck(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	type report struct {
+		accepted int64
+		buffered int
+	}
+
+	// dropWriter writes size bytes with a checked Writer, closes it if requested, then drops it
+	// and runs the garbage collector until the finalizer reports it or the timeout expires.
+	dropWriter := func(size int, padding cipherio.Padding, close bool, timeout time.Duration, opts ...cipherio.WriterOption) (report, bool) {
+		reports := make(chan report, 1)
+		opts = append(opts, cipherio.WithCloseCheck(func(accepted int64, buffered int) {
+			reports <- report{accepted, buffered}
+		}))
+
+		func() {
+			writer := cipherio.NewBlockWriterWithPadding(ioutil.Discard, cipher.NewCBCEncrypter(aesCipher, iv), padding, opts...)
+			_, err := writer.Write(make([]byte, size))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if close {
+				err = writer.Close()
+				if err != nil {
+					t.Fatalf("unexpected err: %v != %v", err, nil)
+				}
+			}
+		}()
+
+		deadline := time.Now().Add(timeout)
+		for time.Now().Before(deadline) {
+			runtime.GC()
+			select {
+			case r := <-reports:
+				return r, true
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		return report{}, false
+	}
+
+	t.Run("Unclosed", func(t *testing.T) {
+		r, ok := dropWriter(100, cipherio.ZeroPadding, false, 5*time.Second)
+		if !ok {
+			t.Fatalf("unreported unclosed Writer")
+		}
+		if r.accepted != 100 || r.buffered != 4 {
+			t.Fatalf("unexpected report: %v != %v", r, report{100, 4})
+		}
+	})
+
+	t.Run("Buffered", func(t *testing.T) {
+		// Complete blocks stay buffered below the high-water mark.
+		r, ok := dropWriter(96, cipherio.ZeroPadding, false, 5*time.Second, cipherio.WithHighWaterMark(1024))
+		if !ok {
+			t.Fatalf("unreported unclosed Writer")
+		}
+		if r.accepted != 96 || r.buffered != 96 {
+			t.Fatalf("unexpected report: %v != %v", r, report{96, 96})
+		}
+	})
+
+	t.Run("Padded", func(t *testing.T) {
+		// Even at a block boundary, the padding due by Close is lost.
+		r, ok := dropWriter(96, cipherio.PKCS7Padding, false, 5*time.Second)
+		if !ok {
+			t.Fatalf("unreported unclosed Writer")
+		}
+		if r.accepted != 96 || r.buffered != 0 {
+			t.Fatalf("unexpected report: %v != %v", r, report{96, 0})
+		}
+	})
+
+	t.Run("Aligned", func(t *testing.T) {
+		// Nothing is lost if all blocks have already been written and no padding is due.
+		if r, ok := dropWriter(96, nil, false, 100*time.Millisecond); ok {
+			t.Fatalf("unexpected report: %v", r)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		if r, ok := dropWriter(100, cipherio.ZeroPadding, true, 100*time.Millisecond); ok {
+			t.Fatalf("unexpected report: %v", r)
+		}
+	})
+}
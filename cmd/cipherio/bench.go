@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/connesc/cipherio"
+)
+
+// paddings maps the names accepted by the -padding flags.
+var paddings = map[string]cipherio.Padding{
+	"none":  nil,
+	"zero":  cipherio.ZeroPadding,
+	"bit":   cipherio.BitPadding,
+	"pkcs7": cipherio.PKCS7Padding,
+}
+
+func runBench(e *env, args []string) error {
+	flags := newFlagSet(e, "bench", "")
+	size := flags.Int64("size", 64<<20, "number of `bytes` to encrypt")
+	keySize := flags.Int("key-size", 32, "AES key size in `bytes` (16, 24 or 32)")
+	paddingName := flags.String("padding", "pkcs7", "padding: none, zero, bit or pkcs7")
+	bufferSize := flags.Int("buffer", 32<<10, "size of each write, in `bytes`")
+	chunkSize := flags.Int("chunk", cipherio.DefaultChunkSize, "chunk size of parallel encryption, in `bytes`")
+	workers := flags.Int("workers", 0, "number of parallel workers (0 for GOMAXPROCS)")
+	dir := flags.String("dir", "", "`directory` of the temporary files of the file-to-file benchmark (default: system temporary directory)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	padding, ok := paddings[*paddingName]
+	if !ok {
+		return fmt.Errorf("unknown padding: %s", *paddingName)
+	}
+	if *size < 0 || *bufferSize <= 0 {
+		return errors.New("size and buffer must be positive")
+	}
+
+	key := make([]byte, *keySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	iv := make([]byte, block.BlockSize())
+
+	data := make([]byte, *size)
+	if _, err := rand.Read(data); err != nil {
+		return err
+	}
+
+	report := func(name string, elapsed time.Duration) {
+		rate := float64(*size) / (1 << 20) / elapsed.Seconds()
+		fmt.Fprintf(e.stdout, "%-20s %10d bytes in %-12v %10.1f MiB/s\n", name, *size, elapsed.Round(time.Microsecond), rate)
+	}
+
+	// Memory to memory, through a BlockWriter.
+	start := time.Now()
+	writer := cipherio.NewBlockWriterWithPadding(ioutil.Discard, cipher.NewCBCEncrypter(block, iv), padding)
+	for offset := int64(0); offset < *size; offset += int64(*bufferSize) {
+		end := offset + int64(*bufferSize)
+		if end > *size {
+			end = *size
+		}
+		if _, err := writer.Write(data[offset:end]); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	report("memory", time.Since(start))
+
+	// Memory to memory, in parallel with independent chunks.
+	factory := func(chunkIndex int64) (cipher.BlockMode, error) {
+		return cipher.NewCBCEncrypter(block, iv), nil
+	}
+	opts := cipherio.ParallelOptions{ChunkSize: *chunkSize, Workers: *workers, Padding: padding}
+	start = time.Now()
+	if _, err := cipherio.CopyParallel(context.Background(), ioutil.Discard, bytes.NewReader(data), factory, opts); err != nil {
+		return err
+	}
+	report("memory-parallel", time.Since(start))
+
+	// File to file.
+	tmp, err := ioutil.TempDir(*dir, "cipherio-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	srcPath := filepath.Join(tmp, "src")
+	if err := ioutil.WriteFile(srcPath, data, 0600); err != nil {
+		return err
+	}
+	start = time.Now()
+	if err := cipherio.EncryptFile(filepath.Join(tmp, "dst"), srcPath, factory, opts); err != nil {
+		return err
+	}
+	report("file-parallel", time.Since(start))
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	status, stdout, stderr := runCLI(t, nil, "bench", "-size", "100000", "-buffer", "1000", "-chunk", "16384", "-padding", "zero")
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	for _, name := range []string{"memory ", "memory-parallel", "file-parallel"} {
+		if !strings.Contains(stdout, name) {
+			t.Fatalf("missing %q benchmark: %s", name, stdout)
+		}
+	}
+
+	status, _, stderr = runCLI(t, nil, "bench", "-padding", "unknown")
+	if status != 1 || !strings.Contains(stderr, "unknown padding") {
+		t.Fatalf("unexpected result: %d: %s", status, stderr)
+	}
+}
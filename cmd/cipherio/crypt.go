@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/connesc/cipherio"
+)
+
+// paddingIDs maps the names accepted by the -padding flag of encrypt.
+var paddingIDs = map[string]cipherio.PaddingID{
+	"zero":  cipherio.PaddingZero,
+	"bit":   cipherio.PaddingBit,
+	"pkcs7": cipherio.PaddingPKCS7,
+}
+
+func runEncrypt(e *env, args []string) error {
+	flags := newFlagSet(e, "encrypt", "INPUT OUTPUT")
+	keys := addKeyFlags(flags, "key", "AES key")
+	paddingName := flags.String("padding", "pkcs7", "padding of the stream format: zero, bit or pkcs7")
+	format := flags.String("format", "stream", "output `format`, among those registered with cipherio.RegisterFormat")
+	macFile := flags.String("mac-file", "", "`file` where to write the HMAC-SHA256 tags of the chunks of the output, for verify")
+	macKeys := addKeyFlags(flags, "mac-key", "HMAC-SHA256 key")
+	macChunkSize := flags.Int64("mac-chunk-size", defaultMACChunkSize, "size of the chunks authenticated by -mac-file")
+	showProgress := flags.Bool("progress", false, "display a progress bar on stderr")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	key, err := keys.key()
+	if err != nil {
+		return err
+	}
+	padding, ok := paddingIDs[*paddingName]
+	if !ok {
+		return fmt.Errorf("unknown padding: %s", *paddingName)
+	}
+	var macKey []byte
+	if *macFile != "" {
+		if macKey, err = macKeys.key(); err != nil {
+			return err
+		}
+		if *macChunkSize <= 0 {
+			return fmt.Errorf("invalid MAC chunk size: %d", *macChunkSize)
+		}
+	}
+
+	src, closeSrc, err := openInput(e, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      padding,
+		IV:           make([]byte, 16),
+		PlaintextLen: inputSize(src),
+	}
+	if _, err := rand.Read(header.IV); err != nil {
+		return err
+	}
+	header.SetCommitment(key)
+
+	return writeOutput(e, flags.Arg(1), func(dst io.Writer) error {
+		// The MAC covers the whole output, header included.
+		var mac *chunkMAC
+		var tags [][]byte
+		if macKey != nil {
+			mac = newChunkMAC(macKey, *macChunkSize, func(index int64, last bool, tag []byte) error {
+				tags = append(tags, tag)
+				return nil
+			})
+			dst = io.MultiWriter(dst, mac)
+		}
+
+		var opts []cipherio.WriterOption
+		var bar *progressBar
+		if *showProgress {
+			bar = newProgressBar(e.stderr, header.PlaintextLen)
+			opts = append(opts, cipherio.WithWriteProgress(progressEvery, func(accepted, flushed int64) {
+				bar.update(accepted)
+			}))
+		}
+
+		var writer io.WriteCloser
+		var err error
+		if *format == "stream" {
+			writer, err = cipherio.NewStreamWriter(dst, &header, key, opts...)
+		} else {
+			writer, err = cipherio.Create(dst, *format, key, header.PlaintextLen, opts...)
+		}
+		if err != nil {
+			return err
+		}
+		copied, err := io.Copy(writer, src)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		if bar != nil {
+			bar.finish(copied)
+		}
+		if header.PlaintextLen >= 0 && copied != header.PlaintextLen {
+			return errors.New("input size changed during encryption")
+		}
+		if mac != nil {
+			mac.finish()
+			return writeMACFile(*macFile, *macChunkSize, tags)
+		}
+		return nil
+	})
+}
+
+func runDecrypt(e *env, args []string) error {
+	flags := newFlagSet(e, "decrypt", "INPUT OUTPUT")
+	keys := addKeyFlags(flags, "key", "AES key")
+	showProgress := flags.Bool("progress", false, "display a progress bar on stderr")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	key, err := keys.key()
+	if err != nil {
+		return err
+	}
+
+	src, closeSrc, err := openInput(e, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	// The plaintext length is only known once the header has been read.
+	var bar *progressBar
+	var opts []cipherio.ReaderOption
+	if *showProgress {
+		bar = newProgressBar(e.stderr, -1)
+		opts = append(opts, cipherio.WithProgress(progressEvery, func(done int64) {
+			bar.update(done)
+		}))
+	}
+	r := bufio.NewReader(src)
+	format, err := cipherio.DetectFormat(r)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if format == "stream" {
+		var header *cipherio.StreamHeader
+		reader, header, err = cipherio.NewStreamReader(r, key, opts...)
+		if err == nil && bar != nil {
+			bar.total = header.PlaintextLen
+		}
+	} else {
+		reader, _, err = cipherio.Open(r, key, opts...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(e, flags.Arg(1), func(dst io.Writer) error {
+		copied, err := io.Copy(dst, reader)
+		if err != nil {
+			return err
+		}
+		if bar != nil {
+			bar.finish(copied)
+		}
+		return nil
+	})
+}
+
+// writeOutput calls fn with the given output file, or stdout for "-". A file is created, and
+// removed if fn fails, so that no partial output is left behind.
+func writeOutput(e *env, path string, fn func(dst io.Writer) error) (err error) {
+	if path == "-" {
+		return fn(e.stdout)
+	}
+
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	return fn(dst)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cipherio-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plaintext := make([]byte, 3<<20+5)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainPath := filepath.Join(dir, "plain")
+	err = ioutil.WriteFile(plainPath, plaintext, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedPath := filepath.Join(dir, "encrypted")
+	decryptedPath := filepath.Join(dir, "decrypted")
+	macPath := filepath.Join(dir, "mac")
+	key := hex.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	macKey := hex.EncodeToString(bytes.Repeat([]byte{8}, 32))
+
+	status, _, stderr := runCLI(t, nil, "encrypt", "-key", key, "-mac-file", macPath, "-mac-key", macKey, "-progress", plainPath, encryptedPath)
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	if !strings.Contains(stderr, "100%") {
+		t.Fatalf("missing progress: %q", stderr)
+	}
+
+	status, stdout, stderr := runCLI(t, nil, "verify", "-key", key, "-mac-file", macPath, "-mac-key", macKey, "-progress", encryptedPath)
+	if status != 0 || !strings.Contains(stdout, "OK") {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	if !strings.Contains(stderr, "100%") {
+		t.Fatalf("missing progress: %q", stderr)
+	}
+
+	status, _, stderr = runCLI(t, nil, "decrypt", "-key", key, "-progress", encryptedPath, decryptedPath)
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	if !strings.Contains(stderr, "100%") {
+		t.Fatalf("missing progress: %q", stderr)
+	}
+	decrypted, err := ioutil.ReadFile(decryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatal("decrypted data does not match plaintext")
+	}
+
+	// A failure must not leave any partial output.
+	wrongKey := strings.Repeat("00", 32)
+	status, _, _ = runCLI(t, nil, "decrypt", "-key", wrongKey, encryptedPath, filepath.Join(dir, "wrong"))
+	if status != 1 {
+		t.Fatalf("unexpected status: %d != %d", status, 1)
+	}
+	_, err = os.Stat(filepath.Join(dir, "wrong"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// Streams from stdin to stdout have an unknown length.
+	status, stdout, stderr = runCLI(t, []byte("hello"), "encrypt", "-key", key, "-", "-")
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	status, stdout, stderr = runCLI(t, []byte(stdout), "decrypt", "-key", key, "-", "-")
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	if !strings.HasPrefix(stdout, "hello") {
+		t.Fatalf("unexpected plaintext: %q", stdout)
+	}
+}
+
+func TestEncryptUnknownFormat(t *testing.T) {
+	key := hex.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	status, _, stderr := runCLI(t, []byte("data"), "encrypt", "-key", key, "-format", "garbage", "-", "-")
+	if status != 1 || !strings.Contains(stderr, "unknown format") {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+}
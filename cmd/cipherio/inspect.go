@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"unicode"
+
+	"github.com/connesc/cipherio"
+)
+
+var modeNames = map[cipherio.ModeID]string{
+	cipherio.ModeCBC: "CBC",
+}
+
+var paddingNames = map[cipherio.PaddingID]string{
+	cipherio.PaddingNone:  "none",
+	cipherio.PaddingZero:  "zero",
+	cipherio.PaddingBit:   "bit",
+	cipherio.PaddingPKCS7: "PKCS#7",
+}
+
+var kdfNames = map[cipherio.KDFID]string{
+	cipherio.KDFNone:       "none",
+	cipherio.KDFHKDFSHA256: "HKDF-SHA256",
+}
+
+// multipartManifestPrefix starts every encoded MultipartManifest, before its version.
+var multipartManifestPrefix = []byte("CIOMPRT")
+
+func runInspect(e *env, args []string) error {
+	flags := newFlagSet(e, "inspect", "FILE")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	src, closeSrc, err := openInput(e, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	r := bufio.NewReader(src)
+	if prefix, _ := r.Peek(len(multipartManifestPrefix)); bytes.Equal(prefix, multipartManifestPrefix) {
+		return inspectManifest(e, r)
+	}
+	return inspectStream(e, r)
+}
+
+// openInput opens the given file, or stdin for "-".
+func openInput(e *env, path string) (io.Reader, func() error, error) {
+	if path == "-" {
+		return e.stdin, func() error { return nil }, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file.Close, nil
+}
+
+func inspectStream(e *env, r io.Reader) error {
+	counter := &countingReader{src: r}
+	header, err := cipherio.ReadStreamHeader(counter)
+	if err != nil {
+		return err
+	}
+	headerLen := counter.read
+	bodyLen, err := io.Copy(ioutil.Discard, counter)
+	if err != nil {
+		return err
+	}
+
+	w := e.stdout
+	fmt.Fprintf(w, "format:       stream header v%d\n", cipherio.StreamHeaderVersion)
+	fmt.Fprintf(w, "cipher:       %v\n", header.Cipher)
+	fmt.Fprintf(w, "mode:         %s\n", idName(modeNames[header.Mode], uint8(header.Mode)))
+	fmt.Fprintf(w, "padding:      %s\n", idName(paddingNames[header.Padding], uint8(header.Padding)))
+	fmt.Fprintf(w, "kdf:          %s\n", idName(kdfNames[header.KDF.ID], uint8(header.KDF.ID)))
+	if header.KDF.ID != cipherio.KDFNone {
+		fmt.Fprintf(w, "kdf salt:     %s\n", hexOrNone(header.KDF.Salt))
+		fmt.Fprintf(w, "kdf info:     %s\n", hexOrNone(header.KDF.Info))
+	}
+	fmt.Fprintf(w, "iv:           %s\n", hexOrNone(header.IV))
+	if header.PlaintextLen < 0 {
+		fmt.Fprintf(w, "plaintext:    unknown length\n")
+	} else {
+		fmt.Fprintf(w, "plaintext:    %d bytes\n", header.PlaintextLen)
+	}
+	fmt.Fprintf(w, "commitment:   %s\n", hexOrNone(header.Commitment))
+	if len(header.Recipients) > 0 {
+		if header.Threshold > 0 {
+			fmt.Fprintf(w, "recipients:   %d (threshold %d)\n", len(header.Recipients), header.Threshold)
+		} else {
+			fmt.Fprintf(w, "recipients:   %d\n", len(header.Recipients))
+		}
+		for _, slot := range header.Recipients {
+			fmt.Fprintf(w, "  key ID %s: %d-byte wrapped key\n", keyIDString(slot.KeyID), len(slot.WrappedKey))
+		}
+	}
+	fmt.Fprintf(w, "header:       %d bytes\n", headerLen)
+	fmt.Fprintf(w, "body:         %d bytes\n", bodyLen)
+	return nil
+}
+
+func inspectManifest(e *env, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var manifest cipherio.MultipartManifest
+	if err := manifest.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	w := e.stdout
+	fmt.Fprintf(w, "format:       multipart manifest\n")
+	fmt.Fprintf(w, "plaintext:    %d bytes\n", manifest.Size)
+	fmt.Fprintf(w, "part size:    %d bytes\n", manifest.PartSize)
+	fmt.Fprintf(w, "parts:        %d\n", len(manifest.PartSizes))
+	for i, size := range manifest.PartSizes {
+		fmt.Fprintf(w, "  part %d: %d bytes\n", i, size)
+	}
+	return nil
+}
+
+// idName returns the given name, or a placeholder with the numeric ID if unknown.
+func idName(name string, id uint8) string {
+	if name == "" {
+		return fmt.Sprintf("unknown (%d)", id)
+	}
+	return name
+}
+
+func hexOrNone(b []byte) string {
+	if len(b) == 0 {
+		return "none"
+	}
+	return hex.EncodeToString(b)
+}
+
+// keyIDString returns the key ID quoted if printable, or in hexadecimal otherwise.
+func keyIDString(keyID []byte) string {
+	for _, r := range string(keyID) {
+		if !unicode.IsPrint(r) {
+			return hex.EncodeToString(keyID)
+		}
+	}
+	return fmt.Sprintf("%q", keyID)
+}
+
+// countingReader counts the bytes read from src.
+type countingReader struct {
+	src  io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.read += int64(n)
+	return n, err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestInspectStream(t *testing.T) {
+	key := make([]byte, 32)
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		KDF:          cipherio.KDFParams{ID: cipherio.KDFHKDFSHA256, Salt: []byte{1, 2, 3}},
+		IV:           make([]byte, 16),
+		PlaintextLen: 20,
+	}
+	header.SetCommitment(key)
+
+	var stream bytes.Buffer
+	writer, err := cipherio.NewStreamWriter(&stream, &header, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(make([]byte, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, stdout, stderr := runCLI(t, stream.Bytes(), "inspect", "-")
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	for _, expected := range []string{
+		"cipher:       AES\n",
+		"mode:         CBC\n",
+		"padding:      PKCS#7\n",
+		"kdf:          HKDF-SHA256\n",
+		"kdf salt:     010203\n",
+		"plaintext:    20 bytes\n",
+		"body:         32 bytes\n",
+	} {
+		if !strings.Contains(stdout, expected) {
+			t.Fatalf("missing %q in output:\n%s", expected, stdout)
+		}
+	}
+	if strings.Contains(stdout, "commitment:   none") {
+		t.Fatalf("missing commitment in output:\n%s", stdout)
+	}
+}
+
+func TestInspectManifest(t *testing.T) {
+	manifest := cipherio.MultipartManifest{PartSize: 64, Size: 100, PartSizes: []int64{64, 48}}
+	data, err := manifest.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, stdout, stderr := runCLI(t, data, "inspect", "-")
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	for _, expected := range []string{"multipart manifest", "parts:        2\n", "part 1: 48 bytes\n"} {
+		if !strings.Contains(stdout, expected) {
+			t.Fatalf("missing %q in output:\n%s", expected, stdout)
+		}
+	}
+
+	status, _, _ = runCLI(t, []byte("garbage"), "inspect", "-")
+	if status != 1 {
+		t.Fatalf("unexpected status: %d != %d", status, 1)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"strings"
+)
+
+// keyFlags registers the flags selecting a key, given either in hexadecimal or in a file holding
+// it in hexadecimal, as written by the keygen command.
+type keyFlags struct {
+	hex  *string
+	file *string
+}
+
+func addKeyFlags(flags *flag.FlagSet, name, usage string) keyFlags {
+	return keyFlags{
+		hex:  flags.String(name, "", usage+", in hexadecimal"),
+		file: flags.String(name+"-file", "", "`file` holding the "+usage+" in hexadecimal"),
+	}
+}
+
+// key returns the selected key, or an error if none or both flags are set.
+func (k keyFlags) key() ([]byte, error) {
+	encoded := *k.hex
+	switch {
+	case encoded != "" && *k.file != "":
+		return nil, errors.New("a key must be given either inline or in a file, not both")
+	case *k.file != "":
+		data, err := ioutil.ReadFile(*k.file)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	case encoded == "":
+		return nil, errors.New("missing key")
+	}
+	return hex.DecodeString(strings.TrimSpace(encoded))
+}
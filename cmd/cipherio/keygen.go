@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/connesc/cipherio"
+)
+
+func runKeygen(e *env, args []string) error {
+	flags := newFlagSet(e, "keygen", "")
+	size := flags.Int("size", 32, "key size in `bytes`")
+	output := flags.String("o", "-", "output `file`, created with restricted permissions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	if *size <= 0 {
+		return fmt.Errorf("invalid key size: %d", *size)
+	}
+
+	key := make([]byte, *size)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	return writeOutput(e, *output, func(dst io.Writer) error {
+		_, err := fmt.Fprintln(dst, hex.EncodeToString(key))
+		return err
+	})
+}
+
+func runWrapKey(e *env, args []string) error {
+	flags := newFlagSet(e, "wrapkey", "")
+	keks := addKeyFlags(flags, "kek", "key encryption key")
+	keys := addKeyFlags(flags, "key", "data key to wrap")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	wrapper, err := newKeyWrapper(keks)
+	if err != nil {
+		return err
+	}
+	key, err := keys.key()
+	if err != nil {
+		return err
+	}
+	wrapped, err := wrapper.Wrap(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.stdout, hex.EncodeToString(wrapped))
+	return err
+}
+
+func runUnwrapKey(e *env, args []string) error {
+	flags := newFlagSet(e, "unwrapkey", "WRAPPED")
+	keks := addKeyFlags(flags, "kek", "key encryption key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	wrapper, err := newKeyWrapper(keks)
+	if err != nil {
+		return err
+	}
+	wrapped, err := hex.DecodeString(strings.TrimSpace(flags.Arg(0)))
+	if err != nil {
+		return err
+	}
+	key, err := wrapper.Unwrap(context.Background(), wrapped)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.stdout, hex.EncodeToString(key))
+	return err
+}
+
+// newKeyWrapper returns an AES key wrapper (RFC 3394) for the selected KEK.
+func newKeyWrapper(keks keyFlags) (*cipherio.AESKeyWrapper, error) {
+	kek, err := keks.key()
+	if err != nil {
+		return nil, err
+	}
+	return cipherio.NewAESKeyWrapper(kek)
+}
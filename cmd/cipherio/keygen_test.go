@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestKeygenWrapUnwrap(t *testing.T) {
+	status, stdout, stderr := runCLI(t, nil, "keygen", "-size", "32")
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	dataKey := strings.TrimSpace(stdout)
+	if decoded, err := hex.DecodeString(dataKey); err != nil || len(decoded) != 32 {
+		t.Fatalf("unexpected key: %q", dataKey)
+	}
+
+	status, stdout, stderr = runCLI(t, nil, "keygen", "-size", "16")
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	kek := strings.TrimSpace(stdout)
+
+	status, stdout, stderr = runCLI(t, nil, "wrapkey", "-kek", kek, "-key", dataKey)
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	wrapped := strings.TrimSpace(stdout)
+	if len(wrapped) != 2*40 {
+		t.Fatalf("unexpected wrapped key: %q", wrapped)
+	}
+
+	status, stdout, stderr = runCLI(t, nil, "unwrapkey", "-kek", kek, wrapped)
+	if status != 0 {
+		t.Fatalf("unexpected status: %d: %s", status, stderr)
+	}
+	if unwrapped := strings.TrimSpace(stdout); unwrapped != dataKey {
+		t.Fatalf("unexpected unwrapped key: %s != %s", unwrapped, dataKey)
+	}
+
+	otherKEK := strings.Repeat("00", 16)
+	status, _, _ = runCLI(t, nil, "unwrapkey", "-kek", otherKEK, wrapped)
+	if status != 1 {
+		t.Fatalf("unexpected status: %d != %d", status, 1)
+	}
+}
+
+func TestKeygenInvalidSize(t *testing.T) {
+	status, _, _ := runCLI(t, nil, "keygen", "-size", "0")
+	if status != 1 {
+		t.Fatalf("unexpected status: %d != %d", status, 1)
+	}
+}
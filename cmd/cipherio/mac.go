@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultMACChunkSize is the default size of the chunks authenticated by a MAC file.
+const defaultMACChunkSize = 1 << 20
+
+// chunkMAC computes an HMAC-SHA256 tag for each chunk of an encrypted file, header included, so
+// that a corrupted chunk can be located. The tag of a chunk covers its index, its bytes, and
+// whether it is the last one, so that chunks can be neither reordered nor dropped.
+type chunkMAC struct {
+	chunkSize int64
+	mac       hash.Hash
+	index     int64 // index of the current chunk
+	size      int64 // number of bytes of the current chunk so far
+	onTag     func(index int64, last bool, tag []byte) error
+}
+
+func newChunkMAC(key []byte, chunkSize int64, onTag func(index int64, last bool, tag []byte) error) *chunkMAC {
+	m := &chunkMAC{
+		chunkSize: chunkSize,
+		mac:       hmac.New(sha256.New, key),
+		onTag:     onTag,
+	}
+	m.reset()
+	return m
+}
+
+func (m *chunkMAC) reset() {
+	m.mac.Reset()
+	binary.Write(m.mac, binary.BigEndian, m.index)
+	m.size = 0
+}
+
+// Write adds bytes to the current chunk. A complete chunk is only tagged once more bytes follow,
+// since it may otherwise be the last one.
+func (m *chunkMAC) Write(p []byte) (int, error) {
+	count := 0
+	for len(p) > 0 {
+		if m.size == m.chunkSize {
+			if err := m.tag(false); err != nil {
+				return count, err
+			}
+		}
+		n := len(p)
+		if remaining := m.chunkSize - m.size; int64(n) > remaining {
+			n = int(remaining)
+		}
+		m.mac.Write(p[:n])
+		m.size += int64(n)
+		p = p[n:]
+		count += n
+	}
+	return count, nil
+}
+
+// finish tags the last chunk, which may be empty.
+func (m *chunkMAC) finish() error {
+	return m.tag(true)
+}
+
+func (m *chunkMAC) tag(last bool) error {
+	flag := byte(0)
+	if last {
+		flag = 1
+	}
+	m.mac.Write([]byte{flag})
+	if err := m.onTag(m.index, last, m.mac.Sum(nil)); err != nil {
+		return err
+	}
+	m.index++
+	m.reset()
+	return nil
+}
+
+// chunkError reports the chunk of an encrypted file which failed authentication.
+type chunkError struct {
+	index     int64
+	chunkSize int64
+	reason    string
+}
+
+func (e chunkError) Error() string {
+	start := e.index * e.chunkSize
+	return fmt.Sprintf("chunk %d (from byte %d to %d) %s", e.index, start, start+e.chunkSize-1, e.reason)
+}
+
+// newChunkVerifier returns a chunkMAC checking the tags of a MAC file. Any mismatch is reported as
+// a chunkError.
+func newChunkVerifier(key []byte, chunkSize int64, tags [][]byte) *chunkMAC {
+	return newChunkMAC(key, chunkSize, func(index int64, last bool, tag []byte) error {
+		switch {
+		case index >= int64(len(tags)):
+			return chunkError{index, chunkSize, "is beyond the end of the authenticated file"}
+		case last && index < int64(len(tags))-1:
+			return chunkError{index, chunkSize, "is the last one, but the file is truncated"}
+		case !last && index == int64(len(tags))-1:
+			return chunkError{index, chunkSize, "is followed by data beyond the end of the authenticated file"}
+		case !hmac.Equal(tag, tags[index]):
+			return chunkError{index, chunkSize, "is corrupted"}
+		}
+		return nil
+	})
+}
+
+// writeMACFile writes the chunk size, then one tag per line, in hexadecimal.
+func writeMACFile(path string, chunkSize int64, tags [][]byte) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d\n", chunkSize)
+	for _, tag := range tags {
+		fmt.Fprintf(&b, "%x\n", tag)
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0600)
+}
+
+// readMACFile reads a file written by writeMACFile.
+func readMACFile(path string) (int64, [][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	invalid := errors.New("invalid MAC file")
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return 0, nil, invalid
+	}
+	chunkSize, err := strconv.ParseInt(scanner.Text(), 10, 64)
+	if err != nil || chunkSize <= 0 {
+		return 0, nil, invalid
+	}
+	var tags [][]byte
+	for scanner.Scan() {
+		tag, err := hex.DecodeString(scanner.Text())
+		if err != nil || len(tag) != sha256.Size {
+			return 0, nil, invalid
+		}
+		tags = append(tags, tag)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, nil, err
+	}
+	if len(tags) == 0 {
+		return 0, nil, invalid
+	}
+	return chunkSize, tags, nil
+}
+
+// drain feeds the rest of r to its tee, so that all bytes are authenticated.
+func drain(r io.Reader) error {
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
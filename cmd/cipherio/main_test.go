@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runCLI runs the command line with the given stdin, and returns its exit status and outputs.
+func runCLI(t *testing.T, stdin []byte, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	status := run(args, &env{bytes.NewReader(stdin), &stdout, &stderr})
+	return status, stdout.String(), stderr.String()
+}
+
+func TestUsage(t *testing.T) {
+	status, _, stderr := runCLI(t, nil)
+	if status != 2 {
+		t.Fatalf("unexpected status: %d != %d", status, 2)
+	}
+	if !strings.Contains(stderr, "bench") {
+		t.Fatalf("commands are not listed: %s", stderr)
+	}
+
+	status, _, stderr = runCLI(t, nil, "unknown")
+	if status != 2 {
+		t.Fatalf("unexpected status: %d != %d", status, 2)
+	}
+	if !strings.Contains(stderr, `unknown command "unknown"`) {
+		t.Fatalf("unexpected error: %s", stderr)
+	}
+}
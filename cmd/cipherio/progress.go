@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressInterval is the minimum delay between two refreshes of a progress bar.
+const progressInterval = 100 * time.Millisecond
+
+// progressEvery is the number of bytes between two progress callbacks of the library.
+const progressEvery = 1 << 20
+
+// progressBar displays the progress of an operation on a single line, like pv: a bar if the total
+// is known, the amount of data processed and the throughput.
+type progressBar struct {
+	w     io.Writer
+	total int64 // -1 if unknown
+	now   func() time.Time
+	start time.Time
+	last  time.Time
+}
+
+func newProgressBar(w io.Writer, total int64) *progressBar {
+	now := time.Now()
+	return &progressBar{w: w, total: total, now: time.Now, start: now, last: now}
+}
+
+// update refreshes the display, at most once every progressInterval.
+func (p *progressBar) update(done int64) {
+	now := p.now()
+	if now.Sub(p.last) < progressInterval {
+		return
+	}
+	p.last = now
+	p.draw(done, now)
+}
+
+// finish draws the final state, then ends the line.
+func (p *progressBar) finish(done int64) {
+	p.draw(done, p.now())
+	fmt.Fprintln(p.w)
+}
+
+func (p *progressBar) draw(done int64, now time.Time) {
+	var rate float64
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(done) / elapsed
+	}
+
+	if p.total < 0 {
+		fmt.Fprintf(p.w, "\r%s %s/s", formatBytes(float64(done)), formatBytes(rate))
+		return
+	}
+
+	const width = 30
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = float64(done) / float64(p.total)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * width)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	fmt.Fprintf(p.w, "\r[%s] %3.0f%% %s / %s %s/s", bar, 100*ratio, formatBytes(float64(done)), formatBytes(float64(p.total)), formatBytes(rate))
+}
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for n >= 1024 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[unit])
+}
+
+// inputSize returns the size of the given input if it is a regular file, or -1.
+func inputSize(src io.Reader) int64 {
+	file, ok := src.(*os.File)
+	if !ok {
+		return -1
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return -1
+	}
+	return info.Size()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressBar(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Unix(0, 0)
+	bar := newProgressBar(&out, 4<<20)
+	bar.now = func() time.Time { return now }
+	bar.start, bar.last = now, now
+
+	// Updates are throttled.
+	bar.update(1 << 20)
+	if out.Len() != 0 {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+
+	now = now.Add(time.Second)
+	bar.update(2 << 20)
+	if !strings.Contains(out.String(), " 50% 2.0 MiB / 4.0 MiB 2.0 MiB/s") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+
+	now = now.Add(time.Second)
+	bar.finish(4 << 20)
+	if !strings.HasSuffix(out.String(), "[==============================] 100% 4.0 MiB / 4.0 MiB 2.0 MiB/s\n") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+
+	out.Reset()
+	bar = newProgressBar(&out, -1)
+	bar.finish(100)
+	if !strings.HasPrefix(out.String(), "\r100 B ") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/connesc/cipherio"
+)
+
+func runVerify(e *env, args []string) error {
+	flags := newFlagSet(e, "verify", "FILE")
+	keys := addKeyFlags(flags, "key", "key of the stream")
+	macFile := flags.String("mac-file", "", "`file` holding the HMAC-SHA256 tags of the chunks of the file, as written by encrypt")
+	macKeys := addKeyFlags(flags, "mac-key", "HMAC-SHA256 key")
+	unauthenticated := flags.Bool("unauthenticated", false, "only check the format and length of the stream, without -mac-file")
+	showProgress := flags.Bool("progress", false, "display a progress bar on stderr")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	key, err := keys.key()
+	if err != nil {
+		return err
+	}
+	// Without a MAC, a tampered stream of valid length decrypts without error.
+	if *macFile == "" && !*unauthenticated {
+		return errors.New("nothing to authenticate: use -mac-file and -mac-key, or -unauthenticated to only check the format")
+	}
+	var verifier *chunkMAC
+	if *macFile != "" {
+		chunkSize, tags, err := readMACFile(*macFile)
+		if err != nil {
+			return err
+		}
+		macKey, err := macKeys.key()
+		if err != nil {
+			return err
+		}
+		verifier = newChunkVerifier(macKey, chunkSize, tags)
+	}
+
+	src, closeSrc, err := openInput(e, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	// The MAC covers the whole file, header included.
+	if verifier != nil {
+		src = io.TeeReader(src, verifier)
+	}
+
+	// Read the header first, to know the length of the plaintext.
+	header, err := cipherio.ReadStreamHeader(src)
+	if err != nil {
+		return verificationError(err)
+	}
+	headerData, err := header.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	var bar *progressBar
+	var opts []cipherio.ReaderOption
+	if *showProgress {
+		bar = newProgressBar(e.stderr, header.PlaintextLen)
+		opts = append(opts, cipherio.WithProgress(progressEvery, func(done int64) {
+			bar.update(done)
+		}))
+	}
+
+	// The key commitment, if any, is checked before any decryption. The plaintext is discarded.
+	reader, _, err := cipherio.NewStreamReader(io.MultiReader(bytes.NewReader(headerData), src), key, opts...)
+	if err != nil {
+		return verificationError(err)
+	}
+	verified, err := io.Copy(ioutil.Discard, reader)
+	if bar != nil {
+		bar.finish(verified)
+	}
+	if verifier != nil {
+		// Authentication errors take precedence, since they locate the corruption.
+		if drainErr := drain(src); drainErr != nil && err == nil {
+			err = drainErr
+		}
+		var chunkErr chunkError
+		if errors.As(err, &chunkErr) {
+			return verificationError(chunkErr)
+		}
+		if finishErr := verifier.finish(); finishErr != nil {
+			return verificationError(finishErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("verification failed after %d plaintext bytes: %v", verified, err)
+	}
+
+	if verifier == nil {
+		fmt.Fprintln(e.stderr, "warning: the stream is not authenticated, only its format and length have been checked")
+		fmt.Fprintf(e.stdout, "OK: %d plaintext bytes decrypted\n", verified)
+		return nil
+	}
+	fmt.Fprintf(e.stdout, "OK: %d plaintext bytes verified\n", verified)
+	return nil
+}
+
+func verificationError(err error) error {
+	return fmt.Errorf("verification failed: %v", err)
+}
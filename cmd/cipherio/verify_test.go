@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestVerify(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	macKey := bytes.Repeat([]byte{2}, 32)
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           make([]byte, 16),
+		PlaintextLen: 1000,
+	}
+	header.SetCommitment(key)
+
+	var stream bytes.Buffer
+	writer, err := cipherio.NewStreamWriter(&stream, &header, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "cipherio-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	err = ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(key)+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyHex := hex.EncodeToString(key)
+	macKeyHex := hex.EncodeToString(macKey)
+
+	// Authenticate the stream in chunks of 256 bytes.
+	writeMAC := func(name string, data []byte) string {
+		var tags [][]byte
+		mac := newChunkMAC(macKey, 256, func(index int64, last bool, tag []byte) error {
+			tags = append(tags, tag)
+			return nil
+		})
+		mac.Write(data)
+		mac.finish()
+		path := filepath.Join(dir, name)
+		if err := writeMACFile(path, 256, tags); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	macFile := writeMAC("mac", stream.Bytes())
+	macArgs := []string{"-key", keyHex, "-mac-file", macFile, "-mac-key", macKeyHex}
+
+	// Data appended to an authenticated prefix ending at a chunk boundary.
+	prefixMACFile := writeMAC("prefix.mac", stream.Bytes()[:512])
+	prefixMACArgs := []string{"-key", keyHex, "-mac-file", prefixMACFile, "-mac-key", macKeyHex}
+
+	corrupted := append([]byte(nil), stream.Bytes()...)
+	corrupted[600] ^= 1
+
+	testCases := []struct {
+		name     string
+		stream   []byte
+		args     []string
+		status   int
+		expected string
+	}{
+		{"Valid", stream.Bytes(), macArgs, 0, "OK: 1000 plaintext bytes verified"},
+		{"Unauthenticated", stream.Bytes(), []string{"-key-file", keyFile}, 1, "nothing to authenticate"},
+		{"UnauthenticatedAllowed", stream.Bytes(), []string{"-key-file", keyFile, "-unauthenticated"}, 0, "warning: the stream is not authenticated"},
+		{"WrongKey", stream.Bytes(), []string{"-key", strings.Repeat("00", 32), "-unauthenticated"}, 1, "key does not match commitment"},
+		{"Truncated", stream.Bytes()[:stream.Len()-16], []string{"-key", keyHex, "-unauthenticated"}, 1, "verification failed after"},
+		{"Corrupted", corrupted, macArgs, 1, "chunk 2 (from byte 512 to 767) is corrupted"},
+		{"TruncatedMAC", stream.Bytes()[:512], macArgs, 1, "chunk 1 (from byte 256 to 511) is the last one, but the file is truncated"},
+		{"Extended", stream.Bytes(), prefixMACArgs, 1, "chunk 1 (from byte 256 to 511) is followed by data beyond the end of the authenticated file"},
+		{"WrongMACKey", stream.Bytes(), []string{"-key", keyHex, "-mac-file", macFile, "-mac-key", keyHex}, 1, "chunk 0 (from byte 0 to 255) is corrupted"},
+		{"MissingKey", stream.Bytes(), nil, 1, "missing key"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			args := append(append([]string{"verify"}, testCase.args...), "-")
+			status, stdout, stderr := runCLI(t, testCase.stream, args...)
+			if status != testCase.status {
+				t.Fatalf("unexpected status: %d != %d: %s", status, testCase.status, stderr)
+			}
+			if !strings.Contains(stdout+stderr, testCase.expected) {
+				t.Fatalf("missing %q in output: %s%s", testCase.expected, stdout, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrKeyCommitment is returned when a key does not match the commitment of a StreamHeader.
+var ErrKeyCommitment = errors.New("cipherio: key does not match commitment")
+
+// ErrMissingCommitment is returned when a commitment is required but the StreamHeader has none.
+var ErrMissingCommitment = errors.New("cipherio: stream header has no key commitment")
+
+// commitmentInfo is the HKDF info used to derive key commitments.
+var commitmentInfo = []byte("cipherio key commitment")
+
+// commitmentSize is the length of key commitments, in bytes.
+const commitmentSize = 32
+
+// SetCommitment stores in the header a commitment to the given key, which must then be passed to
+// NewStreamWriter or NewEnvelopeWriter. The commitment is an HMAC-SHA256 of the header fields
+// describing the encryption, keyed with a key derived from the given key with HKDF-SHA256, using
+// the KDF salt of the header. It must therefore be set once these fields are final.
+//
+// Without a commitment, a ciphertext can be crafted to decrypt to valid data under several keys.
+// This matters when the key is selected by an attacker, for example among the slots of an
+// envelope or from a Keyring. With a commitment, decryption with any other key fails with
+// ErrKeyCommitment before reading any data.
+//
+// The commitment also authenticates the Cipher, Mode, Padding, KDF, IV and PlaintextLen of the
+// header, which cannot be altered without the key either. Recipients and Threshold are not
+// covered, so that an envelope can be rewrapped: a forged slot yields another data key, which is
+// rejected anyway. The body is not authenticated: a modified ciphertext still decrypts to
+// modified plaintext, unless the stream is checked by other means, such as a MAC.
+func (h *StreamHeader) SetCommitment(key []byte) {
+	h.Commitment = h.commitment(key)
+}
+
+// VerifyCommitment returns ErrKeyCommitment if the header holds a commitment that does not match
+// the given key. It returns nil if there is no commitment.
+func (h *StreamHeader) VerifyCommitment(key []byte) error {
+	if len(h.Commitment) == 0 {
+		return nil
+	}
+	if !EqualTags(h.Commitment, h.commitment(key)) {
+		return ErrKeyCommitment
+	}
+	return nil
+}
+
+// WithRequireCommitment makes NewStreamReader fail with ErrMissingCommitment if the header has no
+// commitment. Otherwise, a commitment can simply be stripped from the header, which defeats its
+// purpose.
+//
+// The envelope readers, such as NewEnvelopeReader and NewEnvelopeReaderWithKeyring, and
+// NewStreamReadSeekCloser always require a commitment.
+func WithRequireCommitment() ReaderOption {
+	return func(o *readerOptions) {
+		o.requireCommitment = true
+	}
+}
+
+// withRequiredCommitment returns the given options followed by WithRequireCommitment.
+func withRequiredCommitment(opts []ReaderOption) []ReaderOption {
+	return append(opts[:len(opts):len(opts)], WithRequireCommitment())
+}
+
+// checkCommitment is similar to VerifyCommitment, except that ErrMissingCommitment is returned if
+// the header has no commitment and one is required.
+func (h *StreamHeader) checkCommitment(key []byte, required bool) error {
+	if required && len(h.Commitment) == 0 {
+		return ErrMissingCommitment
+	}
+	return h.VerifyCommitment(key)
+}
+
+func (h *StreamHeader) commitment(key []byte) []byte {
+	mac := hmac.New(sha256.New, hkdf(key, h.KDF.Salt, commitmentInfo, commitmentSize))
+	mac.Write(h.committedFields())
+	return mac.Sum(nil)
+}
+
+// committedFields encodes the header fields covered by the commitment, like MarshalBinary.
+func (h *StreamHeader) committedFields() []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{byte(h.Cipher), byte(h.Mode), byte(h.Padding), byte(h.KDF.ID)})
+	for _, field := range [][]byte{h.KDF.Salt, h.KDF.Info, h.IV} {
+		binary.Write(&buf, binary.BigEndian, uint16(len(field)))
+		buf.Write(field)
+	}
+	binary.Write(&buf, binary.BigEndian, h.PlaintextLen)
+	return buf.Bytes()
+}
@@ -0,0 +1,199 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestKeyCommitment(t *testing.T) {
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	key := randomBytes(32)
+	plaintext := randomBytes(100)
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		KDF:          cipherio.KDFParams{ID: cipherio.KDFHKDFSHA256, Salt: randomBytes(16)},
+		IV:           randomBytes(aes.BlockSize),
+		PlaintextLen: int64(len(plaintext)),
+	}
+	header.SetCommitment(key)
+
+	var stream bytes.Buffer
+	writer, err := cipherio.NewStreamWriter(&stream, &header, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("RightKey", func(t *testing.T) {
+		reader, decoded, err := cipherio.NewStreamReader(bytes.NewReader(stream.Bytes()), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.Commitment, header.Commitment) || len(decoded.Commitment) != 32 {
+			t.Fatalf("unexpected commitment: %x != %x", decoded.Commitment, header.Commitment)
+		}
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatalf("unexpected decrypted bytes")
+		}
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		_, _, err := cipherio.NewStreamReader(bytes.NewReader(stream.Bytes()), randomBytes(32))
+		if err != cipherio.ErrKeyCommitment {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrKeyCommitment)
+		}
+	})
+
+	t.Run("ForgedHeader", func(t *testing.T) {
+		// The fields describing the encryption cannot be altered without the key.
+		for name, forge := range map[string]func(h *cipherio.StreamHeader){
+			"IV":           func(h *cipherio.StreamHeader) { h.IV[0] ^= 1 },
+			"PlaintextLen": func(h *cipherio.StreamHeader) { h.PlaintextLen-- },
+			"Padding":      func(h *cipherio.StreamHeader) { h.Padding = cipherio.PaddingNone },
+			"KDF":          func(h *cipherio.StreamHeader) { h.KDF.Info = []byte("forged") },
+		} {
+			t.Run(name, func(t *testing.T) {
+				forged, err := cipherio.ReadStreamHeader(bytes.NewReader(stream.Bytes()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				original, err := forged.MarshalBinary()
+				if err != nil {
+					t.Fatal(err)
+				}
+				forge(forged)
+				data, err := forged.MarshalBinary()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data = append(data, stream.Bytes()[len(original):]...)
+
+				_, _, err = cipherio.NewStreamReader(bytes.NewReader(data), key)
+				if err != cipherio.ErrKeyCommitment {
+					t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrKeyCommitment)
+				}
+			})
+		}
+	})
+
+	t.Run("StrippedCommitment", func(t *testing.T) {
+		stripped, err := cipherio.ReadStreamHeader(bytes.NewReader(stream.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		original, err := stripped.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stripped.Commitment = nil
+		data, err := stripped.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, stream.Bytes()[len(original):]...)
+
+		// A commitment is only required on demand.
+		_, _, err = cipherio.NewStreamReader(bytes.NewReader(data), key)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		_, _, err = cipherio.NewStreamReader(bytes.NewReader(data), key, cipherio.WithRequireCommitment())
+		if err != cipherio.ErrMissingCommitment {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrMissingCommitment)
+		}
+	})
+
+	t.Run("StaleCommitment", func(t *testing.T) {
+		_, err := cipherio.NewStreamWriter(ioutil.Discard, &header, randomBytes(32))
+		if err != cipherio.ErrKeyCommitment {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrKeyCommitment)
+		}
+	})
+
+	t.Run("Envelope", func(t *testing.T) {
+		dataKey := randomBytes(32)
+		kek := randomBytes(32)
+
+		envelopeHeader := header
+		envelopeHeader.SetCommitment(dataKey)
+
+		var envelope bytes.Buffer
+		writer, err := cipherio.NewEnvelopeWriter(&envelope, &envelopeHeader, dataKey, []cipherio.Recipient{
+			{KeyID: []byte("kek"), KEK: kek},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = cipherio.NewEnvelopeReaderWithKeyring(bytes.NewReader(envelope.Bytes()), cipherio.MapKeyring{"kek": kek})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Envelopes always require a commitment.
+		stripped, err := cipherio.ReadStreamHeader(bytes.NewReader(envelope.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		original, err := stripped.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stripped.Commitment = nil
+		data, err := stripped.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, envelope.Bytes()[len(original):]...)
+		_, _, err = cipherio.NewEnvelopeReaderWithKeyring(bytes.NewReader(data), cipherio.MapKeyring{"kek": kek})
+		if err != cipherio.ErrMissingCommitment {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrMissingCommitment)
+		}
+		_, _, err = cipherio.NewEnvelopeReader(bytes.NewReader(data), cipherio.Recipient{KeyID: []byte("kek"), KEK: kek})
+		if err != cipherio.ErrMissingCommitment {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrMissingCommitment)
+		}
+
+		// Any other data key, as could be found in a forged slot, is rejected.
+		decoded, err := cipherio.ReadStreamHeader(bytes.NewReader(envelope.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherKey := randomBytes(32)
+		err = decoded.VerifyCommitment(otherKey)
+		if err != cipherio.ErrKeyCommitment {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrKeyCommitment)
+		}
+	})
+}
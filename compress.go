@@ -0,0 +1,140 @@
+package cipherio
+
+import (
+	"compress/gzip"
+	"crypto/cipher"
+	"io"
+)
+
+// Compression creates the compressors and decompressors used by a Pipeline, such as gzip or zstd.
+//
+// Since the encrypted data may end with padding, a decompressor must stop at the end of the
+// compressed stream and ignore any trailing data.
+type Compression interface {
+	NewCompressor(dst io.Writer) (io.WriteCloser, error)
+	NewDecompressor(src io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCompression implements Compression with compress/gzip. The zero value is valid.
+type GzipCompression struct {
+	// Level is the compression level, as defined by compress/gzip. If zero, gzip.DefaultCompression
+	// is used.
+	Level int
+}
+
+// NewCompressor returns a gzip.Writer writing to dst.
+func (c GzipCompression) NewCompressor(dst io.Writer) (io.WriteCloser, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(dst, level)
+}
+
+// NewDecompressor returns a gzip.Reader reading a single gzip member from src, so that any
+// trailing padding is ignored.
+func (c GzipCompression) NewDecompressor(src io.Reader) (io.ReadCloser, error) {
+	reader, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	reader.Multistream(false)
+	return reader, nil
+}
+
+// Pipeline composes a Compression with the Readers and Writers of this package, so that data is
+// always compressed before being encrypted, and decrypted before being decompressed. The zero
+// value is valid and does not compress.
+type Pipeline struct {
+	Compression   Compression
+	Padding       Padding
+	WriterOptions []WriterOption
+	ReaderOptions []ReaderOption
+}
+
+// PipelineWriter is the Writer returned by Pipeline.NewWriter.
+type PipelineWriter struct {
+	compressor io.WriteCloser
+	encrypter  *BlockWriter
+}
+
+// NewWriter returns a PipelineWriter compressing data, then encrypting it with the given
+// BlockMode and writing it to dst.
+func (p Pipeline) NewWriter(dst io.Writer, blockMode cipher.BlockMode) (*PipelineWriter, error) {
+	encrypter := NewBlockWriterWithPadding(dst, blockMode, p.Padding, p.WriterOptions...)
+	if p.Compression == nil {
+		return &PipelineWriter{encrypter: encrypter}, nil
+	}
+	compressor, err := p.Compression.NewCompressor(encrypter)
+	if err != nil {
+		return nil, err
+	}
+	return &PipelineWriter{compressor: compressor, encrypter: encrypter}, nil
+}
+
+func (w *PipelineWriter) Write(p []byte) (int, error) {
+	if w.compressor == nil {
+		return w.encrypter.Write(p)
+	}
+	return w.compressor.Write(p)
+}
+
+// Flush flushes the compressor, if it provides a Flush method, then writes all complete blocks
+// to the wrapped Writer, like BlockWriter.Flush.
+func (w *PipelineWriter) Flush() error {
+	if flusher, ok := w.compressor.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return err
+		}
+	}
+	return w.encrypter.Flush()
+}
+
+// Close closes the compressor, so that it writes its trailer, then closes the underlying
+// BlockWriter, which writes the last block. The BlockWriter is closed even if the compressor
+// fails, and the first error is returned. The wrapped Writer is not closed.
+func (w *PipelineWriter) Close() error {
+	var err error
+	if w.compressor != nil {
+		err = w.compressor.Close()
+	}
+	if closeErr := w.encrypter.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// PipelineReader is the Reader returned by Pipeline.NewReader.
+type PipelineReader struct {
+	decompressor io.ReadCloser
+	decrypter    *BlockReader
+}
+
+// NewReader returns a PipelineReader decrypting data read from src with the given BlockMode, then
+// decompressing it. The decompressor may read from src, hence this may block.
+func (p Pipeline) NewReader(src io.Reader, blockMode cipher.BlockMode) (*PipelineReader, error) {
+	decrypter := NewBlockReaderWithPadding(src, blockMode, p.Padding, p.ReaderOptions...)
+	if p.Compression == nil {
+		return &PipelineReader{decrypter: decrypter}, nil
+	}
+	decompressor, err := p.Compression.NewDecompressor(decrypter)
+	if err != nil {
+		return nil, err
+	}
+	return &PipelineReader{decompressor: decompressor, decrypter: decrypter}, nil
+}
+
+func (r *PipelineReader) Read(p []byte) (int, error) {
+	if r.decompressor == nil {
+		return r.decrypter.Read(p)
+	}
+	return r.decompressor.Read(p)
+}
+
+// Close closes the decompressor, if any. The wrapped Reader is not closed.
+func (r *PipelineReader) Close() error {
+	if r.decompressor == nil {
+		return nil
+	}
+	return r.decompressor.Close()
+}
@@ -0,0 +1,152 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestPipeline(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := bytes.Repeat([]byte("compressible data "), 1000)
+
+	testCases := []struct {
+		name     string
+		pipeline cipherio.Pipeline
+	}{
+		{"Gzip", cipherio.Pipeline{Compression: cipherio.GzipCompression{}, Padding: cipherio.PKCS7Padding}},
+		{"GzipBestSpeed", cipherio.Pipeline{Compression: cipherio.GzipCompression{Level: 1}, Padding: cipherio.ZeroPadding}},
+		{"NoCompression", cipherio.Pipeline{Padding: cipherio.ZeroPadding}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			var encrypted bytes.Buffer
+			writer, err := testCase.pipeline.NewWriter(&encrypted, cipher.NewCBCEncrypter(aesCipher, iv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = writer.Write(plaintext[:1000])
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = writer.Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = writer.Write(plaintext[1000:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if encrypted.Len()%aesCipher.BlockSize() != 0 {
+				t.Fatalf("unaligned output: %d", encrypted.Len())
+			}
+			if testCase.pipeline.Compression != nil && encrypted.Len() >= len(plaintext)/10 {
+				t.Fatalf("data has not been compressed: %d bytes", encrypted.Len())
+			}
+
+			reader, err := testCase.pipeline.NewReader(&encrypted, cipher.NewCBCDecrypter(aesCipher, iv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if testCase.pipeline.Compression == nil {
+				result = bytes.TrimRight(result, "\x00")
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatal("decrypted data does not match plaintext")
+			}
+		})
+	}
+}
+
+// failingCompression returns compressors that fail on Close.
+type failingCompression struct {
+	err error
+}
+
+type failingCompressor struct {
+	io.Writer
+	err error
+}
+
+func (c failingCompressor) Close() error {
+	return c.err
+}
+
+func (c failingCompression) NewCompressor(dst io.Writer) (io.WriteCloser, error) {
+	return failingCompressor{dst, c.err}, nil
+}
+
+func (c failingCompression) NewDecompressor(src io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(src), nil
+}
+
+func TestPipelineCloseError(t *testing.T) {
+	aesCipher, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	expectedErr := errors.New("compressor failure")
+	pipeline := cipherio.Pipeline{Compression: failingCompression{expectedErr}, Padding: cipherio.ZeroPadding}
+
+	var encrypted bytes.Buffer
+	writer, err := pipeline.NewWriter(&encrypted, cipher.NewCBCEncrypter(aesCipher, iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != expectedErr {
+		t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+	}
+
+	// The encrypting writer must have been closed anyway.
+	if encrypted.Len() != aesCipher.BlockSize() {
+		t.Fatalf("unexpected length: %d != %d", encrypted.Len(), aesCipher.BlockSize())
+	}
+}
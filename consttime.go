@@ -0,0 +1,55 @@
+package cipherio
+
+import "crypto/subtle"
+
+// FillBytes sets all bytes of dst to val. Its duration only depends on the length of dst.
+func FillBytes(dst []byte, val byte) {
+	for i := range dst {
+		dst[i] = val
+	}
+}
+
+// EqualTags reports whether the given tags, such as MACs or key commitments, are equal. Its
+// duration only depends on their lengths, so that it is safe to compare secret values.
+func EqualTags(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// CheckPKCS7Padding checks that the given block ends with a valid PKCS#7 padding, as produced by
+// PKCS7Padding, and returns its length. Its duration only depends on the length of the block, so
+// that it does not act as a padding oracle.
+//
+// The second result is false, and the length is 0, if the padding is invalid or if the block is
+// empty or larger than 256 bytes.
+func CheckPKCS7Padding(block []byte) (int, bool) {
+	size := len(block)
+	if size == 0 || size > 256 {
+		return 0, false
+	}
+
+	n := int(block[size-1])
+	good := subtle.ConstantTimeLessOrEq(1, n) & subtle.ConstantTimeLessOrEq(n, size)
+	for i, b := range block {
+		inPadding := subtle.ConstantTimeLessOrEq(size-n, i)
+		match := subtle.ConstantTimeByteEq(b, byte(n))
+		good &= subtle.ConstantTimeSelect(inPadding, match, 1)
+	}
+	return subtle.ConstantTimeSelect(good, n, 0), good == 1
+}
+
+// CheckBitPadding checks that the given block ends with a valid bit padding, as produced by
+// BitPadding, and returns its length. Its duration only depends on the length of the block, so that
+// it does not act as a padding oracle.
+//
+// The second result is false, and the length is 0, if the padding is invalid.
+func CheckBitPadding(block []byte) (int, bool) {
+	// Find the last non-zero byte, which must be 0x80.
+	last, lastByte := 0, 0
+	for i, b := range block {
+		nonZero := 1 - subtle.ConstantTimeByteEq(b, 0)
+		last = subtle.ConstantTimeSelect(nonZero, i, last)
+		lastByte = subtle.ConstantTimeSelect(nonZero, int(b), lastByte)
+	}
+	good := subtle.ConstantTimeEq(int32(lastByte), 0x80)
+	return subtle.ConstantTimeSelect(good, len(block)-last, 0), good == 1
+}
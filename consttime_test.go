@@ -0,0 +1,88 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestFillBytes(t *testing.T) {
+	buf := make([]byte, 7)
+	cipherio.FillBytes(buf, 0x5a)
+	if !bytes.Equal(buf, bytes.Repeat([]byte{0x5a}, 7)) {
+		t.Fatalf("unexpected result: %x", buf)
+	}
+}
+
+func TestEqualTags(t *testing.T) {
+	if !cipherio.EqualTags([]byte("tag"), []byte("tag")) {
+		t.Fatal("equal tags should match")
+	}
+	if cipherio.EqualTags([]byte("tag"), []byte("tah")) {
+		t.Fatal("different tags should not match")
+	}
+	if cipherio.EqualTags([]byte("tag"), []byte("tags")) {
+		t.Fatal("tags of different lengths should not match")
+	}
+}
+
+type paddingCheckTest struct {
+	Name        string
+	Block       []byte
+	ExpectedLen int
+	ExpectedOK  bool
+}
+
+func TestCheckPKCS7Padding(t *testing.T) {
+	tests := []paddingCheckTest{
+		{Name: "One", Block: []byte{1, 2, 3, 1}, ExpectedLen: 1, ExpectedOK: true},
+		{Name: "Three", Block: []byte{1, 3, 3, 3}, ExpectedLen: 3, ExpectedOK: true},
+		{Name: "Full", Block: []byte{4, 4, 4, 4}, ExpectedLen: 4, ExpectedOK: true},
+		{Name: "Zero", Block: []byte{1, 2, 3, 0}},
+		{Name: "TooLong", Block: []byte{5, 5, 5, 5}},
+		{Name: "Mismatch", Block: []byte{1, 2, 3, 3}},
+		{Name: "Empty", Block: []byte{}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			n, ok := cipherio.CheckPKCS7Padding(test.Block)
+			if n != test.ExpectedLen || ok != test.ExpectedOK {
+				t.Fatalf("unexpected result: (%d, %v) != (%d, %v)", n, ok, test.ExpectedLen, test.ExpectedOK)
+			}
+		})
+	}
+
+	// Check that padded blocks are accepted.
+	for n := 1; n <= 16; n++ {
+		block := make([]byte, 16)
+		cipherio.PKCS7Padding.Fill(block[16-n:])
+		if length, ok := cipherio.CheckPKCS7Padding(block); length != n || !ok {
+			t.Fatalf("unexpected result for padding of %d bytes: (%d, %v)", n, length, ok)
+		}
+	}
+}
+
+func TestCheckBitPadding(t *testing.T) {
+	tests := []paddingCheckTest{
+		{Name: "One", Block: []byte{1, 2, 3, 0x80}, ExpectedLen: 1, ExpectedOK: true},
+		{Name: "Three", Block: []byte{1, 0x80, 0, 0}, ExpectedLen: 3, ExpectedOK: true},
+		{Name: "Full", Block: []byte{0x80, 0, 0, 0}, ExpectedLen: 4, ExpectedOK: true},
+		{Name: "DataWith0x80", Block: []byte{0x80, 0x80, 0, 0}, ExpectedLen: 3, ExpectedOK: true},
+		{Name: "AllZero", Block: []byte{0, 0, 0, 0}},
+		{Name: "Mismatch", Block: []byte{1, 2, 0x81, 0}},
+		{Name: "Empty", Block: []byte{}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			n, ok := cipherio.CheckBitPadding(test.Block)
+			if n != test.ExpectedLen || ok != test.ExpectedOK {
+				t.Fatalf("unexpected result: (%d, %v) != (%d, %v)", n, ok, test.ExpectedLen, test.ExpectedOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// CTRLayout describes where the counter lies in the counter block of CTR mode, and how it is
+// incremented. The zero value matches cipher.NewCTR: the whole block is a big-endian counter.
+type CTRLayout struct {
+	// Width is the number of bytes of the counter, which occupies the end of the counter block. The
+	// other bytes are a fixed nonce. If zero, the whole block is used.
+	Width int
+	// LittleEndian makes the counter little-endian instead of big-endian.
+	LittleEndian bool
+	// Start is added to the counter found in the IV before the first block.
+	Start uint64
+}
+
+// ctr implements CTR mode with a configurable counter layout.
+type ctr struct {
+	block        cipher.Block
+	counter      []byte
+	field        []byte // the counter within counter
+	littleEndian bool
+	keyStream    []byte
+	used         int // number of bytes of keyStream already consumed
+}
+
+// NewCTR returns a Stream (en|de)crypting with the given block cipher in CTR mode, with the given
+// counter layout. This allows to interoperate with libraries whose CTR conventions differ from
+// those of crypto/cipher, such as a 64-bit counter in the low half of the IV.
+//
+// The counter wraps around within its width, leaving the nonce untouched. The IV must be as long
+// as a block.
+func NewCTR(block cipher.Block, iv []byte, layout CTRLayout) (cipher.Stream, error) {
+	if err := checkPolicy("CTR", true, false); err != nil {
+		return nil, err
+	}
+	blockSize := block.BlockSize()
+	if err := checkIV(iv, blockSize); err != nil {
+		return nil, err
+	}
+	width := layout.Width
+	if width == 0 {
+		width = blockSize
+	}
+	if width < 0 || width > blockSize {
+		return nil, fmt.Errorf("cipherio: CTR counter width must be between 1 and %d bytes: %d", blockSize, width)
+	}
+
+	counter := append([]byte(nil), iv...)
+	x := &ctr{
+		block:        block,
+		counter:      counter,
+		field:        counter[blockSize-width:],
+		littleEndian: layout.LittleEndian,
+		keyStream:    make([]byte, blockSize),
+		used:         blockSize,
+	}
+	x.add(layout.Start)
+	return x, nil
+}
+
+// add adds n to the counter, modulo its width.
+func (x *ctr) add(n uint64) {
+	for i := 0; i < len(x.field) && n > 0; i++ {
+		index := len(x.field) - 1 - i
+		if x.littleEndian {
+			index = i
+		}
+		sum := uint64(x.field[index]) + n&0xff
+		x.field[index] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+}
+
+func (x *ctr) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("cipherio: output smaller than input")
+	}
+	for len(src) > 0 {
+		if x.used == len(x.keyStream) {
+			x.block.Encrypt(x.keyStream, x.counter)
+			x.add(1)
+			x.used = 0
+		}
+		n := len(src)
+		if available := len(x.keyStream) - x.used; n > available {
+			n = available
+		}
+		for i := 0; i < n; i++ {
+			dst[i] = src[i] ^ x.keyStream[x.used+i]
+		}
+		x.used += n
+		dst = dst[n:]
+		src = src[n:]
+	}
+}
+
+// NewCTRReader returns a Reader (en|de)crypting src with the given block cipher in CTR mode, with
+// the given counter layout.
+func NewCTRReader(src io.Reader, block cipher.Block, iv []byte, layout CTRLayout) (io.Reader, error) {
+	stream, err := NewCTR(block, iv, layout)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamReader{S: stream, R: src}, nil
+}
+
+// NewCTRWriter returns a WriteCloser (en|de)crypting data with the given block cipher in CTR mode,
+// with the given counter layout, and writing it to dst. Close closes dst if it implements
+// io.Closer.
+func NewCTRWriter(dst io.Writer, block cipher.Block, iv []byte, layout CTRLayout) (io.WriteCloser, error) {
+	stream, err := NewCTR(block, iv, layout)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamWriter{S: stream, W: dst}, nil
+}
@@ -0,0 +1,150 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+var ctrTests = []streamModeTest{
+	{
+		Name: "CTR",
+		NewReader: func(src io.Reader, block cipher.Block, iv []byte) (io.Reader, error) {
+			return cipherio.NewCTRReader(src, block, iv, cipherio.CTRLayout{})
+		},
+		NewWriter: func(dst io.Writer, block cipher.Block, iv []byte) (io.WriteCloser, error) {
+			return cipherio.NewCTRWriter(dst, block, iv, cipherio.CTRLayout{})
+		},
+		Key:        "2b7e151628aed2a6abf7158809cf4f3c",
+		IV:         "f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		Plaintext:  "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51",
+		Ciphertext: "874d6191b620e3261bef6864990db6ce9806f66b7970fdff8617187bb9fffdff",
+	},
+}
+
+func TestCTR(t *testing.T) {
+	runStreamModeTests(t, ctrTests)
+}
+
+// ctrLayoutTest describes a counter layout, along with the expected counter blocks.
+type ctrLayoutTest struct {
+	Name   string
+	Layout cipherio.CTRLayout
+	IV     func() []byte
+	Next   func(counter []byte)
+}
+
+func TestCTRLayout(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []ctrLayoutTest{
+		{
+			Name:   "BigEndian32Wrap",
+			Layout: cipherio.CTRLayout{Width: 4},
+			IV: func() []byte {
+				iv := append([]byte(nil), nonce...)
+				binary.BigEndian.PutUint32(iv[12:], 0xfffffffe)
+				return iv
+			},
+			Next: func(counter []byte) {
+				binary.BigEndian.PutUint32(counter[12:], binary.BigEndian.Uint32(counter[12:])+1)
+			},
+		},
+		{
+			Name:   "LittleEndian64",
+			Layout: cipherio.CTRLayout{Width: 8, LittleEndian: true, Start: 0xff},
+			IV: func() []byte {
+				iv := append([]byte(nil), nonce...)
+				binary.LittleEndian.PutUint64(iv[8:], 0)
+				return iv
+			},
+			Next: func(counter []byte) {
+				binary.LittleEndian.PutUint64(counter[8:], binary.LittleEndian.Uint64(counter[8:])+1)
+			},
+		},
+	}
+
+	plaintext := make([]byte, 100)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.Name, func(t *testing.T) {
+			stream, err := cipherio.NewCTR(aesCipher, testCase.IV(), testCase.Layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := make([]byte, len(plaintext))
+			for offset := 0; offset < len(plaintext); offset += 7 {
+				end := offset + 7
+				if end > len(plaintext) {
+					end = len(plaintext)
+				}
+				stream.XORKeyStream(result[offset:end], plaintext[offset:end])
+			}
+
+			// Compute the expected result block by block.
+			counter := testCase.IV()
+			for i := uint64(0); i < testCase.Layout.Start; i++ {
+				testCase.Next(counter)
+			}
+			expected := make([]byte, len(plaintext))
+			keyStream := make([]byte, aesCipher.BlockSize())
+			for offset := 0; offset < len(plaintext); offset += len(keyStream) {
+				aesCipher.Encrypt(keyStream, counter)
+				for i := offset; i < offset+len(keyStream) && i < len(plaintext); i++ {
+					expected[i] = plaintext[i] ^ keyStream[i-offset]
+				}
+				testCase.Next(counter)
+			}
+
+			if !bytes.Equal(result, expected) {
+				t.Fatalf("unexpected ciphertext: %x != %x", result, expected)
+			}
+		})
+	}
+
+	// The default layout must match crypto/cipher.
+	stream, err := cipherio.NewCTR(aesCipher, nonce, cipherio.CTRLayout{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make([]byte, len(plaintext))
+	stream.XORKeyStream(result, plaintext)
+	expected := make([]byte, len(plaintext))
+	cipher.NewCTR(aesCipher, nonce).XORKeyStream(expected, plaintext)
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected ciphertext: %x != %x", result, expected)
+	}
+
+	_, err = cipherio.NewCTR(aesCipher, nonce, cipherio.CTRLayout{Width: 17})
+	if err == nil {
+		t.Fatal("expected an error for a counter wider than a block")
+	}
+}
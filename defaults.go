@@ -0,0 +1,17 @@
+//go:build !tinygo
+// +build !tinygo
+
+package cipherio
+
+import "runtime"
+
+// defaultBufferBlocks is the size of the internal buffer of a BlockWriter, in blocks.
+const defaultBufferBlocks = 1024
+
+// largeWrites enables the (en|de)cryption of large writes at once into a pooled buffer.
+const largeWrites = true
+
+// defaultWorkers returns the default number of workers of CopyParallel and EncryptFile.
+func defaultWorkers() int {
+	return runtime.GOMAXPROCS(0)
+}
@@ -0,0 +1,18 @@
+//go:build tinygo
+// +build tinygo
+
+package cipherio
+
+// With TinyGo, memory is scarce and goroutines are expensive, hence small fixed buffers and a
+// single worker by default.
+
+// defaultBufferBlocks is the size of the internal buffer of a BlockWriter, in blocks.
+const defaultBufferBlocks = 16
+
+// largeWrites is disabled, so that the size of a write never determines an allocation.
+const largeWrites = false
+
+// defaultWorkers returns the default number of workers of CopyParallel and EncryptFile.
+func defaultWorkers() int {
+	return 1
+}
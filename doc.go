@@ -9,4 +9,13 @@
 //
 // This package has been written with performance in mind: buffering and copies are avoided as much
 // as possible.
+//
+// Building with the cipheriodebug tag makes Readers and Writers verify their internal invariants
+// after every operation, and panic with a descriptive message if any is violated. This is meant
+// for tests, especially when extending this package.
+//
+// With TinyGo, which sets the tinygo build tag, Writers use a small fixed buffer of 16 blocks and
+// never allocate according to the size of a write, and parallel operations default to a single
+// worker, so that no background goroutine is started unless requested. WithLowMemory goes further
+// for devices handling many streams, by reducing the buffer of a Writer to a single block.
 package cipherio
@@ -0,0 +1,97 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// BlockReadWriterOptions configures a BlockReadWriter. The zero value is valid.
+type BlockReadWriterOptions struct {
+	// ReadPadding, if not nil, fills any incomplete block received at the end of the stream, as
+	// with NewBlockReaderWithPadding.
+	ReadPadding Padding
+
+	// WritePadding, if not nil, fills any incomplete block when closing, as with
+	// NewBlockWriterWithPadding.
+	WritePadding Padding
+
+	ReaderOptions []ReaderOption
+	WriterOptions []WriterOption
+}
+
+// BlockReadWriter wraps a bidirectional stream, such as a socket or a pipe, with a BlockReader
+// decrypting what is received and a BlockWriter encrypting what is sent, each one with its own
+// BlockMode and the same guarantees as when used alone.
+//
+// Read may be called concurrently with Write, Flush and Close, since both directions are
+// independent. Calls within each direction must be serialized, as with BlockReader and
+// BlockWriter.
+type BlockReadWriter struct {
+	rw     io.ReadWriter
+	reader *BlockReader
+	writer *BlockWriter
+	closed bool
+}
+
+// NewBlockReadWriter returns a BlockReadWriter over rw, encrypting sent data with encrypter and
+// decrypting received data with decrypter.
+func NewBlockReadWriter(rw io.ReadWriter, encrypter, decrypter cipher.BlockMode, opts BlockReadWriterOptions) *BlockReadWriter {
+	return &BlockReadWriter{
+		rw:     rw,
+		reader: NewBlockReaderWithPadding(rw, decrypter, opts.ReadPadding, opts.ReaderOptions...),
+		writer: NewBlockWriterWithPadding(rw, encrypter, opts.WritePadding, opts.WriterOptions...),
+	}
+}
+
+func (rw *BlockReadWriter) Read(p []byte) (int, error) {
+	return rw.reader.Read(p)
+}
+
+func (rw *BlockReadWriter) Write(p []byte) (int, error) {
+	return rw.writer.Write(p)
+}
+
+// Flush sends every complete block buffered by the writing direction. See BlockWriter.Flush.
+func (rw *BlockReadWriter) Flush() error {
+	return rw.writer.Flush()
+}
+
+// CloseWrite closes the writing direction, which writes the last block, then half-closes the
+// wrapped stream if it provides a CloseWrite method, like net.TCPConn. Reading remains possible.
+func (rw *BlockReadWriter) CloseWrite() error {
+	if err := rw.writer.Close(); err != nil {
+		return err
+	}
+	if closer, ok := rw.rw.(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
+	return nil
+}
+
+// Close closes the writing direction, which writes the last block, then closes the wrapped stream
+// if it is an io.Closer, even if the former failed. The first error is returned. After that, Close
+// becomes a no-op.
+func (rw *BlockReadWriter) Close() error {
+	if rw.closed {
+		return nil
+	}
+	rw.closed = true
+
+	err := rw.writer.Close()
+	if closer, ok := rw.rw.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Reader returns the BlockReader of the reading direction, to access its other methods.
+func (rw *BlockReadWriter) Reader() *BlockReader {
+	return rw.reader
+}
+
+// Writer returns the BlockWriter of the writing direction, to access its other methods.
+func (rw *BlockReadWriter) Writer() *BlockWriter {
+	return rw.writer
+}
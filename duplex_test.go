@@ -0,0 +1,121 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestBlockReadWriter(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each direction has its own IV.
+	ivAB := make([]byte, aesCipher.BlockSize())
+	ivBA := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(ivAB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rand.Read(ivBA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataAB := make([]byte, 100000)
+	dataBA := make([]byte, 1000)
+	_, err = rand.Read(dataAB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rand.Read(dataBA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connA, connB := net.Pipe()
+	opts := cipherio.BlockReadWriterOptions{WritePadding: cipherio.ZeroPadding}
+	a := cipherio.NewBlockReadWriter(connA, cipher.NewCBCEncrypter(aesCipher, ivAB), cipher.NewCBCDecrypter(aesCipher, ivBA), opts)
+	b := cipherio.NewBlockReadWriter(connB, cipher.NewCBCEncrypter(aesCipher, ivBA), cipher.NewCBCDecrypter(aesCipher, ivAB), opts)
+
+	// Both ends send and receive at the same time, which would deadlock on the synchronous pipe if
+	// directions were not independent.
+	errs := make(chan error, 2)
+	go func() {
+		_, err := a.Write(dataAB)
+		if err == nil {
+			err = a.Flush()
+		}
+		errs <- err
+	}()
+	go func() {
+		_, err := b.Write(dataBA)
+		if err == nil {
+			err = b.Flush()
+		}
+		errs <- err
+	}()
+
+	receivedByB := make([]byte, len(dataAB))
+	_, err = io.ReadFull(b, receivedByB)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	receivedByA := make([]byte, len(dataBA)/16*16)
+	_, err = io.ReadFull(a, receivedByA)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+	}
+
+	// Closing B sends its last padded block, then closes its end of the pipe.
+	go func() {
+		errs <- b.Close()
+	}()
+	rest, err := ioutil.ReadAll(a)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	receivedByA = append(receivedByA, rest...)
+	if err := <-errs; err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	if !bytes.Equal(receivedByB, dataAB) {
+		t.Fatal("data received by B does not match")
+	}
+	if len(receivedByA) != 1008 || !bytes.Equal(receivedByA[:len(dataBA)], dataBA) {
+		t.Fatal("data received by A does not match")
+	}
+
+	err = b.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	// A has no incomplete block to send, so closing it does not need its peer.
+	err = a.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+}
@@ -0,0 +1,55 @@
+package cipherio
+
+import "crypto/cipher"
+
+// ecb implements ECB mode, where each block is (en|de)crypted independently.
+type ecb struct {
+	block   cipher.Block
+	decrypt bool
+}
+
+// NewInsecureECBEncrypter returns a BlockMode encrypting in ECB mode with the given block cipher.
+// It is rejected by any restrictive Policy.
+//
+// WARNING: ECB is insecure: identical plaintext blocks give identical ciphertext blocks, which
+// leaks patterns of the data. It MUST NOT be used for new designs, and is only provided for
+// interoperability with legacy formats that require it, and as a trivially parallelizable mode.
+func NewInsecureECBEncrypter(block cipher.Block) (cipher.BlockMode, error) {
+	if err := checkPolicy("ECB", false, false); err != nil {
+		return nil, err
+	}
+	return ecb{block: block}, nil
+}
+
+// NewInsecureECBDecrypter returns a BlockMode decrypting in ECB mode with the given block cipher.
+// See NewInsecureECBEncrypter for why ECB is insecure.
+func NewInsecureECBDecrypter(block cipher.Block) (cipher.BlockMode, error) {
+	if err := checkPolicy("ECB", false, false); err != nil {
+		return nil, err
+	}
+	return ecb{block: block, decrypt: true}, nil
+}
+
+func (x ecb) BlockSize() int {
+	return x.block.BlockSize()
+}
+
+func (x ecb) CryptBlocks(dst, src []byte) {
+	blockSize := x.block.BlockSize()
+	if len(src)%blockSize != 0 {
+		panic("cipherio: input not full blocks")
+	}
+	if len(dst) < len(src) {
+		panic("cipherio: output smaller than input")
+	}
+	if inexactOverlap(dst[:len(src)], src) {
+		panic("cipherio: invalid buffer overlap")
+	}
+	for offset := 0; offset < len(src); offset += blockSize {
+		if x.decrypt {
+			x.block.Decrypt(dst[offset:], src[offset:offset+blockSize])
+		} else {
+			x.block.Encrypt(dst[offset:], src[offset:offset+blockSize])
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestECB(t *testing.T) {
+	// NIST SP 800-38A, F.1.1 and F.1.2
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	plaintext, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51")
+	expected, _ := hex.DecodeString("3ad77bb40d7a3660a89ecaf32466ef97f5d3d58503b9699de785895a96fdbaaf")
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypter, err := cipherio.NewInsecureECBEncrypter(aesCipher)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	result := make([]byte, len(plaintext))
+	encrypter.CryptBlocks(result, plaintext)
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected ciphertext: %x != %x", result, expected)
+	}
+
+	decrypter, err := cipherio.NewInsecureECBDecrypter(aesCipher)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	decrypter.CryptBlocks(result, result)
+	if !bytes.Equal(result, plaintext) {
+		t.Fatalf("unexpected plaintext: %x != %x", result, plaintext)
+	}
+}
+
+func TestECBParallel(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 10000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Since ECB blocks are independent, parallel chunks must match a sequential encryption.
+	encrypter, err := cipherio.NewInsecureECBEncrypter(aesCipher)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	expected := make([]byte, len(plaintext))
+	encrypter.CryptBlocks(expected, plaintext)
+
+	var result bytes.Buffer
+	factory := func(chunkIndex int64) (cipher.BlockMode, error) {
+		return cipherio.NewInsecureECBEncrypter(aesCipher)
+	}
+	_, err = cipherio.CopyParallel(context.Background(), &result, bytes.NewReader(plaintext), factory, cipherio.ParallelOptions{ChunkSize: 1024, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result.Bytes(), expected) {
+		t.Fatal("parallel encryption does not match sequential encryption")
+	}
+}
@@ -0,0 +1,308 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// encryptedFileMagic identifies the header of an EncryptedFile.
+var encryptedFileMagic = []byte("CIOFILE\x01")
+
+// encryptedFileHeaderSize is the size of the header of an EncryptedFile: the magic followed by
+// the plaintext size.
+const encryptedFileHeaderSize = 16
+
+// defaultPageSize is the page size used by EncryptedFile if none is given.
+const defaultPageSize = 4096
+
+// ErrInvalidEncryptedFile is returned when opening a file that is not a valid EncryptedFile.
+var ErrInvalidEncryptedFile = errors.New("cipherio: invalid encrypted file")
+
+// EncryptedFileOptions configures an EncryptedFile. The zero value is valid.
+type EncryptedFileOptions struct {
+	// PageSize is the number of plaintext bytes encrypted together. It must be a multiple of the
+	// AES block size. If zero, 4 KiB is used.
+	PageSize int
+}
+
+// EncryptedFile provides random access to an encrypted file, which makes it suitable for the
+// on-disk pages of databases and caches.
+//
+// The file is divided into pages, each one encrypted with AES-CBC and an IV derived from its
+// index, as ESSIV does. Any write therefore only rewrites the pages it touches. The last page is
+// zero-padded to the block size, and the plaintext size is stored in a small header.
+//
+// EncryptedFile is safe for concurrent use. Since pages are rewritten in place, a crash during a
+// write may leave a page corrupted: this is meant for scratch files, not durable storage.
+type EncryptedFile struct {
+	mu       sync.RWMutex
+	file     *os.File
+	block    cipher.Block
+	essiv    cipher.Block
+	pageSize int
+	size     int64
+}
+
+// NewEncryptedFile returns an EncryptedFile over the given file, which must be opened for reading
+// and writing. An empty file is initialized, otherwise its header is checked. The same key and
+// page size must be used each time a file is opened.
+//
+// The key must be a valid AES key. Distinct keys are derived from it for pages and IVs.
+func NewEncryptedFile(file *os.File, key []byte, opts EncryptedFileOptions) (*EncryptedFile, error) {
+	pageSize := opts.PageSize
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize < 0 || pageSize%16 != 0 {
+		return nil, fmt.Errorf("cipherio: page size must be a positive multiple of 16: %d", pageSize)
+	}
+	if err := checkPolicy("encrypted file", true, false); err != nil {
+		return nil, err
+	}
+	if _, err := newAESCipher(key); err != nil {
+		return nil, err
+	}
+	block, err := newAESCipher(hkdf(key, nil, []byte("cipherio file page"), len(key)))
+	if err != nil {
+		return nil, err
+	}
+	essiv, err := newAESCipher(hkdf(key, nil, []byte("cipherio file iv"), len(key)))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &EncryptedFile{
+		file:     file,
+		block:    block,
+		essiv:    essiv,
+		pageSize: pageSize,
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		if err := f.writeHeader(0); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	header := make([]byte, encryptedFileHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return nil, ErrInvalidEncryptedFile
+		}
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(encryptedFileMagic)], encryptedFileMagic) {
+		return nil, ErrInvalidEncryptedFile
+	}
+	f.size = int64(binary.BigEndian.Uint64(header[len(encryptedFileMagic):]))
+	if f.size < 0 || encryptedFileHeaderSize+alignedSize(f.size, 16) != info.Size() {
+		return nil, ErrInvalidEncryptedFile
+	}
+	return f, nil
+}
+
+// Size returns the plaintext size of the file.
+func (f *EncryptedFile) Size() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.size
+}
+
+// ReadAt decrypts len(p) bytes starting at the given offset, as defined by io.ReaderAt.
+func (f *EncryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("cipherio: negative offset: %d", off)
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	var err error
+	if remaining := f.size - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		err = io.EOF
+	}
+
+	page := make([]byte, f.pageSize)
+	n := 0
+	for n < len(p) {
+		index := (off + int64(n)) / int64(f.pageSize)
+		plain, readErr := f.readPage(page, index)
+		if readErr != nil {
+			return n, readErr
+		}
+		n += copy(p[n:], plain[(off+int64(n))%int64(f.pageSize):])
+	}
+	return n, err
+}
+
+// WriteAt encrypts p and writes it at the given offset, as defined by io.WriterAt. Writing beyond
+// the end of the file first extends it with zeroes.
+func (f *EncryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("cipherio: negative offset: %d", off)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if off > f.size {
+		if err := f.extend(off); err != nil {
+			return 0, err
+		}
+	}
+	return f.writeAt(p, off)
+}
+
+// Truncate changes the plaintext size of the file. Extending it appends zeroes.
+func (f *EncryptedFile) Truncate(size int64) error {
+	if size < 0 {
+		return fmt.Errorf("cipherio: negative size: %d", size)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if size >= f.size {
+		return f.extend(size)
+	}
+
+	// Zero the end of the new last page, so that extending the file later yields zeroes.
+	if tail := int(size % int64(f.pageSize)); tail > 0 {
+		index := size / int64(f.pageSize)
+		page := make([]byte, f.pageSize)
+		plain, err := f.readPage(page, index)
+		if err != nil {
+			return err
+		}
+		f.size = size
+		if err := f.writePage(plain[:tail], index); err != nil {
+			return err
+		}
+	}
+
+	if err := f.file.Truncate(encryptedFileHeaderSize + alignedSize(size, 16)); err != nil {
+		return err
+	}
+	f.size = size
+	return f.writeHeader(size)
+}
+
+// Close closes the underlying file.
+func (f *EncryptedFile) Close() error {
+	return f.file.Close()
+}
+
+// extend appends zeroes up to the given size.
+func (f *EncryptedFile) extend(size int64) error {
+	zeroes := make([]byte, f.pageSize)
+	for f.size < size {
+		n := int64(f.pageSize) - f.size%int64(f.pageSize)
+		if remaining := size - f.size; n > remaining {
+			n = remaining
+		}
+		if _, err := f.writeAt(zeroes[:n], f.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAt writes p at the given offset, which must not be beyond the end of the file.
+func (f *EncryptedFile) writeAt(p []byte, off int64) (int, error) {
+	page := make([]byte, f.pageSize)
+	n := 0
+	for n < len(p) {
+		index := (off + int64(n)) / int64(f.pageSize)
+		start := int((off + int64(n)) % int64(f.pageSize))
+
+		plain, err := f.readPage(page, index)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(page[start:], p[n:])
+		if end := start + copied; end > len(plain) {
+			plain = page[:end]
+		}
+
+		if err := f.writePage(plain, index); err != nil {
+			return n, err
+		}
+		n += copied
+		if end := off + int64(n); end > f.size {
+			f.size = end
+			if err := f.writeHeader(end); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// readPage decrypts the given page into buf, and returns its plaintext, which is shorter than a
+// page at the end of the file. Beyond the end, an empty slice is returned.
+func (f *EncryptedFile) readPage(buf []byte, index int64) ([]byte, error) {
+	start := index * int64(f.pageSize)
+	if start >= f.size {
+		return buf[:0], nil
+	}
+	plainLen := int64(f.pageSize)
+	if remaining := f.size - start; plainLen > remaining {
+		plainLen = remaining
+	}
+	encrypted := buf[:alignedSize(plainLen, 16)]
+
+	if _, err := f.file.ReadAt(encrypted, encryptedFileHeaderSize+start); err != nil {
+		if err == io.EOF {
+			err = ErrLengthMismatch
+		}
+		return nil, err
+	}
+	cipher.NewCBCDecrypter(f.block, f.pageIV(index)).CryptBlocks(encrypted, encrypted)
+	return encrypted[:plainLen], nil
+}
+
+// writePage encrypts the plaintext of the given page, zero-padded to the block size, and writes
+// it.
+func (f *EncryptedFile) writePage(plain []byte, index int64) error {
+	encrypted := make([]byte, alignedSize(int64(len(plain)), 16))
+	copy(encrypted, plain)
+	cipher.NewCBCEncrypter(f.block, f.pageIV(index)).CryptBlocks(encrypted, encrypted)
+	_, err := f.file.WriteAt(encrypted, encryptedFileHeaderSize+index*int64(f.pageSize))
+	return err
+}
+
+// pageIV derives the IV of the given page by encrypting its index with a dedicated key.
+func (f *EncryptedFile) pageIV(index int64) []byte {
+	iv := make([]byte, f.essiv.BlockSize())
+	binary.BigEndian.PutUint64(iv[len(iv)-8:], uint64(index))
+	f.essiv.Encrypt(iv, iv)
+	return iv
+}
+
+func (f *EncryptedFile) writeHeader(size int64) error {
+	header := make([]byte, encryptedFileHeaderSize)
+	copy(header, encryptedFileMagic)
+	binary.BigEndian.PutUint64(header[len(encryptedFileMagic):], uint64(size))
+	_, err := f.file.WriteAt(header, 0)
+	return err
+}
+
+// alignedSize rounds size up to a multiple of blockSize.
+func alignedSize(size int64, blockSize int64) int64 {
+	return (size + blockSize - 1) / blockSize * blockSize
+}
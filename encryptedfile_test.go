@@ -0,0 +1,160 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func openEncryptedFile(t *testing.T, path string, key []byte) *cipherio.EncryptedFile {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := cipherio.NewEncryptedFile(file, key, cipherio.EncryptedFileOptions{PageSize: 64})
+	if err != nil {
+		file.Close()
+		t.Fatal(err)
+	}
+	return encrypted
+}
+
+func TestEncryptedFile(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "cipherio-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/pages"
+
+	// Mirror every operation on a plaintext slice.
+	var expected []byte
+	writeAt := func(f *cipherio.EncryptedFile, p []byte, off int) {
+		t.Helper()
+		n, err := f.WriteAt(p, int64(off))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if n != len(p) {
+			t.Fatalf("unexpected write length: %d != %d", n, len(p))
+		}
+		if end := off + len(p); end > len(expected) {
+			expected = append(expected, make([]byte, end-len(expected))...)
+		}
+		copy(expected[off:], p)
+	}
+	check := func(f *cipherio.EncryptedFile) {
+		t.Helper()
+		if f.Size() != int64(len(expected)) {
+			t.Fatalf("unexpected size: %d != %d", f.Size(), len(expected))
+		}
+		result, err := ioutil.ReadAll(io.NewSectionReader(f, 0, f.Size()+10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, expected) {
+			t.Fatalf("unexpected content: %x != %x", result, expected)
+		}
+		for _, off := range []int{0, 1, 63, 64, 65, 100} {
+			if off >= len(expected) {
+				continue
+			}
+			part := make([]byte, 30)
+			n, err := f.ReadAt(part, int64(off))
+			if off+len(part) <= len(expected) && err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if !bytes.Equal(part[:n], expected[off:off+n]) {
+				t.Fatalf("unexpected content at offset %d", off)
+			}
+		}
+	}
+
+	file := openEncryptedFile(t, path, key)
+	check(file)
+	writeAt(file, []byte("hello, world"), 0)
+	check(file)
+	writeAt(file, bytes.Repeat([]byte{'a'}, 100), 60)
+	check(file)
+	writeAt(file, []byte("overwrite"), 5)
+	check(file)
+	writeAt(file, []byte("sparse"), 300)
+	check(file)
+
+	err = file.Truncate(70)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = expected[:70]
+	check(file)
+
+	// Extending again must yield zeroes, not the truncated data.
+	err = file.Truncate(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = append(expected, make([]byte, 130)...)
+	check(file)
+
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("hello")) || bytes.Contains(raw, []byte("aaaa")) {
+		t.Fatal("plaintext found in file")
+	}
+
+	// Reopening must preserve the content.
+	file = openEncryptedFile(t, path, key)
+	check(file)
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedFileInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cipherio-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + "/invalid"
+	err = ioutil.WriteFile(path, []byte("not an encrypted file"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = cipherio.NewEncryptedFile(file, make([]byte, 16), cipherio.EncryptedFileOptions{})
+	if err != cipherio.ErrInvalidEncryptedFile {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidEncryptedFile)
+	}
+	_, err = cipherio.NewEncryptedFile(file, make([]byte, 16), cipherio.EncryptedFileOptions{PageSize: 10})
+	if err == nil {
+		t.Fatal("expected an error for an unaligned page size")
+	}
+}
@@ -0,0 +1,73 @@
+package cipherio
+
+import (
+	"crypto/rand"
+	"io"
+	"time"
+)
+
+// Features of this package that depend on time or randomness accept injected sources, so that
+// tests can be fully deterministic: a Clock for timers and timestamps, and an io.Reader for random
+// bytes. Writers take them with WithClock and WithRand, and options structs with Clock and Rand
+// fields. Nil sources default to SystemClock and crypto/rand.Reader.
+
+// Clock provides the current time and timers.
+type Clock interface {
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine once d has elapsed, like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by Clock.AfterFunc, with the same semantics as time.Timer.
+type Timer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is the Clock based on the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// WithClock sets the Clock used by time-based features built on the Writer, such as
+// IdleFlushWriter.
+func WithClock(clock Clock) WriterOption {
+	return func(o *writerOptions) {
+		o.clock = clock
+	}
+}
+
+// WithRand sets the source of random bytes used by the Writer constructors that generate secrets,
+// such as the nonces of NewEnvelopeWriter or the shares of NewSplitEnvelopeWriter.
+//
+// The source must be cryptographically secure: this option is meant for deterministic tests.
+func WithRand(rand io.Reader) WriterOption {
+	return func(o *writerOptions) {
+		o.rand = rand
+	}
+}
+
+// clockOrDefault returns clock, or SystemClock if nil.
+func clockOrDefault(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock
+	}
+	return clock
+}
+
+// randOrDefault returns r, or crypto/rand.Reader if nil.
+func randOrDefault(r io.Reader) io.Reader {
+	if r == nil {
+		return rand.Reader
+	}
+	return r
+}
@@ -0,0 +1,189 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/connesc/cipherio"
+)
+
+// fakeClock is a Clock whose time only advances with Advance, which fires due timers
+// synchronously.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	when   time.Time
+	fn     func()
+	active bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) cipherio.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &fakeTimer{clock: c, when: c.now.Add(d), fn: f, active: true}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	for _, timer := range c.timers {
+		if timer.active && !timer.when.After(c.now) {
+			timer.active = false
+			due = append(due, timer)
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].when.Before(due[j].when) })
+	for _, timer := range due {
+		timer.fn()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.when = t.clock.now.Add(d)
+	t.active = true
+	return active
+}
+
+func TestIdleFlushWriterWithClock(t *testing.T) {
+	aesCipher, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	clock := &fakeClock{}
+	var dst syncBuffer
+	blockWriter := cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithHighWaterMark(1024), cipherio.WithClock(clock))
+	writer := cipherio.NewIdleFlushWriter(blockWriter, time.Second)
+
+	if _, err := writer.Write(make([]byte, 20)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing again postpones the flush.
+	clock.Advance(900 * time.Millisecond)
+	if _, err := writer.Write(make([]byte, 20)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(900 * time.Millisecond)
+	if dst.Len() != 0 {
+		t.Fatalf("unexpected flush before idle: %d bytes", dst.Len())
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	if dst.Len() != 32 {
+		t.Fatalf("unexpected flushed length: %d != %d", dst.Len(), 32)
+	}
+}
+
+func TestWithRand(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x42}, 1024)
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		IV:           make([]byte, 16),
+		PlaintextLen: -1,
+	}
+	dataKey := make([]byte, 32)
+	recipients := []cipherio.Recipient{
+		{KeyID: []byte("alice"), KEK: bytes.Repeat([]byte{1}, 32)},
+		{KeyID: []byte("bob"), KEK: bytes.Repeat([]byte{2}, 32)},
+	}
+
+	write := func(split bool) []byte {
+		var buf bytes.Buffer
+		h := header
+		var (
+			writer *cipherio.BlockWriter
+			err    error
+		)
+		if split {
+			writer, err = cipherio.NewSplitEnvelopeWriter(context.Background(), &buf, &h, dataKey, recipients, 2, cipherio.WithRand(bytes.NewReader(seed)))
+		} else {
+			writer, err = cipherio.NewEnvelopeWriter(&buf, &h, dataKey, recipients, cipherio.WithRand(bytes.NewReader(seed)))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	for _, split := range []bool{false, true} {
+		if !bytes.Equal(write(split), write(split)) {
+			t.Fatalf("output is not deterministic with split=%v", split)
+		}
+	}
+
+	// A short source is reported.
+	h := header
+	_, err := cipherio.NewEnvelopeWriter(ioutil.Discard, &h, dataKey, recipients, cipherio.WithRand(bytes.NewReader(nil)))
+	if err != io.EOF {
+		t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+	}
+}
+
+func TestShardConfigRand(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x42}, 32)
+	masterKey := make([]byte, 32)
+
+	write := func() []byte {
+		lanes := []*bytes.Buffer{{}, {}}
+		writer, err := cipherio.NewShardWriter([]io.Writer{lanes[0], lanes[1]}, masterKey, cipherio.ShardConfig{
+			StripeSize: 64,
+			Rand:       bytes.NewReader(seed),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(make([]byte, 500)); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return append(lanes[0].Bytes(), lanes[1].Bytes()...)
+	}
+
+	if !bytes.Equal(write(), write()) {
+		t.Fatal("output is not deterministic")
+	}
+}
@@ -0,0 +1,232 @@
+package cipherio
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RecipientSlot holds the data key of an envelope wrapped for a single recipient.
+type RecipientSlot struct {
+	KeyID      []byte // at most 255 bytes
+	WrappedKey []byte // at most 65535 bytes
+}
+
+// Recipient identifies a key encryption key (KEK), used to wrap or unwrap the data key of an
+// envelope.
+//
+// If Wrapper is nil, the KEK must be a valid AES key, and the data key is wrapped with AES-GCM,
+// using the key ID as additional data. Otherwise, the KEK is ignored and wrapping is delegated to
+// the KeyWrapper, typically backed by a KMS.
+type Recipient struct {
+	KeyID   []byte
+	KEK     []byte
+	Wrapper KeyWrapper
+}
+
+// ErrNoRecipient is returned when an envelope has no slot for the given key ID.
+var ErrNoRecipient = errors.New("cipherio: no matching recipient")
+
+// NewEnvelopeWriter wraps the given data key for each recipient, stores the results in the
+// Recipients of the header, then returns a BlockWriter like NewStreamWriter.
+//
+// This allows to share a stream between several parties, each one holding its own KEK, without
+// encrypting the data more than once. The data key should be random and used for a single stream.
+// A commitment to the data key is stored in the header, unless it already has one.
+func NewEnvelopeWriter(dst io.Writer, header *StreamHeader, dataKey []byte, recipients []Recipient, opts ...WriterOption) (*BlockWriter, error) {
+	return NewEnvelopeWriterContext(context.Background(), dst, header, dataKey, recipients, opts...)
+}
+
+// NewEnvelopeWriterContext is similar to NewEnvelopeWriter, except that the given context is passed
+// to the KeyWrapper of each recipient.
+func NewEnvelopeWriterContext(ctx context.Context, dst io.Writer, header *StreamHeader, dataKey []byte, recipients []Recipient, opts ...WriterOption) (*BlockWriter, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("cipherio: envelope requires at least one recipient")
+	}
+
+	options := newWriterOptions(opts)
+	slots, err := wrapRecipients(ctx, randOrDefault(options.rand), recipients, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header.Recipients = slots
+	if len(header.Commitment) == 0 {
+		header.SetCommitment(dataKey)
+	}
+
+	return NewStreamWriter(dst, header, dataKey, opts...)
+}
+
+// wrapRecipients wraps dataKey for each recipient, reading any random byte from rand.
+func wrapRecipients(ctx context.Context, rand io.Reader, recipients []Recipient, dataKey []byte) ([]RecipientSlot, error) {
+	slots := make([]RecipientSlot, 0, len(recipients))
+	for _, recipient := range recipients {
+		wrapped, err := wrapKey(ctx, rand, recipient, dataKey)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, RecipientSlot{
+			KeyID:      recipient.KeyID,
+			WrappedKey: wrapped,
+		})
+	}
+	return slots, nil
+}
+
+// NewEnvelopeReader reads a header from src, unwraps the data key from the slot matching the key
+// ID of the given recipient, then returns a Reader like NewStreamReader.
+//
+// ErrNoRecipient is returned if no slot matches, and ErrMissingCommitment if the header has no key
+// commitment, which would allow a forged slot to select another data key.
+func NewEnvelopeReader(src io.Reader, recipient Recipient, opts ...ReaderOption) (io.Reader, *StreamHeader, error) {
+	return NewEnvelopeReaderContext(context.Background(), src, recipient, opts...)
+}
+
+// NewEnvelopeReaderContext is similar to NewEnvelopeReader, except that the given context is passed
+// to the KeyWrapper of the recipient.
+func NewEnvelopeReaderContext(ctx context.Context, src io.Reader, recipient Recipient, opts ...ReaderOption) (io.Reader, *StreamHeader, error) {
+	header, err := ReadStreamHeader(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataKey, err := header.UnwrapKeyContext(ctx, recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := newStreamReader(src, header, dataKey, withRequiredCommitment(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, header, nil
+}
+
+// UnwrapKey returns the data key stored in the slot matching the key ID of the given recipient.
+func (h *StreamHeader) UnwrapKey(recipient Recipient) ([]byte, error) {
+	return h.UnwrapKeyContext(context.Background(), recipient)
+}
+
+// UnwrapKeyContext is similar to UnwrapKey, except that the given context is passed to the
+// KeyWrapper of the recipient.
+func (h *StreamHeader) UnwrapKeyContext(ctx context.Context, recipient Recipient) ([]byte, error) {
+	if h.Threshold > 0 {
+		return nil, errSplitKey
+	}
+	return h.unwrapSlot(ctx, recipient)
+}
+
+// unwrapSlot returns the content of the slot matching the key ID of the given recipient.
+func (h *StreamHeader) unwrapSlot(ctx context.Context, recipient Recipient) ([]byte, error) {
+	for _, slot := range h.Recipients {
+		if bytes.Equal(slot.KeyID, recipient.KeyID) {
+			return unwrapKey(ctx, recipient, slot.WrappedKey)
+		}
+	}
+	return nil, ErrNoRecipient
+}
+
+// newKeyAEAD returns the AES-GCM instance used to wrap data keys with the given KEK.
+func newKeyAEAD(kek []byte) (cipher.AEAD, error) {
+	block, err := newAESCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapKey encrypts dataKey for the given recipient. Without KeyWrapper, the result is made of a
+// nonce read from rand followed by the sealed key.
+func wrapKey(ctx context.Context, rand io.Reader, recipient Recipient, dataKey []byte) ([]byte, error) {
+	if recipient.Wrapper != nil {
+		return recipient.Wrapper.Wrap(ctx, dataKey)
+	}
+
+	aead, err := newKeyAEAD(recipient.KEK)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(dataKey)+aead.Overhead())
+	if _, err := io.ReadFull(rand, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, recipient.KeyID), nil
+}
+
+// unwrapKey decrypts a data key wrapped by wrapKey.
+func unwrapKey(ctx context.Context, recipient Recipient, wrapped []byte) ([]byte, error) {
+	if recipient.Wrapper != nil {
+		return recipient.Wrapper.Unwrap(ctx, wrapped)
+	}
+
+	aead, err := newKeyAEAD(recipient.KEK)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("cipherio: invalid wrapped key")
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], recipient.KeyID)
+	if err != nil {
+		return nil, errors.New("cipherio: cannot unwrap key: wrong KEK or corrupted slot")
+	}
+	return dataKey, nil
+}
+
+// marshalRecipients appends the count of slots, then each slot, to buf.
+func marshalRecipients(buf *bytes.Buffer, slots []RecipientSlot) error {
+	if len(slots) > 255 {
+		return fmt.Errorf("cipherio: too many recipients: %d > 255", len(slots))
+	}
+
+	buf.WriteByte(byte(len(slots)))
+	for _, slot := range slots {
+		if len(slot.KeyID) > 255 || len(slot.WrappedKey) > 65535 {
+			return errors.New("cipherio: recipient slot field is too long")
+		}
+		buf.WriteByte(byte(len(slot.KeyID)))
+		buf.Write(slot.KeyID)
+		binary.Write(buf, binary.BigEndian, uint16(len(slot.WrappedKey)))
+		buf.Write(slot.WrappedKey)
+	}
+	return nil
+}
+
+// unmarshalRecipients decodes slots encoded by marshalRecipients.
+func unmarshalRecipients(r *bytes.Reader) ([]RecipientSlot, error) {
+	truncated := errors.New("cipherio: truncated stream header")
+
+	count, err := r.ReadByte()
+	if err != nil {
+		return nil, truncated
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+	slots := make([]RecipientSlot, count)
+	for i := range slots {
+		keyIDLen, err := r.ReadByte()
+		if err != nil {
+			return nil, truncated
+		}
+		slots[i].KeyID = make([]byte, keyIDLen)
+		if _, err := io.ReadFull(r, slots[i].KeyID); err != nil {
+			return nil, truncated
+		}
+
+		var wrappedLen uint16
+		if err := binary.Read(r, binary.BigEndian, &wrappedLen); err != nil {
+			return nil, truncated
+		}
+		slots[i].WrappedKey = make([]byte, wrappedLen)
+		if _, err := io.ReadFull(r, slots[i].WrappedKey); err != nil {
+			return nil, truncated
+		}
+	}
+	return slots, nil
+}
@@ -0,0 +1,120 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestEnvelope(t *testing.T) {
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	dataKey := randomBytes(32)
+	recipients := []cipherio.Recipient{
+		{KeyID: []byte("alice"), KEK: randomBytes(32)},
+		{KeyID: []byte("bob"), KEK: randomBytes(16)},
+		{KeyID: []byte("carol"), KEK: randomBytes(24)},
+	}
+	plaintext := randomBytes(1000)
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           randomBytes(aes.BlockSize),
+		PlaintextLen: int64(len(plaintext)),
+	}
+
+	var stream bytes.Buffer
+	writer, err := cipherio.NewEnvelopeWriter(&stream, &header, dataKey, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each recipient can decrypt the stream with its own KEK.
+	for _, recipient := range recipients {
+		recipient := recipient
+		t.Run(string(recipient.KeyID), func(t *testing.T) {
+			reader, decoded, err := cipherio.NewEnvelopeReader(bytes.NewReader(stream.Bytes()), recipient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded.Recipients) != len(recipients) {
+				t.Fatalf("unexpected recipient count: %d != %d", len(decoded.Recipients), len(recipients))
+			}
+
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatalf("unexpected decrypted bytes")
+			}
+		})
+	}
+
+	t.Run("UnknownKeyID", func(t *testing.T) {
+		_, _, err := cipherio.NewEnvelopeReader(bytes.NewReader(stream.Bytes()), cipherio.Recipient{
+			KeyID: []byte("dave"),
+			KEK:   randomBytes(32),
+		})
+		if err != cipherio.ErrNoRecipient {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNoRecipient)
+		}
+	})
+
+	t.Run("WrongKEK", func(t *testing.T) {
+		_, _, err := cipherio.NewEnvelopeReader(bytes.NewReader(stream.Bytes()), cipherio.Recipient{
+			KeyID: []byte("alice"),
+			KEK:   randomBytes(32),
+		})
+		if err == nil || err.Error() != "cipherio: cannot unwrap key: wrong KEK or corrupted slot" {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	t.Run("SwappedKeyID", func(t *testing.T) {
+		// Slots are bound to their key ID.
+		var decoded cipherio.StreamHeader
+		data, err := header.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = decoded.UnmarshalBinary(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded.Recipients[0].KeyID, decoded.Recipients[1].KeyID = decoded.Recipients[1].KeyID, decoded.Recipients[0].KeyID
+
+		_, err = decoded.UnwrapKey(recipients[0])
+		if err == nil {
+			t.Fatal("swapped slot accepted")
+		}
+	})
+
+	t.Run("NoRecipient", func(t *testing.T) {
+		_, err := cipherio.NewEnvelopeWriter(ioutil.Discard, &header, dataKey, nil)
+		if err == nil {
+			t.Fatal("envelope without recipient accepted")
+		}
+	})
+}
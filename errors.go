@@ -0,0 +1,82 @@
+package cipherio
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// AlignmentError is returned when data ends in the middle of a block and no padding is defined.
+//
+// It wraps io.ErrUnexpectedEOF, so that errors.Is(err, io.ErrUnexpectedEOF) still holds.
+type AlignmentError struct {
+	Buffered int // number of bytes of the incomplete block
+	Missing  int // number of bytes needed to complete the block
+}
+
+func (e AlignmentError) Error() string {
+	return fmt.Sprintf("cipherio: data is not aligned to the block size: %d bytes buffered, %d more needed (or use a padding)", e.Buffered, e.Missing)
+}
+
+// Unwrap returns io.ErrUnexpectedEOF.
+func (e AlignmentError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
+
+// VerificationError is returned by a Writer created with WithVerification when a block cannot be
+// decrypted back to its input.
+type VerificationError struct {
+	Offset int64 // offset of the first faulty block in the output
+}
+
+func (e VerificationError) Error() string {
+	return fmt.Sprintf("cipherio: verification failed for block at offset %d", e.Offset)
+}
+
+// AccountingError is returned in strict mode when the wrapped Reader or Writer reports an invalid
+// number of bytes, which would otherwise corrupt the internal state. See WithStrictSource and
+// WithStrictDestination.
+type AccountingError struct {
+	Op        string // "read" or "write"
+	Requested int    // length of the buffer passed to the wrapped Reader or Writer
+	Reported  int    // number of bytes reported by the wrapped Reader or Writer
+}
+
+func (e AccountingError) Error() string {
+	return fmt.Sprintf("cipherio: wrapped %s reported %d bytes for a buffer of %d bytes", e.Op, e.Reported, e.Requested)
+}
+
+// PolicyError is returned by constructors when the current Policy rejects the requested algorithm.
+//
+// It wraps ErrNotApproved, so that errors.Is(err, ErrNotApproved) holds.
+type PolicyError struct {
+	Algorithm string // such as "ChaCha20" or "AES-CBC"
+	Reason    string // such as "not approved by FIPS 140-3"
+}
+
+func (e PolicyError) Error() string {
+	return fmt.Sprintf("cipherio: %s rejected by policy: %s", e.Algorithm, e.Reason)
+}
+
+// Unwrap returns ErrNotApproved.
+func (e PolicyError) Unwrap() error {
+	return ErrNotApproved
+}
+
+// StalledError is returned by a WatchdogReader or a WatchdogWriter when a call to the wrapped
+// Reader or Writer does not return within the configured timeout.
+//
+// It wraps ErrStalled, so that errors.Is(err, ErrStalled) holds.
+type StalledError struct {
+	Op      string        // "read" or "write"
+	Timeout time.Duration // duration after which the call was aborted
+}
+
+func (e StalledError) Error() string {
+	return fmt.Sprintf("cipherio: wrapped %s made no progress for %v", e.Op, e.Timeout)
+}
+
+// Unwrap returns ErrStalled.
+func (e StalledError) Unwrap() error {
+	return ErrStalled
+}
@@ -0,0 +1,22 @@
+package cipherio_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestAlignmentError(t *testing.T) {
+	var err error = cipherio.AlignmentError{Buffered: 5, Missing: 11}
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("AlignmentError should wrap ErrUnexpectedEOF")
+	}
+
+	var alignmentErr cipherio.AlignmentError
+	if !errors.As(err, &alignmentErr) || alignmentErr.Buffered != 5 || alignmentErr.Missing != 11 {
+		t.Fatalf("unexpected AlignmentError: %v", alignmentErr)
+	}
+}
@@ -0,0 +1,93 @@
+package cipherio
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// WithConcurrencyCheck makes the Reader panic when its methods are called concurrently, instead of
+// silently corrupting the stream. The panic names both calls, for example:
+//
+//	cipherio: concurrent calls to BlockReader.Read and BlockReader.Read (use a SyncReader)
+//
+// Detection relies on an atomic flag set for the duration of each call: it only catches calls that
+// actually overlap, and adds a small overhead. This is meant to be enabled in tests and debug
+// builds, along with the race detector when possible.
+func WithConcurrencyCheck() ReaderOption {
+	return func(o *readerOptions) {
+		o.exclusive = true
+	}
+}
+
+// WithWriteConcurrencyCheck is similar to WithConcurrencyCheck, for the methods of a Writer.
+func WithWriteConcurrencyCheck() WriterOption {
+	return func(o *writerOptions) {
+		o.exclusive = true
+	}
+}
+
+// Methods guarded by an exclusiveGuard.
+const (
+	methodRead int32 = iota + 1
+	methodWrite
+	methodWriteByte
+	methodFlush
+	methodTruncatePending
+	methodSetPadding
+	methodClose
+	methodFinalizeRecord
+	methodWipe
+	methodSkipTo
+)
+
+var methodNames = [...]string{
+	methodRead:            "Read",
+	methodWrite:           "Write",
+	methodWriteByte:       "WriteByte",
+	methodFlush:           "Flush",
+	methodTruncatePending: "TruncatePending",
+	methodSetPadding:      "SetPadding",
+	methodClose:           "Close",
+	methodFinalizeRecord:  "FinalizeRecord",
+	methodWipe:            "Wipe",
+	methodSkipTo:          "SkipTo",
+}
+
+// exclusiveGuard detects concurrent calls to the methods of a Reader or Writer. It does nothing
+// unless enabled.
+type exclusiveGuard struct {
+	owner   int32  // guarded method being called, if any, accessed atomically
+	enabled bool   // whether calls are checked
+	name    string // name of the guarded type, for panic messages
+	sync    string // name of the synchronized wrapper to suggest
+}
+
+func newExclusiveGuard(enabled bool, name, sync string) exclusiveGuard {
+	return exclusiveGuard{
+		enabled: enabled,
+		name:    name,
+		sync:    sync,
+	}
+}
+
+// acquire marks the given method as being called, or panics if another call is in progress.
+func (g *exclusiveGuard) acquire(method int32) {
+	if !g.enabled {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&g.owner, 0, method) {
+		// The other call may have returned meanwhile.
+		other := "another method"
+		if owner := atomic.LoadInt32(&g.owner); owner != 0 {
+			other = g.name + "." + methodNames[owner]
+		}
+		panic(fmt.Sprintf("cipherio: concurrent calls to %s.%s and %s (use a %s)", g.name, methodNames[method], other, g.sync))
+	}
+}
+
+// release marks the end of the call.
+func (g *exclusiveGuard) release() {
+	if g.enabled {
+		atomic.StoreInt32(&g.owner, 0)
+	}
+}
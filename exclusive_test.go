@@ -0,0 +1,142 @@
+package cipherio_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// gate signals each call to Read or Write, then blocks it until opened.
+type gate struct {
+	entered chan struct{}
+	open    chan struct{}
+}
+
+func newGate() *gate {
+	return &gate{
+		entered: make(chan struct{}, 1),
+		open:    make(chan struct{}),
+	}
+}
+
+func (g *gate) Read(p []byte) (int, error) {
+	g.entered <- struct{}{}
+	<-g.open
+	return 0, io.EOF
+}
+
+func (g *gate) Write(p []byte) (int, error) {
+	g.entered <- struct{}{}
+	<-g.open
+	return len(p), nil
+}
+
+// recoverPanic calls fn and returns the value of its panic, if any.
+func recoverPanic(fn func()) (value interface{}) {
+	defer func() {
+		value = recover()
+	}()
+	fn()
+	return nil
+}
+
+func TestConcurrencyCheck(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	t.Run("Reader", func(t *testing.T) {
+		src := newGate()
+		reader := cipherio.NewBlockReader(src, cipher.NewCBCDecrypter(aesCipher, iv), cipherio.WithConcurrencyCheck())
+
+		done := make(chan error)
+		go func() {
+			_, err := reader.Read(make([]byte, 64))
+			done <- err
+		}()
+		<-src.entered
+
+		value := recoverPanic(func() {
+			reader.Read(make([]byte, 64))
+		})
+		expectedValue := "cipherio: concurrent calls to BlockReader.Read and BlockReader.Read (use a SyncReader)"
+		if value != expectedValue {
+			t.Fatalf("unexpected panic: %v != %v", value, expectedValue)
+		}
+
+		// The first call is not affected, and the Reader can still be used once it returns.
+		close(src.open)
+		if err := <-done; err != io.EOF {
+			t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+		}
+		if _, err := reader.Read(make([]byte, 64)); err != io.EOF {
+			t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+		}
+	})
+
+	t.Run("Writer", func(t *testing.T) {
+		dst := newGate()
+		writer := cipherio.NewBlockWriter(dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithWriteConcurrencyCheck())
+
+		done := make(chan error)
+		go func() {
+			_, err := writer.Write(make([]byte, 64))
+			done <- err
+		}()
+		<-dst.entered
+
+		for _, tc := range []struct {
+			method string
+			fn     func()
+		}{
+			{"Write", func() { writer.Write(make([]byte, 64)) }},
+			{"WriteByte", func() { writer.WriteByte(0) }},
+			{"Flush", func() { writer.Flush() }},
+			{"Close", func() { writer.Close() }},
+			{"Wipe", func() { writer.Wipe() }},
+		} {
+			value := recoverPanic(tc.fn)
+			expectedValue := fmt.Sprintf("cipherio: concurrent calls to BlockWriter.%s and BlockWriter.Write (use a SyncWriter)", tc.method)
+			if value != expectedValue {
+				t.Fatalf("unexpected panic: %v != %v", value, expectedValue)
+			}
+		}
+
+		close(dst.open)
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+	})
+
+	t.Run("Serialized", func(t *testing.T) {
+		// Serialized calls never panic.
+		writer := cipherio.NewBlockWriter(ioutil.Discard, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithWriteConcurrencyCheck())
+		for i := 0; i < 10; i++ {
+			if _, err := writer.Write(make([]byte, 96)); err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+	})
+}
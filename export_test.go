@@ -0,0 +1,38 @@
+package cipherio
+
+import "io"
+
+// HKDF exposes hkdf to tests.
+var HKDF = hkdf
+
+// ResolveWorkers exposes resolveWorkers to tests, along with the size detection of CopyParallel.
+func ResolveWorkers(workers int, src io.Reader, chunkSize int) int {
+	return resolveWorkers(workers, inputSize(src), chunkSize)
+}
+
+// ReaderBuf exposes the whole internal buffer of a BlockReader to tests.
+func ReaderBuf(r *BlockReader) []byte {
+	return r.buf[:cap(r.buf)]
+}
+
+// WriterBuf exposes the whole internal buffer of a BlockWriter to tests.
+func WriterBuf(w *BlockWriter) []byte {
+	return w.buf[:cap(w.buf)]
+}
+
+// AbortWatchdog aborts the stalled Read of a WatchdogReader, as its timer does.
+func AbortWatchdog(r *WatchdogReader) {
+	r.watchdog.abort()
+}
+
+// PBKDF2 exposes pbkdf2 to tests.
+var PBKDF2 = pbkdf2
+
+// HChaCha20 exposes hChaCha20 to tests.
+var HChaCha20 = hChaCha20
+
+// FF3Encrypt exposes the rounds of FF31 to tests with an 8-byte tweak, as defined by the original
+// FF3, for which NIST published sample vectors.
+func FF3Encrypt(f *FF31, tweak, field []byte) ([]byte, error) {
+	return f.crypt(tweak[:4], tweak[4:], field, false)
+}
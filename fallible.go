@@ -0,0 +1,49 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// FallibleBlockMode is a BlockMode that may fail, such as one backed by an HSM or a PKCS#11 token.
+//
+// Since CryptBlocks cannot return an error, Err is called after each call to CryptBlocks. If it
+// returns an error, the blocks produced by this call are considered invalid: a BlockReader never
+// returns them and a BlockWriter never writes them. The error is then returned by the current and
+// all subsequent calls to Read, or to Write, Flush and Close, like any other terminal error.
+type FallibleBlockMode interface {
+	cipher.BlockMode
+
+	// Err returns the error encountered by the last call to CryptBlocks, if any.
+	Err() error
+}
+
+// blockModeErr returns the error of the given BlockMode if it is a FallibleBlockMode.
+func blockModeErr(blockMode cipher.BlockMode) error {
+	if fallible, ok := blockMode.(FallibleBlockMode); ok {
+		return fallible.Err()
+	}
+	return nil
+}
+
+// NewBlockReaderFromFactory is similar to NewBlockReaderWithPadding, except that the BlockMode is
+// obtained from the given factory, whose error is returned as is. This suits BlockModes whose
+// setup may fail, such as hardware-backed ones. See also FallibleBlockMode.
+func NewBlockReaderFromFactory(src io.Reader, factory func() (cipher.BlockMode, error), padding Padding, opts ...ReaderOption) (*BlockReader, error) {
+	blockMode, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	return NewBlockReaderWithPadding(src, blockMode, padding, opts...), nil
+}
+
+// NewBlockWriterFromFactory is similar to NewBlockWriterWithPadding, except that the BlockMode is
+// obtained from the given factory, whose error is returned as is. This suits BlockModes whose
+// setup may fail, such as hardware-backed ones. See also FallibleBlockMode.
+func NewBlockWriterFromFactory(dst io.Writer, factory func() (cipher.BlockMode, error), padding Padding, opts ...WriterOption) (*BlockWriter, error) {
+	blockMode, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	return NewBlockWriterWithPadding(dst, blockMode, padding, opts...), nil
+}
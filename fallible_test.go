@@ -0,0 +1,155 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// failingBlockMode fails once a given number of blocks has been crypted.
+type failingBlockMode struct {
+	cipher.BlockMode
+	failAfter int
+	blocks    int
+	err       error
+}
+
+func (m *failingBlockMode) CryptBlocks(dst, src []byte) {
+	m.BlockMode.CryptBlocks(dst, src)
+	m.blocks += len(src) / m.BlockSize()
+	if m.blocks > m.failAfter {
+		m.err = fmt.Errorf("device failure")
+	}
+}
+
+func (m *failingBlockMode) Err() error {
+	return m.err
+}
+
+func TestFallibleBlockMode(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 64*16)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, readSize := range []int{5, 16, 100, 4096} {
+		readSize := readSize
+		t.Run(fmt.Sprintf("Reader/%d", readSize), func(t *testing.T) {
+			reader, err := cipherio.NewBlockReaderFromFactory(bytes.NewReader(plaintext), func() (cipher.BlockMode, error) {
+				return &failingBlockMode{BlockMode: cipher.NewCBCEncrypter(aesCipher, iv), failAfter: 10}, nil
+			}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var result []byte
+			buf := make([]byte, readSize)
+			for {
+				n, err := reader.Read(buf)
+				result = append(result, buf[:n]...)
+				if err != nil {
+					if err.Error() != "device failure" {
+						t.Fatalf("unexpected err: %v", err)
+					}
+					break
+				}
+			}
+
+			// Only the blocks crypted before the failure may be returned.
+			expected := make([]byte, len(plaintext))
+			cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expected, plaintext)
+			if len(result) > 10*16 || !bytes.Equal(result, expected[:len(result)]) {
+				t.Fatalf("unexpected read bytes: %d bytes", len(result))
+			}
+
+			// The error is sticky.
+			n, err := reader.Read(buf)
+			if n != 0 || err == nil || err.Error() != "device failure" {
+				t.Fatalf("unexpected read after failure: %d, %v", n, err)
+			}
+		})
+	}
+
+	for _, writeSize := range []int{5, 16, 100, 4096} {
+		writeSize := writeSize
+		t.Run(fmt.Sprintf("Writer/%d", writeSize), func(t *testing.T) {
+			var dst bytes.Buffer
+			writer, err := cipherio.NewBlockWriterFromFactory(&dst, func() (cipher.BlockMode, error) {
+				return &failingBlockMode{BlockMode: cipher.NewCBCEncrypter(aesCipher, iv), failAfter: 10}, nil
+			}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var writeErr error
+			for offset := 0; offset < len(plaintext) && writeErr == nil; offset += writeSize {
+				end := offset + writeSize
+				if end > len(plaintext) {
+					end = len(plaintext)
+				}
+				_, writeErr = writer.Write(plaintext[offset:end])
+			}
+			if writeErr == nil {
+				writeErr = writer.Close()
+			}
+			if writeErr == nil || writeErr.Error() != "device failure" {
+				t.Fatalf("unexpected err: %v", writeErr)
+			}
+
+			// Only the blocks crypted before the failure may be written.
+			expected := make([]byte, len(plaintext))
+			cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expected, plaintext)
+			if dst.Len() > 10*16 || !bytes.Equal(dst.Bytes(), expected[:dst.Len()]) {
+				t.Fatalf("unexpected written bytes: %d bytes", dst.Len())
+			}
+
+			// The error is sticky.
+			err = writer.Close()
+			if err == nil || err.Error() != "device failure" {
+				t.Fatalf("unexpected close err: %v", err)
+			}
+		})
+	}
+
+	t.Run("FactoryError", func(t *testing.T) {
+		testErr := fmt.Errorf("no device")
+		factory := func() (cipher.BlockMode, error) {
+			return nil, testErr
+		}
+
+		_, err := cipherio.NewBlockReaderFromFactory(bytes.NewReader(nil), factory, nil)
+		if err != testErr {
+			t.Fatalf("unexpected reader err: %v != %v", err, testErr)
+		}
+		_, err = cipherio.NewBlockWriterFromFactory(ioutil.Discard, factory, nil)
+		if err != testErr {
+			t.Fatalf("unexpected writer err: %v != %v", err, testErr)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package cipherio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// EncryptFile (en|de)crypts the file at srcPath into the file at dstPath, using independent chunks
+// like CopyParallel. The output is identical to the one of CopyParallel with the same options. The
+// destination file is created or truncated, and removed if an error is encountered.
+//
+// Where supported, the source file is memory-mapped and each chunk is (en|de)crypted directly from
+// the mapping to a per-worker buffer, then written at its final position with WriteAt. This avoids
+// a read copy and any reordering. Otherwise, the source file is streamed with CopyParallel.
+func EncryptFile(dstPath, srcPath string, factory BlockModeFactory, opts ParallelOptions) (err error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dstPath)
+		}
+	}()
+
+	data, unmap, err := mmapFile(src, info.Size())
+	if err != nil {
+		// Fall back to streaming.
+		_, err = CopyParallel(context.Background(), dst, src, factory, opts)
+		return err
+	}
+	defer unmap()
+
+	return cryptMapped(dst, data, factory, opts)
+}
+
+// cryptMapped (en|de)crypts data chunk by chunk, in parallel, and writes each chunk to dst at the
+// same offset as in data.
+func cryptMapped(dst io.WriterAt, data []byte, factory BlockModeFactory, opts ParallelOptions) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	workers := resolveWorkers(opts.Workers, int64(len(data)), chunkSize)
+	chunks := (int64(len(data)) + int64(chunkSize) - 1) / int64(chunkSize)
+
+	var (
+		mu       sync.Mutex
+		next     int64
+		firstErr error
+	)
+
+	// nextChunk returns the index of the next chunk to process, or -1 once done or failed.
+	nextChunk := func() int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr != nil || next == chunks {
+			return -1
+		}
+		next++
+		return next - 1
+	}
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, chunkSize)
+			for index := nextChunk(); index >= 0; index = nextChunk() {
+				offset := index * int64(chunkSize)
+				end := offset + int64(chunkSize)
+				if end > int64(len(data)) {
+					end = int64(len(data))
+				}
+				if err := cryptMappedChunk(dst, data[offset:end], index, buf, factory, opts.Padding); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// cryptMappedChunk (en|de)crypts a chunk from src to buf, filling its last block with padding if
+// needed, then writes it to dst at the offset of src within the mapping.
+func cryptMappedChunk(dst io.WriterAt, src []byte, index int64, buf []byte, factory BlockModeFactory, padding Padding) error {
+	blockMode, err := factory(index)
+	if err != nil {
+		return err
+	}
+
+	chunkSize := len(buf)
+	blockSize := blockMode.BlockSize()
+	if chunkSize%blockSize != 0 {
+		return fmt.Errorf("cipherio: chunk size must be a multiple of the block size: %d %% %d != 0", chunkSize, blockSize)
+	}
+
+	// Crypt complete blocks without any preliminary copy.
+	aligned := len(src) - len(src)%blockSize
+	out := buf[:aligned]
+	blockMode.CryptBlocks(out, src[:aligned])
+
+	if remaining := len(src) - aligned; remaining > 0 {
+		if padding == nil {
+			return AlignmentError{
+				Buffered: remaining,
+				Missing:  blockSize - remaining,
+			}
+		}
+		last := buf[aligned : aligned+blockSize]
+		copy(last, src[aligned:])
+		padding.Fill(last[remaining:])
+		blockMode.CryptBlocks(last, last)
+		out = buf[:aligned+blockSize]
+	}
+
+	_, err = dst.WriteAt(out, index*int64(chunkSize))
+	return err
+}
@@ -0,0 +1,148 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type encryptFileTest struct {
+	Name    string
+	DataLen int
+	Padding cipherio.Padding
+}
+
+func TestEncryptFile(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Derive each chunk IV from its index
+	factory := func(chunkIndex int64) (cipher.BlockMode, error) {
+		iv := make([]byte, aesCipher.BlockSize())
+		binary.BigEndian.PutUint64(iv[8:], uint64(chunkIndex))
+		return cipher.NewCBCEncrypter(aesCipher, iv), nil
+	}
+
+	dir, err := ioutil.TempDir("", "cipherio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const chunkSize = 64
+
+	// Prepare test cases
+	testCases := []encryptFileTest{
+		{
+			Name:    "Empty",
+			DataLen: 0,
+		},
+		{
+			Name:    "ExactChunks",
+			DataLen: 100 * chunkSize,
+		},
+		{
+			Name:    "AlignedLastChunk",
+			DataLen: 100*chunkSize + 32,
+		},
+		{
+			Name:    "PaddedLastChunk",
+			DataLen: 100*chunkSize + 37,
+			Padding: cipherio.ZeroPadding,
+		},
+	}
+
+	// Run test cases
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			originalBytes := make([]byte, testCase.DataLen)
+			_, err := rand.Read(originalBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts := cipherio.ParallelOptions{
+				ChunkSize: chunkSize,
+				Workers:   4,
+				Padding:   testCase.Padding,
+			}
+
+			// The output must be the same as the one of CopyParallel.
+			var expected bytes.Buffer
+			_, err = cipherio.CopyParallel(context.Background(), &expected, bytes.NewReader(originalBytes), factory, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srcPath := filepath.Join(dir, testCase.Name+".src")
+			dstPath := filepath.Join(dir, testCase.Name+".dst")
+			err = ioutil.WriteFile(srcPath, originalBytes, 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = cipherio.EncryptFile(dstPath, srcPath, factory, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := ioutil.ReadFile(dstPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, expected.Bytes()) {
+				t.Fatalf("unexpected encrypted file")
+			}
+		})
+	}
+
+	t.Run("AlignmentError", func(t *testing.T) {
+		srcPath := filepath.Join(dir, "unaligned.src")
+		dstPath := filepath.Join(dir, "unaligned.dst")
+		err := ioutil.WriteFile(srcPath, make([]byte, 10*chunkSize+5), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cipherio.EncryptFile(dstPath, srcPath, factory, cipherio.ParallelOptions{
+			ChunkSize: chunkSize,
+		})
+		if err != (cipherio.AlignmentError{Buffered: 5, Missing: 11}) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// The incomplete destination file must have been removed.
+		_, err = os.Stat(dstPath)
+		if !os.IsNotExist(err) {
+			t.Fatalf("unexpected destination file: %v", err)
+		}
+	})
+
+	t.Run("MissingSource", func(t *testing.T) {
+		err := cipherio.EncryptFile(filepath.Join(dir, "missing.dst"), filepath.Join(dir, "missing.src"), factory, cipherio.ParallelOptions{})
+		if !os.IsNotExist(err) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+}
@@ -0,0 +1,465 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// CipherID identifies a block cipher in a StreamHeader.
+type CipherID uint8
+
+// Block ciphers supported by StreamHeader. Others can be added with RegisterCipher.
+const (
+	CipherAES CipherID = 1
+)
+
+// ModeID identifies a block mode in a StreamHeader.
+type ModeID uint8
+
+// Block modes supported by StreamHeader.
+const (
+	ModeCBC ModeID = 1
+)
+
+// PaddingID identifies a padding in a StreamHeader.
+type PaddingID uint8
+
+// Paddings supported by StreamHeader.
+const (
+	PaddingNone PaddingID = iota
+	PaddingZero
+	PaddingBit
+	PaddingPKCS7
+)
+
+// Padding returns the Padding identified by id, or nil for PaddingNone.
+func (id PaddingID) Padding() (Padding, error) {
+	switch id {
+	case PaddingNone:
+		return nil, nil
+	case PaddingZero:
+		return ZeroPadding, nil
+	case PaddingBit:
+		return BitPadding, nil
+	case PaddingPKCS7:
+		return PKCS7Padding, nil
+	}
+	return nil, fmt.Errorf("cipherio: unknown padding ID: %d", id)
+}
+
+// KDFID identifies how the data key is derived from the key given to NewStreamWriter and
+// NewStreamReader.
+type KDFID uint8
+
+// Key derivation functions supported by StreamHeader.
+const (
+	// KDFNone uses the given key as is.
+	KDFNone KDFID = iota
+	// KDFHKDFSHA256 derives a key of the same length with HKDF-SHA256, as defined by RFC 5869.
+	KDFHKDFSHA256
+)
+
+// KDFParams describes how the data key is derived.
+type KDFParams struct {
+	ID   KDFID
+	Salt []byte // at most 255 bytes
+	Info []byte // at most 255 bytes
+}
+
+// deriveKey returns the data key derived from key.
+func (p *KDFParams) deriveKey(key []byte) ([]byte, error) {
+	switch p.ID {
+	case KDFNone:
+		return key, nil
+	case KDFHKDFSHA256:
+		return hkdf(key, p.Salt, p.Info, len(key)), nil
+	}
+	return nil, fmt.Errorf("cipherio: unknown KDF ID: %d", p.ID)
+}
+
+// StreamHeader is a small versioned header describing how the rest of a stream is encrypted, so
+// that it can be decrypted by any tool knowing the key.
+//
+// Its binary format starts with an 8-byte magic including the format version, followed by the
+// length of the remaining fields on 2 bytes. Readers skip any trailing field they do not know,
+// which allows compatible extensions within a version.
+type StreamHeader struct {
+	Cipher  CipherID
+	Mode    ModeID
+	Padding PaddingID
+	KDF     KDFParams
+	IV      []byte // at most 255 bytes
+
+	// PlaintextLen is the number of bytes before padding, or -1 if unknown. When known, the
+	// padding is removed by NewStreamReader.
+	PlaintextLen int64
+
+	// Recipients holds the data key wrapped for each recipient of an envelope, at most 255. It is
+	// empty for streams written by NewStreamWriter. See NewEnvelopeWriter.
+	Recipients []RecipientSlot
+
+	// Commitment, if not empty, commits the stream to its key. It is set by SetCommitment and
+	// checked by NewStreamReader and NewEnvelopeReader before any decryption.
+	Commitment []byte
+
+	// Threshold, if not zero, means that Recipients hold shares of the data key rather than the
+	// data key itself, and that Threshold of them are needed to recover it. See
+	// NewSplitEnvelopeWriter.
+	Threshold int
+}
+
+// StreamHeaderVersion is the version of the StreamHeader format written by this package.
+const StreamHeaderVersion = 1
+
+var streamHeaderMagic = []byte("CIOSTRM")
+
+// ErrLengthMismatch is returned by the Reader of NewStreamReader when the decrypted stream is
+// shorter or longer than declared by the PlaintextLen of its header.
+var ErrLengthMismatch = errors.New("cipherio: stream length does not match header")
+
+// MarshalBinary encodes the header in its binary format.
+func (h *StreamHeader) MarshalBinary() ([]byte, error) {
+	for _, field := range []struct {
+		name  string
+		value []byte
+	}{
+		{"KDF salt", h.KDF.Salt},
+		{"KDF info", h.KDF.Info},
+		{"IV", h.IV},
+		{"commitment", h.Commitment},
+	} {
+		if len(field.value) > 255 {
+			return nil, fmt.Errorf("cipherio: stream header %s is too long: %d > 255", field.name, len(field.value))
+		}
+	}
+
+	var body bytes.Buffer
+	body.Write([]byte{byte(h.Cipher), byte(h.Mode), byte(h.Padding), byte(h.KDF.ID)})
+	body.WriteByte(byte(len(h.KDF.Salt)))
+	body.Write(h.KDF.Salt)
+	body.WriteByte(byte(len(h.KDF.Info)))
+	body.Write(h.KDF.Info)
+	body.WriteByte(byte(len(h.IV)))
+	body.Write(h.IV)
+	binary.Write(&body, binary.BigEndian, h.PlaintextLen)
+	if err := marshalRecipients(&body, h.Recipients); err != nil {
+		return nil, err
+	}
+	body.WriteByte(byte(len(h.Commitment)))
+	body.Write(h.Commitment)
+	if h.Threshold < 0 || h.Threshold > 255 {
+		return nil, fmt.Errorf("cipherio: invalid stream header threshold: %d", h.Threshold)
+	}
+	body.WriteByte(byte(h.Threshold))
+	if body.Len() > math.MaxUint16 {
+		return nil, fmt.Errorf("cipherio: stream header is too long: %d > %d", body.Len(), math.MaxUint16)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(streamHeaderMagic)
+	buf.WriteByte(StreamHeaderVersion)
+	binary.Write(&buf, binary.BigEndian, uint16(body.Len()))
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a header encoded by MarshalBinary. Trailing bytes are rejected.
+func (h *StreamHeader) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	if err := h.readFrom(r); err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return errors.New("cipherio: invalid stream header")
+	}
+	return nil
+}
+
+// ReadStreamHeader reads a header from the start of r, which is left at the first byte following
+// it.
+func ReadStreamHeader(r io.Reader) (*StreamHeader, error) {
+	h := &StreamHeader{}
+	if err := h.readFrom(r); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *StreamHeader) readFrom(r io.Reader) error {
+	prefix := make([]byte, len(streamHeaderMagic)+3)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return errors.New("cipherio: truncated stream header")
+	}
+	if !bytes.Equal(prefix[:len(streamHeaderMagic)], streamHeaderMagic) {
+		return errors.New("cipherio: invalid stream header")
+	}
+	if version := prefix[len(streamHeaderMagic)]; version != StreamHeaderVersion {
+		return fmt.Errorf("cipherio: unsupported stream header version: %d", version)
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(prefix[len(streamHeaderMagic)+1:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return errors.New("cipherio: truncated stream header")
+	}
+	return h.parseBody(body)
+}
+
+func (h *StreamHeader) parseBody(body []byte) error {
+	r := bytes.NewReader(body)
+	truncated := errors.New("cipherio: truncated stream header")
+
+	ids := make([]byte, 4)
+	if _, err := io.ReadFull(r, ids); err != nil {
+		return truncated
+	}
+
+	var fields [3][]byte
+	for i := range fields {
+		n, err := r.ReadByte()
+		if err != nil {
+			return truncated
+		}
+		if n == 0 {
+			continue
+		}
+		fields[i] = make([]byte, n)
+		if _, err := io.ReadFull(r, fields[i]); err != nil {
+			return truncated
+		}
+	}
+
+	var plaintextLen int64
+	if err := binary.Read(r, binary.BigEndian, &plaintextLen); err != nil {
+		return truncated
+	}
+	if plaintextLen < -1 {
+		return errors.New("cipherio: invalid stream header")
+	}
+
+	// Recipients were added after the first revision of this version.
+	var recipients []RecipientSlot
+	if r.Len() > 0 {
+		var err error
+		if recipients, err = unmarshalRecipients(r); err != nil {
+			return err
+		}
+	}
+
+	// So was the commitment.
+	var commitment []byte
+	if r.Len() > 0 {
+		n, _ := r.ReadByte()
+		if n > 0 {
+			commitment = make([]byte, n)
+			if _, err := io.ReadFull(r, commitment); err != nil {
+				return truncated
+			}
+		}
+	}
+	// And so was the threshold.
+	var threshold byte
+	if r.Len() > 0 {
+		threshold, _ = r.ReadByte()
+	}
+	// Any remaining byte belongs to a newer revision of this version, and is ignored.
+
+	h.Cipher = CipherID(ids[0])
+	h.Mode = ModeID(ids[1])
+	h.Padding = PaddingID(ids[2])
+	h.KDF = KDFParams{
+		ID:   KDFID(ids[3]),
+		Salt: fields[0],
+		Info: fields[1],
+	}
+	h.IV = fields[2]
+	h.PlaintextLen = plaintextLen
+	h.Recipients = recipients
+	h.Commitment = commitment
+	h.Threshold = int(threshold)
+	return nil
+}
+
+// NewEncrypter returns the encrypting BlockMode described by the header for the given key.
+func (h *StreamHeader) NewEncrypter(key []byte) (cipher.BlockMode, error) {
+	return h.newBlockMode(key, cipher.NewCBCEncrypter)
+}
+
+// NewDecrypter returns the decrypting BlockMode described by the header for the given key.
+func (h *StreamHeader) NewDecrypter(key []byte) (cipher.BlockMode, error) {
+	return h.newBlockMode(key, cipher.NewCBCDecrypter)
+}
+
+func (h *StreamHeader) newBlockMode(key []byte, newCBC func(cipher.Block, []byte) cipher.BlockMode) (cipher.BlockMode, error) {
+	block, err := h.newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch h.Mode {
+	case ModeCBC:
+		if err := checkPolicy(h.Cipher.String()+"-CBC", true, false); err != nil {
+			return nil, err
+		}
+		return newCBC(block, h.IV), nil
+	}
+	return nil, fmt.Errorf("cipherio: unknown mode ID: %d", h.Mode)
+}
+
+// newBlock returns the block cipher described by the header for the given key, after having
+// checked the IV against its block size.
+func (h *StreamHeader) newBlock(key []byte) (cipher.Block, error) {
+	dataKey, err := h.KDF.deriveKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := h.Cipher.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkIV(h.IV, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// NewStreamWriter writes the given header to dst, then returns a BlockWriter encrypting the rest
+// of the stream as described by the header.
+//
+// If an IVRegistry is configured, ErrIVReuse is returned when the IV of the header has already been
+// used with the same key. See WithIVRegistry.
+func NewStreamWriter(dst io.Writer, header *StreamHeader, key []byte, opts ...WriterOption) (*BlockWriter, error) {
+	if err := header.VerifyCommitment(key); err != nil {
+		return nil, err
+	}
+	padding, err := header.Padding.Padding()
+	if err != nil {
+		return nil, err
+	}
+	blockMode, err := header.NewEncrypter(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Register the actual key of the block cipher.
+	dataKey, err := header.KDF.deriveKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := registerIV(opts, dataKey, header.IV); err != nil {
+		return nil, err
+	}
+
+	data, err := header.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(data); err != nil {
+		return nil, err
+	}
+
+	return NewBlockWriterWithPadding(dst, blockMode, padding, opts...), nil
+}
+
+// NewStreamReader reads a header from src, then returns a Reader decrypting the rest of the stream
+// as described by the header, along with the header itself.
+//
+// If the header specifies the plaintext length, the padding is removed, and ErrLengthMismatch is
+// returned if the stream does not end exactly after the padded plaintext. This detects truncated or
+// extended streams, even when they end with a valid padding. Otherwise, the padding is kept.
+func NewStreamReader(src io.Reader, key []byte, opts ...ReaderOption) (io.Reader, *StreamHeader, error) {
+	header, err := ReadStreamHeader(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := newStreamReader(src, header, key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, header, nil
+}
+
+// newStreamReader returns a Reader decrypting src, positioned after the given header.
+func newStreamReader(src io.Reader, header *StreamHeader, key []byte, opts []ReaderOption) (io.Reader, error) {
+	if err := header.checkCommitment(key, newReaderOptions(opts).requireCommitment); err != nil {
+		return nil, err
+	}
+
+	blockMode, err := header.NewDecrypter(key)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := NewBlockReader(src, blockMode, opts...)
+	if header.PlaintextLen < 0 {
+		return reader, nil
+	}
+
+	padding, err := header.Padding.Padding()
+	if err != nil {
+		return nil, err
+	}
+	size := EncryptedSize(header.PlaintextLen, blockMode.BlockSize(), padding)
+	if size < 0 {
+		return nil, ErrLengthMismatch
+	}
+	return &exactReader{
+		src:       reader,
+		remaining: header.PlaintextLen,
+		trailing:  size - header.PlaintextLen,
+	}, nil
+}
+
+// exactReader returns exactly remaining bytes from src, then checks that src ends after trailing
+// more bytes.
+type exactReader struct {
+	src       io.Reader
+	remaining int64
+	trailing  int64
+	err       error
+}
+
+func (r *exactReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.remaining == 0 {
+		r.err = r.checkEnd()
+		return 0, r.err
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.src.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF {
+		if r.remaining > 0 {
+			err = ErrLengthMismatch
+		} else {
+			err = r.checkEnd()
+		}
+	}
+	r.err = err
+	return n, err
+}
+
+// checkEnd discards the trailing bytes and returns io.EOF if src ends right after them, or
+// ErrLengthMismatch otherwise.
+func (r *exactReader) checkEnd() error {
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(r.src, r.trailing+1))
+	if err != nil {
+		return err
+	}
+	if n != r.trailing {
+		return ErrLengthMismatch
+	}
+	return io.EOF
+}
@@ -0,0 +1,299 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type streamFormatTest struct {
+	Name   string
+	Header cipherio.StreamHeader
+	Size   int
+}
+
+func TestStreamFormat(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Prepare test cases
+	testCases := []streamFormatTest{
+		{
+			Name: "Aligned",
+			Header: cipherio.StreamHeader{
+				Cipher:       cipherio.CipherAES,
+				Mode:         cipherio.ModeCBC,
+				Padding:      cipherio.PaddingNone,
+				IV:           iv,
+				PlaintextLen: -1,
+			},
+			Size: 1024,
+		},
+		{
+			Name: "UnknownLength",
+			Header: cipherio.StreamHeader{
+				Cipher:       cipherio.CipherAES,
+				Mode:         cipherio.ModeCBC,
+				Padding:      cipherio.PaddingZero,
+				IV:           iv,
+				PlaintextLen: -1,
+			},
+			Size: 1000,
+		},
+		{
+			Name: "KnownLength",
+			Header: cipherio.StreamHeader{
+				Cipher:       cipherio.CipherAES,
+				Mode:         cipherio.ModeCBC,
+				Padding:      cipherio.PaddingPKCS7,
+				IV:           iv,
+				PlaintextLen: 1000,
+			},
+			Size: 1000,
+		},
+		{
+			Name: "HKDF",
+			Header: cipherio.StreamHeader{
+				Cipher:  cipherio.CipherAES,
+				Mode:    cipherio.ModeCBC,
+				Padding: cipherio.PaddingBit,
+				KDF: cipherio.KDFParams{
+					ID:   cipherio.KDFHKDFSHA256,
+					Salt: []byte("salt"),
+					Info: []byte("info"),
+				},
+				IV:           iv,
+				PlaintextLen: 1000,
+			},
+			Size: 1000,
+		},
+	}
+
+	// Run test cases
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			plaintext := make([]byte, testCase.Size)
+			_, err := rand.Read(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var stream bytes.Buffer
+			writer, err := cipherio.NewStreamWriter(&stream, &testCase.Header, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = writer.Write(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader, header, err := cipherio.NewStreamReader(bytes.NewReader(stream.Bytes()), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(header, &testCase.Header) {
+				t.Fatalf("unexpected header: %+v != %+v", header, testCase.Header)
+			}
+
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testCase.Header.PlaintextLen < 0 {
+				// The padding is kept.
+				result = result[:len(plaintext)]
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatalf("unexpected decrypted bytes")
+			}
+
+			// The header can be decoded on its own.
+			data, err := testCase.Header.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded cipherio.StreamHeader
+			err = decoded.UnmarshalBinary(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&decoded, &testCase.Header) {
+				t.Fatalf("unexpected decoded header: %+v != %+v", decoded, testCase.Header)
+			}
+		})
+	}
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		IV:           iv,
+		PlaintextLen: 32,
+	}
+	data, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		for length := 0; length < len(data); length++ {
+			var decoded cipherio.StreamHeader
+			if decoded.UnmarshalBinary(data[:length]) == nil {
+				t.Fatalf("truncated header accepted: %d bytes", length)
+			}
+		}
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		// Each field fits, but not the whole body.
+		long := header
+		long.Recipients = []cipherio.RecipientSlot{
+			{KeyID: []byte("a"), WrappedKey: make([]byte, 65535)},
+			{KeyID: []byte("b"), WrappedKey: make([]byte, 16)},
+		}
+		_, err := long.MarshalBinary()
+		if err == nil || !strings.HasPrefix(err.Error(), "cipherio: stream header is too long: ") {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	t.Run("UnsupportedVersion", func(t *testing.T) {
+		modified := append([]byte(nil), data...)
+		modified[7] = 2
+		_, err := cipherio.ReadStreamHeader(bytes.NewReader(modified))
+		if err == nil || err.Error() != "cipherio: unsupported stream header version: 2" {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	t.Run("ExtendedHeader", func(t *testing.T) {
+		// Unknown trailing fields are skipped.
+		extended := append([]byte(nil), data...)
+		extended[9] += 3
+		extended = append(extended, 1, 2, 3)
+		extended = append(extended, "data"...)
+
+		r := bytes.NewReader(extended)
+		decoded, err := cipherio.ReadStreamHeader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, &header) {
+			t.Fatalf("unexpected decoded header: %+v != %+v", decoded, header)
+		}
+		rest, _ := ioutil.ReadAll(r)
+		if string(rest) != "data" {
+			t.Fatalf("unexpected remaining bytes: %q", rest)
+		}
+	})
+
+	t.Run("ShortStream", func(t *testing.T) {
+		aesCipher, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Only one block follows the header, while 32 bytes are expected.
+		stream := append([]byte(nil), data...)
+		block := make([]byte, 16)
+		cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(block, block)
+		stream = append(stream, block...)
+
+		reader, _, err := cipherio.NewStreamReader(bytes.NewReader(stream), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(reader)
+		if err != cipherio.ErrLengthMismatch {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrLengthMismatch)
+		}
+	})
+
+	t.Run("LongStream", func(t *testing.T) {
+		aesCipher, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Three blocks follow the header, while 32 bytes are expected.
+		stream := append([]byte(nil), data...)
+		blocks := make([]byte, 48)
+		cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(blocks, blocks)
+		stream = append(stream, blocks...)
+
+		reader, _, err := cipherio.NewStreamReader(bytes.NewReader(stream), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plaintext, err := ioutil.ReadAll(reader)
+		if err != cipherio.ErrLengthMismatch {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrLengthMismatch)
+		}
+		if len(plaintext) != 32 {
+			t.Fatalf("unexpected plaintext length: %d != %d", len(plaintext), 32)
+		}
+	})
+
+	t.Run("TruncatedPadding", func(t *testing.T) {
+		padded := header
+		padded.Padding = cipherio.PaddingPKCS7
+		padded.PlaintextLen = 20
+		paddedData, err := padded.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		aesCipher, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The plaintext is complete, but the padded block is missing.
+		stream := append([]byte(nil), paddedData...)
+		blocks := make([]byte, 32)
+		cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(blocks, blocks)
+		stream = append(stream, blocks[:16]...)
+
+		reader, _, err := cipherio.NewStreamReader(bytes.NewReader(stream), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(reader)
+		if err != cipherio.ErrLengthMismatch {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrLengthMismatch)
+		}
+	})
+
+	t.Run("InvalidIV", func(t *testing.T) {
+		invalid := header
+		invalid.IV = iv[:8]
+		_, err := cipherio.NewStreamWriter(ioutil.Discard, &invalid, key)
+		if !errors.Is(err, cipherio.ErrInvalidIV) || err.Error() != "cipherio: invalid IV: length must equal block size: 8 != 16" {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package cipherio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownFormat is returned by Open and DetectFormat when the input does not start with the
+// magic of any registered format, and by Create for an unregistered format name.
+var ErrUnknownFormat = errors.New("cipherio: unknown format")
+
+// FormatHandlers plugs a stream format into Open and Create. See RegisterFormat.
+type FormatHandlers struct {
+	// Magic is the prefix of every stream of this format, used by Open to detect it. It must not
+	// be empty, nor be a prefix of the magic of another format, or conversely.
+	Magic []byte
+
+	// NewReader returns a Reader decrypting src, which starts with Magic.
+	NewReader func(src io.Reader, key []byte, opts ...ReaderOption) (io.Reader, error)
+
+	// NewWriter returns a WriteCloser encrypting to dst. The size is the number of plaintext bytes
+	// that will be written, or -1 if unknown. It may be nil for read-only formats.
+	NewWriter func(dst io.Writer, key []byte, size int64, opts ...WriterOption) (io.WriteCloser, error)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]FormatHandlers{
+		"stream": {
+			Magic:     appendVersion(streamHeaderMagic, StreamHeaderVersion),
+			NewReader: openStream,
+			NewWriter: createStream,
+		},
+		"openssl-enc": {
+			Magic:     openSSLMagic,
+			NewReader: openOpenSSL,
+			NewWriter: createOpenSSL,
+		},
+	}
+)
+
+// RegisterFormat makes a stream format available to Open and Create under the given name, so
+// that external packages can provide their own formats to generic tools such as the cipherio
+// command. It is typically called from an init function.
+//
+// RegisterFormat panics if the name is already registered, including the built-in "stream" and
+// "openssl-enc" formats, if NewReader is nil, or if the magic is empty or conflicts with another format.
+func RegisterFormat(name string, handlers FormatHandlers) {
+	if handlers.NewReader == nil {
+		panic("cipherio: RegisterFormat with a nil NewReader")
+	}
+	if len(handlers.Magic) == 0 {
+		panic("cipherio: RegisterFormat with an empty magic")
+	}
+	handlers.Magic = append([]byte(nil), handlers.Magic...)
+
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	if _, ok := formats[name]; ok {
+		panic(fmt.Sprintf("cipherio: format %s already registered", name))
+	}
+	for other, registered := range formats {
+		if bytes.HasPrefix(handlers.Magic, registered.Magic) || bytes.HasPrefix(registered.Magic, handlers.Magic) {
+			panic(fmt.Sprintf("cipherio: magic of format %s conflicts with format %s", name, other))
+		}
+	}
+	formats[name] = handlers
+}
+
+// DetectFormat returns the name of the registered format whose magic starts r, without consuming
+// it.
+func DetectFormat(r *bufio.Reader) (string, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for name, handlers := range formats {
+		// Magics cannot be prefixes of each other, so at most one format matches.
+		prefix, _ := r.Peek(len(handlers.Magic))
+		if bytes.Equal(prefix, handlers.Magic) {
+			return name, nil
+		}
+	}
+	return "", ErrUnknownFormat
+}
+
+// Open detects the format of src among registered formats, and returns a Reader decrypting it,
+// along with the name of the format.
+//
+// Unless src is a bufio.Reader, it is wrapped into one, so it may be consumed beyond the stream.
+func Open(src io.Reader, key []byte, opts ...ReaderOption) (io.Reader, string, error) {
+	r, ok := src.(*bufio.Reader)
+	if !ok {
+		r = bufio.NewReader(src)
+	}
+
+	name, err := DetectFormat(r)
+	if err != nil {
+		return nil, "", err
+	}
+	handlers, _ := lookupFormat(name)
+
+	reader, err := handlers.NewReader(r, key, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return reader, name, nil
+}
+
+// Create returns a WriteCloser encrypting to dst in the given registered format. The size is the
+// number of plaintext bytes that will be written, or -1 if unknown.
+//
+// The built-in "stream" format uses AES-CBC with a random IV and a key commitment. It is padded
+// with PKCS#7 if size is known, so that the padding can be removed. Otherwise, the plaintext must
+// be aligned to the block size.
+func Create(dst io.Writer, format string, key []byte, size int64, opts ...WriterOption) (io.WriteCloser, error) {
+	handlers, ok := lookupFormat(format)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	if handlers.NewWriter == nil {
+		return nil, fmt.Errorf("cipherio: format %s cannot be written", format)
+	}
+	return handlers.NewWriter(dst, key, size, opts...)
+}
+
+// lookupFormat returns the handlers registered under the given name.
+func lookupFormat(name string) (FormatHandlers, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	handlers, ok := formats[name]
+	return handlers, ok
+}
+
+// registeredFormats returns the descriptors of the formats added with RegisterFormat, sorted by
+// name.
+func registeredFormats() []FormatDescriptor {
+	formatsMu.RLock()
+	var descriptors []FormatDescriptor
+	for name, handlers := range formats {
+		if name != "stream" && name != "openssl-enc" {
+			descriptors = append(descriptors, FormatDescriptor{Name: name, Magic: append([]byte(nil), handlers.Magic...)})
+		}
+	}
+	formatsMu.RUnlock()
+
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].Name < descriptors[j].Name
+	})
+	return descriptors
+}
+
+// openStream is the NewReader handler of the "stream" format.
+func openStream(src io.Reader, key []byte, opts ...ReaderOption) (io.Reader, error) {
+	reader, _, err := NewStreamReader(src, key, opts...)
+	return reader, err
+}
+
+// createStream is the NewWriter handler of the "stream" format.
+func createStream(dst io.Writer, key []byte, size int64, opts ...WriterOption) (io.WriteCloser, error) {
+	options := newWriterOptions(opts)
+
+	header := &StreamHeader{
+		Cipher:       CipherAES,
+		Mode:         ModeCBC,
+		IV:           make([]byte, 16),
+		PlaintextLen: size,
+	}
+	if size >= 0 {
+		header.Padding = PaddingPKCS7
+	}
+	if _, err := io.ReadFull(randOrDefault(options.rand), header.IV); err != nil {
+		return nil, err
+	}
+	header.SetCommitment(key)
+
+	return NewStreamWriter(dst, header, key, opts...)
+}
+
+// openOpenSSL is the NewReader handler of the "openssl-enc" format, whose key is the password
+// given to "openssl enc -aes-256-cbc -pbkdf2".
+func openOpenSSL(src io.Reader, password []byte, opts ...ReaderOption) (io.Reader, error) {
+	return newOpenSSLReader(src, password, OpenSSLOptions{}, opts)
+}
+
+// createOpenSSL is the NewWriter handler of the "openssl-enc" format.
+func createOpenSSL(dst io.Writer, password []byte, size int64, opts ...WriterOption) (io.WriteCloser, error) {
+	options := newWriterOptions(opts)
+	return NewOpenSSLWriter(dst, password, OpenSSLOptions{Rand: options.rand})
+}
@@ -0,0 +1,189 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// xorFormat is a toy format XORing data with the first byte of the key, after a magic.
+var xorFormat = cipherio.FormatHandlers{
+	Magic: []byte("TESTXOR\x01"),
+	NewReader: func(src io.Reader, key []byte, opts ...cipherio.ReaderOption) (io.Reader, error) {
+		magic := make([]byte, 8)
+		if _, err := io.ReadFull(src, magic); err != nil {
+			return nil, err
+		}
+		return &xorReader{src, key[0]}, nil
+	},
+}
+
+type xorReader struct {
+	src io.Reader
+	key byte
+}
+
+func (r *xorReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	for i := range p[:n] {
+		p[i] ^= r.key
+	}
+	return n, err
+}
+
+func init() {
+	cipherio.RegisterFormat("test-xor", xorFormat)
+}
+
+func TestCreateOpen(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Name  string
+		Size  int
+		Known bool
+	}{
+		{"KnownUnaligned", 1000, true},
+		{"KnownEmpty", 0, true},
+		{"UnknownAligned", 1024, false},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			plaintext := make([]byte, testCase.Size)
+			_, err := rand.Read(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := int64(-1)
+			if testCase.Known {
+				size = int64(len(plaintext))
+			}
+
+			var buf bytes.Buffer
+			writer, err := cipherio.Create(&buf, "stream", key, size)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			_, err = writer.Write(plaintext)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+
+			reader, format, err := cipherio.Open(&buf, key)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if format != "stream" {
+				t.Fatalf("unexpected format: %s != %s", format, "stream")
+			}
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatal("decrypted data does not match plaintext")
+			}
+		})
+	}
+}
+
+func TestCreateUnalignedUnknownSize(t *testing.T) {
+	writer, err := cipherio.Create(ioutil.Discard, "stream", make([]byte, 16), -1)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write([]byte("unaligned"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected err: %v != %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestOpenRegisteredFormat(t *testing.T) {
+	src := append([]byte("TESTXOR\x01"), 'h'^7, 'i'^7)
+	reader, format, err := cipherio.Open(bytes.NewReader(src), []byte{7})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if format != "test-xor" {
+		t.Fatalf("unexpected format: %s != %s", format, "test-xor")
+	}
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if string(result) != "hi" {
+		t.Fatalf("unexpected result: %q", result)
+	}
+
+	_, err = cipherio.Create(ioutil.Discard, "test-xor", []byte{7}, -1)
+	if err == nil {
+		t.Fatal("read-only format has been created")
+	}
+
+	found := false
+	for _, descriptor := range cipherio.SupportedFormats() {
+		found = found || descriptor.Name == "test-xor"
+	}
+	if !found {
+		t.Fatal("registered format is not supported")
+	}
+}
+
+func TestOpenUnknownFormat(t *testing.T) {
+	_, _, err := cipherio.Open(bytes.NewReader([]byte("garbage")), nil)
+	if err != cipherio.ErrUnknownFormat {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrUnknownFormat)
+	}
+
+	_, err = cipherio.Create(ioutil.Discard, "garbage", nil, -1)
+	if !errors.Is(err, cipherio.ErrUnknownFormat) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrUnknownFormat)
+	}
+}
+
+func TestRegisterFormatPanics(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Format   string
+		Handlers cipherio.FormatHandlers
+	}{
+		{"Duplicate", "stream", xorFormat},
+		{"NilReader", "nil-reader", cipherio.FormatHandlers{Magic: []byte("NILREAD")}},
+		{"EmptyMagic", "empty-magic", cipherio.FormatHandlers{NewReader: xorFormat.NewReader}},
+		{"ConflictingMagic", "conflict", cipherio.FormatHandlers{Magic: []byte("TESTXOR"), NewReader: xorFormat.NewReader}},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("RegisterFormat did not panic")
+				}
+			}()
+			cipherio.RegisterFormat(testCase.Format, testCase.Handlers)
+		})
+	}
+}
@@ -0,0 +1,521 @@
+package cipherio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+)
+
+// ErrInvalidFPEInput is returned when a field to (en|de)crypt contains a character outside of the
+// alphabet of the FPE cipher.
+var ErrInvalidFPEInput = errors.New("cipherio: character outside of the FPE alphabet")
+
+// FPE is a format-preserving cipher, such as FF1 or FF31: the ciphertext of a field has the same
+// length and alphabet as its plaintext, so that tokenized records keep their layout.
+type FPE interface {
+	// Encrypt returns the encryption of the given field under the given tweak.
+	Encrypt(tweak, field []byte) ([]byte, error)
+
+	// Decrypt returns the decryption of the given field under the given tweak.
+	Decrypt(tweak, field []byte) ([]byte, error)
+
+	// MinLen and MaxLen are the lengths of the shortest and longest supported fields.
+	MinLen() int
+	MaxLen() int
+}
+
+// fpeAlphabet maps the characters of an alphabet to digits in the corresponding radix.
+type fpeAlphabet struct {
+	chars  string
+	digits [256]int16 // digit of each character, or -1
+	radix  *big.Int
+}
+
+func newFPEAlphabet(chars string) (*fpeAlphabet, error) {
+	if len(chars) < 2 || len(chars) > 256 {
+		return nil, fmt.Errorf("cipherio: FPE alphabet must have between 2 and 256 characters: %d", len(chars))
+	}
+	a := &fpeAlphabet{
+		chars: chars,
+		radix: big.NewInt(int64(len(chars))),
+	}
+	for i := range a.digits {
+		a.digits[i] = -1
+	}
+	for i := 0; i < len(chars); i++ {
+		if a.digits[chars[i]] >= 0 {
+			return nil, fmt.Errorf("cipherio: duplicate character in FPE alphabet: %q", chars[i])
+		}
+		a.digits[chars[i]] = int16(i)
+	}
+	return a, nil
+}
+
+// toDigits converts the characters of a field to digits.
+func (a *fpeAlphabet) toDigits(field []byte) ([]byte, error) {
+	digits := make([]byte, len(field))
+	for i, c := range field {
+		digit := a.digits[c]
+		if digit < 0 {
+			return nil, ErrInvalidFPEInput
+		}
+		digits[i] = byte(digit)
+	}
+	return digits, nil
+}
+
+// toChars converts digits back to characters, in place.
+func (a *fpeAlphabet) toChars(digits []byte) []byte {
+	for i, digit := range digits {
+		digits[i] = a.chars[digit]
+	}
+	return digits
+}
+
+// num returns the number represented by the given digits, most significant first.
+func (a *fpeAlphabet) num(digits []byte) *big.Int {
+	x := new(big.Int)
+	d := new(big.Int)
+	for _, digit := range digits {
+		x.Mul(x, a.radix)
+		x.Add(x, d.SetInt64(int64(digit)))
+	}
+	return x
+}
+
+// str returns the m digits representing x, most significant first. x must be lower than radix^m.
+func (a *fpeAlphabet) str(x *big.Int, m int) []byte {
+	digits := make([]byte, m)
+	x = new(big.Int).Set(x)
+	r := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		x.QuoRem(x, a.radix, r)
+		digits[i] = byte(r.Int64())
+	}
+	return digits
+}
+
+// pow returns radix^m.
+func (a *fpeAlphabet) pow(m int) *big.Int {
+	return new(big.Int).Exp(a.radix, big.NewInt(int64(m)), nil)
+}
+
+// minLen returns the smallest length such that radix^minLen >= 1000000, as required by NIST
+// SP 800-38G for both FF1 and FF3-1.
+func (a *fpeAlphabet) minLen() int {
+	threshold := big.NewInt(1000000)
+	n := 2
+	for a.pow(n).Cmp(threshold) < 0 {
+		n++
+	}
+	return n
+}
+
+// putNum writes x in big-endian order into dst, which must be large enough.
+func putNum(dst []byte, x *big.Int) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	b := x.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
+
+// reverse reverses b in place, and returns it.
+func reverse(b []byte) []byte {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
+
+// FF1 implements the FF1 format-preserving encryption mode of NIST SP 800-38G with AES, over the
+// characters of a given alphabet. Tweaks may have any length.
+//
+// FF1 is safe for concurrent use.
+type FF1 struct {
+	block    cipher.Block
+	alphabet *fpeAlphabet
+	minLen   int
+}
+
+// NewFF1 returns an FF1 cipher with the given AES key, for fields made of the characters of the
+// given alphabet, such as "0123456789". The radix is the number of characters.
+func NewFF1(key []byte, alphabet string) (*FF1, error) {
+	block, err := newAESCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	a, err := newFPEAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return &FF1{block: block, alphabet: a, minLen: a.minLen()}, nil
+}
+
+// MinLen returns the length of the shortest supported field.
+func (f *FF1) MinLen() int {
+	return f.minLen
+}
+
+// MaxLen returns the length of the longest supported field.
+func (f *FF1) MaxLen() int {
+	return 1<<31 - 1
+}
+
+// Encrypt returns the encryption of the given field under the given tweak.
+func (f *FF1) Encrypt(tweak, field []byte) ([]byte, error) {
+	return f.crypt(tweak, field, false)
+}
+
+// Decrypt returns the decryption of the given field under the given tweak.
+func (f *FF1) Decrypt(tweak, field []byte) ([]byte, error) {
+	return f.crypt(tweak, field, true)
+}
+
+func (f *FF1) crypt(tweak, field []byte, decrypt bool) ([]byte, error) {
+	n := len(field)
+	if n < f.minLen {
+		return nil, fmt.Errorf("cipherio: FF1 field must have at least %d characters: %d", f.minLen, n)
+	}
+	digits, err := f.alphabet.toDigits(field)
+	if err != nil {
+		return nil, err
+	}
+
+	u := n / 2
+	v := n - u
+	a, b := digits[:u], digits[u:]
+	radix := len(f.alphabet.chars)
+	byteLen := (new(big.Int).Sub(f.alphabet.pow(v), big.NewInt(1)).BitLen() + 7) / 8
+	d := 4*((byteLen+3)/4) + 4
+	modU, modV := f.alphabet.pow(u), f.alphabet.pow(v)
+
+	// P || Q, where only the round number and the numeral change between rounds.
+	t := len(tweak)
+	padLen := ((-(t + byteLen + 1))%16 + 16) % 16
+	pq := make([]byte, 16+t+padLen+1+byteLen)
+	copy(pq, []byte{1, 2, 1, byte(radix >> 16), byte(radix >> 8), byte(radix), 10, byte(u),
+		byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n),
+		byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t)})
+	copy(pq[16:], tweak)
+	round := pq[16+t+padLen:]
+
+	s := make([]byte, (d+15)/16*16)
+	mac := make([]byte, 16)
+	y := new(big.Int)
+	for step := 0; step < 10; step++ {
+		i := step
+		if decrypt {
+			i = 9 - step
+		}
+		m, mod := u, modU
+		if i%2 == 1 {
+			m, mod = v, modV
+		}
+
+		// Q ends with the round number and the numeral of the half that is not modified.
+		round[0] = byte(i)
+		if decrypt {
+			putNum(round[1:], f.alphabet.num(a))
+		} else {
+			putNum(round[1:], f.alphabet.num(b))
+		}
+
+		// R = PRF(P || Q), a CBC-MAC with a zero IV.
+		for j := range mac {
+			mac[j] = 0
+		}
+		for off := 0; off < len(pq); off += 16 {
+			for j := range mac {
+				mac[j] ^= pq[off+j]
+			}
+			f.block.Encrypt(mac, mac)
+		}
+
+		// S = R || CIPH(R xor [1]) || CIPH(R xor [2]) || ..., truncated to d bytes.
+		copy(s, mac)
+		for j := 1; j*16 < d; j++ {
+			block := s[j*16 : j*16+16]
+			copy(block, mac)
+			block[15] ^= byte(j)
+			block[14] ^= byte(j >> 8)
+			f.block.Encrypt(block, block)
+		}
+		y.SetBytes(s[:d])
+
+		if decrypt {
+			c := f.alphabet.num(b)
+			c.Sub(c, y)
+			c.Mod(c, mod)
+			a, b = f.alphabet.str(c, m), a
+		} else {
+			c := f.alphabet.num(a)
+			c.Add(c, y)
+			c.Mod(c, mod)
+			a, b = b, f.alphabet.str(c, m)
+		}
+	}
+	return f.alphabet.toChars(append(append([]byte(nil), a...), b...)), nil
+}
+
+// FF31TweakSize is the size of the tweaks of FF3-1.
+const FF31TweakSize = 7
+
+// FF31 implements the FF3-1 format-preserving encryption mode of NIST SP 800-38G Revision 1 with
+// AES, over the characters of a given alphabet. Tweaks are 7 bytes long.
+//
+// FF31 is safe for concurrent use.
+type FF31 struct {
+	block    cipher.Block
+	alphabet *fpeAlphabet
+	minLen   int
+	maxLen   int
+}
+
+// NewFF31 returns an FF3-1 cipher with the given AES key, for fields made of the characters of
+// the given alphabet, such as "0123456789". The radix is the number of characters.
+func NewFF31(key []byte, alphabet string) (*FF31, error) {
+	if _, err := newAESCipher(key); err != nil {
+		return nil, err
+	}
+	reversed := reverse(append([]byte(nil), key...))
+	block, err := aes.NewCipher(reversed)
+	wipeBytes(reversed)
+	if err != nil {
+		return nil, err
+	}
+	a, err := newFPEAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	// maxLen = 2 * floor(log_radix(2^96))
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	k := 0
+	for a.pow(k+1).Cmp(limit) <= 0 {
+		k++
+	}
+	return &FF31{block: block, alphabet: a, minLen: a.minLen(), maxLen: 2 * k}, nil
+}
+
+// MinLen returns the length of the shortest supported field.
+func (f *FF31) MinLen() int {
+	return f.minLen
+}
+
+// MaxLen returns the length of the longest supported field.
+func (f *FF31) MaxLen() int {
+	return f.maxLen
+}
+
+// Encrypt returns the encryption of the given field under the given 7-byte tweak.
+func (f *FF31) Encrypt(tweak, field []byte) ([]byte, error) {
+	tl, tr, err := ff31Tweak(tweak)
+	if err != nil {
+		return nil, err
+	}
+	return f.crypt(tl, tr, field, false)
+}
+
+// Decrypt returns the decryption of the given field under the given 7-byte tweak.
+func (f *FF31) Decrypt(tweak, field []byte) ([]byte, error) {
+	tl, tr, err := ff31Tweak(tweak)
+	if err != nil {
+		return nil, err
+	}
+	return f.crypt(tl, tr, field, true)
+}
+
+// ff31Tweak splits a 56-bit tweak into the 32-bit halves used by the rounds.
+func ff31Tweak(tweak []byte) ([]byte, []byte, error) {
+	if len(tweak) != FF31TweakSize {
+		return nil, nil, fmt.Errorf("cipherio: FF3-1 tweak must be %d bytes long: %d", FF31TweakSize, len(tweak))
+	}
+	tl := []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0}
+	tr := []byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+	return tl, tr, nil
+}
+
+// crypt runs the rounds of FF3 with the given tweak halves, which FF3-1 derives from 56 bits.
+func (f *FF31) crypt(tl, tr, field []byte, decrypt bool) ([]byte, error) {
+	n := len(field)
+	if n < f.minLen || n > f.maxLen {
+		return nil, fmt.Errorf("cipherio: FF3-1 field must have between %d and %d characters: %d", f.minLen, f.maxLen, n)
+	}
+	digits, err := f.alphabet.toDigits(field)
+	if err != nil {
+		return nil, err
+	}
+
+	u := (n + 1) / 2
+	v := n - u
+	a, b := digits[:u], digits[u:]
+	modU, modV := f.alphabet.pow(u), f.alphabet.pow(v)
+
+	p := make([]byte, 16)
+	y := new(big.Int)
+	for step := 0; step < 8; step++ {
+		i := step
+		if decrypt {
+			i = 7 - step
+		}
+		m, mod, w := u, modU, tr
+		if i%2 == 1 {
+			m, mod, w = v, modV, tl
+		}
+
+		// P = W xor [i]^4 || [NUM(REV(B))]^12, with the half that is not modified.
+		copy(p, w)
+		p[3] ^= byte(i)
+		unchanged := b
+		if decrypt {
+			unchanged = a
+		}
+		putNum(p[4:], f.alphabet.num(reverse(append([]byte(nil), unchanged...))))
+
+		// S = REVB(CIPH_REVB(K)(REVB(P)))
+		reverse(p)
+		f.block.Encrypt(p, p)
+		reverse(p)
+		y.SetBytes(p)
+
+		if decrypt {
+			c := f.alphabet.num(reverse(append([]byte(nil), b...)))
+			c.Sub(c, y)
+			c.Mod(c, mod)
+			a, b = reverse(f.alphabet.str(c, m)), a
+		} else {
+			c := f.alphabet.num(reverse(append([]byte(nil), a...)))
+			c.Add(c, y)
+			c.Mod(c, mod)
+			a, b = b, reverse(f.alphabet.str(c, m))
+		}
+	}
+	return f.alphabet.toChars(append(append([]byte(nil), a...), b...)), nil
+}
+
+// FPEField locates a fixed-width field within the records of an FPERecordWriter.
+type FPEField struct {
+	Offset int // position of the field within each record
+	Length int // number of characters of the field
+	Cipher FPE
+	Tweak  []byte // tweak of the field, such as the column name, so that columns are independent
+}
+
+// FPERecordOptions configures an FPERecordWriter.
+type FPERecordOptions struct {
+	// RecordLen is the number of bytes of each record, including any delimiter such as a newline.
+	RecordLen int
+
+	// Fields are the fields to (en|de)crypt in each record. They must not overlap. Other bytes
+	// are copied as is.
+	Fields []FPEField
+
+	// Decrypt restores the original fields instead of tokenizing them.
+	Decrypt bool
+}
+
+// FPERecordWriter tokenizes fixed-width fields of fixed-length records written to it, such as
+// card numbers or identifiers in fixed-width text files, with format-preserving encryption. Since
+// ciphertexts keep the length and alphabet of their fields, records keep their layout, and
+// downstream parsers are not affected.
+//
+// Each record is written with a single call to the wrapped Writer, as soon as it is complete.
+type FPERecordWriter struct {
+	dst    io.Writer
+	opts   FPERecordOptions
+	buf    []byte // pending record
+	record int64  // index of the pending record
+	err    error
+}
+
+// NewFPERecordWriter returns an FPERecordWriter writing records to dst.
+func NewFPERecordWriter(dst io.Writer, opts FPERecordOptions) (*FPERecordWriter, error) {
+	if opts.RecordLen <= 0 {
+		return nil, fmt.Errorf("cipherio: invalid record length: %d", opts.RecordLen)
+	}
+	fields := append([]FPEField(nil), opts.Fields...)
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Offset < fields[j].Offset
+	})
+	end := 0
+	for _, field := range fields {
+		if field.Offset < end || field.Offset+field.Length > opts.RecordLen {
+			return nil, fmt.Errorf("cipherio: invalid FPE field at offset %d", field.Offset)
+		}
+		if field.Length < field.Cipher.MinLen() || field.Length > field.Cipher.MaxLen() {
+			return nil, fmt.Errorf("cipherio: FPE field at offset %d must have between %d and %d characters: %d", field.Offset, field.Cipher.MinLen(), field.Cipher.MaxLen(), field.Length)
+		}
+		end = field.Offset + field.Length
+	}
+	opts.Fields = fields
+
+	return &FPERecordWriter{
+		dst:  dst,
+		opts: opts,
+		buf:  make([]byte, 0, opts.RecordLen),
+	}, nil
+}
+
+func (w *FPERecordWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	count := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):w.opts.RecordLen], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		count += n
+
+		if len(w.buf) == w.opts.RecordLen {
+			if w.err = w.writeRecord(); w.err != nil {
+				return count, w.err
+			}
+		}
+	}
+	return count, nil
+}
+
+// writeRecord (en|de)crypts the fields of the pending record in place, then writes it.
+func (w *FPERecordWriter) writeRecord() error {
+	for _, field := range w.opts.Fields {
+		value := w.buf[field.Offset : field.Offset+field.Length]
+		var result []byte
+		var err error
+		if w.opts.Decrypt {
+			result, err = field.Cipher.Decrypt(field.Tweak, value)
+		} else {
+			result, err = field.Cipher.Encrypt(field.Tweak, value)
+		}
+		if err != nil {
+			return fmt.Errorf("cipherio: record %d, field at offset %d: %w", w.record, field.Offset, err)
+		}
+		copy(value, result)
+	}
+
+	if _, err := w.dst.Write(w.buf); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	w.record++
+	return nil
+}
+
+// Close returns an error if a record is incomplete. The wrapped Writer is not closed.
+func (w *FPERecordWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf) > 0 {
+		w.err = fmt.Errorf("cipherio: incomplete record: %d bytes of %d", len(w.buf), w.opts.RecordLen)
+		return w.err
+	}
+	w.err = errors.New("cipherio: write to closed FPERecordWriter")
+	return nil
+}
@@ -0,0 +1,249 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+const (
+	alphabet10 = "0123456789"
+	alphabet36 = "0123456789abcdefghijklmnopqrstuvwxyz"
+)
+
+func TestFF1(t *testing.T) {
+	// NIST SP 800-38G samples, FF1-AES128 and FF1-AES256
+	testCases := []struct {
+		Name       string
+		Key        string
+		Alphabet   string
+		Tweak      string
+		Plaintext  string
+		Ciphertext string
+	}{
+		{"Sample1", "2b7e151628aed2a6abf7158809cf4f3c", alphabet10, "", "0123456789", "2433477484"},
+		{"Sample2", "2b7e151628aed2a6abf7158809cf4f3c", alphabet10, "39383736353433323130", "0123456789", "6124200773"},
+		{"Sample3", "2b7e151628aed2a6abf7158809cf4f3c", alphabet36, "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+		{"Sample7", "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94", alphabet10, "", "0123456789", "6657667009"},
+		{"Sample9", "2b7e151628aed2a6abf7158809cf4f3cef4359d8d580aa4f7f036d6f04fc6a94", alphabet36, "3737373770717273373737", "0123456789abcdefghi", "xs8a0azh2avyalyzuwd"},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			key, _ := hex.DecodeString(testCase.Key)
+			tweak, _ := hex.DecodeString(testCase.Tweak)
+			ff1, err := cipherio.NewFF1(key, testCase.Alphabet)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+
+			ciphertext, err := ff1.Encrypt(tweak, []byte(testCase.Plaintext))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if string(ciphertext) != testCase.Ciphertext {
+				t.Fatalf("unexpected ciphertext: %s != %s", ciphertext, testCase.Ciphertext)
+			}
+
+			plaintext, err := ff1.Decrypt(tweak, ciphertext)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if string(plaintext) != testCase.Plaintext {
+				t.Fatalf("unexpected plaintext: %s != %s", plaintext, testCase.Plaintext)
+			}
+		})
+	}
+}
+
+func TestFF3(t *testing.T) {
+	// NIST SP 800-38G samples of the original FF3, whose rounds are shared with FF3-1
+	testCases := []struct {
+		Name       string
+		Key        string
+		Tweak      string
+		Plaintext  string
+		Ciphertext string
+	}{
+		{"Sample1", "ef4359d8d580aa4f7f036d6f04fc6a94", "d8e7920afa330a73", "890121234567890000", "750918814058654607"},
+		{"Sample2", "ef4359d8d580aa4f7f036d6f04fc6a94", "9a768a92f60e12d8", "890121234567890000", "018989839189395384"},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			key, _ := hex.DecodeString(testCase.Key)
+			tweak, _ := hex.DecodeString(testCase.Tweak)
+			ff3, err := cipherio.NewFF31(key, alphabet10)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			ciphertext, err := cipherio.FF3Encrypt(ff3, tweak, []byte(testCase.Plaintext))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if string(ciphertext) != testCase.Ciphertext {
+				t.Fatalf("unexpected ciphertext: %s != %s", ciphertext, testCase.Ciphertext)
+			}
+		})
+	}
+}
+
+func TestFF31(t *testing.T) {
+	key, _ := hex.DecodeString("ef4359d8d580aa4f7f036d6f04fc6a94")
+	ff31, err := cipherio.NewFF31(key, alphabet36)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if ff31.MinLen() != 4 || ff31.MaxLen() != 36 {
+		t.Fatalf("unexpected lengths: %d, %d", ff31.MinLen(), ff31.MaxLen())
+	}
+
+	tweak := []byte("tweak56")
+	plaintext := []byte("0123456789abcdefghijklmnopqrstuvwxy")
+	ciphertext, err := ff31.Encrypt(tweak, plaintext)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if len(ciphertext) != len(plaintext) || bytes.Equal(ciphertext, plaintext) {
+		t.Fatalf("unexpected ciphertext: %s", ciphertext)
+	}
+	result, err := ff31.Decrypt(tweak, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(result, plaintext) {
+		t.Fatalf("unexpected plaintext: %s != %s", result, plaintext)
+	}
+
+	// Another tweak gives another ciphertext.
+	other, err := ff31.Encrypt([]byte("tweak57"), plaintext)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if bytes.Equal(other, ciphertext) {
+		t.Fatal("tweak has no effect")
+	}
+}
+
+func TestFPEInvalid(t *testing.T) {
+	ff1, err := cipherio.NewFF1(make([]byte, 16), alphabet10)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = ff1.Encrypt(nil, []byte("12345x7890"))
+	if err != cipherio.ErrInvalidFPEInput {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidFPEInput)
+	}
+	_, err = ff1.Encrypt(nil, []byte("12345"))
+	if err == nil {
+		t.Fatal("short field was accepted")
+	}
+
+	ff31, err := cipherio.NewFF31(make([]byte, 16), alphabet10)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = ff31.Encrypt(make([]byte, 8), []byte("1234567890"))
+	if err == nil {
+		t.Fatal("8-byte tweak was accepted by FF3-1")
+	}
+
+	_, err = cipherio.NewFF1(make([]byte, 16), "0120")
+	if err == nil {
+		t.Fatal("duplicate characters were accepted")
+	}
+}
+
+func TestFPERecordWriter(t *testing.T) {
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	ff1, err := cipherio.NewFF1(key, alphabet10)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	ff31, err := cipherio.NewFF31(key, alphabet36)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// Records of a fixed-width file: a 16-digit card number, a space, an 8-character ID, a newline.
+	records := "4111111111111111 alice001\n5500000000000004 bob00002\n"
+	fields := []cipherio.FPEField{
+		{Offset: 17, Length: 8, Cipher: ff31, Tweak: []byte("user_id")},
+		{Offset: 0, Length: 16, Cipher: ff1, Tweak: []byte("pan")},
+	}
+
+	var tokenized bytes.Buffer
+	writer, err := cipherio.NewFPERecordWriter(&tokenized, cipherio.FPERecordOptions{RecordLen: 26, Fields: fields})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	for i := 0; i < len(records); i += 7 {
+		end := i + 7
+		if end > len(records) {
+			end = len(records)
+		}
+		_, err = writer.Write([]byte(records[i:end]))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	result := tokenized.String()
+	if len(result) != len(records) || result[16] != ' ' || result[25] != '\n' || result[42] != ' ' {
+		t.Fatalf("layout is not preserved: %q", result)
+	}
+	if result[:16] == records[:16] || result[17:25] == records[17:25] {
+		t.Fatalf("fields are not tokenized: %q", result)
+	}
+
+	var restored bytes.Buffer
+	writer, err = cipherio.NewFPERecordWriter(&restored, cipherio.FPERecordOptions{RecordLen: 26, Fields: fields, Decrypt: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write(tokenized.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if restored.String() != records {
+		t.Fatalf("unexpected records: %q != %q", restored.String(), records)
+	}
+
+	// Invalid characters and incomplete records are reported.
+	writer, err = cipherio.NewFPERecordWriter(ioutil.Discard, cipherio.FPERecordOptions{RecordLen: 26, Fields: fields})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write([]byte("4111-1111-1111-1 alice001\n"))
+	if !errors.Is(err, cipherio.ErrInvalidFPEInput) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidFPEInput)
+	}
+	writer, err = cipherio.NewFPERecordWriter(ioutil.Discard, cipherio.FPERecordOptions{RecordLen: 26, Fields: fields})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write([]byte("4111111111111111"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err == nil {
+		t.Fatal("incomplete record was accepted")
+	}
+}
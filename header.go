@@ -0,0 +1,109 @@
+package cipherio
+
+import (
+	"fmt"
+	"io"
+)
+
+// HeaderFunc builds the header to be written at the start of the output, given the total number
+// of bytes accepted by Write and the number of (en|de)crypted bytes written after the header.
+type HeaderFunc func(plaintextLen, ciphertextLen int64) ([]byte, error)
+
+// WithReservedHeader reserves size bytes at the start of the output, before any (en|de)crypted
+// block, and patches them on Close with the header returned by fn. This allows formats to put an
+// IV, a length or a MAC in front of the data in a single pass.
+//
+// The wrapped Writer must implement either io.WriteSeeker or io.WriterAt. When it only implements
+// io.WriterAt, the output is assumed to start at offset 0. The header must be exactly size bytes
+// long.
+func WithReservedHeader(size int, fn HeaderFunc) WriterOption {
+	return func(o *writerOptions) {
+		o.headerSize = size
+		o.headerFn = fn
+	}
+}
+
+type headerReservation struct {
+	size     int
+	fn       HeaderFunc
+	reserved bool
+	start    int64 // position of the header in the wrapped Writer
+}
+
+// reserveHeader writes a zeroed header to the destination writer, unless already done. Any error
+// is saved.
+func (w *BlockWriter) reserveHeader() error {
+	h := w.header
+	if h == nil || h.reserved {
+		return nil
+	}
+	h.reserved = true
+
+	switch dst := w.dst.(type) {
+	case io.WriteSeeker:
+		start, err := dst.Seek(0, io.SeekCurrent)
+		if err != nil {
+			w.err = err
+			return err
+		}
+		h.start = start
+	case io.WriterAt:
+		h.start = 0
+	default:
+		w.err = fmt.Errorf("cipherio: header reservation requires an io.WriteSeeker or io.WriterAt: %T", w.dst)
+		return w.err
+	}
+
+	n, err := w.dst.Write(make([]byte, h.size))
+	if err == nil && n < h.size {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// patchHeader builds the final header and writes it over the reserved one, only once. Any error is
+// saved.
+func (w *BlockWriter) patchHeader() error {
+	h := w.header
+	if h == nil {
+		return nil
+	}
+	w.header = nil
+
+	header, err := h.fn(w.accepted, w.flushed)
+	if err == nil && len(header) != h.size {
+		err = fmt.Errorf("cipherio: header length must equal reserved size: %d != %d", len(header), h.size)
+	}
+	if err == nil {
+		switch dst := w.dst.(type) {
+		case io.WriteSeeker:
+			err = patchAt(dst, header, h.start)
+		case io.WriterAt:
+			_, err = dst.WriteAt(header, h.start)
+		}
+	}
+
+	w.err = err
+	return err
+}
+
+// patchAt writes p at the given offset, then moves back to the previous position.
+func patchAt(dst io.WriteSeeker, p []byte, offset int64) error {
+	end, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(p)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Seek(end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,139 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestReservedHeader(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 100)
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, 112)
+	copy(expectedBytes, originalBytes)
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, expectedBytes)
+
+	// The header contains the IV followed by both lengths.
+	expectedHeader := make([]byte, 32)
+	copy(expectedHeader, iv)
+	binary.BigEndian.PutUint64(expectedHeader[16:], 100)
+	binary.BigEndian.PutUint64(expectedHeader[24:], 112)
+
+	headerFn := func(plaintextLen, ciphertextLen int64) ([]byte, error) {
+		header := make([]byte, 32)
+		copy(header, iv)
+		binary.BigEndian.PutUint64(header[16:], uint64(plaintextLen))
+		binary.BigEndian.PutUint64(header[24:], uint64(ciphertextLen))
+		return header, nil
+	}
+
+	file, err := ioutil.TempFile("", "cipherio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// Write some unrelated prefix first, the header must be reserved at the current position.
+	_, err = file.Write([]byte("prefix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := cipherio.NewBlockWriterWithPadding(file, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding, cipherio.WithReservedHeader(32, headerFn))
+	_, err = writer.Write(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Further writes to the file must happen after the encrypted data.
+	_, err = file.Write([]byte("suffix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := append([]byte("prefix"), expectedHeader...)
+	expected = append(expected, expectedBytes...)
+	expected = append(expected, "suffix"...)
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected written bytes")
+	}
+
+	// A Writer that can neither seek nor write at an offset is rejected.
+	var buf bytes.Buffer
+	writer = cipherio.NewBlockWriter(&buf, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithReservedHeader(32, headerFn))
+	_, err = writer.Write(originalBytes[:16])
+	if err == nil {
+		t.Fatalf("unexpected success without io.WriteSeeker or io.WriterAt")
+	}
+}
+
+// shortWriterAt accepts all but the last byte of each write, without returning an error.
+type shortWriterAt struct{}
+
+func (shortWriterAt) Write(p []byte) (int, error) {
+	return len(p) - 1, nil
+}
+
+func (shortWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
+}
+
+func TestReservedHeaderShortWrite(t *testing.T) {
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	headerFn := func(plaintextLen, ciphertextLen int64) ([]byte, error) {
+		return make([]byte, 32), nil
+	}
+	writer := cipherio.NewBlockWriter(shortWriterAt{}, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithReservedHeader(32, headerFn))
+	_, err = writer.Write(make([]byte, 16))
+	if err != io.ErrShortWrite {
+		t.Fatalf("unexpected err: %v != %v", err, io.ErrShortWrite)
+	}
+}
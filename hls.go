@@ -0,0 +1,103 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// HLSSequenceIV returns the IV of a media segment whose EXT-X-KEY tag has no IV attribute: its
+// media sequence number as a big-endian 128-bit integer, as specified by RFC 8216.
+func HLSSequenceIV(mediaSequence uint64) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint64(iv[8:], mediaSequence)
+	return iv
+}
+
+// HLSSegmentWriter encrypts a media segment with the AES-128 method of HLS: AES-128-CBC with
+// PKCS#7 padding, which always adds between 1 and 16 bytes.
+type HLSSegmentWriter struct {
+	*PKCS7Writer
+}
+
+// NewHLSSegmentWriter returns an HLSSegmentWriter encrypting a segment to dst with the given
+// 16-byte key and IV. Use HLSSequenceIV if the playlist does not specify the IV.
+//
+// Each segment must be encrypted by its own HLSSegmentWriter, which allows to encrypt live input
+// segment by segment.
+func NewHLSSegmentWriter(dst io.Writer, key, iv []byte, opts ...WriterOption) (*HLSSegmentWriter, error) {
+	block, err := newHLSCipher(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	return &HLSSegmentWriter{NewPKCS7Writer(dst, cipher.NewCBCEncrypter(block, iv), opts...)}, nil
+}
+
+// NewHLSSegmentReader returns a Reader decrypting a segment encrypted with the AES-128 method of
+// HLS, and removing its padding. ErrInvalidPadding is returned at the end of the segment if its
+// padding is invalid, which also happens with a wrong key or IV.
+func NewHLSSegmentReader(src io.Reader, key, iv []byte, opts ...ReaderOption) (io.Reader, error) {
+	block, err := newHLSCipher(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	return NewPKCS7Reader(src, cipher.NewCBCDecrypter(block, iv), opts...), nil
+}
+
+// newHLSCipher checks the key and the IV of a segment, and returns the AES-128 cipher.
+func newHLSCipher(key, iv []byte) (cipher.Block, error) {
+	if err := checkPolicy("HLS AES-128", true, false); err != nil {
+		return nil, err
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("%w: HLS requires AES-128: %d", ErrInvalidKeySize, len(key))
+	}
+	block, err := newAESCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// HLSKeyInfo describes the key of encrypted media segments, for playlists and packagers.
+type HLSKeyInfo struct {
+	URI     string // URI of the key, as fetched by players
+	KeyFile string // local path of the key, only used by WriteKeyInfoFile
+	IV      []byte // explicit IV, or nil to derive it from the media sequence number
+}
+
+// Tag returns the EXT-X-KEY tag announcing this key in a media playlist, as specified by RFC 8216.
+func (k HLSKeyInfo) Tag() string {
+	var tag strings.Builder
+	tag.WriteString("#EXT-X-KEY:METHOD=AES-128,URI=")
+	tag.WriteString(quoteHLSString(k.URI))
+	if k.IV != nil {
+		tag.WriteString(",IV=0x")
+		tag.WriteString(strings.ToUpper(hex.EncodeToString(k.IV)))
+	}
+	return tag.String()
+}
+
+// WriteKeyInfoFile writes the key info file expected by packagers such as FFmpeg's
+// -hls_key_info_file: the key URI, the key file path, and the optional IV, one per line.
+func (k HLSKeyInfo) WriteKeyInfoFile(w io.Writer) error {
+	lines := k.URI + "\n" + k.KeyFile + "\n"
+	if k.IV != nil {
+		lines += hex.EncodeToString(k.IV) + "\n"
+	}
+	_, err := io.WriteString(w, lines)
+	return err
+}
+
+// quoteHLSString quotes s as a quoted-string attribute, which cannot contain quotes nor line
+// breaks: they are percent-encoded, as they would be in a URI.
+func quoteHLSString(s string) string {
+	s = strings.NewReplacer(`"`, "%22", "\r", "%0D", "\n", "%0A").Replace(s)
+	return `"` + s + `"`
+}
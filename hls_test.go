@@ -0,0 +1,133 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestHLSSegment(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := cipherio.HLSSequenceIV(42)
+
+	for _, size := range []int{0, 1, 15, 16, 17, 188 * 7, 8192} {
+		plaintext := make([]byte, size)
+		_, err = rand.Read(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// PKCS#7 always adds between 1 and 16 bytes.
+		padding := 16 - size%16
+		expected := append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(expected, expected)
+
+		var buf bytes.Buffer
+		writer, err := cipherio.NewHLSSegmentWriter(&buf, key, iv)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		_, err = writer.Write(plaintext)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Fatalf("unexpected ciphertext for %d bytes", size)
+		}
+
+		reader, err := cipherio.NewHLSSegmentReader(bytes.NewReader(expected), key, iv)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatalf("decrypted data does not match plaintext for %d bytes", size)
+		}
+	}
+}
+
+func TestHLSSegmentInvalidPadding(t *testing.T) {
+	key := make([]byte, 16)
+	iv := cipherio.HLSSequenceIV(0)
+
+	testCases := []struct {
+		Name       string
+		Ciphertext []byte
+	}{
+		{"Empty", nil},
+		{"Garbage", bytes.Repeat([]byte{1}, 64)},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			reader, err := cipherio.NewHLSSegmentReader(bytes.NewReader(testCase.Ciphertext), key, iv)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			_, err = ioutil.ReadAll(reader)
+			if err != cipherio.ErrInvalidPadding {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidPadding)
+			}
+		})
+	}
+
+	_, err := cipherio.NewHLSSegmentWriter(ioutil.Discard, make([]byte, 32), iv)
+	if err == nil {
+		t.Fatal("AES-256 key has been accepted")
+	}
+}
+
+func TestHLSKeyInfo(t *testing.T) {
+	info := cipherio.HLSKeyInfo{
+		URI:     `https://example.com/key?id="1"`,
+		KeyFile: "/tmp/segment.key",
+		IV:      cipherio.HLSSequenceIV(255),
+	}
+
+	expected := `#EXT-X-KEY:METHOD=AES-128,URI="https://example.com/key?id=%221%22",IV=0x000000000000000000000000000000FF`
+	if tag := info.Tag(); tag != expected {
+		t.Fatalf("unexpected tag: %s != %s", tag, expected)
+	}
+
+	var buf strings.Builder
+	err := info.WriteKeyInfoFile(&buf)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	expected = "https://example.com/key?id=\"1\"\n/tmp/segment.key\n000000000000000000000000000000ff\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected key info file: %q != %q", buf.String(), expected)
+	}
+
+	info.IV = nil
+	if tag := info.Tag(); strings.Contains(tag, "IV=") {
+		t.Fatalf("unexpected IV in tag: %s", tag)
+	}
+}
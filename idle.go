@@ -0,0 +1,85 @@
+package cipherio
+
+import (
+	"sync"
+	"time"
+)
+
+// IdleFlushWriter wraps a BlockWriter to flush its buffered blocks after a period of inactivity.
+//
+// With WithHighWaterMark, small writes are coalesced until enough blocks are available. This is
+// desirable under load, but a short message may then linger in the internal buffer indefinitely.
+// IdleFlushWriter bounds this latency, which is useful for interactive network streams.
+//
+// Calls to its methods are serialized with the background flushes, so it can also be shared
+// between goroutines like a SyncWriter. An error encountered by a background flush is returned by
+// the next call.
+type IdleFlushWriter struct {
+	mu     sync.Mutex
+	dst    *BlockWriter
+	idle   time.Duration
+	timer  Timer
+	closed bool
+}
+
+// NewIdleFlushWriter wraps the given BlockWriter so that it is flushed once no Write has been
+// made for the given duration. The timer is created by the Clock of the BlockWriter, see
+// WithClock.
+func NewIdleFlushWriter(dst *BlockWriter, idle time.Duration) *IdleFlushWriter {
+	return &IdleFlushWriter{
+		dst:  dst,
+		idle: idle,
+	}
+}
+
+func (w *IdleFlushWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.dst.Write(p)
+
+	// Restart the timer only if some crypted blocks are waiting to be written.
+	if err == nil && !w.closed && w.dst.crypted > 0 {
+		w.schedule()
+	}
+	return n, err
+}
+
+// schedule starts or restarts the timer. It must be called with the mutex held.
+func (w *IdleFlushWriter) schedule() {
+	if w.timer == nil {
+		w.timer = w.dst.clock.AfterFunc(w.idle, w.flushIdle)
+		return
+	}
+	w.timer.Stop()
+	w.timer.Reset(w.idle)
+}
+
+// flushIdle is called by the timer. Errors are kept by the BlockWriter.
+func (w *IdleFlushWriter) flushIdle() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		_ = w.dst.Flush()
+	}
+}
+
+// Flush immediately writes buffered blocks. See BlockWriter.Flush.
+func (w *IdleFlushWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dst.Flush()
+}
+
+// Close stops the timer, then closes the BlockWriter.
+func (w *IdleFlushWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.closed = true
+	return w.dst.Close()
+}
@@ -0,0 +1,137 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/connesc/cipherio"
+)
+
+// syncBuffer is a Buffer that can be written and inspected concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+func TestIdleFlushWriter(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const idle = 20 * time.Millisecond
+
+	t.Run("FlushOnIdle", func(t *testing.T) {
+		var dst syncBuffer
+		writer := cipherio.NewIdleFlushWriter(cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithHighWaterMark(1024)), idle)
+
+		// A complete block and an incomplete one remain buffered.
+		_, err := writer.Write(make([]byte, 20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dst.Len() != 0 {
+			t.Fatalf("unexpected written length: %d != %d", dst.Len(), 0)
+		}
+
+		// Only the complete block is flushed once idle.
+		deadline := time.Now().Add(time.Second)
+		for dst.Len() == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if dst.Len() != 16 {
+			t.Fatalf("unexpected written length: %d != %d", dst.Len(), 16)
+		}
+
+		_, err = writer.Write(make([]byte, 12))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dst.Len() != 32 {
+			t.Fatalf("unexpected written length: %d != %d", dst.Len(), 32)
+		}
+	})
+
+	t.Run("BatchUnderLoad", func(t *testing.T) {
+		var dst syncBuffer
+		writer := cipherio.NewIdleFlushWriter(cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithHighWaterMark(64)), time.Hour)
+
+		// Frequent writes never let the writer become idle: only the high-water mark applies.
+		for i := 0; i < 3; i++ {
+			_, err := writer.Write(make([]byte, 16))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if dst.Len() != 0 {
+			t.Fatalf("unexpected written length: %d != %d", dst.Len(), 0)
+		}
+
+		_, err := writer.Write(make([]byte, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dst.Len() != 64 {
+			t.Fatalf("unexpected written length: %d != %d", dst.Len(), 64)
+		}
+
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("NoFlushAfterClose", func(t *testing.T) {
+		var dst syncBuffer
+		writer := cipherio.NewIdleFlushWriter(cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithHighWaterMark(1024)), idle)
+
+		_, err := writer.Write(make([]byte, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(2 * idle)
+		if dst.Len() != 16 {
+			t.Fatalf("unexpected written length: %d != %d", dst.Len(), 16)
+		}
+	})
+}
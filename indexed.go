@@ -0,0 +1,330 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// indexedMagic identifies both ends of a file written by IndexedWriter.
+var indexedMagic = []byte("CIOINDX\x01")
+
+const (
+	indexedTrailerSize = 8 + 8 + 8 // footer offset, number of chunks and magic
+	indexedEntrySize   = 8 + 4     // ciphertext offset and plaintext length, followed by the IV
+)
+
+// ErrInvalidIndexedFile is returned when opening data that is not a valid indexed file.
+var ErrInvalidIndexedFile = errors.New("cipherio: invalid indexed file")
+
+// IndexedOptions configures an IndexedWriter. The zero value is valid.
+type IndexedOptions struct {
+	// ChunkSize is the number of plaintext bytes per chunk, which is the granularity of parallel
+	// reads. Defaults to DefaultChunkSize.
+	ChunkSize int
+
+	// Boundary, if not nil, ends chunks at content-defined cut points, ChunkSize being then the
+	// maximum chunk size.
+	Boundary ChunkBoundaryFunc
+
+	// Rand is the source of the IVs. Defaults to crypto/rand.Reader.
+	Rand io.Reader
+}
+
+// IndexedChunk locates a chunk of a file written by IndexedWriter.
+type IndexedChunk struct {
+	Offset int64  // offset of the ciphertext in the file
+	Size   int64  // length of the ciphertext, padded to the block size
+	Start  int64  // offset of the plaintext in the decrypted data
+	Length int    // number of plaintext bytes
+	IV     []byte // IV of the chunk
+}
+
+// IndexedWriter encrypts a file as a sequence of independent chunks followed by a footer, in the
+// manner of Parquet, so that analytics engines can read the footer first, then fan out parallel
+// range reads over the encrypted data.
+//
+// The file starts with an 8-byte magic. Each chunk is encrypted with CBC under its own random IV,
+// and is zero-padded to the block size. The footer is not encrypted: it lists the offset, the
+// plaintext length and the IV of each chunk, and ends with its own offset, the number of chunks
+// and the magic again. It thus reveals the chunk sizes, but nothing about their content.
+//
+// The footer is only written by Close: a file is unreadable until then. Chunks are not
+// authenticated.
+type IndexedWriter struct {
+	dst       io.Writer
+	block     cipher.Block
+	rand      io.Reader
+	chunkSize int
+	boundary  ChunkBoundaryFunc
+	buf       []byte // plaintext of the pending chunk
+	offset    int64  // number of bytes written to dst so far
+	footer    []byte
+	chunks    uint64
+	err       error
+}
+
+// NewIndexedWriter returns an IndexedWriter encrypting to dst with the given block cipher, and
+// writes the magic of the file.
+func NewIndexedWriter(dst io.Writer, block cipher.Block, opts IndexedOptions) (*IndexedWriter, error) {
+	if err := checkPolicy("indexed file", true, false); err != nil {
+		return nil, err
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < 0 || uint64(chunkSize) > 1<<32-1 {
+		return nil, fmt.Errorf("cipherio: invalid indexed chunk size: %d", chunkSize)
+	}
+
+	if _, err := dst.Write(indexedMagic); err != nil {
+		return nil, err
+	}
+	return &IndexedWriter{
+		dst:       dst,
+		block:     block,
+		rand:      randOrDefault(opts.Rand),
+		chunkSize: chunkSize,
+		boundary:  opts.Boundary,
+		offset:    int64(len(indexedMagic)),
+	}, nil
+}
+
+func (w *IndexedWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.buf == nil {
+		w.buf = make([]byte, 0, w.chunkSize)
+	}
+
+	count := 0
+	for len(p) > 0 {
+		available := p
+		if len(available) > w.chunkSize-len(w.buf) {
+			available = available[:w.chunkSize-len(w.buf)]
+		}
+		n, cut := nextCut(w.boundary, available)
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		count += n
+
+		if cut || len(w.buf) == w.chunkSize {
+			if w.err = w.writeChunk(); w.err != nil {
+				return count, w.err
+			}
+		}
+	}
+	return count, nil
+}
+
+// writeChunk encrypts and writes the pending chunk under a new IV, and records it in the footer.
+func (w *IndexedWriter) writeChunk() error {
+	blockSize := w.block.BlockSize()
+	entry := make([]byte, indexedEntrySize+blockSize)
+	binary.BigEndian.PutUint64(entry[:8], uint64(w.offset))
+	binary.BigEndian.PutUint32(entry[8:], uint32(len(w.buf)))
+	iv := entry[indexedEntrySize:]
+	if _, err := io.ReadFull(w.rand, iv); err != nil {
+		return err
+	}
+
+	ciphertext := make([]byte, alignedSize(int64(len(w.buf)), int64(blockSize)))
+	copy(ciphertext, w.buf)
+	cipher.NewCBCEncrypter(w.block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	n, err := w.dst.Write(ciphertext)
+	w.offset += int64(n)
+	if err != nil {
+		return err
+	}
+	w.footer = append(w.footer, entry...)
+	w.chunks++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes any pending chunk, followed by the footer. The wrapped Writer is not closed.
+func (w *IndexedWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf) > 0 {
+		if w.err = w.writeChunk(); w.err != nil {
+			return w.err
+		}
+	}
+
+	var trailer [indexedTrailerSize]byte
+	binary.BigEndian.PutUint64(trailer[:8], uint64(w.offset))
+	binary.BigEndian.PutUint64(trailer[8:16], w.chunks)
+	copy(trailer[16:], indexedMagic)
+
+	if _, w.err = w.dst.Write(append(w.footer, trailer[:]...)); w.err != nil {
+		return w.err
+	}
+	w.err = errors.New("cipherio: write to closed IndexedWriter")
+	return nil
+}
+
+// ReadIndexedFooter reads the footer of the indexed file of the given size stored in src, and
+// returns its chunks in order. It does not need the key, so that a planner can split the work
+// before handing chunks to workers. The block size must be the one of the cipher used to write the
+// file.
+func ReadIndexedFooter(src io.ReaderAt, size int64, blockSize int) ([]IndexedChunk, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("cipherio: invalid block size: %d", blockSize)
+	}
+	if size < int64(len(indexedMagic))+indexedTrailerSize {
+		return nil, ErrInvalidIndexedFile
+	}
+	magic := make([]byte, len(indexedMagic))
+	if _, err := src.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+	var trailer [indexedTrailerSize]byte
+	if _, err := src.ReadAt(trailer[:], size-indexedTrailerSize); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, indexedMagic) || !bytes.Equal(trailer[16:], indexedMagic) {
+		return nil, ErrInvalidIndexedFile
+	}
+
+	footerOffset := int64(binary.BigEndian.Uint64(trailer[:8]))
+	count := binary.BigEndian.Uint64(trailer[8:16])
+	entrySize := int64(indexedEntrySize + blockSize)
+	if count > uint64(size)/uint64(entrySize) {
+		return nil, ErrInvalidIndexedFile
+	}
+	if footerOffset < int64(len(indexedMagic)) || footerOffset+int64(count)*entrySize != size-indexedTrailerSize {
+		return nil, ErrInvalidIndexedFile
+	}
+
+	footer := make([]byte, int64(count)*entrySize)
+	if _, err := src.ReadAt(footer, footerOffset); err != nil {
+		return nil, err
+	}
+
+	chunks := make([]IndexedChunk, count)
+	offset := int64(len(indexedMagic))
+	start := int64(0)
+	for i := range chunks {
+		entry := footer[int64(i)*entrySize:]
+		chunk := IndexedChunk{
+			Offset: int64(binary.BigEndian.Uint64(entry[:8])),
+			Start:  start,
+			Length: int(binary.BigEndian.Uint32(entry[8:12])),
+			IV:     append([]byte(nil), entry[indexedEntrySize:entrySize]...),
+		}
+		chunk.Size = alignedSize(int64(chunk.Length), int64(blockSize))
+		if chunk.Offset != offset || chunk.Length == 0 {
+			return nil, ErrInvalidIndexedFile
+		}
+		offset += chunk.Size
+		start += int64(chunk.Length)
+		chunks[i] = chunk
+	}
+	if offset != footerOffset {
+		return nil, ErrInvalidIndexedFile
+	}
+	return chunks, nil
+}
+
+// IndexedReader decrypts any byte range of a file written by IndexedWriter, only reading and
+// decrypting the blocks needed, thanks to its footer.
+//
+// It implements io.ReaderAt, and is safe for concurrent use if the underlying ReaderAt is, so
+// that ranges can be read in parallel.
+type IndexedReader struct {
+	src    io.ReaderAt
+	block  cipher.Block
+	chunks []IndexedChunk
+	size   int64
+}
+
+// NewIndexedReader opens the indexed file of the given size stored in src, with the given block
+// cipher, and loads its footer.
+func NewIndexedReader(src io.ReaderAt, size int64, block cipher.Block) (*IndexedReader, error) {
+	if err := checkPolicy("indexed file", true, false); err != nil {
+		return nil, err
+	}
+	chunks, err := ReadIndexedFooter(src, size, block.BlockSize())
+	if err != nil {
+		return nil, err
+	}
+	r := &IndexedReader{
+		src:    src,
+		block:  block,
+		chunks: chunks,
+	}
+	if len(chunks) > 0 {
+		last := chunks[len(chunks)-1]
+		r.size = last.Start + int64(last.Length)
+	}
+	return r, nil
+}
+
+// Size returns the number of plaintext bytes of the file.
+func (r *IndexedReader) Size() int64 {
+	return r.size
+}
+
+// Chunks returns the chunks of the file, in order. The returned slice must not be modified.
+func (r *IndexedReader) Chunks() []IndexedChunk {
+	return r.chunks
+}
+
+// ReadChunk decrypts the whole chunk at the given index, and returns its plaintext.
+func (r *IndexedReader) ReadChunk(index int) ([]byte, error) {
+	if index < 0 || index >= len(r.chunks) {
+		return nil, fmt.Errorf("cipherio: chunk index out of range: %d", index)
+	}
+	p := make([]byte, r.chunks[index].Length)
+	n, err := r.readChunk(p, index, 0)
+	return p[:n], err
+}
+
+// ReadAt decrypts len(p) bytes starting at the given offset, as defined by io.ReaderAt.
+func (r *IndexedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("cipherio: negative offset: %d", off)
+	}
+
+	// Find the chunk containing off.
+	i := sort.Search(len(r.chunks), func(i int) bool {
+		return r.chunks[i].Start+int64(r.chunks[i].Length) > off
+	})
+
+	count := 0
+	for ; len(p) > 0 && i < len(r.chunks); i++ {
+		n, err := r.readChunk(p, i, off-r.chunks[i].Start)
+		p = p[n:]
+		off += int64(n)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	if len(p) > 0 {
+		return count, io.EOF
+	}
+	return count, nil
+}
+
+// readChunk decrypts the blocks of the chunk at the given index needed to fill p from the given
+// position within the chunk.
+func (r *IndexedReader) readChunk(p []byte, chunkIndex int, pos int64) (int, error) {
+	chunk := r.chunks[chunkIndex]
+	if remaining := int64(chunk.Length) - pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	if err := decryptCBCRange(p, r.src, chunk.Offset, r.block, chunk.IV, pos); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,223 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestIndexed(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 10000+5)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	writer, err := cipherio.NewIndexedWriter(&buf, block, cipherio.IndexedOptions{ChunkSize: 1000})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = io.CopyBuffer(writer, bytes.NewReader(plaintext), make([]byte, 777))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	file := bytes.NewReader(buf.Bytes())
+
+	// A planner reads the footer without the key.
+	chunks, err := cipherio.ReadIndexedFooter(file, file.Size(), aes.BlockSize)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if len(chunks) != 11 {
+		t.Fatalf("unexpected chunks: %d != %d", len(chunks), 11)
+	}
+	if chunks[10].Start != 10000 || chunks[10].Length != 5 || chunks[10].Size != 16 {
+		t.Fatalf("unexpected last chunk: %+v", chunks[10])
+	}
+
+	reader, err := cipherio.NewIndexedReader(file, file.Size(), block)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if reader.Size() != int64(len(plaintext)) {
+		t.Fatalf("unexpected size: %d != %d", reader.Size(), len(plaintext))
+	}
+
+	// Workers decrypt chunks in parallel.
+	results := make([][]byte, len(chunks))
+	errs := make([]error, len(chunks))
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = reader.ReadChunk(i)
+		}(i)
+	}
+	wg.Wait()
+	for i, chunk := range chunks {
+		if errs[i] != nil {
+			t.Fatalf("unexpected err: %v != %v", errs[i], nil)
+		}
+		if !bytes.Equal(results[i], plaintext[chunk.Start:chunk.Start+int64(chunk.Length)]) {
+			t.Fatalf("chunk %d does not match plaintext", i)
+		}
+	}
+
+	testCases := []struct {
+		Name   string
+		Offset int64
+		Length int64
+	}{
+		{"All", 0, 10005},
+		{"WithinBlock", 3, 5},
+		{"WithinChunk", 1017, 500},
+		{"AcrossChunks", 990, 2020},
+		{"End", 9990, 15},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			result, err := ioutil.ReadAll(io.NewSectionReader(reader, testCase.Offset, testCase.Length))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			expected := plaintext[testCase.Offset : testCase.Offset+testCase.Length]
+			if !bytes.Equal(result, expected) {
+				t.Fatal("decrypted data does not match plaintext")
+			}
+		})
+	}
+}
+
+func TestIndexedInvalid(t *testing.T) {
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	writer, err := cipherio.NewIndexedWriter(&buf, block, cipherio.IndexedOptions{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write([]byte("some data"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	file := buf.Bytes()
+
+	testCases := []struct {
+		Name string
+		Data []byte
+	}{
+		{"Empty", nil},
+		{"Truncated", file[:len(file)-1]},
+		{"NoFooter", file[:len(file)-24-28]},
+		{"BadMagic", append([]byte("X"), file[1:]...)},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			_, err := cipherio.NewIndexedReader(bytes.NewReader(testCase.Data), int64(len(testCase.Data)), block)
+			if err != cipherio.ErrInvalidIndexedFile {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidIndexedFile)
+			}
+		})
+	}
+
+	t.Run("BlockSize", func(t *testing.T) {
+		for _, blockSize := range []int{0, -1, -12} {
+			_, err := cipherio.ReadIndexedFooter(bytes.NewReader(file), int64(len(file)), blockSize)
+			if err == nil {
+				t.Fatalf("invalid block size has been accepted: %d", blockSize)
+			}
+		}
+	})
+}
+
+func TestIndexedBoundary(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := plaintextWithZeros(t, 3000, 9, 1500)
+
+	var buf bytes.Buffer
+	writer, err := cipherio.NewIndexedWriter(&buf, block, cipherio.IndexedOptions{ChunkSize: 1000, Boundary: cutAfterZero})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = io.CopyBuffer(writer, bytes.NewReader(plaintext), make([]byte, 777))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	reader, err := cipherio.NewIndexedReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), block)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	var lengths []int
+	for _, chunk := range reader.Chunks() {
+		lengths = append(lengths, chunk.Length)
+	}
+	expected := []int{10, 1000, 491, 1000, 499}
+	if fmt.Sprint(lengths) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected chunk lengths: %v != %v", lengths, expected)
+	}
+
+	decrypted, err := ioutil.ReadAll(io.NewSectionReader(reader, 0, reader.Size()))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatal("decrypted data does not match plaintext")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !cipheriodebug
+// +build !cipheriodebug
+
+package cipherio
+
+// checkInvariants is a no-op without the cipheriodebug build tag.
+func (r *BlockReader) checkInvariants() {}
+
+// checkInvariants is a no-op without the cipheriodebug build tag.
+func (w *BlockWriter) checkInvariants() {}
@@ -0,0 +1,56 @@
+//go:build cipheriodebug
+// +build cipheriodebug
+
+package cipherio
+
+import "fmt"
+
+// invariantError panics with a descriptive message about a violated invariant.
+func invariantError(format string, args ...interface{}) {
+	panic(fmt.Sprintf("cipherio: invariant violated: "+format, args...))
+}
+
+// checkInvariants verifies the consistency of the internal state of the Reader. It is only
+// enabled by the cipheriodebug build tag.
+func (r *BlockReader) checkInvariants() {
+	if cap(r.buf) != r.blockSize {
+		invariantError("BlockReader: cap(buf)=%d != blockSize=%d", cap(r.buf), r.blockSize)
+	}
+	if r.crypted < 0 || r.crypted > len(r.buf) {
+		invariantError("BlockReader: crypted=%d out of [0, len(buf)=%d]", r.crypted, len(r.buf))
+	}
+	if r.crypted > 0 && len(r.buf) != r.blockSize {
+		invariantError("BlockReader: crypted=%d > 0 with len(buf)=%d != blockSize=%d", r.crypted, len(r.buf), r.blockSize)
+	}
+	if r.crypted == 0 && len(r.buf) >= r.blockSize {
+		invariantError("BlockReader: complete block buffered without being crypted: len(buf)=%d", len(r.buf))
+	}
+	if r.offset < 0 {
+		invariantError("BlockReader: offset=%d < 0", r.offset)
+	}
+}
+
+// checkInvariants verifies the consistency of the internal state of the Writer. It is only
+// enabled by the cipheriodebug build tag.
+func (w *BlockWriter) checkInvariants() {
+	if w.accepted < 0 || w.flushed < 0 {
+		invariantError("BlockWriter: accepted=%d, flushed=%d must not be negative", w.accepted, w.flushed)
+	}
+
+	// The internal buffer is freed once closed or failed.
+	if w.buf == nil {
+		return
+	}
+	if w.crypted < 0 || w.crypted > len(w.buf) {
+		invariantError("BlockWriter: crypted=%d out of [0, len(buf)=%d]", w.crypted, len(w.buf))
+	}
+	if w.crypted%w.blockSize != 0 {
+		invariantError("BlockWriter: crypted=%d is not a multiple of blockSize=%d", w.crypted, w.blockSize)
+	}
+	if pending := w.pending(); pending >= w.blockSize {
+		invariantError("BlockWriter: complete block buffered without being crypted: pending=%d", pending)
+	}
+	if w.highWater == 0 && w.crypted != 0 && w.err == nil {
+		invariantError("BlockWriter: crypted=%d bytes buffered without high-water mark", w.crypted)
+	}
+}
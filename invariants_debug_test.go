@@ -0,0 +1,46 @@
+//go:build cipheriodebug
+// +build cipheriodebug
+
+package cipherio
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"testing"
+)
+
+func TestCheckInvariants(t *testing.T) {
+	aesCipher, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	expectPanic := func(t *testing.T, expected string, fn func()) {
+		defer func() {
+			msg, _ := recover().(string)
+			if !strings.Contains(msg, expected) {
+				t.Fatalf("unexpected panic: %q does not contain %q", msg, expected)
+			}
+		}()
+		fn()
+	}
+
+	t.Run("Reader", func(t *testing.T) {
+		reader := NewBlockReader(bytes.NewReader(nil), cipher.NewCBCDecrypter(aesCipher, iv))
+		reader.checkInvariants()
+
+		reader.crypted = 3
+		expectPanic(t, "BlockReader: crypted=3 out of [0, len(buf)=0]", reader.checkInvariants)
+	})
+
+	t.Run("Writer", func(t *testing.T) {
+		writer := NewBlockWriter(&bytes.Buffer{}, cipher.NewCBCEncrypter(aesCipher, iv))
+		writer.checkInvariants()
+
+		writer.buf = writer.buf[:20]
+		expectPanic(t, "BlockWriter: complete block buffered without being crypted: pending=20", writer.checkInvariants)
+	})
+}
@@ -0,0 +1,39 @@
+package cipherio
+
+import "math/bits"
+
+// IOStats describes the calls made by a BlockReader or a BlockWriter to the Reader or Writer it
+// wraps, as returned by their Stats method. It allows to check the effect of buffer sizes and
+// options on the actual IO pattern.
+type IOStats struct {
+	Calls int64         // number of calls to Read or Write
+	Bytes int64         // number of bytes read or written
+	Sizes SizeHistogram // sizes of the calls: bytes returned by reads, or buffers given to writes
+
+	// PartialBlocks counts the times an incomplete block had to be kept in the internal buffer:
+	// after a read from the wrapped Reader not ending at a block boundary, or after a call to
+	// BlockWriter.Write not ending at a block boundary.
+	PartialBlocks int64
+}
+
+// SizeHistogram counts IO calls by size, in buckets of powers of two. Bucket 0 counts the calls of
+// 0 bytes, and bucket i counts those from 2^(i-1) to 2^i-1 bytes. The last bucket also counts all
+// larger calls.
+type SizeHistogram [32]int64
+
+func (h *SizeHistogram) add(size int) {
+	i := bits.Len(uint(size))
+	if i >= len(h) {
+		i = len(h) - 1
+	}
+	h[i]++
+}
+
+// record counts a call of the given size, which transferred n bytes.
+func (s *IOStats) record(size, n int) {
+	s.Calls++
+	if n > 0 {
+		s.Bytes += int64(n)
+	}
+	s.Sizes.add(size)
+}
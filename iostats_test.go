@@ -0,0 +1,118 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestIOStats(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	t.Run("Reader", func(t *testing.T) {
+		// Reading one byte at a time makes the BlockReader read one block at a time, except at the
+		// boundary between both sources: 6 blocks, then 4 and 12 bytes, then 5 blocks, then 8 bytes
+		// and EOF.
+		src := io.MultiReader(bytes.NewReader(make([]byte, 100)), bytes.NewReader(make([]byte, 100)))
+		reader := cipherio.NewBlockReaderWithPadding(src, cipher.NewCBCDecrypter(aesCipher, iv), cipherio.ZeroPadding)
+		_, err := io.CopyBuffer(ioutil.Discard, iotest.OneByteReader(reader), make([]byte, 64))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		stats := reader.Stats()
+		expected := cipherio.IOStats{Calls: 15, Bytes: 200, PartialBlocks: 2}
+		expected.Sizes[0] = 1
+		expected.Sizes[3] = 1
+		expected.Sizes[4] = 2
+		expected.Sizes[5] = 11
+		if stats != expected {
+			t.Fatalf("unexpected stats: %+v != %+v", stats, expected)
+		}
+	})
+
+	t.Run("ReaderPartial", func(t *testing.T) {
+		var sizes []int
+		src := &sizedReader{data: make([]byte, 64), sizes: []int{16, 20, 12, 16}}
+		reader := cipherio.NewBlockReader(src, cipher.NewCBCDecrypter(aesCipher, iv))
+		for {
+			n, err := reader.Read(make([]byte, 64))
+			sizes = append(sizes, n)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+		}
+
+		// Reads of 16, 20, 12, 16 and 0 bytes, only the second one ending in the middle of a block.
+		stats := reader.Stats()
+		expected := cipherio.IOStats{Calls: 5, Bytes: 64, PartialBlocks: 1}
+		expected.Sizes[0] = 1
+		expected.Sizes[4] = 1
+		expected.Sizes[5] = 3
+		if stats != expected {
+			t.Fatalf("unexpected stats: %+v != %+v", stats, expected)
+		}
+	})
+
+	t.Run("Writer", func(t *testing.T) {
+		var dst bytes.Buffer
+		writer := cipherio.NewBlockWriterWithPadding(&dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding, cipherio.WithLowMemory())
+		for i := 0; i < 4; i++ {
+			_, err := writer.Write(make([]byte, 20))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+		}
+		err := writer.Close()
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		// Each block is written on its own, and three writes out of four leave an incomplete
+		// block.
+		stats := writer.Stats()
+		expected := cipherio.IOStats{Calls: 5, Bytes: 80, PartialBlocks: 3}
+		expected.Sizes[5] = 5
+		if stats != expected {
+			t.Fatalf("unexpected stats: %+v != %+v", stats, expected)
+		}
+	})
+}
+
+// sizedReader returns its data in reads of the given sizes.
+type sizedReader struct {
+	data  []byte
+	sizes []int
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	if len(r.sizes) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:r.sizes[0]], r.data)
+	r.data = r.data[n:]
+	r.sizes = r.sizes[1:]
+	return n, nil
+}
@@ -0,0 +1,94 @@
+package cipherio
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// IVRegistry records the IVs used with each key, in order to detect reuse.
+//
+// Reusing an IV with the same key is the most common catastrophic mistake with block modes: with
+// CBC, it reveals whether two streams share a prefix. A registry is an opt-in guardrail, typically
+// enabled in tests and staging. See WithIVRegistry and SetDefaultIVRegistry.
+type IVRegistry interface {
+	// Register records the given IV for the given key, or returns ErrIVReuse if it has already
+	// been recorded.
+	Register(key, iv []byte) error
+}
+
+// ErrIVReuse is returned by an IVRegistry when an IV is used twice with the same key.
+var ErrIVReuse = errors.New("cipherio: IV reused with the same key")
+
+// MemoryIVRegistry is an IVRegistry keeping a fingerprint of each key and IV pair in memory. It is
+// safe for concurrent use. Keys are never stored.
+type MemoryIVRegistry struct {
+	mu   sync.Mutex
+	seen map[[sha256.Size]byte]struct{}
+}
+
+// NewMemoryIVRegistry returns an empty MemoryIVRegistry.
+func NewMemoryIVRegistry() *MemoryIVRegistry {
+	return &MemoryIVRegistry{seen: make(map[[sha256.Size]byte]struct{})}
+}
+
+// Register implements IVRegistry.
+func (r *MemoryIVRegistry) Register(key, iv []byte) error {
+	// Prefix the key with its length, so that the boundary between key and IV is unambiguous.
+	h := sha256.New()
+	h.Write([]byte("cipherio iv registry"))
+	binary.Write(h, binary.BigEndian, uint32(len(key)))
+	h.Write(key)
+	h.Write(iv)
+	var fingerprint [sha256.Size]byte
+	copy(fingerprint[:], h.Sum(nil))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.seen[fingerprint]; ok {
+		return ErrIVReuse
+	}
+	r.seen[fingerprint] = struct{}{}
+	return nil
+}
+
+var defaultIVRegistry struct {
+	sync.Mutex
+	registry IVRegistry
+}
+
+// SetDefaultIVRegistry sets the process-level IVRegistry, used by NewStreamWriter and
+// NewEnvelopeWriter unless WithIVRegistry is given. It is nil by default, which disables the
+// check.
+func SetDefaultIVRegistry(registry IVRegistry) {
+	defaultIVRegistry.Lock()
+	defer defaultIVRegistry.Unlock()
+	defaultIVRegistry.registry = registry
+}
+
+// WithIVRegistry makes NewStreamWriter and NewEnvelopeWriter register the key and IV of the stream
+// in the given IVRegistry, instead of the default one. They fail with ErrIVReuse if the IV has
+// already been used with the same key.
+//
+// Other constructors cannot know the key behind a BlockMode: callers should then call Register
+// themselves.
+func WithIVRegistry(registry IVRegistry) WriterOption {
+	return func(o *writerOptions) {
+		o.ivRegistry = registry
+	}
+}
+
+// registerIV registers the given key and IV in the configured or default IVRegistry, if any.
+func registerIV(opts []WriterOption, key, iv []byte) error {
+	registry := newWriterOptions(opts).ivRegistry
+	if registry == nil {
+		defaultIVRegistry.Lock()
+		registry = defaultIVRegistry.registry
+		defaultIVRegistry.Unlock()
+	}
+	if registry == nil {
+		return nil
+	}
+	return registry.Register(key, iv)
+}
@@ -0,0 +1,97 @@
+package cipherio_test
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestIVRegistry(t *testing.T) {
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	key := randomBytes(32)
+	newHeader := func(iv []byte) *cipherio.StreamHeader {
+		return &cipherio.StreamHeader{
+			Cipher:       cipherio.CipherAES,
+			Mode:         cipherio.ModeCBC,
+			IV:           iv,
+			PlaintextLen: -1,
+		}
+	}
+
+	t.Run("Option", func(t *testing.T) {
+		registry := cipherio.NewMemoryIVRegistry()
+		iv := randomBytes(aes.BlockSize)
+
+		_, err := cipherio.NewStreamWriter(ioutil.Discard, newHeader(iv), key, cipherio.WithIVRegistry(registry))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Another IV, or another key, is accepted.
+		_, err = cipherio.NewStreamWriter(ioutil.Discard, newHeader(randomBytes(aes.BlockSize)), key, cipherio.WithIVRegistry(registry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = cipherio.NewStreamWriter(ioutil.Discard, newHeader(iv), randomBytes(32), cipherio.WithIVRegistry(registry))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = cipherio.NewStreamWriter(ioutil.Discard, newHeader(iv), key, cipherio.WithIVRegistry(registry))
+		if err != cipherio.ErrIVReuse {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrIVReuse)
+		}
+	})
+
+	t.Run("DerivedKey", func(t *testing.T) {
+		// The same IV is accepted with distinct keys derived from the same master key.
+		registry := cipherio.NewMemoryIVRegistry()
+		iv := randomBytes(aes.BlockSize)
+		for _, salt := range []string{"first", "second"} {
+			header := newHeader(iv)
+			header.KDF = cipherio.KDFParams{ID: cipherio.KDFHKDFSHA256, Salt: []byte(salt)}
+			_, err := cipherio.NewStreamWriter(ioutil.Discard, header, key, cipherio.WithIVRegistry(registry))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		cipherio.SetDefaultIVRegistry(cipherio.NewMemoryIVRegistry())
+		defer cipherio.SetDefaultIVRegistry(nil)
+
+		iv := randomBytes(aes.BlockSize)
+		_, err := cipherio.NewEnvelopeWriter(ioutil.Discard, newHeader(iv), key, []cipherio.Recipient{
+			{KeyID: []byte("kek"), KEK: randomBytes(32)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = cipherio.NewStreamWriter(ioutil.Discard, newHeader(iv), key)
+		if err != cipherio.ErrIVReuse {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrIVReuse)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		iv := randomBytes(aes.BlockSize)
+		for i := 0; i < 2; i++ {
+			_, err := cipherio.NewStreamWriter(ioutil.Discard, newHeader(iv), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package cipherio
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+// hkdf derives length bytes from the given secret, as defined by RFC 5869 with SHA-256.
+func hkdf(secret, salt, info []byte, length int) []byte {
+	if length > 255*sha256.Size {
+		panic(fmt.Errorf("cipherio: HKDF cannot derive more than %d bytes: %d", 255*sha256.Size, length))
+	}
+
+	// Extract
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	prk := mac.Sum(nil)
+
+	// Expand
+	out := make([]byte, 0, length+sha256.Size)
+	var prev []byte
+	for counter := byte(1); len(out) < length; counter++ {
+		mac = hmac.New(sha256.New, prk)
+		mac.Write(prev)
+		mac.Write(info)
+		mac.Write([]byte{counter})
+		prev = mac.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
+
+// pbkdf2 derives length bytes from the given password, as defined by RFC 8018 with HMAC-SHA-256.
+func pbkdf2(password, salt []byte, iterations, length int) []byte {
+	mac := hmac.New(sha256.New, password)
+	out := make([]byte, 0, length+sha256.Size)
+	block := make([]byte, sha256.Size)
+	for counter := uint32(1); len(out) < length; counter++ {
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write([]byte{byte(counter >> 24), byte(counter >> 16), byte(counter >> 8), byte(counter)})
+		u := mac.Sum(nil)
+		copy(block, u)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range block {
+				block[j] ^= u[j]
+			}
+		}
+		out = append(out, block...)
+	}
+	return out[:length]
+}
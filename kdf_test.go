@@ -0,0 +1,60 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestHKDF(t *testing.T) {
+	// RFC 5869, test cases 1 and 3
+	testCases := []struct {
+		Name     string
+		Secret   string
+		Salt     string
+		Info     string
+		Expected string
+	}{
+		{
+			Name:     "Basic",
+			Secret:   "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			Salt:     "000102030405060708090a0b0c",
+			Info:     "f0f1f2f3f4f5f6f7f8f9",
+			Expected: "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+		},
+		{
+			Name:     "NoSaltNoInfo",
+			Secret:   "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			Salt:     "",
+			Info:     "",
+			Expected: "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+		},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			secret, _ := hex.DecodeString(testCase.Secret)
+			salt, _ := hex.DecodeString(testCase.Salt)
+			info, _ := hex.DecodeString(testCase.Info)
+			expected, _ := hex.DecodeString(testCase.Expected)
+
+			result := cipherio.HKDF(secret, salt, info, len(expected))
+			if !bytes.Equal(result, expected) {
+				t.Fatalf("unexpected HKDF result: %x != %x", result, expected)
+			}
+		})
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 7914, section 11
+	expected, _ := hex.DecodeString("55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783")
+	result := cipherio.PBKDF2([]byte("passwd"), []byte("salt"), 1, 64)
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected result: %x != %x", result, expected)
+	}
+}
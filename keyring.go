@@ -0,0 +1,72 @@
+package cipherio
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Keyring resolves key encryption keys (KEKs) by ID, typically from a key management system.
+//
+// Retired keys should remain resolvable as long as streams referencing them are kept, so that
+// keys can be rotated without re-encrypting existing data.
+type Keyring interface {
+	// Get returns the KEK identified by keyID, or an error wrapping ErrKeyNotFound if unknown.
+	Get(keyID []byte) ([]byte, error)
+}
+
+// ErrKeyNotFound is returned by a Keyring for an unknown key ID.
+var ErrKeyNotFound = errors.New("cipherio: key not found")
+
+// MapKeyring is a Keyring backed by a map from key IDs to KEKs.
+type MapKeyring map[string][]byte
+
+// Get implements Keyring.
+func (k MapKeyring) Get(keyID []byte) ([]byte, error) {
+	kek, ok := k[string(keyID)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return kek, nil
+}
+
+// NewEnvelopeReaderWithKeyring is similar to NewEnvelopeReader, except that the KEK is resolved
+// from the given Keyring. Slots are tried in order, and the first one whose key ID is found in the
+// Keyring is used.
+//
+// ErrNoRecipient is returned if no key ID is found. Other errors returned by the Keyring are
+// returned as is.
+func NewEnvelopeReaderWithKeyring(src io.Reader, keyring Keyring, opts ...ReaderOption) (io.Reader, *StreamHeader, error) {
+	header, err := ReadStreamHeader(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataKey, err := header.UnwrapKeyWithKeyring(keyring)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := newStreamReader(src, header, dataKey, withRequiredCommitment(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, header, nil
+}
+
+// UnwrapKeyWithKeyring returns the data key stored in the first slot whose key ID is found in the
+// given Keyring.
+func (h *StreamHeader) UnwrapKeyWithKeyring(keyring Keyring) ([]byte, error) {
+	if h.Threshold > 0 {
+		return nil, errSplitKey
+	}
+	for _, slot := range h.Recipients {
+		kek, err := keyring.Get(slot.KeyID)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return unwrapKey(context.Background(), Recipient{KeyID: slot.KeyID, KEK: kek}, slot.WrappedKey)
+	}
+	return nil, ErrNoRecipient
+}
@@ -0,0 +1,105 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// failingKeyring fails for every key ID.
+type failingKeyring struct {
+	err error
+}
+
+func (k failingKeyring) Get(keyID []byte) ([]byte, error) {
+	return nil, k.err
+}
+
+func TestKeyring(t *testing.T) {
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	oldKEK := randomBytes(32)
+	newKEK := randomBytes(32)
+	plaintext := randomBytes(100)
+
+	// Encrypt a stream for the old key only.
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           randomBytes(aes.BlockSize),
+		PlaintextLen: int64(len(plaintext)),
+	}
+	var stream bytes.Buffer
+	writer, err := cipherio.NewEnvelopeWriter(&stream, &header, randomBytes(32), []cipherio.Recipient{
+		{KeyID: []byte("2019"), KEK: oldKEK},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("RetiredKey", func(t *testing.T) {
+		// The retired key remains resolvable after a rotation.
+		keyring := cipherio.MapKeyring{
+			"2019": oldKEK,
+			"2020": newKEK,
+		}
+		reader, _, err := cipherio.NewEnvelopeReaderWithKeyring(bytes.NewReader(stream.Bytes()), keyring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatalf("unexpected decrypted bytes")
+		}
+	})
+
+	t.Run("UnknownKey", func(t *testing.T) {
+		keyring := cipherio.MapKeyring{
+			"2020": newKEK,
+		}
+		_, _, err := cipherio.NewEnvelopeReaderWithKeyring(bytes.NewReader(stream.Bytes()), keyring)
+		if err != cipherio.ErrNoRecipient {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNoRecipient)
+		}
+	})
+
+	t.Run("KeyringError", func(t *testing.T) {
+		testErr := fmt.Errorf("test error")
+		_, _, err := cipherio.NewEnvelopeReaderWithKeyring(bytes.NewReader(stream.Bytes()), failingKeyring{err: testErr})
+		if err != testErr {
+			t.Fatalf("unexpected err: %v != %v", err, testErr)
+		}
+	})
+
+	t.Run("WrappedNotFound", func(t *testing.T) {
+		notFound := fmt.Errorf("vault: %w", cipherio.ErrKeyNotFound)
+		_, _, err := cipherio.NewEnvelopeReaderWithKeyring(bytes.NewReader(stream.Bytes()), failingKeyring{err: notFound})
+		if err != cipherio.ErrNoRecipient {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNoRecipient)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package cipherio
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// KeyWrapper wraps and unwraps data keys, typically by delegating to a key management service
+// (KMS). This allows to plug any KMS backend into envelopes without depending on its SDK.
+type KeyWrapper interface {
+	// Wrap returns an opaque blob from which Unwrap can recover the given data key.
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+
+	// Unwrap returns the data key wrapped in the given blob.
+	Unwrap(ctx context.Context, blob []byte) ([]byte, error)
+}
+
+// AESKeyWrapper is a local KeyWrapper implementing the AES Key Wrap algorithm, as defined by
+// RFC 3394. Data keys must be a multiple of 8 bytes, and at least 16 bytes long.
+type AESKeyWrapper struct {
+	block cipher.Block
+}
+
+// NewAESKeyWrapper returns an AESKeyWrapper using the given KEK, which must be a valid AES key.
+func NewAESKeyWrapper(kek []byte) (*AESKeyWrapper, error) {
+	block, err := newAESCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return &AESKeyWrapper{block: block}, nil
+}
+
+// aesKeyWrapIV is the default initial value defined by RFC 3394.
+var aesKeyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// Wrap implements KeyWrapper. The result is 8 bytes longer than the data key.
+func (w *AESKeyWrapper) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	if len(dataKey) < 16 || len(dataKey)%8 != 0 {
+		return nil, fmt.Errorf("cipherio: AES key wrap requires a multiple of 8 bytes, at least 16: %d", len(dataKey))
+	}
+
+	n := len(dataKey) / 8
+	out := make([]byte, 8+len(dataKey))
+	copy(out, aesKeyWrapIV)
+	copy(out[8:], dataKey)
+
+	var b [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[:8], out[:8])
+			copy(b[8:], out[8*i:8*i+8])
+			w.block.Encrypt(b[:], b[:])
+
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(out[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[8*i:8*i+8], b[8:])
+		}
+	}
+	return out, nil
+}
+
+// Unwrap implements KeyWrapper. An error is returned if the blob has not been wrapped with the
+// same KEK.
+func (w *AESKeyWrapper) Unwrap(ctx context.Context, blob []byte) ([]byte, error) {
+	if len(blob) < 24 || len(blob)%8 != 0 {
+		return nil, errors.New("cipherio: invalid wrapped key")
+	}
+
+	n := len(blob)/8 - 1
+	out := make([]byte, len(blob))
+	copy(out, blob)
+
+	var b [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(out[:8])^t)
+			copy(b[8:], out[8*i:8*i+8])
+			w.block.Decrypt(b[:], b[:])
+
+			copy(out[:8], b[:8])
+			copy(out[8*i:8*i+8], b[8:])
+		}
+	}
+
+	if !EqualTags(out[:8], aesKeyWrapIV) {
+		return nil, errors.New("cipherio: cannot unwrap key: wrong KEK or corrupted slot")
+	}
+	return out[8:], nil
+}
@@ -0,0 +1,156 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type aesKeyWrapTest struct {
+	Name    string
+	KEK     string
+	Key     string
+	Wrapped string
+}
+
+func TestAESKeyWrapper(t *testing.T) {
+	// Test vectors from RFC 3394, section 4
+	testCases := []aesKeyWrapTest{
+		{
+			Name:    "128KEK128Key",
+			KEK:     "000102030405060708090A0B0C0D0E0F",
+			Key:     "00112233445566778899AABBCCDDEEFF",
+			Wrapped: "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5",
+		},
+		{
+			Name:    "192KEK128Key",
+			KEK:     "000102030405060708090A0B0C0D0E0F1011121314151617",
+			Key:     "00112233445566778899AABBCCDDEEFF",
+			Wrapped: "96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D",
+		},
+		{
+			Name:    "256KEK256Key",
+			KEK:     "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+			Key:     "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+			Wrapped: "28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21",
+		},
+	}
+
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			wrapper, err := cipherio.NewAESKeyWrapper(decode(testCase.KEK))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wrapped, err := wrapper.Wrap(context.Background(), decode(testCase.Key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(wrapped, decode(testCase.Wrapped)) {
+				t.Fatalf("unexpected wrapped key: %X != %s", wrapped, testCase.Wrapped)
+			}
+
+			key, err := wrapper.Unwrap(context.Background(), wrapped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(key, decode(testCase.Key)) {
+				t.Fatalf("unexpected unwrapped key: %X != %s", key, testCase.Key)
+			}
+
+			// Any corruption must be detected.
+			wrapped[len(wrapped)-1] ^= 1
+			_, err = wrapper.Unwrap(context.Background(), wrapped)
+			if err == nil {
+				t.Fatal("corrupted key accepted")
+			}
+		})
+	}
+
+	t.Run("InvalidLength", func(t *testing.T) {
+		wrapper, err := cipherio.NewAESKeyWrapper(make([]byte, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = wrapper.Wrap(context.Background(), make([]byte, 20))
+		if err == nil {
+			t.Fatal("unaligned key accepted")
+		}
+		_, err = wrapper.Unwrap(context.Background(), make([]byte, 16))
+		if err == nil {
+			t.Fatal("short blob accepted")
+		}
+	})
+
+	t.Run("Envelope", func(t *testing.T) {
+		kek := make([]byte, 32)
+		_, err := rand.Read(kek)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrapper, err := cipherio.NewAESKeyWrapper(kek)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipient := cipherio.Recipient{KeyID: []byte("kms"), Wrapper: wrapper}
+
+		dataKey := make([]byte, 32)
+		_, err = rand.Read(dataKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := cipherio.StreamHeader{
+			Cipher:       cipherio.CipherAES,
+			Mode:         cipherio.ModeCBC,
+			Padding:      cipherio.PaddingPKCS7,
+			IV:           make([]byte, aes.BlockSize),
+			PlaintextLen: 5,
+		}
+
+		var stream bytes.Buffer
+		writer, err := cipherio.NewEnvelopeWriterContext(context.Background(), &stream, &header, dataKey, []cipherio.Recipient{recipient})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(header.Recipients[0].WrappedKey) != 40 {
+			t.Fatalf("unexpected wrapped key length: %d != %d", len(header.Recipients[0].WrappedKey), 40)
+		}
+
+		reader, _, err := cipherio.NewEnvelopeReaderContext(context.Background(), bytes.NewReader(stream.Bytes()), recipient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(result) != "hello" {
+			t.Fatalf("unexpected decrypted bytes: %q", result)
+		}
+	})
+}
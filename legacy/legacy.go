@@ -0,0 +1,87 @@
+// Package legacy provides readers for weak ciphers, so that migration tools can read old archives
+// with the Readers of cipherio.
+//
+// WARNING: RC4, DES and Triple-DES are broken or obsolete. They MUST NOT be used to protect new
+// data, hence this package only provides decrypting Readers. Every constructor requires
+// AcknowledgeWeak, so that each use is explicit and easy to audit.
+//
+// Constructors also enforce cipherio.CurrentPolicy: FIPS rejects RC4 and DES, and RequireMAC
+// rejects every CBC Reader.
+package legacy
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rc4"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/connesc/cipherio"
+)
+
+// OptIn acknowledges that the algorithms of this package are weak.
+type OptIn bool
+
+// AcknowledgeWeak must be passed to every constructor of this package.
+const AcknowledgeWeak OptIn = true
+
+// ErrNotAcknowledged is returned by constructors called without AcknowledgeWeak.
+var ErrNotAcknowledged = errors.New("legacy: weak algorithms must be acknowledged with AcknowledgeWeak")
+
+// NewRC4Reader returns a Reader decrypting src with RC4.
+func NewRC4Reader(src io.Reader, key []byte, optIn OptIn) (io.Reader, error) {
+	if !optIn {
+		return nil, ErrNotAcknowledged
+	}
+	if cipherio.CurrentPolicy().FIPS {
+		return nil, cipherio.PolicyError{Algorithm: "RC4", Reason: "not approved by FIPS 140-3"}
+	}
+	stream, err := rc4.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", cipherio.ErrInvalidKeySize, err)
+	}
+	return cipher.StreamReader{S: stream, R: src}, nil
+}
+
+// NewDESCBCReader returns a BlockReader decrypting src with DES in CBC mode. The key must be 8
+// bytes long. As with cipherio.NewBlockReader, src must be aligned to the block size, and any
+// padding is left for the caller to remove.
+func NewDESCBCReader(src io.Reader, key, iv []byte, optIn OptIn, opts ...cipherio.ReaderOption) (*cipherio.BlockReader, error) {
+	if !optIn {
+		return nil, ErrNotAcknowledged
+	}
+	if cipherio.CurrentPolicy().FIPS {
+		return nil, cipherio.PolicyError{Algorithm: "DES", Reason: "not approved by FIPS 140-3"}
+	}
+	block, err := des.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: DES requires 8 bytes: %d", cipherio.ErrInvalidKeySize, len(key))
+	}
+	return newCBCReader(src, block, iv, opts)
+}
+
+// NewTripleDESCBCReader returns a BlockReader decrypting src with Triple-DES in CBC mode. The key
+// is either 24 or 16 bytes long, as with cipherio.NewTripleDESCipher. Degenerate keys are accepted,
+// since old archives may have been encrypted with them. As with cipherio.NewBlockReader, src must
+// be aligned to the block size, and any padding is left for the caller to remove.
+func NewTripleDESCBCReader(src io.Reader, key, iv []byte, optIn OptIn, opts ...cipherio.ReaderOption) (*cipherio.BlockReader, error) {
+	if !optIn {
+		return nil, ErrNotAcknowledged
+	}
+	block, err := cipherio.NewTripleDESCipher(key, cipherio.TripleDESOptions{AllowSingleDES: true})
+	if err != nil {
+		return nil, err
+	}
+	return newCBCReader(src, block, iv, opts)
+}
+
+func newCBCReader(src io.Reader, block cipher.Block, iv []byte, opts []cipherio.ReaderOption) (*cipherio.BlockReader, error) {
+	if cipherio.CurrentPolicy().RequireMAC {
+		return nil, cipherio.PolicyError{Algorithm: "CBC", Reason: "not authenticated"}
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("%w: length must equal block size: %d != %d", cipherio.ErrInvalidIV, len(iv), block.BlockSize())
+	}
+	return cipherio.NewBlockReader(src, cipher.NewCBCDecrypter(block, iv), opts...), nil
+}
@@ -0,0 +1,118 @@
+package legacy_test
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rc4"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+	"github.com/connesc/cipherio/legacy"
+)
+
+// archive is a legacy plaintext, aligned to the DES block size.
+var archive = []byte("an old archive, written long ago")
+
+func TestRC4Reader(t *testing.T) {
+	key := []byte("legacy key")
+	stream, err := rc4.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := make([]byte, len(archive))
+	stream.XORKeyStream(encrypted, archive)
+
+	reader, err := legacy.NewRC4Reader(bytes.NewReader(encrypted), key, legacy.AcknowledgeWeak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, archive) {
+		t.Fatalf("unexpected plaintext: %q != %q", result, archive)
+	}
+}
+
+func TestCBCReaders(t *testing.T) {
+	iv := []byte("8 bytes!")
+
+	testCases := []struct {
+		name      string
+		key       []byte
+		newCipher func([]byte) (cipher.Block, error)
+		newReader func(io.Reader, []byte, []byte, legacy.OptIn, ...cipherio.ReaderOption) (*cipherio.BlockReader, error)
+	}{
+		{"DES", []byte("8bytekey"), des.NewCipher, legacy.NewDESCBCReader},
+		{"TripleDES", []byte("a twenty-four byte key!!"), des.NewTripleDESCipher, legacy.NewTripleDESCBCReader},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			block, err := testCase.newCipher(testCase.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encrypted := make([]byte, len(archive))
+			cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, archive)
+
+			reader, err := testCase.newReader(bytes.NewReader(encrypted), testCase.key, iv, legacy.AcknowledgeWeak)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, archive) {
+				t.Fatalf("unexpected plaintext: %q != %q", result, archive)
+			}
+
+			_, err = testCase.newReader(bytes.NewReader(encrypted), testCase.key[:5], iv, legacy.AcknowledgeWeak)
+			if !errors.Is(err, cipherio.ErrInvalidKeySize) {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidKeySize)
+			}
+			_, err = testCase.newReader(bytes.NewReader(encrypted), testCase.key, iv[:4], legacy.AcknowledgeWeak)
+			if !errors.Is(err, cipherio.ErrInvalidIV) {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidIV)
+			}
+			_, err = testCase.newReader(bytes.NewReader(encrypted), testCase.key, iv, false)
+			if err != legacy.ErrNotAcknowledged {
+				t.Fatalf("unexpected err: %v != %v", err, legacy.ErrNotAcknowledged)
+			}
+		})
+	}
+}
+
+func TestNotAcknowledged(t *testing.T) {
+	_, err := legacy.NewRC4Reader(bytes.NewReader(nil), []byte("key"), false)
+	if err != legacy.ErrNotAcknowledged {
+		t.Fatalf("unexpected err: %v != %v", err, legacy.ErrNotAcknowledged)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	defer cipherio.SetPolicy(cipherio.Policy{})
+
+	cipherio.SetPolicy(cipherio.Policy{FIPS: true})
+	_, err := legacy.NewRC4Reader(bytes.NewReader(archive), []byte("legacy key"), legacy.AcknowledgeWeak)
+	if !errors.Is(err, cipherio.ErrNotApproved) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNotApproved)
+	}
+	_, err = legacy.NewDESCBCReader(bytes.NewReader(archive), make([]byte, 8), make([]byte, 8), legacy.AcknowledgeWeak)
+	if !errors.Is(err, cipherio.ErrNotApproved) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNotApproved)
+	}
+
+	cipherio.SetPolicy(cipherio.Policy{RequireMAC: true})
+	_, err = legacy.NewTripleDESCBCReader(bytes.NewReader(archive), make([]byte, 24), make([]byte, 8), legacy.AcknowledgeWeak)
+	if !errors.Is(err, cipherio.ErrNotApproved) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNotApproved)
+	}
+}
@@ -0,0 +1,162 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// lengthTrailerSize is the size of the length stored at the end of the trailer block.
+const lengthTrailerSize = 8
+
+// LengthTrailerWriter (en|de)crypts data followed by a trailer block storing its length, so that
+// any padding can be removed unambiguously by a Reader returned by NewLengthTrailerReader.
+//
+// Any incomplete block is filled with zeroes, then a dedicated trailer block is added, made of
+// zeroes followed by the length of the data as a big-endian 64-bit integer. Unlike ZeroPadding and
+// BitPadding, this supports binary data ending with any byte, and unlike PKCS#7, any block size of
+// at least 8 bytes.
+type LengthTrailerWriter struct {
+	writer   *BlockWriter
+	accepted int64
+}
+
+// NewLengthTrailerWriter returns a LengthTrailerWriter wrapping a BlockWriter with the given
+// BlockMode. An error is returned if the block size is smaller than 8 bytes.
+func NewLengthTrailerWriter(dst io.Writer, blockMode cipher.BlockMode, opts ...WriterOption) (*LengthTrailerWriter, error) {
+	if err := checkLengthTrailer(blockMode.BlockSize()); err != nil {
+		return nil, err
+	}
+	return &LengthTrailerWriter{
+		writer: NewBlockWriter(dst, blockMode, opts...),
+	}, nil
+}
+
+func (w *LengthTrailerWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.accepted += int64(n)
+	return n, err
+}
+
+// Close writes the padding and the trailer block, then closes the underlying BlockWriter. The
+// wrapped Writer is not closed.
+func (w *LengthTrailerWriter) Close() error {
+	blockSize := int64(w.writer.blockSize)
+	fill := alignedSize(w.accepted, blockSize) - w.accepted
+
+	// Both the padding and the leading bytes of the trailer block are zeroes.
+	trailer := make([]byte, fill+blockSize)
+	binary.BigEndian.PutUint64(trailer[len(trailer)-lengthTrailerSize:], uint64(w.accepted))
+	if _, err := w.writer.Write(trailer); err != nil {
+		w.writer.Close()
+		return err
+	}
+	return w.writer.Close()
+}
+
+// NewLengthTrailerReader returns a Reader (en|de)crypting src with the given BlockMode, like
+// NewBlockReader, then removing the padding and the trailer block of the result, as added by
+// LengthTrailerWriter. An error is returned if the block size is smaller than 8 bytes.
+//
+// The last two blocks are held back until EOF. ErrInvalidPadding is then returned if the trailer
+// does not match the length of the data, which also happens with a wrong key or IV, or with
+// truncated data.
+func NewLengthTrailerReader(src io.Reader, blockMode cipher.BlockMode, opts ...ReaderOption) (io.Reader, error) {
+	blockSize := blockMode.BlockSize()
+	if err := checkLengthTrailer(blockSize); err != nil {
+		return nil, err
+	}
+	return &lengthTrailerUnpadder{
+		src:       NewBlockReader(src, blockMode, opts...),
+		blockSize: blockSize,
+		buf:       make([]byte, 0, 256*blockSize),
+	}, nil
+}
+
+func checkLengthTrailer(blockSize int) error {
+	if blockSize < lengthTrailerSize {
+		return fmt.Errorf("cipherio: block size too small for a length trailer: %d < %d", blockSize, lengthTrailerSize)
+	}
+	return nil
+}
+
+// lengthTrailerUnpadder holds back the last two blocks read from src until EOF, to remove the
+// padding and the trailer block, as added by LengthTrailerWriter.
+type lengthTrailerUnpadder struct {
+	src       io.Reader
+	blockSize int
+	buf       []byte // bytes read from src and not returned yet
+	offset    int64  // number of bytes returned so far
+	err       error
+	done      bool // if true, the padding and the trailer block have been removed from buf
+}
+
+func (r *lengthTrailerUnpadder) Read(p []byte) (int, error) {
+	for {
+		// The padding is shorter than a block, and followed by the trailer block.
+		available := len(r.buf)
+		if !r.done {
+			available -= 2 * r.blockSize
+		}
+		if available > 0 {
+			n := copy(p, r.buf[:available])
+			r.buf = r.buf[:copy(r.buf, r.buf[n:])]
+			r.offset += int64(n)
+			return n, nil
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.src.Read(r.buf[len(r.buf):cap(r.buf)])
+		r.buf = r.buf[:len(r.buf)+n]
+		if err == io.EOF {
+			if length, ok := r.checkTrailer(); !ok {
+				err = ErrInvalidPadding
+			} else {
+				r.buf = r.buf[:length-r.offset]
+				r.done = true
+			}
+		}
+		r.err = err
+		if err != nil && !r.done {
+			r.buf = r.buf[:0]
+		}
+	}
+}
+
+// checkTrailer returns the length of the data stored in the trailer block at the end of buf, if
+// consistent with the amount of data read and followed by a valid padding.
+func (r *lengthTrailerUnpadder) checkTrailer() (int64, bool) {
+	if len(r.buf) < r.blockSize {
+		return 0, false
+	}
+	trailerStart := len(r.buf) - r.blockSize
+	trailer := r.buf[trailerStart:]
+	lengthStart := r.blockSize - lengthTrailerSize
+	if !isZero(trailer[:lengthStart]) {
+		return 0, false
+	}
+
+	// The data must end in the last block before the trailer.
+	size := r.offset + int64(trailerStart)
+	length := binary.BigEndian.Uint64(trailer[lengthStart:])
+	if length > uint64(size) || alignedSize(int64(length), int64(r.blockSize)) != size {
+		return 0, false
+	}
+	if !isZero(r.buf[int64(length)-r.offset : trailerStart]) {
+		return 0, false
+	}
+	return int64(length), true
+}
+
+// isZero returns whether all bytes of b are zeroes.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
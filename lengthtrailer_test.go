@@ -0,0 +1,176 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// tinyBlockMode is a BlockMode whose block size is too small for a length trailer.
+type tinyBlockMode struct{}
+
+func (tinyBlockMode) BlockSize() int { return 4 }
+
+func (tinyBlockMode) CryptBlocks(dst, src []byte) { copy(dst, src) }
+
+func TestLengthTrailerWriterReader(t *testing.T) {
+	for _, keySize := range []int{8, 32} {
+		// Generate a random key, for DES and AES
+		key := make([]byte, keySize)
+		_, err := rand.Read(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Initialize the cipher
+		var block cipher.Block
+		if keySize == 8 {
+			block, err = des.NewCipher(key)
+		} else {
+			block, err = aes.NewCipher(key)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockSize := block.BlockSize()
+		iv := make([]byte, blockSize)
+
+		for _, size := range []int{0, 1, 7, 8, 9, 16, 17, 5000} {
+			// The second half is made of zeroes, which ZeroPadding would not preserve.
+			plaintext := make([]byte, size)
+			_, err = rand.Read(plaintext[:size/2])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			writer, err := cipherio.NewLengthTrailerWriter(&buf, cipher.NewCBCEncrypter(block, iv))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			_, err = writer.Write(plaintext)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if expected := (size+blockSize-1)/blockSize*blockSize + blockSize; buf.Len() != expected {
+				t.Fatalf("unexpected ciphertext size: %d != %d", buf.Len(), expected)
+			}
+
+			// The trailer block ends with the length.
+			decrypted := make([]byte, buf.Len())
+			cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, buf.Bytes())
+			if length := binary.BigEndian.Uint64(decrypted[len(decrypted)-8:]); length != uint64(size) {
+				t.Fatalf("unexpected trailer length: %d != %d", length, size)
+			}
+
+			reader, err := cipherio.NewLengthTrailerReader(&buf, cipher.NewCBCDecrypter(block, iv))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatalf("decrypted data does not match plaintext for %d bytes with %d-byte blocks", size, blockSize)
+			}
+		}
+	}
+}
+
+func TestLengthTrailerReaderInvalid(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	// trailed returns the given data, padded and followed by a trailer block storing length.
+	trailed := func(data []byte, length uint64) []byte {
+		result := make([]byte, (len(data)+15)/16*16+16)
+		copy(result, data)
+		binary.BigEndian.PutUint64(result[len(result)-8:], length)
+		return result
+	}
+
+	for name, plaintext := range map[string][]byte{
+		"Empty":     {},
+		"Longer":    trailed(make([]byte, 20), 33),
+		"Shorter":   trailed(make([]byte, 20), 16),
+		"Truncated": trailed(make([]byte, 20), 20)[:32],
+		"Padding":   trailed([]byte{1, 2, 3, 4}, 2),
+		"Trailer":   append(trailed(make([]byte, 20), 20)[:32], 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 20),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ciphertext := make([]byte, len(plaintext))
+			cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(ciphertext, plaintext)
+			reader, err := cipherio.NewLengthTrailerReader(bytes.NewReader(ciphertext), cipher.NewCBCDecrypter(aesCipher, iv))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			_, err = ioutil.ReadAll(reader)
+			if err != cipherio.ErrInvalidPadding {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidPadding)
+			}
+		})
+	}
+
+	t.Run("WrongKey", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer, err := cipherio.NewLengthTrailerWriter(&buf, cipher.NewCBCEncrypter(aesCipher, iv))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		_, err = writer.Write(make([]byte, 100))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		otherCipher, err := aes.NewCipher(make([]byte, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := cipherio.NewLengthTrailerReader(&buf, cipher.NewCBCDecrypter(otherCipher, iv))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		_, err = ioutil.ReadAll(reader)
+		if err != cipherio.ErrInvalidPadding {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidPadding)
+		}
+	})
+
+	t.Run("BlockSize", func(t *testing.T) {
+		_, err := cipherio.NewLengthTrailerWriter(ioutil.Discard, tinyBlockMode{})
+		if err == nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		_, err = cipherio.NewLengthTrailerReader(bytes.NewReader(nil), tinyBlockMode{})
+		if err == nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+}
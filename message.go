@@ -0,0 +1,220 @@
+package cipherio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+)
+
+const (
+	messageHeaderSize = 4 // length of the rest of the frame
+	messageOverhead   = aes.BlockSize + sha256.Size
+
+	// DefaultMaxMessageSize is the largest payload accepted by MessageReader when none is
+	// specified.
+	DefaultMaxMessageSize = 16 << 20
+)
+
+// MessageOptions configures MessageWriter and MessageReader. The zero value is valid.
+type MessageOptions struct {
+	// MaxSize is the largest payload, in bytes, that can be written or read, which bounds the
+	// memory allocated for a frame announced by a peer. Defaults to DefaultMaxMessageSize.
+	MaxSize int
+
+	// Rand is the source of the IVs. Defaults to crypto/rand.Reader.
+	Rand io.Reader
+}
+
+// messageKeys holds the keys derived for messages from the key given by the application.
+type messageKeys struct {
+	block   cipher.Block
+	macKey  []byte
+	maxSize int
+}
+
+func newMessageKeys(key []byte, opts MessageOptions) (messageKeys, error) {
+	if _, err := newAESCipher(key); err != nil {
+		return messageKeys{}, err
+	}
+	maxSize := opts.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+	if maxSize < 0 || uint64(maxSize)+messageOverhead+aes.BlockSize > 1<<32-1 {
+		return messageKeys{}, fmt.Errorf("cipherio: invalid maximum message size: %d", opts.MaxSize)
+	}
+
+	block, err := newAESCipher(hkdf(key, nil, []byte("cipherio message encryption"), len(key)))
+	if err != nil {
+		return messageKeys{}, err
+	}
+	return messageKeys{
+		block:   block,
+		macKey:  hkdf(key, nil, []byte("cipherio message authentication"), sha256.Size),
+		maxSize: maxSize,
+	}, nil
+}
+
+// messageCiphertextLen returns the length of the ciphertext of a message, which is always padded.
+func messageCiphertextLen(messageLen int) int {
+	return (messageLen/aes.BlockSize + 1) * aes.BlockSize
+}
+
+// messageTag returns the MAC of a frame, computed over its header, IV and ciphertext.
+func messageTag(mac hash.Hash, frame []byte) []byte {
+	mac.Reset()
+	mac.Write(frame)
+	return mac.Sum(nil)
+}
+
+// MessageWriter encrypts and authenticates individual messages, and frames them on a Writer, so
+// that pipelines exchanging discrete payloads do not need to invent their own framing.
+//
+// Each frame is made of the length of the rest of the frame as a big-endian uint32, followed by a
+// random IV, the AES-CBC ciphertext of the message with PKCS#7 padding, and an HMAC-SHA256 tag over
+// everything before it. Distinct keys are derived for encryption and authentication.
+//
+// Each message is authenticated on its own: an attacker can still drop, replay or reorder whole
+// messages, which applications must detect if needed, for example with sequence numbers in the
+// payload.
+type MessageWriter struct {
+	dst  io.Writer
+	keys messageKeys
+	mac  hash.Hash
+	rand io.Reader
+}
+
+// NewMessageWriter returns a MessageWriter writing frames to dst with the given AES key.
+func NewMessageWriter(dst io.Writer, key []byte, opts MessageOptions) (*MessageWriter, error) {
+	keys, err := newMessageKeys(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageWriter{
+		dst:  dst,
+		keys: keys,
+		mac:  hmac.New(sha256.New, keys.macKey),
+		rand: randOrDefault(opts.Rand),
+	}, nil
+}
+
+// WriteMessage encrypts the given message, and writes it as a single frame with a single call to
+// the wrapped Writer. It is not safe for concurrent use.
+func (w *MessageWriter) WriteMessage(message []byte) error {
+	if len(message) > w.keys.maxSize {
+		return fmt.Errorf("cipherio: message is too large: %d > %d", len(message), w.keys.maxSize)
+	}
+
+	// Unlike BlockWriter, a full block of padding is added to aligned messages, so that the
+	// padding can always be removed.
+	ciphertextLen := messageCiphertextLen(len(message))
+	frame := make([]byte, messageHeaderSize+aes.BlockSize+ciphertextLen, messageHeaderSize+aes.BlockSize+ciphertextLen+sha256.Size)
+	binary.BigEndian.PutUint32(frame, uint32(aes.BlockSize+ciphertextLen+sha256.Size))
+	iv := frame[messageHeaderSize : messageHeaderSize+aes.BlockSize]
+	if _, err := io.ReadFull(w.rand, iv); err != nil {
+		return err
+	}
+
+	ciphertext := frame[messageHeaderSize+aes.BlockSize:]
+	copy(ciphertext, message)
+	PKCS7Padding.Fill(ciphertext[len(message):])
+	cipher.NewCBCEncrypter(w.keys.block, iv).CryptBlocks(ciphertext, ciphertext)
+	frame = append(frame, messageTag(w.mac, frame)...)
+
+	_, err := w.dst.Write(frame)
+	return err
+}
+
+// MessageReader reads and verifies the frames written by a MessageWriter.
+type MessageReader struct {
+	src  io.Reader
+	keys messageKeys
+	mac  hash.Hash
+}
+
+// NewMessageReader returns a MessageReader reading frames from src with the given AES key, which
+// must match the one of the MessageWriter.
+func NewMessageReader(src io.Reader, key []byte, opts MessageOptions) (*MessageReader, error) {
+	keys, err := newMessageKeys(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageReader{
+		src:  src,
+		keys: keys,
+		mac:  hmac.New(sha256.New, keys.macKey),
+	}, nil
+}
+
+// ReadMessage reads the next frame, verifies it, and returns the decrypted message. It returns
+// io.EOF if the stream ends between frames, io.ErrUnexpectedEOF if it ends within a frame, and
+// ErrAuthentication if the frame has been tampered with or was encrypted with another key. It is
+// not safe for concurrent use.
+func (r *MessageReader) ReadMessage() ([]byte, error) {
+	var header [messageHeaderSize]byte
+	if _, err := io.ReadFull(r.src, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	maxLength := uint64(messageCiphertextLen(r.keys.maxSize)) + messageOverhead
+	if length < messageOverhead+aes.BlockSize || (length-messageOverhead)%aes.BlockSize != 0 || uint64(length) > maxLength {
+		return nil, fmt.Errorf("cipherio: invalid message length: %d", length)
+	}
+
+	frame := make([]byte, messageHeaderSize+int(length))
+	copy(frame, header[:])
+	if _, err := io.ReadFull(r.src, frame[messageHeaderSize:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	body, tag := frame[:len(frame)-sha256.Size], frame[len(frame)-sha256.Size:]
+	if !EqualTags(messageTag(r.mac, body), tag) {
+		return nil, ErrAuthentication
+	}
+
+	iv, ciphertext := body[messageHeaderSize:messageHeaderSize+aes.BlockSize], body[messageHeaderSize+aes.BlockSize:]
+	cipher.NewCBCDecrypter(r.keys.block, iv).CryptBlocks(ciphertext, ciphertext)
+	n, ok := CheckPKCS7Padding(ciphertext[len(ciphertext)-aes.BlockSize:])
+	if !ok {
+		// Only a writer knowing the key can produce an authenticated frame with a bad padding.
+		return nil, ErrInvalidPadding
+	}
+	message := ciphertext[:len(ciphertext)-n]
+	if len(message) > r.keys.maxSize {
+		return nil, fmt.Errorf("cipherio: message is too large: %d > %d", len(message), r.keys.maxSize)
+	}
+	return message, nil
+}
+
+// MessageConn exchanges messages over a bidirectional stream, such as a net.Conn, by combining a
+// MessageWriter and a MessageReader. WriteMessage and ReadMessage may be called concurrently with
+// each other.
+//
+// Both directions use the same key, so a message could be reflected back to its writer. Protocols
+// where this matters should use a distinct key per direction, with NewMessageWriter and
+// NewMessageReader.
+type MessageConn struct {
+	*MessageWriter
+	*MessageReader
+}
+
+// NewMessageConn returns a MessageConn over rw with the given AES key.
+func NewMessageConn(rw io.ReadWriter, key []byte, opts MessageOptions) (*MessageConn, error) {
+	writer, err := NewMessageWriter(rw, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewMessageReader(rw, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageConn{writer, reader}, nil
+}
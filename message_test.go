@@ -0,0 +1,116 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestMessage(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := [][]byte{
+		{},
+		[]byte("a"),
+		bytes.Repeat([]byte("x"), 16),
+		bytes.Repeat([]byte("y"), 1000),
+	}
+
+	var buf bytes.Buffer
+	conn, err := cipherio.NewMessageConn(&buf, key, cipherio.MessageOptions{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	for _, message := range messages {
+		err = conn.WriteMessage(message)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+	}
+	for i, message := range messages {
+		result, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(result, message) {
+			t.Fatalf("unexpected message %d: %q != %q", i, result, message)
+		}
+	}
+	_, err = conn.ReadMessage()
+	if err != io.EOF {
+		t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+	}
+}
+
+func TestMessageInvalid(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	writer, err := cipherio.NewMessageWriter(&buf, key, cipherio.MessageOptions{MaxSize: 100})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.WriteMessage(make([]byte, 101))
+	if err == nil {
+		t.Fatal("oversized message was accepted")
+	}
+	err = writer.WriteMessage([]byte("hello, message"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	frame := buf.Bytes()
+
+	tampered := append([]byte(nil), frame...)
+	tampered[30] ^= 1
+
+	testCases := []struct {
+		Name     string
+		Frame    []byte
+		Key      []byte
+		MaxSize  int
+		Expected error
+	}{
+		{"Tampered", tampered, key, 0, cipherio.ErrAuthentication},
+		{"WrongKey", frame, make([]byte, 16), 0, cipherio.ErrAuthentication},
+		{"Truncated", frame[:len(frame)-1], key, 0, io.ErrUnexpectedEOF},
+		{"TruncatedHeader", frame[:2], key, 0, io.ErrUnexpectedEOF},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			reader, err := cipherio.NewMessageReader(bytes.NewReader(testCase.Frame), testCase.Key, cipherio.MessageOptions{})
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			_, err = reader.ReadMessage()
+			if err != testCase.Expected {
+				t.Fatalf("unexpected err: %v != %v", err, testCase.Expected)
+			}
+		})
+	}
+
+	// A reader with a smaller maximum rejects the message.
+	reader, err := cipherio.NewMessageReader(bytes.NewReader(frame), key, cipherio.MessageOptions{MaxSize: 8})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = reader.ReadMessage()
+	if err == nil {
+		t.Fatal("oversized frame was accepted")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package cipherio
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform.
+func mmapFile(file *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("cipherio: memory mapping is not supported")
+}
@@ -0,0 +1,320 @@
+package cipherio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MultipartManifest describes the parts written by a MultipartWriter. It is needed to read them
+// back.
+type MultipartManifest struct {
+	PartSize  int64   // number of plaintext bytes per part, except the last one
+	Size      int64   // total number of plaintext bytes
+	PartSizes []int64 // number of ciphertext bytes of each part
+}
+
+var multipartManifestMagic = []byte("CIOMPRT\x01")
+
+// MarshalBinary encodes the manifest in a compact binary format.
+func (m *MultipartManifest) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(multipartManifestMagic)
+	binary.Write(&buf, binary.BigEndian, m.PartSize)
+	binary.Write(&buf, binary.BigEndian, m.Size)
+	binary.Write(&buf, binary.BigEndian, uint32(len(m.PartSizes)))
+	binary.Write(&buf, binary.BigEndian, m.PartSizes)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a manifest encoded by MarshalBinary.
+func (m *MultipartManifest) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	magic := make([]byte, len(multipartManifestMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, multipartManifestMagic) {
+		return errors.New("cipherio: invalid multipart manifest")
+	}
+
+	var partSize, size int64
+	var parts uint32
+	for _, v := range []interface{}{&partSize, &size, &parts} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return errors.New("cipherio: truncated multipart manifest")
+		}
+	}
+	if partSize <= 0 || size < 0 || int64(parts)*8 != int64(r.Len()) {
+		return errors.New("cipherio: invalid multipart manifest")
+	}
+	partSizes := make([]int64, parts)
+	if err := binary.Read(r, binary.BigEndian, partSizes); err != nil {
+		return errors.New("cipherio: truncated multipart manifest")
+	}
+
+	m.PartSize = partSize
+	m.Size = size
+	m.PartSizes = partSizes
+	return nil
+}
+
+// partPlaintextLen returns the number of plaintext bytes of the given part.
+func (m *MultipartManifest) partPlaintextLen(partIndex int) int64 {
+	remaining := m.Size - int64(partIndex)*m.PartSize
+	if remaining > m.PartSize {
+		return m.PartSize
+	}
+	return remaining
+}
+
+// MultipartWriter splits a plaintext stream into parts, each one encrypted independently with the
+// BlockMode returned by a BlockModeFactory for its index, typically with a derived IV or key (see
+// ChunkKeys). It is the WriteCloser returned by NewMultipartWriter.
+//
+// Unlike PartWriter, each part can be decrypted on its own with OpenPart. Since encryption is
+// deterministic for a given factory, a failed part upload can also be retried by encrypting the
+// same plaintext part again.
+type MultipartWriter struct {
+	nextWriter func(partIndex int) (io.Writer, error)
+	factory    BlockModeFactory
+	padding    Padding
+	partSize   int64
+	opts       []WriterOption
+
+	index     int          // index of the next part
+	dst       io.Writer    // destination of the current part, if any
+	current   *BlockWriter // writer of the current part, if any
+	remaining int64        // number of plaintext bytes left in the current part
+	size      int64
+	partSizes []int64
+	manifest  *MultipartManifest
+	err       error
+}
+
+// NewMultipartWriter returns a MultipartWriter encrypting parts of partSize plaintext bytes, each
+// one written to a different Writer obtained from nextWriter. If a Writer also implements
+// io.Closer, then it is closed once its part is complete.
+//
+// The part size must be a multiple of the block size. Only the last part may be smaller and end
+// with padding. Parts are requested lazily, except that Close requests a single empty part if
+// nothing has been written.
+func NewMultipartWriter(nextWriter func(partIndex int) (io.Writer, error), partSize int64, factory BlockModeFactory, padding Padding, opts ...WriterOption) (*MultipartWriter, error) {
+	if partSize <= 0 {
+		return nil, fmt.Errorf("cipherio: part size must be positive: %d", partSize)
+	}
+	return &MultipartWriter{
+		nextWriter: nextWriter,
+		factory:    factory,
+		padding:    padding,
+		partSize:   partSize,
+		opts:       opts,
+	}, nil
+}
+
+func (w *MultipartWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	count := 0
+	for len(p) > 0 {
+		if w.current == nil {
+			if w.err = w.startPart(); w.err != nil {
+				return count, w.err
+			}
+		}
+
+		chunk := p
+		if int64(len(chunk)) > w.remaining {
+			chunk = chunk[:w.remaining]
+		}
+		n, err := w.current.Write(chunk)
+		count += n
+		w.remaining -= int64(n)
+		w.size += int64(n)
+		p = p[n:]
+		if err != nil {
+			w.err = err
+			return count, err
+		}
+
+		if w.remaining == 0 {
+			if w.err = w.finishPart(); w.err != nil {
+				return count, w.err
+			}
+		}
+	}
+	return count, nil
+}
+
+// startPart requests the next part and prepares its BlockWriter.
+func (w *MultipartWriter) startPart() error {
+	blockMode, err := w.factory(int64(w.index))
+	if err != nil {
+		return err
+	}
+	if w.partSize%int64(blockMode.BlockSize()) != 0 {
+		return fmt.Errorf("cipherio: part size must be a multiple of the block size: %d %% %d != 0", w.partSize, blockMode.BlockSize())
+	}
+
+	dst, err := w.nextWriter(w.index)
+	if err != nil {
+		return err
+	}
+
+	w.index++
+	w.dst = dst
+	w.current = NewBlockWriterWithPadding(dst, blockMode, w.padding, w.opts...)
+	w.remaining = w.partSize
+	return nil
+}
+
+// finishPart closes the current part and records its size.
+func (w *MultipartWriter) finishPart() error {
+	current, dst := w.current, w.dst
+	w.current, w.dst = nil, nil
+
+	if err := current.Close(); err != nil {
+		return err
+	}
+	w.partSizes = append(w.partSizes, current.Written())
+
+	if closer, ok := dst.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Close completes the last part, then builds the manifest.
+func (w *MultipartWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.manifest != nil {
+		return nil
+	}
+
+	// Ensure that at least one part exists.
+	if w.index == 0 {
+		if w.err = w.startPart(); w.err != nil {
+			return w.err
+		}
+	}
+	if w.current != nil {
+		if w.err = w.finishPart(); w.err != nil {
+			return w.err
+		}
+	}
+
+	w.manifest = &MultipartManifest{
+		PartSize:  w.partSize,
+		Size:      w.size,
+		PartSizes: w.partSizes,
+	}
+	return nil
+}
+
+// Manifest returns the manifest describing the written parts, or nil if Close has not succeeded.
+func (w *MultipartWriter) Manifest() *MultipartManifest {
+	return w.manifest
+}
+
+// OpenPart returns a Reader decrypting the given part of a multipart stream, independently of the
+// other parts. The padding is removed, and ErrLengthMismatch is returned if the part does not
+// match its size recorded in the manifest.
+func OpenPart(src io.Reader, partIndex int, manifest *MultipartManifest, factory BlockModeFactory) (io.Reader, error) {
+	if partIndex < 0 || partIndex >= len(manifest.PartSizes) {
+		return nil, fmt.Errorf("cipherio: part index out of range: %d", partIndex)
+	}
+	blockMode, err := factory(int64(partIndex))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintextLen := manifest.partPlaintextLen(partIndex)
+	trailing := manifest.PartSizes[partIndex] - plaintextLen
+	if plaintextLen < 0 || trailing < 0 || trailing >= int64(blockMode.BlockSize()) {
+		return nil, errors.New("cipherio: invalid multipart manifest")
+	}
+	return &exactReader{
+		src:       NewBlockReader(src, blockMode),
+		remaining: plaintextLen,
+		trailing:  trailing,
+	}, nil
+}
+
+// NewMultipartReader returns a Reader decrypting all the parts described by the manifest, in
+// order, each one read from a Reader obtained from nextReader. If a Reader also implements
+// io.Closer, then it is closed once its part has been read.
+func NewMultipartReader(nextReader func(partIndex int) (io.Reader, error), manifest *MultipartManifest, factory BlockModeFactory) io.Reader {
+	return &multipartReader{
+		nextReader: nextReader,
+		manifest:   manifest,
+		factory:    factory,
+	}
+}
+
+type multipartReader struct {
+	nextReader func(partIndex int) (io.Reader, error)
+	manifest   *MultipartManifest
+	factory    BlockModeFactory
+	index      int       // index of the next part
+	src        io.Reader // source of the current part, if any
+	current    io.Reader // reader of the current part, if any
+	err        error
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		if r.current == nil {
+			if r.index == len(r.manifest.PartSizes) {
+				r.err = io.EOF
+				break
+			}
+			r.err = r.openPart()
+			continue
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.closePart()
+			if n > 0 || err != nil {
+				r.err = err
+				return n, err
+			}
+			continue
+		}
+		if err != nil {
+			r.err = err
+		}
+		return n, err
+	}
+	return 0, r.err
+}
+
+// openPart requests the next part and prepares its Reader.
+func (r *multipartReader) openPart() error {
+	src, err := r.nextReader(r.index)
+	if err != nil {
+		return err
+	}
+	current, err := OpenPart(src, r.index, r.manifest, r.factory)
+	if err != nil {
+		return err
+	}
+	r.index++
+	r.src = src
+	r.current = current
+	return nil
+}
+
+// closePart closes the source of the current part, if possible.
+func (r *multipartReader) closePart() error {
+	src := r.src
+	r.src, r.current = nil, nil
+	if closer, ok := src.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// collectParts returns a nextWriter function storing each part in the given slice.
+func collectParts(parts *[]*bytes.Buffer) func(partIndex int) (io.Writer, error) {
+	return func(partIndex int) (io.Writer, error) {
+		part := &bytes.Buffer{}
+		*parts = append(*parts, part)
+		return part, nil
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	master := make([]byte, 32)
+	_, err := rand.Read(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := cipherio.ChunkKeys{Master: master}
+
+	tests := []struct {
+		Name              string
+		Size              int
+		ExpectedPartSizes []int64
+	}{
+		{Name: "Empty", Size: 0, ExpectedPartSizes: []int64{0}},
+		{Name: "Single", Size: 100, ExpectedPartSizes: []int64{112}},
+		{Name: "Aligned", Size: 512, ExpectedPartSizes: []int64{256, 256}},
+		{Name: "Unaligned", Size: 1000, ExpectedPartSizes: []int64{256, 256, 256, 240}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			plaintext := make([]byte, test.Size)
+			_, err := rand.Read(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var parts []*bytes.Buffer
+			writer, err := cipherio.NewMultipartWriter(collectParts(&parts), 256, keys.Encrypter(), cipherio.PKCS7Padding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Write in small chunks that do not match part boundaries.
+			for offset := 0; offset < len(plaintext); offset += 100 {
+				end := offset + 100
+				if end > len(plaintext) {
+					end = len(plaintext)
+				}
+				if _, err := writer.Write(plaintext[offset:end]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			manifest := writer.Manifest()
+			if !reflect.DeepEqual(manifest.PartSizes, test.ExpectedPartSizes) || manifest.Size != int64(test.Size) {
+				t.Fatalf("unexpected manifest: %+v", manifest)
+			}
+
+			// Round trip the manifest.
+			data, err := manifest.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded cipherio.MultipartManifest
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&decoded, manifest) {
+				t.Fatalf("unexpected decoded manifest: %+v != %+v", decoded, manifest)
+			}
+
+			// Decrypt each part independently, in reverse order.
+			for index := len(parts) - 1; index >= 0; index-- {
+				reader, err := cipherio.OpenPart(bytes.NewReader(parts[index].Bytes()), index, &decoded, keys.Decrypter())
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := ioutil.ReadAll(reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				start := index * 256
+				end := start + len(result)
+				if end > len(plaintext) || !bytes.Equal(result, plaintext[start:end]) {
+					t.Fatalf("unexpected bytes for part %d", index)
+				}
+			}
+
+			// Decrypt all parts in order.
+			reader := cipherio.NewMultipartReader(func(partIndex int) (io.Reader, error) {
+				return bytes.NewReader(parts[partIndex].Bytes()), nil
+			}, &decoded, keys.Decrypter())
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatal("unexpected read bytes")
+			}
+		})
+	}
+
+	t.Run("Retry", func(t *testing.T) {
+		plaintext := make([]byte, 600)
+		_, err := rand.Read(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var parts []*bytes.Buffer
+		writer, err := cipherio.NewMultipartWriter(collectParts(&parts), 256, keys.Encrypter(), cipherio.PKCS7Padding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Encrypting the same part again gives the same bytes.
+		blockMode, err := keys.Encrypter()(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := cipherio.EncryptBytes(nil, plaintext[256:512], blockMode, cipherio.PKCS7Padding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, parts[1].Bytes()) {
+			t.Fatal("part encryption is not deterministic")
+		}
+	})
+
+	t.Run("TruncatedPart", func(t *testing.T) {
+		var parts []*bytes.Buffer
+		writer, err := cipherio.NewMultipartWriter(collectParts(&parts), 256, keys.Encrypter(), cipherio.PKCS7Padding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(make([]byte, 600)); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := cipherio.OpenPart(bytes.NewReader(parts[0].Bytes()[:240]), 0, writer.Manifest(), keys.Decrypter())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(reader)
+		if err != cipherio.ErrLengthMismatch {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrLengthMismatch)
+		}
+	})
+
+	t.Run("UnalignedPartSize", func(t *testing.T) {
+		writer, err := cipherio.NewMultipartWriter(collectParts(new([]*bytes.Buffer)), 100, keys.Encrypter(), cipherio.PKCS7Padding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write(make([]byte, 10))
+		if err == nil || err.Error() != "cipherio: part size must be a multiple of the block size: 100 % 16 != 0" {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+}
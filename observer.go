@@ -0,0 +1,149 @@
+package cipherio
+
+import (
+	"context"
+	"io"
+)
+
+// Operation tells whether a stream encrypts or decrypts, since a BlockMode does not say.
+type Operation int
+
+const (
+	// Encryption is the operation of a stream encrypting data.
+	Encryption Operation = iota + 1
+	// Decryption is the operation of a stream decrypting data.
+	Decryption
+)
+
+// String returns "encryption" or "decryption".
+func (op Operation) String() string {
+	switch op {
+	case Encryption:
+		return "encryption"
+	case Decryption:
+		return "decryption"
+	default:
+		return "unknown"
+	}
+}
+
+// Observer is notified of the streams it is attached to with WithObserver and WithWriteObserver,
+// so that instrumentation, such as metrics, traces or logs, can be plugged in without adding
+// dependencies to this package. Stats is an Observer, and the cipheriootel package provides one
+// based on OpenTelemetry.
+type Observer interface {
+	// ObserveStream is called when a Reader or Writer is created, with the context and the
+	// operation given to the option. It returns the StreamObserver of the new stream, or nil to
+	// ignore it.
+	ObserveStream(ctx context.Context, op Operation) StreamObserver
+}
+
+// StreamObserver is notified of the activity of a single stream. Its methods are called
+// synchronously from those of the Reader or Writer, so they must not block.
+//
+// At most one of Failed and Ended is called, at most once. Neither is called if the stream is
+// abandoned before its end.
+type StreamObserver interface {
+	// Crypted is called after n bytes have been (en|de)crypted, including any padding.
+	Crypted(n int)
+
+	// Failed is called with the first error returned by the stream, other than io.EOF.
+	Failed(err error)
+
+	// Ended is called when a Reader returns io.EOF, or when a Writer is successfully closed.
+	Ended()
+}
+
+// RekeyObserver may be implemented by a StreamObserver to be notified when the BlockMode of a
+// Writer is reinitialized by FinalizeRecord, after the last block of the record has been written.
+type RekeyObserver interface {
+	Rekeyed()
+}
+
+// WithObserver attaches the given Observer to the Reader, for the given operation. The context is
+// passed to the Observer, for example to carry a parent span. Several Observers can be attached.
+func WithObserver(ctx context.Context, observer Observer, op Operation) ReaderOption {
+	return func(o *readerOptions) {
+		o.observers = append(o.observers, observerConfig{ctx, observer, op})
+	}
+}
+
+// WithWriteObserver is similar to WithObserver, for a Writer.
+func WithWriteObserver(ctx context.Context, observer Observer, op Operation) WriterOption {
+	return func(o *writerOptions) {
+		o.observers = append(o.observers, observerConfig{ctx, observer, op})
+	}
+}
+
+// observerConfig holds the arguments of WithObserver and WithWriteObserver.
+type observerConfig struct {
+	ctx      context.Context
+	observer Observer
+	op       Operation
+}
+
+// streamObservers notifies the StreamObservers of a stream, and ensures that the end of the stream
+// is reported once. A nil streamObservers does nothing.
+type streamObservers struct {
+	streams []StreamObserver
+	done    bool
+}
+
+// observeStream starts observing a new stream, and returns nil if there is no StreamObserver.
+func observeStream(configs []observerConfig) *streamObservers {
+	var streams []StreamObserver
+	for _, config := range configs {
+		if stream := config.observer.ObserveStream(config.ctx, config.op); stream != nil {
+			streams = append(streams, stream)
+		}
+	}
+	if len(streams) == 0 {
+		return nil
+	}
+	return &streamObservers{streams: streams}
+}
+
+// crypted reports (en|de)crypted bytes.
+func (o *streamObservers) crypted(n int) {
+	if o == nil || n == 0 {
+		return
+	}
+	for _, stream := range o.streams {
+		stream.Crypted(n)
+	}
+}
+
+// fail reports the given error, unless it is nil or io.EOF, or the end has already been reported.
+func (o *streamObservers) fail(err error) {
+	if o == nil || o.done || err == nil || err == io.EOF {
+		return
+	}
+	o.done = true
+	for _, stream := range o.streams {
+		stream.Failed(err)
+	}
+}
+
+// rekeyed reports the reinitialization of the BlockMode to the StreamObservers implementing
+// RekeyObserver.
+func (o *streamObservers) rekeyed() {
+	if o == nil {
+		return
+	}
+	for _, stream := range o.streams {
+		if rekey, ok := stream.(RekeyObserver); ok {
+			rekey.Rekeyed()
+		}
+	}
+}
+
+// end reports the end of the stream, unless it has already been reported.
+func (o *streamObservers) end() {
+	if o == nil || o.done {
+		return
+	}
+	o.done = true
+	for _, stream := range o.streams {
+		stream.Ended()
+	}
+}
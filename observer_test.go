@@ -0,0 +1,122 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type contextKey struct{}
+
+// eventRecorder is an Observer recording the events of its streams.
+type eventRecorder struct {
+	events []string
+}
+
+func (r *eventRecorder) ObserveStream(ctx context.Context, op cipherio.Operation) cipherio.StreamObserver {
+	r.events = append(r.events, fmt.Sprintf("start %s %v", op, ctx.Value(contextKey{})))
+	return r
+}
+
+func (r *eventRecorder) Crypted(n int) {
+	r.events = append(r.events, fmt.Sprintf("crypted %d", n))
+}
+
+func (r *eventRecorder) Failed(err error) {
+	r.events = append(r.events, fmt.Sprintf("failed %v", err))
+}
+
+func (r *eventRecorder) Ended() {
+	r.events = append(r.events, "ended")
+}
+
+func TestObserver(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "request")
+
+	t.Run("Writer", func(t *testing.T) {
+		recorder := &eventRecorder{}
+		stats := new(cipherio.Stats)
+		var encrypted bytes.Buffer
+		writer := cipherio.NewBlockWriterWithPadding(&encrypted, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding,
+			cipherio.WithWriteObserver(ctx, recorder, cipherio.Encryption), cipherio.WithWriteStats(stats, cipherio.Encryption))
+		_, err := writer.Write(make([]byte, 40))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		for i := 0; i < 2; i++ {
+			err = writer.Close()
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+		}
+
+		expected := []string{"start encryption request", "crypted 32", "crypted 16", "ended"}
+		if fmt.Sprint(recorder.events) != fmt.Sprint(expected) {
+			t.Fatalf("unexpected events: %q != %q", recorder.events, expected)
+		}
+		if snapshot := stats.Snapshot(); snapshot.EncryptionStreams != 1 || snapshot.BytesEncrypted != 48 {
+			t.Fatalf("unexpected snapshot: %+v", snapshot)
+		}
+	})
+
+	t.Run("WriterFailed", func(t *testing.T) {
+		recorder := &eventRecorder{}
+		writeErr := errors.New("write failed")
+		writer := cipherio.NewBlockWriter(&failingWriter{writeErr}, cipher.NewCBCEncrypter(aesCipher, iv),
+			cipherio.WithWriteObserver(ctx, recorder, cipherio.Encryption))
+		_, err := writer.Write(make([]byte, 16))
+		if err != writeErr {
+			t.Fatalf("unexpected err: %v != %v", err, writeErr)
+		}
+		err = writer.Close()
+		if err != writeErr {
+			t.Fatalf("unexpected err: %v != %v", err, writeErr)
+		}
+
+		expected := []string{"start encryption request", "crypted 16", "failed write failed"}
+		if fmt.Sprint(recorder.events) != fmt.Sprint(expected) {
+			t.Fatalf("unexpected events: %q != %q", recorder.events, expected)
+		}
+	})
+
+	t.Run("Reader", func(t *testing.T) {
+		recorder := &eventRecorder{}
+		reader := cipherio.NewBlockReader(bytes.NewReader(make([]byte, 32)), cipher.NewCBCDecrypter(aesCipher, iv),
+			cipherio.WithObserver(ctx, recorder, cipherio.Decryption))
+		_, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		_, err = ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		expected := []string{"start decryption request", "crypted 32", "ended"}
+		if fmt.Sprint(recorder.events) != fmt.Sprint(expected) {
+			t.Fatalf("unexpected events: %q != %q", recorder.events, expected)
+		}
+	})
+}
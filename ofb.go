@@ -0,0 +1,33 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// NewOFBReader returns a Reader decrypting src with the given block cipher in OFB mode. The IV
+// must be as long as a block.
+func NewOFBReader(src io.Reader, block cipher.Block, iv []byte) (io.Reader, error) {
+	if err := checkPolicy("OFB", true, false); err != nil {
+		return nil, err
+	}
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	return cipher.StreamReader{S: cipher.NewOFB(block, iv), R: src}, nil
+}
+
+// NewOFBWriter returns a WriteCloser encrypting data with the given block cipher in OFB mode, and
+// writing it to dst. The IV must be as long as a block.
+//
+// Like CFB, OFB is a stream mode: there is neither buffering nor padding. Close closes dst if it
+// implements io.Closer.
+func NewOFBWriter(dst io.Writer, block cipher.Block, iv []byte) (io.WriteCloser, error) {
+	if err := checkPolicy("OFB", true, false); err != nil {
+		return nil, err
+	}
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	return cipher.StreamWriter{S: cipher.NewOFB(block, iv), W: dst}, nil
+}
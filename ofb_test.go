@@ -0,0 +1,23 @@
+package cipherio_test
+
+import (
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+var ofbTests = []streamModeTest{
+	{
+		Name:       "OFB",
+		NewReader:  cipherio.NewOFBReader,
+		NewWriter:  cipherio.NewOFBWriter,
+		Key:        "2b7e151628aed2a6abf7158809cf4f3c",
+		IV:         "000102030405060708090a0b0c0d0e0f",
+		Plaintext:  "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51",
+		Ciphertext: "3b3fd92eb72dad20333449f8e83cfb4a7789508d16918f03f53c52dac54ed825",
+	},
+}
+
+func TestOFB(t *testing.T) {
+	runStreamModeTests(t, ofbTests)
+}
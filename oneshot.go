@@ -0,0 +1,78 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"errors"
+	"unsafe"
+)
+
+// ErrOverlap is returned when the output of an operation partially overlaps its input, which
+// CryptBlocks does not support.
+var ErrOverlap = errors.New("cipherio: invalid buffer overlap")
+
+// EncryptBytes (en|de)crypts src with the given BlockMode, appends the result to dst and returns
+// the updated slice. Any incomplete block at the end of src is filled with padding, or leads to an
+// AlignmentError if padding is nil.
+//
+// To (en|de)crypt src in place, use src[:0] as dst. Otherwise, the appended bytes must not overlap
+// src: ErrOverlap is returned instead of producing a wrong output.
+func EncryptBytes(dst, src []byte, blockMode cipher.BlockMode, padding Padding) ([]byte, error) {
+	blockSize := blockMode.BlockSize()
+	size := EncryptedSize(int64(len(src)), blockSize, padding)
+	if size < 0 {
+		return nil, AlignmentError{
+			Buffered: len(src) % blockSize,
+			Missing:  blockSize - len(src)%blockSize,
+		}
+	}
+
+	ret, out := sliceForAppend(dst, int(size))
+	if inexactOverlap(out, src) {
+		return nil, ErrOverlap
+	}
+
+	// Crypt complete blocks directly, then the padded block if any.
+	aligned := len(src) - len(src)%blockSize
+	blockMode.CryptBlocks(out[:aligned], src[:aligned])
+	if aligned < len(out) {
+		last := out[aligned:]
+		copy(last, src[aligned:])
+		padding.Fill(last[len(src)-aligned:])
+		blockMode.CryptBlocks(last, last)
+	}
+	return ret, nil
+}
+
+// DecryptBytes is similar to EncryptBytes, except that src must be aligned to the block size.
+func DecryptBytes(dst, src []byte, blockMode cipher.BlockMode) ([]byte, error) {
+	return EncryptBytes(dst, src, blockMode, nil)
+}
+
+// sliceForAppend extends in by n bytes, reallocating if needed. It returns the whole slice and the
+// appended part.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// anyOverlap reports whether x and y share memory at any index.
+func anyOverlap(x, y []byte) bool {
+	return len(x) > 0 && len(y) > 0 &&
+		uintptr(unsafe.Pointer(&x[0])) <= uintptr(unsafe.Pointer(&y[len(y)-1])) &&
+		uintptr(unsafe.Pointer(&y[0])) <= uintptr(unsafe.Pointer(&x[len(x)-1]))
+}
+
+// inexactOverlap reports whether x and y share memory at any non-corresponding index. Exact
+// overlap, as used for in-place operations, is allowed.
+func inexactOverlap(x, y []byte) bool {
+	if len(x) == 0 || len(y) == 0 || &x[0] == &y[0] {
+		return false
+	}
+	return anyOverlap(x, y)
+}
@@ -0,0 +1,136 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestEncryptBytes(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, block.BlockSize())
+
+	for _, size := range []int{0, 1, 15, 16, 17, 100, 1024} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Compare with a BlockReader.
+		expected := make([]byte, cipherio.EncryptedSize(int64(size), block.BlockSize(), cipherio.BitPadding))
+		reader := cipherio.NewBlockReaderWithPadding(bytes.NewReader(plaintext), cipher.NewCBCEncrypter(block, iv), cipherio.BitPadding)
+		if _, err := io.ReadFull(reader, expected); err != nil {
+			t.Fatal(err)
+		}
+
+		prefix := []byte("prefix")
+		encrypted, err := cipherio.EncryptBytes(prefix, plaintext, cipher.NewCBCEncrypter(block, iv), cipherio.BitPadding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encrypted[:len(prefix)], prefix) || !bytes.Equal(encrypted[len(prefix):], expected) {
+			t.Fatalf("unexpected result for %d bytes", size)
+		}
+
+		// Decrypt in place.
+		ciphertext := encrypted[len(prefix):]
+		decrypted, err := cipherio.DecryptBytes(ciphertext[:0], ciphertext, cipher.NewCBCDecrypter(block, iv))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted[:size], plaintext) {
+			t.Fatalf("decrypted data does not match for %d bytes", size)
+		}
+	}
+}
+
+func TestEncryptBytesInPlacePadded(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, block.BlockSize())
+
+	plaintext := []byte("some data that is not aligned")
+	expected, err := cipherio.EncryptBytes(nil, plaintext, cipher.NewCBCEncrypter(block, iv), cipherio.PKCS7Padding)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With enough capacity, the padded block is crypted in place too.
+	buf := make([]byte, len(plaintext), len(expected))
+	copy(buf, plaintext)
+	encrypted, err := cipherio.EncryptBytes(buf[:0], buf, cipher.NewCBCEncrypter(block, iv), cipherio.PKCS7Padding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &encrypted[0] != &buf[0] || !bytes.Equal(encrypted, expected) {
+		t.Fatal("unexpected in-place result")
+	}
+}
+
+func TestEncryptBytesErrors(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, block.BlockSize())
+
+	buf := make([]byte, 64)
+
+	// Shifted output.
+	_, err = cipherio.EncryptBytes(buf[1:1], buf[:32], cipher.NewCBCEncrypter(block, iv), nil)
+	if err != cipherio.ErrOverlap {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrOverlap)
+	}
+	_, err = cipherio.DecryptBytes(buf[:0], buf[16:48], cipher.NewCBCDecrypter(block, iv))
+	if err != cipherio.ErrOverlap {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrOverlap)
+	}
+
+	// Adjacent output.
+	if _, err := cipherio.EncryptBytes(buf[32:32], buf[:32], cipher.NewCBCEncrypter(block, iv), nil); err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// Unaligned input without padding.
+	_, err = cipherio.DecryptBytes(nil, buf[:20], cipher.NewCBCDecrypter(block, iv))
+	var alignmentErr cipherio.AlignmentError
+	if !errors.As(err, &alignmentErr) || alignmentErr.Buffered != 4 || alignmentErr.Missing != 12 {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// openSSLMagic starts every salted file written by the enc command of OpenSSL.
+var openSSLMagic = []byte("Salted__")
+
+const openSSLSaltSize = 8
+
+// ErrInvalidOpenSSL is returned when reading data that is not a salted file of OpenSSL enc.
+var ErrInvalidOpenSSL = errors.New("cipherio: invalid OpenSSL enc file")
+
+// OpenSSLOptions describes how the enc command of OpenSSL derives the key and IV from the
+// password. The zero value matches "openssl enc -aes-256-cbc -pbkdf2" with OpenSSL 1.1.1 or later.
+type OpenSSLOptions struct {
+	// KeySize is the AES key size: 16, 24 or 32 bytes, for -aes-128-cbc, -aes-192-cbc or
+	// -aes-256-cbc. Defaults to 32.
+	KeySize int
+
+	// Iterations is the number of PBKDF2-HMAC-SHA256 iterations, as given by -iter. Defaults to
+	// 10000, like -pbkdf2 alone.
+	Iterations int
+
+	// LegacyMD5 derives the key with EVP_BytesToKey and MD5, as done without -pbkdf2 by OpenSSL
+	// before 1.1.0, or with "-md md5". This is weak, and only meant to read old files.
+	LegacyMD5 bool
+
+	// Rand is the source of the salt of written files. Defaults to crypto/rand.Reader.
+	Rand io.Reader
+}
+
+// deriveKeyIV returns the AES key and IV derived from the password and salt.
+func (o OpenSSLOptions) deriveKeyIV(password, salt []byte) ([]byte, []byte, error) {
+	keySize := o.KeySize
+	if keySize == 0 {
+		keySize = 32
+	}
+	if keySize != 16 && keySize != 24 && keySize != 32 {
+		return nil, nil, fmt.Errorf("%w: AES requires 16, 24 or 32 bytes: %d", ErrInvalidKeySize, keySize)
+	}
+	if err := checkPolicy("OpenSSL enc", true, false); err != nil {
+		return nil, nil, err
+	}
+
+	var derived []byte
+	if o.LegacyMD5 {
+		if err := checkPolicy("EVP_BytesToKey with MD5", false, true); err != nil {
+			return nil, nil, err
+		}
+		derived = evpBytesToKey(password, salt, keySize+16)
+	} else {
+		iterations := o.Iterations
+		if iterations == 0 {
+			iterations = 10000
+		}
+		if iterations < 0 {
+			return nil, nil, fmt.Errorf("cipherio: invalid PBKDF2 iterations: %d", iterations)
+		}
+		derived = pbkdf2(password, salt, iterations, keySize+16)
+	}
+	return derived[:keySize], derived[keySize:], nil
+}
+
+// evpBytesToKey derives length bytes from the password and salt as EVP_BytesToKey of OpenSSL does
+// with MD5 and a single iteration.
+func evpBytesToKey(password, salt []byte, length int) []byte {
+	var out, prev []byte
+	for len(out) < length {
+		h := md5.New()
+		h.Write(prev)
+		h.Write(password)
+		h.Write(salt)
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
+
+// NewOpenSSLWriter returns a WriteCloser encrypting data as "openssl enc -e -salt" does with the
+// given options, so that it can be decrypted by OpenSSL. It writes the salted header immediately.
+//
+// This format is neither authenticated nor committed to its key: it is only provided for
+// interoperability with existing tools.
+func NewOpenSSLWriter(dst io.Writer, password []byte, opts OpenSSLOptions) (io.WriteCloser, error) {
+	salt := make([]byte, openSSLSaltSize)
+	if _, err := io.ReadFull(randOrDefault(opts.Rand), salt); err != nil {
+		return nil, err
+	}
+	key, iv, err := opts.deriveKeyIV(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := newAESCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dst.Write(append(append([]byte(nil), openSSLMagic...), salt...)); err != nil {
+		return nil, err
+	}
+	return NewPKCS7Writer(dst, cipher.NewCBCEncrypter(block, iv)), nil
+}
+
+// NewOpenSSLReader returns a Reader decrypting a salted file written by "openssl enc -e" with the
+// given options. ErrInvalidPadding is returned at the end if the padding is invalid, which
+// usually means a wrong password or options.
+func NewOpenSSLReader(src io.Reader, password []byte, opts OpenSSLOptions) (io.Reader, error) {
+	return newOpenSSLReader(src, password, opts, nil)
+}
+
+// newOpenSSLReader is similar to NewOpenSSLReader, with options for the underlying BlockReader.
+func newOpenSSLReader(src io.Reader, password []byte, opts OpenSSLOptions, readerOpts []ReaderOption) (io.Reader, error) {
+	salt, err := readOpenSSLSalt(src)
+	if err != nil {
+		return nil, err
+	}
+	key, iv, err := opts.deriveKeyIV(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := newAESCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewPKCS7Reader(src, cipher.NewCBCDecrypter(block, iv), readerOpts...), nil
+}
+
+// readOpenSSLSalt reads the salted header, and returns the salt.
+func readOpenSSLSalt(src io.Reader) ([]byte, error) {
+	header := make([]byte, len(openSSLMagic)+openSSLSaltSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidOpenSSL
+		}
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(openSSLMagic)], openSSLMagic) {
+		return nil, ErrInvalidOpenSSL
+	}
+	return header[len(openSSLMagic):], nil
+}
+
+// OpenSSLPlaintextLen returns the number of plaintext bytes of the salted file of the given size
+// stored in src, by only decrypting its last block. This allows to declare the plaintext length
+// in a header before converting the file, for example with Transcode.
+func OpenSSLPlaintextLen(src io.ReaderAt, size int64, password []byte, opts OpenSSLOptions) (int64, error) {
+	headerSize := int64(len(openSSLMagic) + openSSLSaltSize)
+	bodySize := size - headerSize
+	if bodySize < 16 || bodySize%16 != 0 {
+		return 0, ErrInvalidOpenSSL
+	}
+
+	salt, err := readOpenSSLSalt(io.NewSectionReader(src, 0, headerSize))
+	if err != nil {
+		return 0, err
+	}
+	key, iv, err := opts.deriveKeyIV(password, salt)
+	if err != nil {
+		return 0, err
+	}
+	block, err := newAESCipher(key)
+	if err != nil {
+		return 0, err
+	}
+
+	// In CBC mode, the last block only depends on the previous ciphertext block, or on the IV.
+	last := make([]byte, 32)
+	if bodySize == 16 {
+		copy(last, iv)
+		_, err = src.ReadAt(last[16:], headerSize)
+	} else {
+		_, err = src.ReadAt(last, size-32)
+	}
+	if err != nil {
+		return 0, err
+	}
+	cipher.NewCBCDecrypter(block, last[:16]).CryptBlocks(last[16:], last[16:])
+
+	padding, ok := CheckPKCS7Padding(last[16:])
+	if !ok {
+		return 0, ErrInvalidPadding
+	}
+	return bodySize - int64(padding), nil
+}
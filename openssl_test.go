@@ -0,0 +1,119 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestOpenSSLVectors(t *testing.T) {
+	// Generated with "openssl enc -pass pass:secret -S 0102030405060708", which omits the salted
+	// header when the salt is given.
+	header := append([]byte("Salted__"), 1, 2, 3, 4, 5, 6, 7, 8)
+	plaintext := []byte("hello cipherio, a 33-byte message")
+
+	testCases := []struct {
+		Name       string
+		Options    cipherio.OpenSSLOptions
+		Ciphertext string
+	}{
+		{
+			Name:       "PBKDF2",
+			Options:    cipherio.OpenSSLOptions{},
+			Ciphertext: "5fb24c7fec44ffe6b06c65f4bf06c98374963753097cdcfd041968eb8fd78b80dd05489e5502da6e38474f180b826917",
+		},
+		{
+			Name:       "PBKDF2Iterations",
+			Options:    cipherio.OpenSSLOptions{Iterations: 1000},
+			Ciphertext: "c200dc9bd169f24f414908e1c8636eecb25faa22c37249b1523be3a06dced7b7f7cd2af26ea6df7032d2fe0d6b7677a9",
+		},
+		{
+			Name:       "LegacyMD5",
+			Options:    cipherio.OpenSSLOptions{KeySize: 16, LegacyMD5: true},
+			Ciphertext: "c398c9699181b561c15d69c130cde20088d90512036892f1cdaf17e3ff2b85640827b641254792ae0ea4ceb7762c157a",
+		},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			ciphertext, err := hex.DecodeString(testCase.Ciphertext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := append(append([]byte(nil), header...), ciphertext...)
+
+			reader, err := cipherio.NewOpenSSLReader(bytes.NewReader(file), []byte("secret"), testCase.Options)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatalf("unexpected plaintext: %q", result)
+			}
+
+			size, err := cipherio.OpenSSLPlaintextLen(bytes.NewReader(file), int64(len(file)), []byte("secret"), testCase.Options)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if size != int64(len(plaintext)) {
+				t.Fatalf("unexpected plaintext length: %d != %d", size, len(plaintext))
+			}
+
+			// Encrypting with the same salt gives the same file.
+			var buf bytes.Buffer
+			opts := testCase.Options
+			opts.Rand = bytes.NewReader(header[8:])
+			writer, err := cipherio.NewOpenSSLWriter(&buf, []byte("secret"), opts)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			_, err = writer.Write(plaintext)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if !bytes.Equal(buf.Bytes(), file) {
+				t.Fatalf("unexpected file: %x", buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestOpenSSLWrongPassword(t *testing.T) {
+	var buf bytes.Buffer
+	opts := cipherio.OpenSSLOptions{Iterations: 1, Rand: bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7, 8})}
+	writer, err := cipherio.NewOpenSSLWriter(&buf, []byte("secret"), opts)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// With a fixed salt, the wrong password is known to be caught by the padding check.
+	reader, err := cipherio.NewOpenSSLReader(bytes.NewReader(buf.Bytes()), []byte("wrong"), cipherio.OpenSSLOptions{Iterations: 1})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = ioutil.ReadAll(reader)
+	if err != cipherio.ErrInvalidPadding {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidPadding)
+	}
+
+	_, err = cipherio.NewOpenSSLReader(bytes.NewReader([]byte("garbage")), []byte("secret"), cipherio.OpenSSLOptions{})
+	if err != cipherio.ErrInvalidOpenSSL {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidOpenSSL)
+	}
+}
@@ -0,0 +1,59 @@
+package cipherio
+
+import "io"
+
+// ReaderOption configures optional behaviours of the Reader returned by NewBlockReader and
+// NewBlockReaderWithPadding.
+type ReaderOption func(o *readerOptions)
+
+type readerOptions struct {
+	progressEvery int64
+	progressFn    func(done int64)
+	strict        bool
+	wipe          bool
+	profiler      *profiler
+	observers     []observerConfig
+	exclusive     bool
+
+	requireCommitment bool
+}
+
+func newReaderOptions(opts []ReaderOption) readerOptions {
+	var o readerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WriterOption configures optional behaviours of the WriteCloser returned by NewBlockWriter and
+// NewBlockWriterWithPadding.
+type WriterOption func(o *writerOptions)
+
+type writerOptions struct {
+	progressEvery int64
+	progressFn    func(accepted, flushed int64)
+	headerSize    int
+	headerFn      HeaderFunc
+	highWater     int
+	lowMemory     bool
+	verifier      *verifier
+	ivRegistry    IVRegistry
+	strict        bool
+	wipe          bool
+	clock         Clock
+	rand          io.Reader
+	profiler      *profiler
+	observers     []observerConfig
+	closeCheck    bool
+	closeCheckFn  func(accepted int64, buffered int)
+	exclusive     bool
+}
+
+func newWriterOptions(opts []WriterOption) writerOptions {
+	var o writerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -30,19 +30,32 @@ var BitPadding = PaddingFunc(bitPadding)
 // WARNING: this padding method MUST NOT be used with a block size larger than 256 bytes.
 var PKCS7Padding = PaddingFunc(pkcs7Padding)
 
-func fill(dst []byte, val byte) {
-	for i := range dst {
-		dst[i] = val
+// EncryptedSize returns the number of bytes produced when (en|de)crypting plaintextLen bytes with
+// the given block size and padding, as done by the Readers and Writers of this package.
+//
+// Without padding, data must be aligned to the block size: -1 is returned if plaintextLen is not
+// a multiple of blockSize. -1 is also returned for an invalid block size.
+func EncryptedSize(plaintextLen int64, blockSize int, padding Padding) int64 {
+	if blockSize <= 0 {
+		return -1
+	}
+	exceeding := plaintextLen % int64(blockSize)
+	if exceeding == 0 {
+		return plaintextLen
+	}
+	if padding == nil {
+		return -1
 	}
+	return plaintextLen - exceeding + int64(blockSize)
 }
 
 func zeroPadding(dst []byte) {
-	fill(dst, 0)
+	FillBytes(dst, 0)
 }
 
 func bitPadding(dst []byte) {
 	dst[0] = 0x80
-	fill(dst[1:], 0)
+	FillBytes(dst[1:], 0)
 }
 
 func pkcs7Padding(dst []byte) {
@@ -50,5 +63,5 @@ func pkcs7Padding(dst []byte) {
 	if n > 255 {
 		panic(fmt.Errorf("cipherio: PKCS#7 padding cannot fill more than 255 bytes: %d > 255", n))
 	}
-	fill(dst, byte(n))
+	FillBytes(dst, byte(n))
 }
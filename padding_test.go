@@ -59,3 +59,34 @@ func TestPadding(t *testing.T) {
 	}
 
 }
+
+type encryptedSizeTest struct {
+	PlaintextLen int64
+	Padding      cipherio.Padding
+	Expected     int64
+}
+
+func TestEncryptedSize(t *testing.T) {
+	testCases := []encryptedSizeTest{
+		{PlaintextLen: 0, Padding: nil, Expected: 0},
+		{PlaintextLen: 32, Padding: nil, Expected: 32},
+		{PlaintextLen: 33, Padding: nil, Expected: -1},
+		{PlaintextLen: 0, Padding: cipherio.ZeroPadding, Expected: 0},
+		{PlaintextLen: 1, Padding: cipherio.ZeroPadding, Expected: 16},
+		{PlaintextLen: 32, Padding: cipherio.PKCS7Padding, Expected: 32},
+		{PlaintextLen: 47, Padding: cipherio.BitPadding, Expected: 48},
+	}
+
+	for _, testCase := range testCases {
+		size := cipherio.EncryptedSize(testCase.PlaintextLen, 16, testCase.Padding)
+		if size != testCase.Expected {
+			t.Fatalf("unexpected size for %d bytes: %d != %d", testCase.PlaintextLen, size, testCase.Expected)
+		}
+	}
+
+	for _, blockSize := range []int{0, -16} {
+		if size := cipherio.EncryptedSize(32, blockSize, cipherio.PKCS7Padding); size != -1 {
+			t.Fatalf("unexpected size for block size %d: %d != %d", blockSize, size, -1)
+		}
+	}
+}
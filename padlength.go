@@ -0,0 +1,164 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// PadToLengthWriter (en|de)crypts data padded up to a multiple of a bucket size, or up to a target
+// length, instead of the next block only, so that the size of the result does not reveal the exact
+// length of the content.
+//
+// The padding is made of 0x80 followed by as many zeroes as needed, as with BitPadding, and is
+// always added so that it can be removed unambiguously by a Reader returned by
+// NewPadToLengthReader.
+type PadToLengthWriter struct {
+	writer   *BlockWriter
+	bucket   int64
+	target   int64
+	accepted int64
+}
+
+// NewPadToLengthWriter returns a PadToLengthWriter wrapping a BlockWriter with the given
+// BlockMode. The size of the result is a multiple of bucket, which is rounded up to the block
+// size.
+func NewPadToLengthWriter(dst io.Writer, blockMode cipher.BlockMode, bucket int64, opts ...WriterOption) (*PadToLengthWriter, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("cipherio: invalid padding bucket size: %d", bucket)
+	}
+	return &PadToLengthWriter{
+		writer: NewBlockWriter(dst, blockMode, opts...),
+		bucket: alignedSize(bucket, int64(blockMode.BlockSize())),
+	}, nil
+}
+
+// SetTargetLength makes Close pad the result up to at least the given length, still rounded up to
+// the bucket size. Data longer than that is padded to the next bucket as usual.
+//
+// This allows to give the same size to a set of payloads, such as all the messages of a
+// conversation, when their maximum length is known.
+func (w *PadToLengthWriter) SetTargetLength(length int64) {
+	w.target = length
+}
+
+func (w *PadToLengthWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.accepted += int64(n)
+	return n, err
+}
+
+// Close writes the padding, then closes the underlying BlockWriter. The wrapped Writer is not
+// closed.
+func (w *PadToLengthWriter) Close() error {
+	// At least the 0x80 byte must be added.
+	length := w.accepted + 1
+	if length < w.target {
+		length = w.target
+	}
+	remaining := alignedSize(length, w.bucket) - w.accepted
+
+	padding := make([]byte, 1, 4096)
+	padding[0] = 0x80
+	for remaining > 0 {
+		if int64(len(padding)) > remaining {
+			padding = padding[:remaining]
+		}
+		if _, err := w.Write(padding); err != nil {
+			w.writer.Close()
+			return err
+		}
+		remaining -= int64(len(padding))
+
+		// Only zeroes follow the 0x80 byte.
+		padding = padding[:cap(padding)]
+		FillBytes(padding, 0)
+	}
+	return w.writer.Close()
+}
+
+// NewPadToLengthReader returns a Reader (en|de)crypting src with the given BlockMode, like
+// NewBlockReader, then removing the padding of the result, as added by PadToLengthWriter.
+//
+// Trailing bytes which may belong to the padding are held back until more data or EOF is read,
+// without buffering them. ErrInvalidPadding is returned at EOF if the padding is missing, which
+// also happens with a wrong key or IV. Like any padding check, this must not be exposed to an
+// attacker able to tamper with the data, unless it is authenticated first.
+func NewPadToLengthReader(src io.Reader, blockMode cipher.BlockMode, opts ...ReaderOption) io.Reader {
+	return &bitUnpadder{
+		src: NewBlockReader(src, blockMode, opts...),
+		buf: make([]byte, 256*blockMode.BlockSize()),
+	}
+}
+
+// bitUnpadder holds back the trailing run of bytes read from src which may be a bit padding, made
+// of 0x80 followed by zeroes, until it is followed by other data or EOF is reached. Since the run
+// can be arbitrarily long, only its length is kept.
+type bitUnpadder struct {
+	src     io.Reader
+	buf     []byte
+	data    []byte // bytes of buf to return
+	run     int64  // length of the held back run, or 0 if none
+	release int64  // number of bytes of a previous run to return, since it was not the padding
+	marker  bool   // if true, the next released byte is 0x80
+	err     error
+}
+
+func (r *bitUnpadder) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		// Return the bytes of a run followed by other data, before that data.
+		if r.release > 0 {
+			n := 0
+			for n < len(p) && r.release > 0 {
+				p[n] = 0
+				if r.marker {
+					p[n] = 0x80
+					r.marker = false
+				}
+				n++
+				r.release--
+			}
+			return n, nil
+		}
+		if len(r.data) > 0 {
+			n := copy(p, r.data)
+			r.data = r.data[n:]
+			return n, nil
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.src.Read(r.buf)
+		chunk := r.buf[:n]
+
+		// Find the last non-zero byte, which may start a new run.
+		last := len(chunk) - 1
+		for last >= 0 && chunk[last] == 0 {
+			last--
+		}
+		switch {
+		case len(chunk) == 0:
+		case last < 0 && r.run > 0:
+			r.run += int64(len(chunk))
+		case last < 0:
+			r.data = chunk
+		default:
+			if r.run > 0 {
+				r.release, r.marker, r.run = r.run, true, 0
+			}
+			r.data = chunk
+			if chunk[last] == 0x80 {
+				r.data, r.run = chunk[:last], int64(len(chunk)-last)
+			}
+		}
+
+		if err == io.EOF && r.run == 0 {
+			err = ErrInvalidPadding
+		}
+		r.err = err
+	}
+}
@@ -0,0 +1,106 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type padToLengthTest struct {
+	Name         string
+	Plaintext    []byte
+	Bucket       int64
+	Target       int64
+	ExpectedSize int
+}
+
+func TestPadToLength(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	random := make([]byte, 5000)
+	_, err = rand.Read(random)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Runs looking like the padding, within the data and at its end, must be kept.
+	lookalike := append(append([]byte("data"), 0x80), make([]byte, 5000)...)
+	lookalike = append(lookalike, 1)
+
+	tests := []padToLengthTest{
+		{"Empty", nil, 16, 0, 16},
+		{"Block", random[:16], 16, 0, 32},
+		{"Bucket", random[:100], 256, 0, 256},
+		{"BucketAligned", random[:256], 256, 0, 512},
+		{"BucketRounded", random[:10], 100, 0, 112},
+		{"Target", random[:10], 16, 1000, 1008},
+		{"TargetExceeded", random[:2000], 1024, 1000, 2048},
+		{"Lookalike", lookalike, 1024, 0, 5120},
+		{"LookalikeEnd", lookalike[:len(lookalike)-1], 4096, 0, 8192},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var dst bytes.Buffer
+			writer, err := cipherio.NewPadToLengthWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv), test.Bucket)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			writer.SetTargetLength(test.Target)
+			_, err = writer.Write(test.Plaintext)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if dst.Len() != test.ExpectedSize {
+				t.Fatalf("unexpected size: %d != %d", dst.Len(), test.ExpectedSize)
+			}
+
+			reader := cipherio.NewPadToLengthReader(&dst, cipher.NewCBCDecrypter(aesCipher, iv))
+			decrypted, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if !bytes.Equal(decrypted, test.Plaintext) {
+				t.Fatal("decrypted data does not match")
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		encrypted, err := cipherio.EncryptBytes(nil, make([]byte, 64), cipher.NewCBCEncrypter(aesCipher, iv), nil)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		reader := cipherio.NewPadToLengthReader(bytes.NewReader(encrypted), cipher.NewCBCDecrypter(aesCipher, iv))
+		_, err = ioutil.ReadAll(reader)
+		if err != cipherio.ErrInvalidPadding {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidPadding)
+		}
+
+		_, err = cipherio.NewPadToLengthWriter(ioutil.Discard, cipher.NewCBCEncrypter(aesCipher, iv), 0)
+		if err == nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+}
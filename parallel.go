@@ -0,0 +1,240 @@
+package cipherio
+
+import (
+	"context"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"os"
+)
+
+// BlockModeFactory returns the BlockMode used to (en|de)crypt the chunk at the given index. Each
+// chunk is expected to use its own IV, or even its own key.
+type BlockModeFactory func(chunkIndex int64) (cipher.BlockMode, error)
+
+// ParallelOptions configures CopyParallel. The zero value is valid.
+type ParallelOptions struct {
+	// ChunkSize is the number of bytes of each chunk. It must be a multiple of the block size.
+	// Defaults to 1 MiB.
+	ChunkSize int
+
+	// Workers is the number of chunks (en|de)crypted concurrently. Defaults to GOMAXPROCS, or 1 with
+	// TinyGo. Use AutoWorkers to let CopyParallel pick it from the input size.
+	Workers int
+
+	// Padding is used to fill the last chunk if it ends in the middle of a block. If nil, an
+	// AlignmentError is returned instead.
+	Padding Padding
+}
+
+// DefaultChunkSize is the chunk size used by CopyParallel when none is specified.
+const DefaultChunkSize = 1 << 20
+
+// AutoWorkers can be used as ParallelOptions.Workers to select the number of workers
+// automatically.
+//
+// It starts from GOMAXPROCS, since (en|de)cryption is CPU-bound, but never exceeds the number of
+// chunks when the size of the input is known. This avoids allocating buffers that would never be
+// used for small inputs. The size is known if the source provides a Len method, like
+// bytes.Reader, or a Stat method, like os.File.
+const AutoWorkers = -1
+
+type parallelJob struct {
+	index int64
+	buf   []byte // whole chunk buffer, to be recycled
+	data  []byte // (en|de)crypted data, once done is closed
+	err   error
+	done  chan struct{}
+}
+
+// CopyParallel copies from src to dst, (en|de)crypting independent chunks concurrently, and
+// returns the number of bytes written to dst.
+//
+// The input is split into chunks of ChunkSize bytes, each one being (en|de)crypted with the
+// BlockMode returned by factory for its index. Chunks are written to dst in order, so the output
+// is the concatenation of all (en|de)crypted chunks. Memory usage is bounded to twice Workers
+// chunks.
+//
+// The first error encountered stops the copy and is returned. Cancelling ctx also stops the copy
+// and returns ctx.Err(). Background goroutines never outlive a call to Read on src.
+func CopyParallel(ctx context.Context, dst io.Writer, src io.Reader, factory BlockModeFactory, opts ParallelOptions) (int64, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	workers := resolveWorkers(opts.Workers, inputSize(src), chunkSize)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Bound the number of chunks in flight by recycling a fixed set of buffers.
+	inFlight := 2 * workers
+	free := make(chan []byte, inFlight)
+	for i := 0; i < inFlight; i++ {
+		free <- make([]byte, chunkSize)
+	}
+
+	jobs := make(chan *parallelJob, inFlight)
+	ordered := make(chan *parallelJob, inFlight)
+
+	go readChunks(ctx, src, free, jobs, ordered)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				job.err = cryptChunk(job, factory, chunkSize, opts.Padding)
+				close(job.done)
+			}
+		}()
+	}
+
+	var written int64
+	for job := range ordered {
+		select {
+		case <-job.done:
+		case <-ctx.Done():
+			return written, ctx.Err()
+		}
+		if job.err != nil {
+			return written, job.err
+		}
+
+		n, err := dst.Write(job.data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+
+		free <- job.buf
+	}
+
+	// The reader may have stopped because of a cancellation.
+	return written, ctx.Err()
+}
+
+// resolveWorkers returns the actual number of workers for the given option value and input size,
+// which is negative if unknown.
+func resolveWorkers(workers int, size int64, chunkSize int) int {
+	if workers > 0 {
+		return workers
+	}
+
+	auto := workers == AutoWorkers
+	workers = defaultWorkers()
+	if !auto || size < 0 {
+		return workers
+	}
+
+	chunks := (size + int64(chunkSize) - 1) / int64(chunkSize)
+	if chunks < int64(workers) {
+		workers = int(chunks)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// inputSize returns the number of bytes remaining in src, or -1 if unknown.
+func inputSize(src io.Reader) int64 {
+	switch src := src.(type) {
+	case interface{ Len() int }:
+		return int64(src.Len())
+	case interface{ Stat() (os.FileInfo, error) }:
+		info, err := src.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		size := info.Size()
+		// Only the remaining bytes are read, if the current offset is available.
+		if seeker, ok := src.(io.Seeker); ok {
+			offset, err := seeker.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return -1
+			}
+			size -= offset
+		}
+		return size
+	}
+	return -1
+}
+
+// readChunks reads src chunk by chunk and sends them both to workers and, in order, to the
+// writer. A read error is sent to the writer as a failed job.
+func readChunks(ctx context.Context, src io.Reader, free <-chan []byte, jobs, ordered chan<- *parallelJob) {
+	defer close(ordered)
+	defer close(jobs)
+
+	for index := int64(0); ; index++ {
+		var buf []byte
+		select {
+		case buf = <-free:
+		case <-ctx.Done():
+			return
+		}
+
+		n, err := io.ReadFull(src, buf)
+		if err == io.EOF {
+			return
+		}
+
+		job := &parallelJob{
+			index: index,
+			buf:   buf,
+			data:  buf[:n],
+			done:  make(chan struct{}),
+		}
+		last := err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			job.err = err
+			close(job.done)
+		}
+
+		select {
+		case ordered <- job:
+		case <-ctx.Done():
+			return
+		}
+		if job.err != nil {
+			return
+		}
+
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			return
+		}
+		if last {
+			return
+		}
+	}
+}
+
+// cryptChunk (en|de)crypts a chunk inplace, filling its last block with padding if needed.
+func cryptChunk(job *parallelJob, factory BlockModeFactory, chunkSize int, padding Padding) error {
+	blockMode, err := factory(job.index)
+	if err != nil {
+		return err
+	}
+
+	blockSize := blockMode.BlockSize()
+	if chunkSize%blockSize != 0 {
+		return fmt.Errorf("cipherio: chunk size must be a multiple of the block size: %d %% %d != 0", chunkSize, blockSize)
+	}
+
+	remaining := len(job.data) % blockSize
+	if remaining > 0 {
+		if padding == nil {
+			return AlignmentError{
+				Buffered: remaining,
+				Missing:  blockSize - remaining,
+			}
+		}
+		padded := job.data[:len(job.data)-remaining+blockSize]
+		padding.Fill(padded[len(job.data):])
+		job.data = padded
+	}
+
+	blockMode.CryptBlocks(job.data, job.data)
+	return nil
+}
@@ -0,0 +1,229 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type parallelTest struct {
+	Name    string
+	DataLen int
+	Workers int
+	Padding cipherio.Padding
+}
+
+func TestCopyParallel(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Derive each chunk IV from its index
+	chunkIV := func(chunkIndex int64) []byte {
+		iv := make([]byte, aesCipher.BlockSize())
+		binary.BigEndian.PutUint64(iv[8:], uint64(chunkIndex))
+		return iv
+	}
+	factory := func(chunkIndex int64) (cipher.BlockMode, error) {
+		return cipher.NewCBCEncrypter(aesCipher, chunkIV(chunkIndex)), nil
+	}
+
+	const chunkSize = 64
+
+	// Prepare test cases
+	testCases := []parallelTest{
+		{
+			Name:    "Empty",
+			DataLen: 0,
+		},
+		{
+			Name:    "ExactChunks",
+			DataLen: 100 * chunkSize,
+		},
+		{
+			Name:    "AlignedLastChunk",
+			DataLen: 100*chunkSize + 32,
+		},
+		{
+			Name:    "PaddedLastChunk",
+			DataLen: 100*chunkSize + 37,
+			Padding: cipherio.ZeroPadding,
+		},
+		{
+			Name:    "AutoWorkers",
+			DataLen: 100*chunkSize + 32,
+			Workers: cipherio.AutoWorkers,
+		},
+		{
+			Name:    "AutoWorkersSingleChunk",
+			DataLen: 32,
+			Workers: cipherio.AutoWorkers,
+		},
+	}
+
+	// Run test cases
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			originalBytes := make([]byte, testCase.DataLen)
+			_, err := rand.Read(originalBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Encrypt each chunk sequentially
+			var expectedBytes []byte
+			for offset := 0; offset < len(originalBytes); offset += chunkSize {
+				end := offset + chunkSize
+				if end > len(originalBytes) {
+					end = len(originalBytes)
+				}
+				chunk := make([]byte, cipherio.EncryptedSize(int64(end-offset), 16, testCase.Padding))
+				copy(chunk, originalBytes[offset:end])
+				cipher.NewCBCEncrypter(aesCipher, chunkIV(int64(offset/chunkSize))).CryptBlocks(chunk, chunk)
+				expectedBytes = append(expectedBytes, chunk...)
+			}
+
+			workers := testCase.Workers
+			if workers == 0 {
+				workers = 4
+			}
+
+			var dst bytes.Buffer
+			n, err := cipherio.CopyParallel(context.Background(), &dst, bytes.NewReader(originalBytes), factory, cipherio.ParallelOptions{
+				ChunkSize: chunkSize,
+				Workers:   workers,
+				Padding:   testCase.Padding,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(expectedBytes)) {
+				t.Fatalf("unexpected written length: %d != %d", n, len(expectedBytes))
+			}
+			if !bytes.Equal(dst.Bytes(), expectedBytes) {
+				t.Fatalf("unexpected written bytes")
+			}
+		})
+	}
+
+	t.Run("AlignmentError", func(t *testing.T) {
+		var dst bytes.Buffer
+		_, err := cipherio.CopyParallel(context.Background(), &dst, bytes.NewReader(make([]byte, 10*chunkSize+5)), factory, cipherio.ParallelOptions{
+			ChunkSize: chunkSize,
+		})
+		if err != (cipherio.AlignmentError{Buffered: 5, Missing: 11}) {
+			t.Fatalf("unexpected copy err: %v", err)
+		}
+		if dst.Len() != 10*chunkSize {
+			t.Fatalf("unexpected written length: %d != %d", dst.Len(), 10*chunkSize)
+		}
+	})
+
+	t.Run("FactoryError", func(t *testing.T) {
+		testErr := fmt.Errorf("test error")
+		failingFactory := func(chunkIndex int64) (cipher.BlockMode, error) {
+			if chunkIndex == 3 {
+				return nil, testErr
+			}
+			return factory(chunkIndex)
+		}
+
+		var dst bytes.Buffer
+		_, err := cipherio.CopyParallel(context.Background(), &dst, bytes.NewReader(make([]byte, 10*chunkSize)), failingFactory, cipherio.ParallelOptions{
+			ChunkSize: chunkSize,
+		})
+		if err != testErr {
+			t.Fatalf("unexpected copy err: %v != %v", err, testErr)
+		}
+		if dst.Len() != 3*chunkSize {
+			t.Fatalf("unexpected written length: %d != %d", dst.Len(), 3*chunkSize)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var dst bytes.Buffer
+		_, err := cipherio.CopyParallel(ctx, &dst, bytes.NewReader(make([]byte, 10*chunkSize)), factory, cipherio.ParallelOptions{
+			ChunkSize: chunkSize,
+		})
+		if err != context.Canceled {
+			t.Fatalf("unexpected copy err: %v != %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestResolveWorkers(t *testing.T) {
+	maxProcs := runtime.GOMAXPROCS(0)
+
+	file, err := ioutil.TempFile("", "cipherio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.Write(make([]byte, 2500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.Seek(1000, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atMost := func(a, b int) int {
+		if a < b {
+			return a
+		}
+		return b
+	}
+
+	testCases := []struct {
+		Name     string
+		Workers  int
+		Src      io.Reader
+		Expected int
+	}{
+		{"Explicit", 3, bytes.NewReader(nil), 3},
+		{"Default", 0, bytes.NewReader(nil), maxProcs},
+		{"AutoEmpty", cipherio.AutoWorkers, bytes.NewReader(nil), 1},
+		{"AutoSmall", cipherio.AutoWorkers, bytes.NewReader(make([]byte, 2001)), atMost(maxProcs, 3)},
+		{"AutoLarge", cipherio.AutoWorkers, bytes.NewReader(make([]byte, 1000000)), maxProcs},
+		{"AutoUnknownSize", cipherio.AutoWorkers, io.MultiReader(), maxProcs},
+		{"AutoFile", cipherio.AutoWorkers, file, atMost(maxProcs, 2)},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.Name, func(t *testing.T) {
+			workers := cipherio.ResolveWorkers(testCase.Workers, testCase.Src, 1000)
+			if workers != testCase.Expected {
+				t.Fatalf("unexpected workers: %d != %d", workers, testCase.Expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// PartWriter is the WriteCloser returned by NewPartWriter.
+type PartWriter struct {
+	writer   *BlockWriter
+	splitter *partSplitter
+}
+
+// NewPartWriter is similar to NewBlockWriterWithPadding, except that (en|de)crypted data is split
+// into parts of partSize bytes, each one written to a different Writer obtained from nextWriter.
+// This is typically used for multipart uploads.
+//
+// The part size must be a multiple of the block size, so that parts always end at a block
+// boundary. Only the last part may be smaller and contain padding. If a Writer returned by
+// nextWriter also implements io.Closer, then it is closed once its part is complete.
+//
+// Parts are requested lazily, so that no empty part is created, except when the whole output is
+// empty: in that case, Close still requests a single empty part.
+func NewPartWriter(nextWriter func(partIndex int) (io.Writer, error), partSize int64, blockMode cipher.BlockMode, padding Padding, opts ...WriterOption) (*PartWriter, error) {
+	blockSize := blockMode.BlockSize()
+	if partSize <= 0 || partSize%int64(blockSize) != 0 {
+		return nil, fmt.Errorf("cipherio: part size must be a positive multiple of the block size: %d", partSize)
+	}
+
+	splitter := &partSplitter{
+		nextWriter: nextWriter,
+		partSize:   partSize,
+	}
+
+	return &PartWriter{
+		writer:   NewBlockWriterWithPadding(splitter, blockMode, padding, opts...),
+		splitter: splitter,
+	}, nil
+}
+
+func (w *PartWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Close writes the last part, then closes it if it implements io.Closer. The current part is
+// closed even if writing it fails, in which case the first error is returned.
+func (w *PartWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		// Do not request a part only to close it, but release the current one.
+		w.splitter.closed = true
+		w.splitter.closeCurrent()
+		return err
+	}
+	return w.splitter.close()
+}
+
+// Parts returns the number of parts requested so far.
+func (w *PartWriter) Parts() int {
+	return w.splitter.index
+}
+
+type partSplitter struct {
+	nextWriter func(partIndex int) (io.Writer, error)
+	partSize   int64
+	index      int       // index of the next part
+	current    io.Writer // current part, if any
+	written    int64     // number of bytes written to the current part
+	closed     bool
+}
+
+func (s *partSplitter) Write(p []byte) (int, error) {
+	count := 0
+
+	for len(p) > 0 {
+		// Switch to the next part if the current one is complete.
+		if s.current == nil || s.written == s.partSize {
+			if err := s.rotate(); err != nil {
+				return count, err
+			}
+		}
+
+		// Write as many bytes as possible to the current part.
+		chunk := p
+		if available := s.partSize - s.written; int64(len(chunk)) > available {
+			chunk = chunk[:available]
+		}
+
+		n, err := s.current.Write(chunk)
+		count += n
+		s.written += int64(n)
+		p = p[n:]
+
+		if err != nil {
+			return count, err
+		}
+		// A part Writer making no progress would otherwise be called forever.
+		if n < len(chunk) {
+			return count, io.ErrShortWrite
+		}
+	}
+
+	return count, nil
+}
+
+// rotate closes the current part, if any, then requests the next one.
+func (s *partSplitter) rotate() error {
+	if err := s.closeCurrent(); err != nil {
+		return err
+	}
+
+	next, err := s.nextWriter(s.index)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return fmt.Errorf("cipherio: no Writer returned for part %d", s.index)
+	}
+
+	s.index++
+	s.current = next
+	s.written = 0
+	return nil
+}
+
+func (s *partSplitter) closeCurrent() error {
+	current := s.current
+	s.current = nil
+
+	if closer, ok := current.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *partSplitter) close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	// Ensure that at least one part exists.
+	if s.index == 0 {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	return s.closeCurrent()
+}
@@ -0,0 +1,226 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type partBuffer struct {
+	bytes.Buffer
+	Closed bool
+}
+
+func (b *partBuffer) Close() error {
+	b.Closed = true
+	return nil
+}
+
+type partWriterTest struct {
+	Name        string
+	DataLen     int
+	ExpectedLen []int
+}
+
+func TestPartWriter(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Prepare test cases
+	testCases := []partWriterTest{
+		{
+			Name:        "Empty",
+			DataLen:     0,
+			ExpectedLen: []int{0},
+		},
+		{
+			Name:        "SinglePaddedPart",
+			DataLen:     20,
+			ExpectedLen: []int{32},
+		},
+		{
+			Name:        "ExactParts",
+			DataLen:     96,
+			ExpectedLen: []int{48, 48},
+		},
+		{
+			Name:        "LastPaddedPart",
+			DataLen:     100,
+			ExpectedLen: []int{48, 48, 16},
+		},
+	}
+
+	// Run test cases
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			originalBytes := make([]byte, testCase.DataLen)
+			_, err := rand.Read(originalBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedBytes := make([]byte, cipherio.EncryptedSize(int64(len(originalBytes)), 16, cipherio.ZeroPadding))
+			copy(expectedBytes, originalBytes)
+			cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, expectedBytes)
+
+			var parts []*partBuffer
+			nextWriter := func(partIndex int) (io.Writer, error) {
+				if partIndex != len(parts) {
+					t.Fatalf("unexpected part index: %d != %d", partIndex, len(parts))
+				}
+				part := &partBuffer{}
+				parts = append(parts, part)
+				return part, nil
+			}
+
+			writer, err := cipherio.NewPartWriter(nextWriter, 48, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Write in small chunks to exercise part boundaries.
+			for offset := 0; offset < len(originalBytes); offset += 7 {
+				end := offset + 7
+				if end > len(originalBytes) {
+					end = len(originalBytes)
+				}
+				_, err = writer.Write(originalBytes[offset:end])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if writer.Parts() != len(testCase.ExpectedLen) {
+				t.Fatalf("unexpected part count: %d != %d", writer.Parts(), len(testCase.ExpectedLen))
+			}
+
+			var result []byte
+			for partIndex, part := range parts {
+				if part.Len() != testCase.ExpectedLen[partIndex] {
+					t.Fatalf("unexpected part length: %d != %d", part.Len(), testCase.ExpectedLen[partIndex])
+				}
+				if !part.Closed {
+					t.Fatalf("part %d has not been closed", partIndex)
+				}
+				result = append(result, part.Bytes()...)
+			}
+			if !bytes.Equal(result, expectedBytes) {
+				t.Fatalf("unexpected written bytes")
+			}
+		})
+	}
+
+	// Part sizes that are not aligned to the block size are rejected.
+	_, err = cipherio.NewPartWriter(nil, 40, cipher.NewCBCEncrypter(aesCipher, iv), nil)
+	if err == nil {
+		t.Fatalf("unexpected success with an unaligned part size")
+	}
+}
+
+// stuckWriter accepts no byte, without returning an error.
+type stuckWriter struct{}
+
+func (stuckWriter) Write(p []byte) (int, error) {
+	return 0, nil
+}
+
+func TestPartWriterInvalidPart(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	t.Run("NoProgress", func(t *testing.T) {
+		writer, err := cipherio.NewPartWriter(func(partIndex int) (io.Writer, error) {
+			return stuckWriter{}, nil
+		}, 48, cipher.NewCBCEncrypter(aesCipher, iv), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write(make([]byte, 64))
+		if err != io.ErrShortWrite {
+			t.Fatalf("unexpected err: %v != %v", err, io.ErrShortWrite)
+		}
+	})
+
+	t.Run("NilWriter", func(t *testing.T) {
+		writer, err := cipherio.NewPartWriter(func(partIndex int) (io.Writer, error) {
+			return nil, nil
+		}, 48, cipher.NewCBCEncrypter(aesCipher, iv), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write(make([]byte, 64))
+		if err == nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		err = writer.Close()
+		if err == nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	t.Run("FailedClose", func(t *testing.T) {
+		var parts []*partBuffer
+		writer, err := cipherio.NewPartWriter(func(partIndex int) (io.Writer, error) {
+			part := &partBuffer{}
+			parts = append(parts, part)
+			return part, nil
+		}, 48, cipher.NewCBCEncrypter(aesCipher, iv), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write(make([]byte, 20))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		// Without padding, the incomplete block cannot be written, but the part is still closed.
+		var alignmentErr cipherio.AlignmentError
+		err = writer.Close()
+		if !errors.As(err, &alignmentErr) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(parts) != 1 || !parts[0].Closed {
+			t.Fatalf("current part has not been closed")
+		}
+	})
+}
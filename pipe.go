@@ -0,0 +1,54 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// PipeWriter is the write half of the pipe returned by Pipe.
+type PipeWriter struct {
+	writer *BlockWriter
+	pipe   *io.PipeWriter
+}
+
+// Pipe creates a synchronous in-memory pipe, similar to io.Pipe, where data written to the
+// PipeWriter is (en|de)crypted on-the-fly using the given BlockMode before being available from
+// the PipeReader.
+//
+// If padding is nil, data must be aligned to the block size, as with NewBlockWriter. Otherwise,
+// any incomplete block is filled with the given padding on Close.
+//
+// Closing the PipeWriter makes the PipeReader return io.EOF once all data has been read, or the
+// error encountered while writing the last block. Closing the PipeReader makes subsequent writes
+// fail with io.ErrClosedPipe.
+func Pipe(blockMode cipher.BlockMode, padding Padding, opts ...WriterOption) (*PipeWriter, *io.PipeReader) {
+	pr, pw := io.Pipe()
+
+	return &PipeWriter{
+		writer: NewBlockWriterWithPadding(pw, blockMode, padding, opts...),
+		pipe:   pw,
+	}, pr
+}
+
+// Write (en|de)crypts complete blocks and writes them to the pipe. It blocks until they have been
+// entirely consumed by the reader, or the reader is closed.
+func (w *PipeWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Close writes the last block, with padding if needed, then closes the pipe. If this fails, then
+// the pipe is closed with the same error.
+func (w *PipeWriter) Close() error {
+	err := w.writer.Close()
+	if err != nil {
+		w.pipe.CloseWithError(err)
+		return err
+	}
+	return w.pipe.Close()
+}
+
+// CloseWithError closes the pipe without writing the last block, so that the reader returns the
+// given error. If err is nil, then the reader returns io.EOF, which may hide a truncated output.
+func (w *PipeWriter) CloseWithError(err error) error {
+	return w.pipe.CloseWithError(err)
+}
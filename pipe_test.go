@@ -0,0 +1,115 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestPipe(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 1000)
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, 1008)
+	copy(expectedBytes, originalBytes)
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, expectedBytes)
+
+	// Prepare a custom error
+	testErr := fmt.Errorf("test error")
+
+	t.Run("Close", func(t *testing.T) {
+		writer, reader := cipherio.Pipe(cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+
+		go func() {
+			_, err := writer.Write(originalBytes)
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			writer.Close()
+		}()
+
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, expectedBytes) {
+			t.Fatalf("unexpected read bytes")
+		}
+	})
+
+	t.Run("CloseAlignmentError", func(t *testing.T) {
+		writer, reader := cipherio.Pipe(cipher.NewCBCEncrypter(aesCipher, iv), nil)
+
+		go func() {
+			_, _ = writer.Write(originalBytes)
+			writer.Close()
+		}()
+
+		result, err := ioutil.ReadAll(reader)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("unexpected read err: %v", err)
+		}
+		if !bytes.Equal(result, expectedBytes[:992]) {
+			t.Fatalf("unexpected read bytes")
+		}
+	})
+
+	t.Run("CloseWithError", func(t *testing.T) {
+		writer, reader := cipherio.Pipe(cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+
+		go func() {
+			_, _ = writer.Write(originalBytes[:100])
+			writer.CloseWithError(testErr)
+		}()
+
+		result, err := ioutil.ReadAll(reader)
+		if err != testErr {
+			t.Fatalf("unexpected read err: %v != %v", err, testErr)
+		}
+		if !bytes.Equal(result, expectedBytes[:96]) {
+			t.Fatalf("unexpected read bytes")
+		}
+	})
+
+	t.Run("ReaderClosed", func(t *testing.T) {
+		writer, reader := cipherio.Pipe(cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+		reader.Close()
+
+		_, err := writer.Write(originalBytes)
+		if err != io.ErrClosedPipe {
+			t.Fatalf("unexpected write err: %v != %v", err, io.ErrClosedPipe)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"io"
+)
+
+// ErrInvalidPadding is returned when decrypted data does not end with a valid padding.
+var ErrInvalidPadding = errors.New("cipherio: invalid padding")
+
+// PKCS7Writer (en|de)crypts data padded as specified by PKCS#7 (RFC 5652) and the formats based on
+// it, such as CMS or HLS: unlike PKCS7Padding alone, which only fills an incomplete block, padding
+// is always added, so that it can be removed unambiguously.
+type PKCS7Writer struct {
+	writer   *BlockWriter
+	accepted int64
+}
+
+// NewPKCS7Writer returns a PKCS7Writer wrapping a BlockWriter with the given BlockMode.
+func NewPKCS7Writer(dst io.Writer, blockMode cipher.BlockMode, opts ...WriterOption) *PKCS7Writer {
+	return &PKCS7Writer{
+		writer: NewBlockWriterWithPadding(dst, blockMode, PKCS7Padding, opts...),
+	}
+}
+
+func (w *PKCS7Writer) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.accepted += int64(n)
+	return n, err
+}
+
+// Close writes the padding, then closes the underlying BlockWriter. The wrapped Writer is not
+// closed.
+func (w *PKCS7Writer) Close() error {
+	// Data aligned to the block size is followed by a whole padding block.
+	blockSize := w.writer.blockSize
+	if w.accepted%int64(blockSize) == 0 {
+		padding := bytes.Repeat([]byte{byte(blockSize)}, blockSize)
+		if _, err := w.Write(padding); err != nil {
+			w.writer.Close()
+			return err
+		}
+	}
+	return w.writer.Close()
+}
+
+// NewPKCS7Reader returns a Reader (en|de)crypting src with the given BlockMode, like
+// NewBlockReader, then removing the PKCS#7 padding of the result, as added by PKCS7Writer.
+//
+// The last block is held back until EOF. ErrInvalidPadding is then returned if the padding is
+// invalid, which also happens with a wrong key or IV.
+func NewPKCS7Reader(src io.Reader, blockMode cipher.BlockMode, opts ...ReaderOption) io.Reader {
+	blockSize := blockMode.BlockSize()
+	return &pkcs7Unpadder{
+		src:       NewBlockReader(src, blockMode, opts...),
+		blockSize: blockSize,
+		buf:       make([]byte, 0, 256*blockSize),
+	}
+}
+
+// pkcs7Unpadder holds back the last block read from src until EOF, to remove its PKCS#7 padding.
+type pkcs7Unpadder struct {
+	src       io.Reader
+	blockSize int
+	buf       []byte // bytes read from src and not returned yet
+	err       error
+	done      bool // if true, the padding has been removed from buf
+}
+
+func (r *pkcs7Unpadder) Read(p []byte) (int, error) {
+	for {
+		available := len(r.buf)
+		if !r.done {
+			available -= r.blockSize
+		}
+		if available > 0 {
+			n := copy(p, r.buf[:available])
+			r.buf = r.buf[:copy(r.buf, r.buf[n:])]
+			return n, nil
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.src.Read(r.buf[len(r.buf):cap(r.buf)])
+		r.buf = r.buf[:len(r.buf)+n]
+		if err == io.EOF {
+			if len(r.buf) < r.blockSize {
+				err = ErrInvalidPadding
+			} else if padding, ok := CheckPKCS7Padding(r.buf[len(r.buf)-r.blockSize:]); !ok {
+				err = ErrInvalidPadding
+			} else {
+				r.buf = r.buf[:len(r.buf)-padding]
+				r.done = true
+			}
+		}
+		r.err = err
+		if err != nil && !r.done {
+			r.buf = r.buf[:0]
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestPKCS7WriterReader(t *testing.T) {
+	// Generate a random DES key, to check a block size other than 16
+	key := make([]byte, 8)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the DES cipher
+	block, err := des.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, 8)
+	for _, size := range []int{0, 7, 8, 9, 5000} {
+		plaintext := make([]byte, size)
+		_, err = rand.Read(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		writer := cipherio.NewPKCS7Writer(&buf, cipher.NewCBCEncrypter(block, iv))
+		_, err = writer.Write(plaintext)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if expected := (size/8 + 1) * 8; buf.Len() != expected {
+			t.Fatalf("unexpected ciphertext size: %d != %d", buf.Len(), expected)
+		}
+
+		result, err := ioutil.ReadAll(cipherio.NewPKCS7Reader(&buf, cipher.NewCBCDecrypter(block, iv)))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatalf("decrypted data does not match plaintext for %d bytes", size)
+		}
+	}
+}
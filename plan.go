@@ -0,0 +1,102 @@
+package cipherio
+
+import (
+	"fmt"
+)
+
+// PlanConfig describes an encryption to be planned by PlanEncryption. The zero value describes an
+// unpadded stream encrypted with a block size of 16 bytes by a BlockWriter.
+type PlanConfig struct {
+	// BlockSize is the block size of the cipher. Defaults to 16, like AES.
+	BlockSize int
+
+	// Padding fills the last block, if incomplete. If nil, the plaintext must be aligned.
+	Padding Padding
+
+	// Header, if not nil, is written before the ciphertext, like NewStreamWriter does.
+	Header *StreamHeader
+
+	// HighWaterMark is the value given to WithHighWaterMark, if any.
+	HighWaterMark int
+
+	// LowMemory means that WithLowMemory is used.
+	LowMemory bool
+
+	// Parallel, if not nil, plans a CopyParallel with these options instead of a BlockWriter. Its
+	// Padding is ignored in favor of the one above.
+	Parallel *ParallelOptions
+}
+
+// Plan reports the sizes and memory requirements of an encryption, as computed by
+// PlanEncryption.
+type Plan struct {
+	PlaintextLen int64 // number of plaintext bytes
+	HeaderLen    int   // number of bytes written before the ciphertext
+	PaddingLen   int   // number of padding bytes appended to the plaintext
+	OutputLen    int64 // total number of bytes written, including the header
+	Blocks       int64 // number of (en|de)crypted blocks
+
+	// Chunks and Workers are the number of chunks and goroutines of CopyParallel, or zero.
+	Chunks  int64
+	Workers int
+
+	// BufferSize is the number of bytes allocated for buffers: the internal buffer of the
+	// BlockWriter, or the chunk buffers of CopyParallel.
+	BufferSize int64
+}
+
+// PlanEncryption computes the Plan of encrypting plaintextLen bytes with the given configuration,
+// without encrypting anything. This allows to check quotas or reserve capacity before streaming
+// starts.
+//
+// An AlignmentError is returned if the plaintext cannot be encrypted without padding.
+func PlanEncryption(plaintextLen int64, config PlanConfig) (*Plan, error) {
+	if plaintextLen < 0 {
+		return nil, fmt.Errorf("cipherio: invalid plaintext length: %d", plaintextLen)
+	}
+	blockSize := config.BlockSize
+	if blockSize <= 0 {
+		blockSize = 16
+	}
+
+	encryptedLen := EncryptedSize(plaintextLen, blockSize, config.Padding)
+	if encryptedLen < 0 {
+		remaining := int(plaintextLen % int64(blockSize))
+		return nil, AlignmentError{
+			Buffered: remaining,
+			Missing:  blockSize - remaining,
+		}
+	}
+
+	plan := &Plan{
+		PlaintextLen: plaintextLen,
+		PaddingLen:   int(encryptedLen - plaintextLen),
+		Blocks:       encryptedLen / int64(blockSize),
+	}
+
+	if config.Header != nil {
+		header, err := config.Header.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		plan.HeaderLen = len(header)
+	}
+	plan.OutputLen = int64(plan.HeaderLen) + encryptedLen
+
+	if config.Parallel == nil {
+		plan.BufferSize = int64(writerBufferSize(blockSize, config.HighWaterMark, config.LowMemory))
+		return plan, nil
+	}
+
+	chunkSize := config.Parallel.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize%blockSize != 0 {
+		return nil, fmt.Errorf("cipherio: chunk size must be a multiple of the block size: %d %% %d != 0", chunkSize, blockSize)
+	}
+	plan.Chunks = (plaintextLen + int64(chunkSize) - 1) / int64(chunkSize)
+	plan.Workers = resolveWorkers(config.Parallel.Workers, plaintextLen, chunkSize)
+	plan.BufferSize = 2 * int64(plan.Workers) * int64(chunkSize)
+	return plan, nil
+}
@@ -0,0 +1,128 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestPlanEncryption(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := &cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           make([]byte, 16),
+		PlaintextLen: 1000,
+	}
+	plan, err := cipherio.PlanEncryption(1000, cipherio.PlanConfig{
+		Padding: cipherio.PKCS7Padding,
+		Header:  header,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	var buf bytes.Buffer
+	writer, err := cipherio.NewStreamWriter(&buf, header, key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write(make([]byte, 1000))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	if plan.OutputLen != int64(buf.Len()) {
+		t.Fatalf("unexpected output length: %d != %d", plan.OutputLen, buf.Len())
+	}
+	if plan.PaddingLen != 8 || plan.Blocks != 63 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan.BufferSize != 16*1024 {
+		t.Fatalf("unexpected buffer size: %d != %d", plan.BufferSize, 16*1024)
+	}
+}
+
+func TestPlanEncryptionParallel(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := cipherio.ParallelOptions{
+		ChunkSize: 4096,
+		Workers:   cipherio.AutoWorkers,
+		Padding:   cipherio.ZeroPadding,
+	}
+	plan, err := cipherio.PlanEncryption(10000, cipherio.PlanConfig{
+		Padding:  cipherio.ZeroPadding,
+		Parallel: &opts,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if plan.Chunks != 3 || plan.Workers < 1 || plan.Workers > 3 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan.BufferSize != 2*int64(plan.Workers)*4096 {
+		t.Fatalf("unexpected buffer size: %d", plan.BufferSize)
+	}
+
+	var buf bytes.Buffer
+	factory := func(chunkIndex int64) (cipher.BlockMode, error) {
+		return cipher.NewCBCEncrypter(block, make([]byte, 16)), nil
+	}
+	written, err := cipherio.CopyParallel(context.Background(), &buf, io.LimitReader(rand.Reader, 10000), factory, opts)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if written != plan.OutputLen {
+		t.Fatalf("unexpected output length: %d != %d", written, plan.OutputLen)
+	}
+}
+
+func TestPlanEncryptionErrors(t *testing.T) {
+	_, err := cipherio.PlanEncryption(1000, cipherio.PlanConfig{})
+	var alignmentErr cipherio.AlignmentError
+	if !errors.As(err, &alignmentErr) || alignmentErr.Buffered != 8 || alignmentErr.Missing != 8 {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	_, err = cipherio.PlanEncryption(-1, cipherio.PlanConfig{})
+	if err == nil {
+		t.Fatal("negative length has been planned")
+	}
+
+	_, err = cipherio.PlanEncryption(1024, cipherio.PlanConfig{
+		Parallel: &cipherio.ParallelOptions{ChunkSize: 100},
+	})
+	if err == nil {
+		t.Fatal("misaligned chunk size has been planned")
+	}
+}
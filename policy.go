@@ -0,0 +1,64 @@
+package cipherio
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotApproved is wrapped by the PolicyError returned when the current Policy rejects an
+// algorithm, mode or padding.
+var ErrNotApproved = errors.New("cipherio: rejected by policy")
+
+// Policy restricts the algorithms that the constructors of this package accept, so that
+// compliance requirements can be enforced centrally, rather than by reviewing each call site. The
+// zero value accepts everything, and is the default.
+//
+// Constructors rejecting an algorithm return a PolicyError. Existing Readers and Writers are not
+// affected by later changes of the policy.
+type Policy struct {
+	// FIPS rejects the algorithms not approved by FIPS 140-3: block ciphers other than AES,
+	// ChaCha20, Triple-DES encryption, the MD5 key derivation of OpenSSL, and RC4 and DES in
+	// package legacy. Decrypting Triple-DES remains allowed for legacy use. ECB is rejected too,
+	// since it leaks patterns of the data.
+	FIPS bool
+
+	// RequireMAC rejects unauthenticated CBC, which is exposed to padding oracles and tampering:
+	// StreamHeader, OpenSSL enc, HLS, backups, chunked streams and encrypted files, as well as
+	// Reencrypt without a MAC on both sides. It also rejects ECB, and the stream modes CTR, CFB,
+	// OFB and ChaCha20, whose ciphertext is malleable. Applications authenticating data at another
+	// layer must not set it.
+	RequireMAC bool
+}
+
+var (
+	policyMu sync.RWMutex
+	policy   Policy
+)
+
+// SetPolicy sets the policy enforced by the constructors of this package. It is typically called
+// once from the main function, before any encryption.
+func SetPolicy(p Policy) {
+	policyMu.Lock()
+	policy = p
+	policyMu.Unlock()
+}
+
+// CurrentPolicy returns the policy set by SetPolicy, so that other packages can enforce it too.
+func CurrentPolicy() Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return policy
+}
+
+// checkPolicy returns a PolicyError if the current policy rejects the given algorithm, which is
+// FIPS approved or not, and authenticated or not.
+func checkPolicy(algorithm string, approved, authenticated bool) error {
+	p := CurrentPolicy()
+	if p.FIPS && !approved {
+		return PolicyError{Algorithm: algorithm, Reason: "not approved by FIPS 140-3"}
+	}
+	if p.RequireMAC && !authenticated {
+		return PolicyError{Algorithm: algorithm, Reason: "not authenticated"}
+	}
+	return nil
+}
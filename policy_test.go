@@ -0,0 +1,232 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestPolicy(t *testing.T) {
+	defer cipherio.SetPolicy(cipherio.Policy{})
+
+	testCases := []struct {
+		Name     string
+		Policy   cipherio.Policy
+		Rejected bool
+		Run      func() error
+	}{
+		{
+			Name:   "ChaCha20",
+			Policy: cipherio.Policy{FIPS: true},
+			Run: func() error {
+				_, err := cipherio.NewChaCha20(make([]byte, 32), make([]byte, 12))
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "TripleDESEncrypter",
+			Policy: cipherio.Policy{FIPS: true},
+			Run: func() error {
+				_, err := cipherio.NewTripleDESCBCEncrypter(bytes.Repeat([]byte{1, 2, 4, 7, 8, 11, 13, 14}, 3)[:24], make([]byte, 8), cipherio.TripleDESOptions{AllowSingleDES: true})
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "TripleDESDecrypter",
+			Policy: cipherio.Policy{FIPS: true},
+			Run: func() error {
+				_, err := cipherio.NewTripleDESCBCDecrypter(bytes.Repeat([]byte{1, 2, 4, 7, 8, 11, 13, 14}, 3)[:24], make([]byte, 8), cipherio.TripleDESOptions{AllowSingleDES: true})
+				return err
+			},
+		},
+		{
+			Name:   "OpenSSLLegacyMD5",
+			Policy: cipherio.Policy{FIPS: true},
+			Run: func() error {
+				_, err := cipherio.NewOpenSSLWriter(&bytes.Buffer{}, []byte("secret"), cipherio.OpenSSLOptions{LegacyMD5: true})
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "OpenSSLPBKDF2",
+			Policy: cipherio.Policy{FIPS: true},
+			Run: func() error {
+				_, err := cipherio.NewOpenSSLWriter(&bytes.Buffer{}, []byte("secret"), cipherio.OpenSSLOptions{Iterations: 1})
+				return err
+			},
+		},
+		{
+			Name:   "StreamFIPS",
+			Policy: cipherio.Policy{FIPS: true},
+			Run: func() error {
+				_, err := newTestHeader().NewEncrypter(make([]byte, 16))
+				return err
+			},
+		},
+		{
+			Name:   "StreamRequireMAC",
+			Policy: cipherio.Policy{RequireMAC: true},
+			Run: func() error {
+				_, err := newTestHeader().NewEncrypter(make([]byte, 16))
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "HLSRequireMAC",
+			Policy: cipherio.Policy{RequireMAC: true},
+			Run: func() error {
+				_, err := cipherio.NewHLSSegmentWriter(&bytes.Buffer{}, make([]byte, 16), make([]byte, 16))
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "ReencryptRequireMAC",
+			Policy: cipherio.Policy{RequireMAC: true},
+			Run: func() error {
+				block, err := aes.NewCipher(make([]byte, 16))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = cipherio.Reencrypt(&bytes.Buffer{}, &bytes.Buffer{},
+					cipherio.DecryptSetup{BlockMode: cipher.NewCBCDecrypter(block, make([]byte, 16)), PlaintextLen: -1},
+					cipherio.EncryptSetup{BlockMode: cipher.NewCBCEncrypter(block, make([]byte, 16))},
+					cipherio.ReencryptOptions{})
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "ChaCha20RequireMAC",
+			Policy: cipherio.Policy{RequireMAC: true},
+			Run: func() error {
+				_, err := cipherio.NewChaCha20(make([]byte, 32), make([]byte, 12))
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "ECBFIPS",
+			Policy: cipherio.Policy{FIPS: true},
+			Run: func() error {
+				block, err := aes.NewCipher(make([]byte, 16))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = cipherio.NewInsecureECBDecrypter(block)
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "CTRFIPS",
+			Policy: cipherio.Policy{FIPS: true},
+			Run: func() error {
+				block, err := aes.NewCipher(make([]byte, 16))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = cipherio.NewCTR(block, make([]byte, 16), cipherio.CTRLayout{})
+				return err
+			},
+		},
+		{
+			Name:   "CTRRequireMAC",
+			Policy: cipherio.Policy{RequireMAC: true},
+			Run: func() error {
+				block, err := aes.NewCipher(make([]byte, 16))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = cipherio.NewCTRWriter(&bytes.Buffer{}, block, make([]byte, 16), cipherio.CTRLayout{})
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "CFBRequireMAC",
+			Policy: cipherio.Policy{RequireMAC: true},
+			Run: func() error {
+				block, err := aes.NewCipher(make([]byte, 16))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = cipherio.NewCFB8Reader(&bytes.Buffer{}, block, make([]byte, 16))
+				return err
+			},
+			Rejected: true,
+		},
+		{
+			Name:   "OFBRequireMAC",
+			Policy: cipherio.Policy{RequireMAC: true},
+			Run: func() error {
+				block, err := aes.NewCipher(make([]byte, 16))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = cipherio.NewOFBReader(&bytes.Buffer{}, block, make([]byte, 16))
+				return err
+			},
+			Rejected: true,
+		},
+	}
+
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			cipherio.SetPolicy(testCase.Policy)
+			err := testCase.Run()
+			cipherio.SetPolicy(cipherio.Policy{})
+
+			if !testCase.Rejected {
+				if err != nil {
+					t.Fatalf("unexpected err: %v != %v", err, nil)
+				}
+				return
+			}
+			if !errors.Is(err, cipherio.ErrNotApproved) {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNotApproved)
+			}
+			var policyErr cipherio.PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("unexpected err type: %T", err)
+			}
+
+			// Without policy, the same call succeeds.
+			err = testCase.Run()
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+		})
+	}
+}
+
+func TestPolicySelfTest(t *testing.T) {
+	defer cipherio.SetPolicy(cipherio.Policy{})
+
+	// Rejected algorithms are skipped rather than failing.
+	cipherio.SetPolicy(cipherio.Policy{FIPS: true})
+	err := cipherio.SelfTest()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+}
+
+func newTestHeader() *cipherio.StreamHeader {
+	return &cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           make([]byte, 16),
+		PlaintextLen: -1,
+	}
+}
@@ -0,0 +1,165 @@
+package cipherio
+
+import (
+	"io"
+	"sync"
+)
+
+// PrefetchOptions configures a PrefetchReader. The zero value is valid.
+type PrefetchOptions struct {
+	// Buffers is the maximum number of buffers filled in advance. Defaults to 4.
+	Buffers int
+
+	// BufferSize is the number of bytes of each buffer. Defaults to 64 KiB.
+	//
+	// Memory usage is bounded to Buffers times BufferSize bytes. High-latency sources, such as
+	// object stores, usually benefit from more or larger buffers than local disks.
+	BufferSize int
+
+	// LowWater is the number of filled buffers at or below which LowWaterFn is called.
+	LowWater int
+
+	// LowWaterFn, if not nil, is called by Read each time it consumes a buffer and the number of
+	// remaining filled buffers is at most LowWater. It receives this number, and is never called
+	// once the end of the wrapped Reader has been reached. A caller consistently observing 0 is
+	// reading faster than the source can deliver.
+	LowWaterFn func(filled int)
+}
+
+// Default values used by NewPrefetchReader when none are specified.
+const (
+	DefaultPrefetchBuffers    = 4
+	DefaultPrefetchBufferSize = 64 << 10
+)
+
+type prefetchChunk struct {
+	buf  []byte // whole buffer, to be recycled
+	data []byte
+	err  error
+}
+
+// PrefetchReader reads ahead from the wrapped Reader in a background goroutine, so that slow
+// sources are consumed while the caller is busy (en|de)crypting or writing.
+//
+// Like BlockReader, a PrefetchReader is not safe for concurrent use.
+type PrefetchReader struct {
+	filled     chan prefetchChunk
+	free       chan []byte
+	done       chan struct{}
+	closeOnce  sync.Once
+	current    prefetchChunk
+	err        error
+	lowWater   int
+	lowWaterFn func(filled int)
+}
+
+// NewPrefetchReader wraps the given Reader and starts reading from it in a background goroutine.
+//
+// Each buffer is filled with io.ReadFull before being handed to Read, so that a source returning
+// many short reads does not waste buffers. The first error returned by the wrapped Reader,
+// including io.EOF, is returned by Read once all previous bytes have been consumed.
+//
+// Close must be called to stop the background goroutine if the Reader is not consumed until the
+// end. It is typically used as the source of a BlockReader.
+func NewPrefetchReader(src io.Reader, opts PrefetchOptions) *PrefetchReader {
+	buffers := opts.Buffers
+	if buffers <= 0 {
+		buffers = DefaultPrefetchBuffers
+	}
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultPrefetchBufferSize
+	}
+
+	r := &PrefetchReader{
+		filled:     make(chan prefetchChunk, buffers),
+		free:       make(chan []byte, buffers),
+		done:       make(chan struct{}),
+		lowWater:   opts.LowWater,
+		lowWaterFn: opts.LowWaterFn,
+	}
+	for i := 0; i < buffers; i++ {
+		r.free <- make([]byte, bufferSize)
+	}
+
+	go r.prefetch(src)
+	return r
+}
+
+// prefetch fills free buffers from src until an error is encountered or the Reader is closed.
+func (r *PrefetchReader) prefetch(src io.Reader) {
+	defer close(r.filled)
+
+	for {
+		var buf []byte
+		select {
+		case buf = <-r.free:
+		case <-r.done:
+			return
+		}
+
+		n, err := io.ReadFull(src, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+
+		select {
+		case r.filled <- prefetchChunk{buf: buf, data: buf[:n], err: err}:
+		case <-r.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *PrefetchReader) Read(p []byte) (int, error) {
+	for len(r.current.data) == 0 {
+		// Recycle the consumed buffer. This never blocks since there are as many slots as buffers.
+		if r.current.buf != nil {
+			r.free <- r.current.buf
+			r.current.buf = nil
+		}
+
+		// Return the previously saved error, if any.
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.current.err != nil {
+			r.err = r.current.err
+			return 0, r.err
+		}
+
+		chunk, ok := <-r.filled
+		if !ok {
+			// The background goroutine only stops early if the Reader has been closed.
+			r.err = io.ErrClosedPipe
+			return 0, r.err
+		}
+		r.current = chunk
+
+		if r.lowWaterFn != nil && chunk.err == nil {
+			if filled := len(r.filled); filled <= r.lowWater {
+				r.lowWaterFn(filled)
+			}
+		}
+	}
+
+	n := copy(p, r.current.data)
+	r.current.data = r.current.data[n:]
+	return n, nil
+}
+
+// Close stops the background goroutine. Any subsequent Read returns io.ErrClosedPipe.
+//
+// Close does not wait for a pending Read on the wrapped Reader, nor does it close the wrapped
+// Reader.
+func (r *PrefetchReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	r.current = prefetchChunk{}
+	r.err = io.ErrClosedPipe
+	return nil
+}
@@ -0,0 +1,212 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/connesc/cipherio"
+)
+
+// countingReader counts the bytes read from the wrapped Reader.
+type countingReader struct {
+	src   io.Reader
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	atomic.AddInt64(&r.count, int64(n))
+	return n, err
+}
+
+type prefetchTest struct {
+	Size    int
+	Options cipherio.PrefetchOptions
+}
+
+func TestPrefetchReader(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []prefetchTest{
+		{Size: 0},
+		{Size: 100000},
+		{Size: 100000, Options: cipherio.PrefetchOptions{Buffers: 1, BufferSize: 7}},
+		{Size: 100000, Options: cipherio.PrefetchOptions{Buffers: 3, BufferSize: 1000}},
+		{Size: 4096, Options: cipherio.PrefetchOptions{Buffers: 2, BufferSize: 1024}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(fmt.Sprintf("%d/%d/%d", testCase.Size, testCase.Options.Buffers, testCase.Options.BufferSize), func(t *testing.T) {
+			plaintext := make([]byte, testCase.Size)
+			_, err := rand.Read(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var expected bytes.Buffer
+			encrypter := cipherio.NewBlockWriterWithPadding(&expected, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+			_, err = encrypter.Write(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = encrypter.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			prefetcher := cipherio.NewPrefetchReader(bytes.NewReader(plaintext), testCase.Options)
+			defer prefetcher.Close()
+
+			reader := cipherio.NewBlockReaderWithPadding(prefetcher, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, expected.Bytes()) {
+				t.Fatalf("unexpected read bytes")
+			}
+
+			// EOF must be sticky.
+			n, err := prefetcher.Read(make([]byte, 1))
+			if n != 0 || err != io.EOF {
+				t.Fatalf("unexpected read after EOF: %d, %v", n, err)
+			}
+		})
+	}
+
+	t.Run("Bounded", func(t *testing.T) {
+		src := &countingReader{src: bytes.NewReader(make([]byte, 1<<20))}
+		prefetcher := cipherio.NewPrefetchReader(src, cipherio.PrefetchOptions{Buffers: 3, BufferSize: 1000})
+		defer prefetcher.Close()
+
+		// Without any Read, the source must only be consumed up to the memory bound.
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt64(&src.count) < 3000 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if count := atomic.LoadInt64(&src.count); count != 3000 {
+			t.Fatalf("unexpected prefetched bytes: %d != %d", count, 3000)
+		}
+
+		// Consuming a buffer allows another one to be filled.
+		_, err := io.ReadFull(prefetcher, make([]byte, 1001))
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline = time.Now().Add(time.Second)
+		for atomic.LoadInt64(&src.count) < 4000 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if count := atomic.LoadInt64(&src.count); count != 4000 {
+			t.Fatalf("unexpected prefetched bytes: %d != %d", count, 4000)
+		}
+	})
+
+	t.Run("LowWater", func(t *testing.T) {
+		src := &blockingReader{data: make([]byte, 4500), unblock: make(chan struct{})}
+		var calls []int
+		prefetcher := cipherio.NewPrefetchReader(src, cipherio.PrefetchOptions{
+			Buffers:    4,
+			BufferSize: 1000,
+			LowWater:   1,
+			LowWaterFn: func(filled int) {
+				calls = append(calls, filled)
+			},
+		})
+		defer prefetcher.Close()
+
+		// Let the first buffers be filled, while the source blocks on the fifth one.
+		time.Sleep(10 * time.Millisecond)
+		for i := 0; i < 4; i++ {
+			_, err := io.ReadFull(prefetcher, make([]byte, 1000))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Only the last two buffers are consumed at or below the low-water mark.
+		if fmt.Sprint(calls) != "[1 0]" {
+			t.Fatalf("unexpected low-water calls: %v", calls)
+		}
+
+		close(src.unblock)
+		rest, err := ioutil.ReadAll(prefetcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rest) != 500 {
+			t.Fatalf("unexpected remaining length: %d != %d", len(rest), 500)
+		}
+		if fmt.Sprint(calls) != "[1 0]" {
+			t.Fatalf("unexpected low-water calls after EOF: %v", calls)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		expectedErr := fmt.Errorf("read failure")
+		src := io.MultiReader(bytes.NewReader(make([]byte, 1500)), &failingReader{err: expectedErr})
+		prefetcher := cipherio.NewPrefetchReader(src, cipherio.PrefetchOptions{BufferSize: 1000})
+		defer prefetcher.Close()
+
+		result, err := ioutil.ReadAll(prefetcher)
+		if err != expectedErr {
+			t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+		}
+		if len(result) != 1500 {
+			t.Fatalf("unexpected read length: %d != %d", len(result), 1500)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		src := &blockingReader{data: make([]byte, 100), unblock: make(chan struct{})}
+		defer close(src.unblock)
+
+		prefetcher := cipherio.NewPrefetchReader(src, cipherio.PrefetchOptions{})
+		err := prefetcher.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = prefetcher.Read(make([]byte, 1))
+		if err != io.ErrClosedPipe {
+			t.Fatalf("unexpected err: %v != %v", err, io.ErrClosedPipe)
+		}
+	})
+}
+
+// failingReader fails on every read.
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,112 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// BlockProcessor (en|de)crypts data with the same buffering logic as BlockReader and BlockWriter,
+// but without any io.Reader or io.Writer. This allows to integrate with custom event loops, or
+// transports that are not streams, such as message queues or io_uring.
+//
+// Data is passed to Process in chunks of any size, and complete blocks are produced as soon as
+// possible. Incomplete blocks are carried over to the next call, and completed with padding by
+// Finish.
+//
+// A BlockProcessor is not safe for concurrent use.
+type BlockProcessor struct {
+	blockMode cipher.BlockMode
+	padding   Padding
+	blockSize int
+	buf       []byte // incomplete block carried over between calls
+}
+
+// NewBlockProcessor returns a BlockProcessor (en|de)crypting data with the given BlockMode. If
+// padding is nil, data must be aligned to the block size, otherwise Finish returns an
+// AlignmentError.
+func NewBlockProcessor(blockMode cipher.BlockMode, padding Padding) *BlockProcessor {
+	blockSize := blockMode.BlockSize()
+	return &BlockProcessor{
+		blockMode: blockMode,
+		padding:   padding,
+		blockSize: blockSize,
+		buf:       make([]byte, 0, blockSize),
+	}
+}
+
+// Process (en|de)crypts as much data from src as possible into dst, and returns the number of
+// bytes consumed from src and produced into dst. The produced length is always a multiple of the
+// block size.
+//
+// If dst is too small, src is only partially consumed and the rest must be passed again. Data is
+// never lost: any incomplete block at the end of src is consumed and carried over. dst and src must
+// not overlap.
+func (p *BlockProcessor) Process(dst, src []byte) (consumed, produced int) {
+	// Complete the carried block first.
+	if len(p.buf) > 0 {
+		n := copy(p.buf[len(p.buf):p.blockSize], src)
+		if len(p.buf)+n < p.blockSize {
+			p.buf = p.buf[:len(p.buf)+n]
+			return n, 0
+		}
+		if len(dst) < p.blockSize {
+			return 0, 0
+		}
+		p.buf = p.buf[:p.blockSize]
+		p.blockMode.CryptBlocks(dst[:p.blockSize], p.buf)
+		p.buf = p.buf[:0]
+		consumed, produced = n, p.blockSize
+	}
+
+	// Then crypt complete blocks directly from src to dst.
+	blocks := (len(src) - consumed) / p.blockSize
+	if room := (len(dst) - produced) / p.blockSize; blocks > room {
+		blocks = room
+	}
+	if n := blocks * p.blockSize; n > 0 {
+		p.blockMode.CryptBlocks(dst[produced:produced+n], src[consumed:consumed+n])
+		consumed += n
+		produced += n
+	}
+
+	// Finally, carry over the trailing incomplete block, unless complete blocks are left.
+	if remaining := len(src) - consumed; remaining < p.blockSize {
+		p.buf = append(p.buf, src[consumed:]...)
+		consumed = len(src)
+	}
+	return consumed, produced
+}
+
+// Pending returns the number of bytes carried over, which is always less than the block size.
+func (p *BlockProcessor) Pending() int {
+	return len(p.buf)
+}
+
+// Finish fills the carried incomplete block with padding, if any, and (en|de)crypts it into dst.
+// It returns the number of bytes produced, which is either zero or the block size.
+//
+// An AlignmentError is returned if a block is incomplete and no padding is defined, and
+// io.ErrShortBuffer if dst is shorter than a block. The BlockProcessor is then left unchanged.
+// Otherwise, it is reset and can be reused with another BlockMode state, such as a new IV.
+func (p *BlockProcessor) Finish(dst []byte) (int, error) {
+	remaining := len(p.buf)
+	if remaining == 0 {
+		return 0, blockModeErr(p.blockMode)
+	}
+	if p.padding == nil {
+		return 0, AlignmentError{
+			Buffered: remaining,
+			Missing:  p.blockSize - remaining,
+		}
+	}
+	if len(dst) < p.blockSize {
+		return 0, io.ErrShortBuffer
+	}
+
+	block := p.buf[:p.blockSize]
+	p.padding.Fill(block[remaining:])
+	p.blockMode.CryptBlocks(dst[:p.blockSize], block)
+	wipeBytes(block)
+	p.buf = p.buf[:0]
+	return p.blockSize, blockModeErr(p.blockMode)
+}
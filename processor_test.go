@@ -0,0 +1,140 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestBlockProcessor(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 1000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	padded := append([]byte(nil), plaintext...)
+	padded = append(padded, make([]byte, 8)...)
+	expected := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expected, padded)
+
+	testCases := []struct {
+		name    string
+		srcSize int
+		dstSize int
+	}{
+		{"Small", 1, 16},
+		{"Unaligned", 17, 64},
+		{"ShortDst", 100, 16},
+		{"TinyDst", 100, 5},
+		{"Large", 1000, 2048},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			processor := cipherio.NewBlockProcessor(cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+
+			var result []byte
+			dst := make([]byte, testCase.dstSize)
+			src := plaintext
+			for len(src) > 0 {
+				chunk := src
+				if len(chunk) > testCase.srcSize {
+					chunk = chunk[:testCase.srcSize]
+				}
+				consumed, produced := processor.Process(dst, chunk)
+				if produced%aesCipher.BlockSize() != 0 {
+					t.Fatalf("unaligned output: %d", produced)
+				}
+				if consumed == 0 && produced == 0 {
+					// The destination is too small for the carried block.
+					if testCase.dstSize >= aesCipher.BlockSize() {
+						t.Fatal("no progress")
+					}
+					dst = make([]byte, aesCipher.BlockSize())
+					continue
+				}
+				result = append(result, dst[:produced]...)
+				src = src[consumed:]
+			}
+			if processor.Pending() != 8 {
+				t.Fatalf("unexpected pending length: %d != %d", processor.Pending(), 8)
+			}
+
+			final := make([]byte, aesCipher.BlockSize())
+			n, err := processor.Finish(final)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, final[:n]...)
+
+			if !bytes.Equal(result, expected) {
+				t.Fatal("processed data does not match CBC encryption")
+			}
+		})
+	}
+}
+
+func TestBlockProcessorFinish(t *testing.T) {
+	aesCipher, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+	dst := make([]byte, 32)
+
+	processor := cipherio.NewBlockProcessor(cipher.NewCBCEncrypter(aesCipher, iv), nil)
+	consumed, produced := processor.Process(dst, make([]byte, 20))
+	if consumed != 20 || produced != 16 {
+		t.Fatalf("unexpected progress: %d, %d != 20, 16", consumed, produced)
+	}
+	_, err = processor.Finish(dst)
+	expectedErr := cipherio.AlignmentError{Buffered: 4, Missing: 12}
+	if err != expectedErr {
+		t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected err: %v != %v", err, io.ErrUnexpectedEOF)
+	}
+
+	processor = cipherio.NewBlockProcessor(cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+	processor.Process(dst, make([]byte, 4))
+	_, err = processor.Finish(dst[:8])
+	if err != io.ErrShortBuffer {
+		t.Fatalf("unexpected err: %v != %v", err, io.ErrShortBuffer)
+	}
+	n, err := processor.Finish(dst)
+	if err != nil || n != 16 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	n, err = processor.Finish(dst)
+	if err != nil || n != 0 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+}
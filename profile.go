@@ -0,0 +1,50 @@
+package cipherio
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// WithProfiling tags the (en|de)cryption of blocks and the reads from the wrapped Reader with
+// pprof labels and runtime/trace regions, so that CPU profiles and execution traces of busy
+// servers separate the cost of encryption from the cost of transport, per stream.
+//
+// The given labels, as key-value pairs like pprof.Labels, are added to those of ctx, which is also
+// the parent of the trace regions. The "cipherio" label is set to "crypt" or "read" depending on
+// the operation, and regions are named "cipherio.crypt" and "cipherio.read".
+//
+// The labels of the calling goroutine are restored after each operation. Since this adds some
+// overhead to every call, it is meant to be enabled on demand.
+func WithProfiling(ctx context.Context, labels ...string) ReaderOption {
+	return func(o *readerOptions) {
+		o.profiler = newProfiler(ctx, labels)
+	}
+}
+
+// WithWriteProfiling is similar to WithProfiling, for writes to the wrapped Writer, which are
+// tagged as "write".
+func WithWriteProfiling(ctx context.Context, labels ...string) WriterOption {
+	return func(o *writerOptions) {
+		o.profiler = newProfiler(ctx, labels)
+	}
+}
+
+// profiler runs operations with pprof labels and within trace regions. It is nil unless enabled, in
+// which case callers run operations directly.
+type profiler struct {
+	ctx context.Context
+}
+
+func newProfiler(ctx context.Context, labels []string) *profiler {
+	return &profiler{
+		ctx: pprof.WithLabels(ctx, pprof.Labels(labels...)),
+	}
+}
+
+// do runs fn as the given operation.
+func (p *profiler) do(op string, fn func()) {
+	pprof.Do(p.ctx, pprof.Labels("cipherio", op), func(ctx context.Context) {
+		trace.WithRegion(ctx, "cipherio."+op, fn)
+	})
+}
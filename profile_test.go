@@ -0,0 +1,101 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// labelRecorder records the goroutine profile, which includes pprof labels, when the wrapped
+// Reader or Writer is called.
+type labelRecorder struct {
+	io.Reader
+	io.Writer
+	profile bytes.Buffer
+}
+
+func (r *labelRecorder) record() {
+	r.profile.Reset()
+	pprof.Lookup("goroutine").WriteTo(&r.profile, 1)
+}
+
+func (r *labelRecorder) Read(p []byte) (int, error) {
+	r.record()
+	return r.Reader.Read(p)
+}
+
+func (r *labelRecorder) Write(p []byte) (int, error) {
+	r.record()
+	return r.Writer.Write(p)
+}
+
+func TestProfiling(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	plaintext := make([]byte, 1000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("tenant", "acme"))
+
+	var encrypted bytes.Buffer
+	dst := &labelRecorder{Writer: &encrypted}
+	writer := cipherio.NewBlockWriterWithPadding(dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding, cipherio.WithWriteProfiling(ctx, "stream", "upload"))
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	for _, label := range []string{`"cipherio":"write"`, `"stream":"upload"`, `"tenant":"acme"`} {
+		if !strings.Contains(dst.profile.String(), label) {
+			t.Fatalf("missing label during write: %s", label)
+		}
+	}
+
+	src := &labelRecorder{Reader: &encrypted}
+	reader := cipherio.NewBlockReader(src, cipher.NewCBCDecrypter(aesCipher, iv), cipherio.WithProfiling(ctx, "stream", "download"))
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(decrypted[:len(plaintext)], plaintext) {
+		t.Fatal("decrypted data does not match")
+	}
+	for _, label := range []string{`"cipherio":"read"`, `"stream":"download"`, `"tenant":"acme"`} {
+		if !strings.Contains(src.profile.String(), label) {
+			t.Fatalf("missing label during read: %s", label)
+		}
+	}
+
+	// The labels of the goroutine are restored afterwards.
+	src.record()
+	if strings.Contains(src.profile.String(), `"cipherio":`) {
+		t.Fatal("labels were not restored")
+	}
+}
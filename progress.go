@@ -0,0 +1,92 @@
+package cipherio
+
+// WithProgress calls fn every time at least every bytes have been returned by Read since the
+// previous call, and once more when the end of the stream is reached. The done argument is the
+// total number of bytes returned so far.
+//
+// The callback is invoked synchronously from Read, so it must not block.
+func WithProgress(every int64, fn func(done int64)) ReaderOption {
+	return func(o *readerOptions) {
+		o.progressEvery = every
+		o.progressFn = fn
+	}
+}
+
+type progress struct {
+	every    int64
+	fn       func(done int64)
+	done     int64
+	reported int64
+	finished bool
+}
+
+func (p *progress) add(n int) {
+	if p.fn == nil || p.finished || n == 0 {
+		return
+	}
+	p.done += int64(n)
+	if p.done-p.reported >= p.every {
+		p.reported = p.done
+		p.fn(p.done)
+	}
+}
+
+func (p *progress) finish() {
+	if p.fn == nil || p.finished {
+		return
+	}
+	p.finished = true
+	if p.done != p.reported || p.done == 0 {
+		p.reported = p.done
+		p.fn(p.done)
+	}
+}
+
+// WithWriteProgress calls fn every time at least every bytes have been either accepted by Write
+// or flushed to the wrapped Writer since the previous call, and once more when Close succeeds.
+//
+// The accepted argument is the total number of plaintext bytes acknowledged by Write so far,
+// including those still buffered. The flushed argument is the total number of bytes successfully
+// written to the wrapped Writer so far.
+//
+// The callback is invoked synchronously from Write and Close, so it must not block.
+func WithWriteProgress(every int64, fn func(accepted, flushed int64)) WriterOption {
+	return func(o *writerOptions) {
+		o.progressEvery = every
+		o.progressFn = fn
+	}
+}
+
+type writeProgress struct {
+	every            int64
+	fn               func(accepted, flushed int64)
+	reportedAccepted int64
+	reportedFlushed  int64
+	finished         bool
+}
+
+func (p *writeProgress) update(accepted, flushed int64) {
+	if p.fn == nil || p.finished {
+		return
+	}
+	if accepted-p.reportedAccepted >= p.every || flushed-p.reportedFlushed >= p.every {
+		p.notify(accepted, flushed)
+	}
+}
+
+func (p *writeProgress) finish(accepted, flushed int64) {
+	if p.fn == nil || p.finished {
+		return
+	}
+	p.finished = true
+	p.notify(accepted, flushed)
+}
+
+func (p *writeProgress) notify(accepted, flushed int64) {
+	if accepted == p.reportedAccepted && flushed == p.reportedFlushed && accepted > 0 {
+		return
+	}
+	p.reportedAccepted = accepted
+	p.reportedFlushed = flushed
+	p.fn(accepted, flushed)
+}
@@ -0,0 +1,177 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type progressTest struct {
+	Name     string
+	DataLen  int
+	BufLen   int
+	Every    int64
+	Expected []int64
+}
+
+func TestProgress(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+
+	// Prepare test cases
+	testCases := []progressTest{
+		{
+			Name:     "EveryBlock",
+			DataLen:  64,
+			BufLen:   16,
+			Every:    16,
+			Expected: []int64{16, 32, 48, 64},
+		},
+		{
+			Name:     "EveryTwoBlocks",
+			DataLen:  80,
+			BufLen:   16,
+			Every:    32,
+			Expected: []int64{32, 64, 80},
+		},
+		{
+			Name:     "LargerThanStream",
+			DataLen:  48,
+			BufLen:   32,
+			Every:    1000,
+			Expected: []int64{48},
+		},
+		{
+			Name:     "SmallBuf",
+			DataLen:  32,
+			BufLen:   5,
+			Every:    10,
+			Expected: []int64{10, 20, 30, 32},
+		},
+		{
+			Name:     "EmptyStream",
+			DataLen:  0,
+			BufLen:   16,
+			Every:    16,
+			Expected: []int64{0},
+		},
+	}
+
+	// Run test cases
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			src := make([]byte, testCase.DataLen)
+			blockMode := cipher.NewCBCEncrypter(aesCipher, iv)
+
+			var reported []int64
+			reader := cipherio.NewBlockReader(&blockByBlockReader{src: src}, blockMode, cipherio.WithProgress(testCase.Every, func(done int64) {
+				reported = append(reported, done)
+			}))
+
+			buf := make([]byte, testCase.BufLen)
+			for {
+				_, err := reader.Read(buf)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if !reflect.DeepEqual(reported, testCase.Expected) {
+				t.Fatalf("unexpected progress: %v != %v", reported, testCase.Expected)
+			}
+
+			// Further reads must not report progress again.
+			_, _ = io.Copy(ioutil.Discard, reader)
+			if !reflect.DeepEqual(reported, testCase.Expected) {
+				t.Fatalf("unexpected progress after EOF: %v != %v", reported, testCase.Expected)
+			}
+		})
+	}
+}
+
+func TestWriteProgress(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	blockMode := cipher.NewCBCEncrypter(aesCipher, iv)
+
+	var reported [][2]int64
+	var dst bytes.Buffer
+	writer := cipherio.NewBlockWriterWithPadding(&dst, blockMode, cipherio.ZeroPadding, cipherio.WithWriteProgress(16, func(accepted, flushed int64) {
+		reported = append(reported, [2]int64{accepted, flushed})
+	}))
+
+	buf := make([]byte, 10)
+	for i := 0; i < 4; i++ {
+		_, err = writer.Write(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][2]int64{{20, 16}, {40, 32}, {40, 48}}
+	if !reflect.DeepEqual(reported, expected) {
+		t.Fatalf("unexpected progress: %v != %v", reported, expected)
+	}
+}
+
+// blockByBlockReader returns at most one block per Read, in order to generate several progress steps.
+type blockByBlockReader struct {
+	src []byte
+}
+
+func (r *blockByBlockReader) Read(p []byte) (int, error) {
+	if len(r.src) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) > 16 {
+		p = p[:16]
+	}
+	n := copy(p, r.src)
+	r.src = r.src[n:]
+	return n, nil
+}
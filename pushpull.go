@@ -0,0 +1,158 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrWouldBlock is returned by PushPull when an operation cannot progress until the other side
+// does: Write when the buffer is full, and Read when it is empty. Like EAGAIN, it is not terminal,
+// and the operation can be retried later.
+var ErrWouldBlock = errors.New("cipherio: operation would block")
+
+// PushPull (en|de)crypts data written to it into an internal ring buffer, from which the result is
+// read. Unlike Pipe, both sides are meant to be driven by the same goroutine, which suits event
+// loops that cannot spawn a goroutine per connection.
+//
+// The buffering of BlockProcessor applies: only complete blocks are (en|de)crypted, and the last
+// one is produced by Close. Data is copied at most once into the ring, except across its end.
+//
+// A PushPull is not safe for concurrent use.
+type PushPull struct {
+	proc      *BlockProcessor
+	blockSize int
+	ring      []byte
+	start     int // position of the first unread byte
+	length    int // number of unread bytes
+	scratch   []byte
+	closed    bool
+}
+
+// NewPushPull returns a PushPull (en|de)crypting with the given BlockMode and padding, as with
+// NewBlockProcessor, through a ring buffer of the given capacity, rounded up to the block size.
+func NewPushPull(blockMode cipher.BlockMode, padding Padding, capacity int) (*PushPull, error) {
+	blockSize := blockMode.BlockSize()
+	if capacity <= 0 {
+		return nil, fmt.Errorf("cipherio: invalid PushPull capacity: %d", capacity)
+	}
+	return &PushPull{
+		proc:      NewBlockProcessor(blockMode, padding),
+		blockSize: blockSize,
+		ring:      make([]byte, alignedSize(int64(capacity), int64(blockSize))),
+		scratch:   make([]byte, blockSize),
+	}, nil
+}
+
+// Write (en|de)crypts as much of p as the buffer can take. If p cannot be entirely consumed, the
+// number of bytes consumed is returned with ErrWouldBlock, and the rest must be written again
+// once some output has been read.
+func (pp *PushPull) Write(p []byte) (int, error) {
+	if pp.closed {
+		return 0, errors.New("cipherio: write to closed PushPull")
+	}
+
+	count := 0
+	for len(p) > 0 {
+		var consumed, produced int
+		if free := pp.contiguousFree(); len(free) >= pp.blockSize {
+			consumed, produced = pp.proc.Process(free, p)
+			pp.length += produced
+		} else if len(pp.ring)-pp.length >= pp.blockSize {
+			// The free space wraps around the end of the ring: produce one block aside.
+			consumed, produced = pp.proc.Process(pp.scratch, p)
+			pp.push(pp.scratch[:produced])
+		} else {
+			// Only an incomplete block can still be carried over.
+			consumed, produced = pp.proc.Process(nil, p)
+		}
+		p = p[consumed:]
+		count += consumed
+		if consumed == 0 && produced == 0 {
+			break
+		}
+	}
+	if len(p) > 0 {
+		return count, ErrWouldBlock
+	}
+	return count, nil
+}
+
+// Read reads (en|de)crypted data from the buffer. It returns ErrWouldBlock if the buffer is empty,
+// and io.EOF once it is empty after Close.
+func (pp *PushPull) Read(p []byte) (int, error) {
+	if pp.length == 0 {
+		if pp.closed {
+			return 0, io.EOF
+		}
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, ErrWouldBlock
+	}
+
+	count := 0
+	for len(p) > 0 && pp.length > 0 {
+		end := pp.start + pp.length
+		if end > len(pp.ring) {
+			end = len(pp.ring)
+		}
+		n := copy(p, pp.ring[pp.start:end])
+		p = p[n:]
+		count += n
+		pp.start = (pp.start + n) % len(pp.ring)
+		pp.length -= n
+	}
+	if pp.length == 0 {
+		pp.start = 0
+	}
+	return count, nil
+}
+
+// Close produces the last block, with padding if needed, after which Read returns io.EOF once the
+// buffer has been drained. ErrWouldBlock is returned if there is no room for the last block: Close
+// must then be called again once some output has been read. After that, Close becomes a no-op.
+func (pp *PushPull) Close() error {
+	if pp.closed {
+		return nil
+	}
+	if pp.proc.Pending() > 0 && len(pp.ring)-pp.length < pp.blockSize {
+		return ErrWouldBlock
+	}
+	n, err := pp.proc.Finish(pp.scratch)
+	if err != nil {
+		return err
+	}
+	pp.push(pp.scratch[:n])
+	pp.closed = true
+	return nil
+}
+
+// Buffered returns the number of bytes that can be read.
+func (pp *PushPull) Buffered() int {
+	return pp.length
+}
+
+// Available returns the number of bytes that can be produced into the buffer before writes block.
+func (pp *PushPull) Available() int {
+	return len(pp.ring) - pp.length
+}
+
+// contiguousFree returns the free space following the unread bytes, up to the end of the ring.
+func (pp *PushPull) contiguousFree() []byte {
+	end := pp.start + pp.length
+	if end >= len(pp.ring) {
+		return pp.ring[end-len(pp.ring) : pp.start]
+	}
+	return pp.ring[end:]
+}
+
+// push appends p to the unread bytes, wrapping around the end of the ring. There must be room.
+func (pp *PushPull) push(p []byte) {
+	for len(p) > 0 {
+		n := copy(pp.contiguousFree(), p)
+		p = p[n:]
+		pp.length += n
+	}
+}
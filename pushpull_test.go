@@ -0,0 +1,137 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	mathrand "math/rand"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestPushPull(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	plaintext := make([]byte, 10000+7)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := cipherio.EncryptBytes(nil, plaintext, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	for _, capacity := range []int{16, 50, 100, 4096} {
+		pp, err := cipherio.NewPushPull(cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding, capacity)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		// A single goroutine alternates between writes and reads of random sizes, like an event
+		// loop would.
+		random := mathrand.New(mathrand.NewSource(int64(capacity)))
+		var output []byte
+		buf := make([]byte, 200)
+		remaining := plaintext
+		for len(remaining) > 0 {
+			n := random.Intn(200)
+			if n > len(remaining) {
+				n = len(remaining)
+			}
+			written, err := pp.Write(remaining[:n])
+			if err != nil && err != cipherio.ErrWouldBlock {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrWouldBlock)
+			}
+			remaining = remaining[written:]
+
+			read, err := pp.Read(buf[:random.Intn(len(buf))+1])
+			if err != nil && err != cipherio.ErrWouldBlock {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrWouldBlock)
+			}
+			output = append(output, buf[:read]...)
+		}
+
+		for {
+			err = pp.Close()
+			if err != cipherio.ErrWouldBlock {
+				break
+			}
+			read, _ := pp.Read(buf)
+			output = append(output, buf[:read]...)
+		}
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		for {
+			read, err := pp.Read(buf)
+			output = append(output, buf[:read]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+		}
+
+		if !bytes.Equal(output, expected) {
+			t.Fatalf("capacity %d: encrypted data does not match", capacity)
+		}
+	}
+}
+
+func TestPushPullWouldBlock(t *testing.T) {
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp, err := cipherio.NewPushPull(cipher.NewCBCEncrypter(aesCipher, make([]byte, 16)), nil, 32)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	_, err = pp.Read(make([]byte, 16))
+	if err != cipherio.ErrWouldBlock {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrWouldBlock)
+	}
+
+	// Two blocks fill the buffer, a third incomplete one is carried over.
+	n, err := pp.Write(make([]byte, 50))
+	if err != cipherio.ErrWouldBlock || n != 32 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	n, err = pp.Write(make([]byte, 10))
+	if err != nil || n != 10 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	if pp.Buffered() != 32 || pp.Available() != 0 {
+		t.Fatalf("unexpected state: %d buffered, %d available", pp.Buffered(), pp.Available())
+	}
+
+	// Without padding, closing with 10 pending bytes fails.
+	_, err = pp.Read(make([]byte, 20))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = pp.Close()
+	if _, ok := err.(cipherio.AlignmentError); !ok {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
@@ -1,11 +1,22 @@
 package cipherio
 
 import (
+	"bytes"
 	"crypto/cipher"
+	"fmt"
 	"io"
+	"io/ioutil"
 )
 
-type blockReader struct {
+// BlockReader is the Reader returned by NewBlockReader and NewBlockReaderWithPadding.
+//
+// Errors are sticky: once Read has returned an error, including EOF, every subsequent call returns
+// the same error without reading from the wrapped Reader again. Bytes already (en|de)crypted are
+// still returned first. Retrying after a transient error thus requires a new BlockReader.
+//
+// A BlockReader is not safe for concurrent use: calls to its methods must be serialized, for
+// example with a SyncReader. Violations can be detected with WithConcurrencyCheck.
+type BlockReader struct {
 	src       io.Reader
 	blockMode cipher.BlockMode
 	padding   Padding
@@ -13,6 +24,14 @@ type blockReader struct {
 	buf       []byte // used to store remaining bytes (before or after crypting)
 	crypted   int    // if > 0, then buf contains remaining crypted bytes
 	err       error
+	offset    int64 // number of bytes returned so far
+	progress  progress
+	strict    bool
+	wipe      bool
+	profiler  *profiler
+	observers *streamObservers
+	stats     IOStats
+	guard     exclusiveGuard
 }
 
 // NewBlockReader wraps the given Reader to add on-the-fly encryption or decryption using the
@@ -31,16 +50,19 @@ type blockReader struct {
 // The wrapped Reader is guaranteed to never be consumed beyond the last requested block. This
 // means that it is safe to stop reading from this Reader at a block boundary and then resume
 // reading from the wrapped Reader for another purpose.
-func NewBlockReader(src io.Reader, blockMode cipher.BlockMode) io.Reader {
-	return NewBlockReaderWithPadding(src, blockMode, nil)
+//
+// Optional behaviours can be enabled with ReaderOption values, such as WithProgress.
+func NewBlockReader(src io.Reader, blockMode cipher.BlockMode, opts ...ReaderOption) *BlockReader {
+	return NewBlockReaderWithPadding(src, blockMode, nil, opts...)
 }
 
 // NewBlockReaderWithPadding is similar to NewBlockReader, except that any incomplete block is
 // filled with the given padding instead of returning ErrUnexpectedEOF.
-func NewBlockReaderWithPadding(src io.Reader, blockMode cipher.BlockMode, padding Padding) io.Reader {
+func NewBlockReaderWithPadding(src io.Reader, blockMode cipher.BlockMode, padding Padding, opts ...ReaderOption) *BlockReader {
 	blockSize := blockMode.BlockSize()
+	options := newReaderOptions(opts)
 
-	return &blockReader{
+	return &BlockReader{
 		src:       src,
 		blockMode: blockMode,
 		padding:   padding,
@@ -48,16 +70,49 @@ func NewBlockReaderWithPadding(src io.Reader, blockMode cipher.BlockMode, paddin
 		buf:       make([]byte, 0, blockSize),
 		crypted:   0,
 		err:       nil,
+		progress: progress{
+			every: options.progressEvery,
+			fn:    options.progressFn,
+		},
+		strict:    options.strict,
+		wipe:      options.wipe,
+		profiler:  options.profiler,
+		observers: observeStream(options.observers),
+		guard:     newExclusiveGuard(options.exclusive, "BlockReader", "SyncReader"),
 	}
 }
 
-func (r *blockReader) readCryptedBuf(p []byte) int {
+func (r *BlockReader) readCryptedBuf(p []byte) int {
 	n := copy(p, r.buf[r.blockSize-r.crypted:])
 	r.crypted -= n
 	return n
 }
 
-func (r *blockReader) Read(p []byte) (int, error) {
+func (r *BlockReader) Read(p []byte) (int, error) {
+	r.guard.acquire(methodRead)
+	defer r.guard.release()
+
+	n, err := r.read(p)
+	r.offset += int64(n)
+	r.checkInvariants()
+
+	// No buffered byte is needed anymore once an error is returned.
+	if err != nil && r.wipe {
+		wipeBytes(r.buf)
+	}
+
+	// Report progress once returned bytes have been counted.
+	r.progress.add(n)
+	if err == io.EOF {
+		r.progress.finish()
+		r.observers.end()
+	}
+	r.observers.fail(err)
+
+	return n, err
+}
+
+func (r *BlockReader) read(p []byte) (int, error) {
 	count := 0
 
 	// Read previously crypted bytes, even if an error has already been encountered. Stop early if
@@ -87,8 +142,11 @@ func (r *blockReader) Read(p []byte) (int, error) {
 	if len(p) < r.blockSize {
 		// The internal buffer may already contain some bytes, try to fill the rest with a single
 		// Read.
-		n, err := r.src.Read(r.buf[len(r.buf):r.blockSize])
+		n, err := r.readSrc(r.buf[len(r.buf):r.blockSize])
 		r.buf = r.buf[:len(r.buf)+n]
+		if n > 0 && len(r.buf) < r.blockSize {
+			r.stats.PartialBlocks++
+		}
 
 		// Apply padding if EOF is reached in the middle of a block.
 		if err == io.EOF && len(r.buf) < r.blockSize && r.padding != nil {
@@ -99,7 +157,9 @@ func (r *blockReader) Read(p []byte) (int, error) {
 		// Crypt the buffered block if complete, then fill the destination buffer with the first
 		// crypted bytes.
 		if len(r.buf) == r.blockSize {
-			r.blockMode.CryptBlocks(r.buf, r.buf)
+			if err := r.cryptBlocks(r.buf, r.buf); err != nil {
+				return count, err
+			}
 			r.crypted = r.blockSize
 			count += r.readCryptedBuf(p)
 		}
@@ -122,14 +182,19 @@ func (r *blockReader) Read(p []byte) (int, error) {
 	// Initialize the destination buffer with buffered bytes, then try to fill the rest with a
 	// single Read.
 	copy(p, r.buf)
-	n, err := r.src.Read(p[len(r.buf):])
+	n, err := r.readSrc(p[len(r.buf):])
 	available := len(r.buf) + n
 	exceeding := available % r.blockSize
 	cryptable := available - exceeding
+	if n > 0 && exceeding > 0 {
+		r.stats.PartialBlocks++
+	}
 
 	// Crypt all complete blocks.
 	if cryptable > 0 {
-		r.blockMode.CryptBlocks(p[:cryptable], p[:cryptable])
+		if err := r.cryptBlocks(p[:cryptable], p[:cryptable]); err != nil {
+			return count, err
+		}
 		p = p[cryptable:]
 		count += cryptable
 	}
@@ -156,7 +221,9 @@ func (r *blockReader) Read(p []byte) (int, error) {
 
 			// Crypt the padded block, then fill the rest of the destination buffer with the first
 			// crypted bytes.
-			r.blockMode.CryptBlocks(r.buf, r.buf)
+			if err := r.cryptBlocks(r.buf, r.buf); err != nil {
+				return count, err
+			}
 			r.crypted = r.blockSize
 			count += r.readCryptedBuf(p)
 
@@ -169,10 +236,167 @@ func (r *blockReader) Read(p []byte) (int, error) {
 			// Otherwise, apply padding to the destination buffer and crypt the padded block.
 			r.padding.Fill(p[exceeding:r.blockSize])
 			r.buf = r.buf[:0]
-			r.blockMode.CryptBlocks(p[:r.blockSize], p[:r.blockSize])
+			if err := r.cryptBlocks(p[:r.blockSize], p[:r.blockSize]); err != nil {
+				return count, err
+			}
 			count += r.blockSize
 		}
 	}
 
 	return count, err
 }
+
+// cryptBlocks crypts complete blocks, then checks for a failure of a FallibleBlockMode. Any error
+// is saved and discards buffered bytes.
+func (r *BlockReader) cryptBlocks(dst, src []byte) error {
+	if r.profiler == nil {
+		r.blockMode.CryptBlocks(dst, src)
+	} else {
+		r.profiler.do("crypt", func() {
+			r.blockMode.CryptBlocks(dst, src)
+		})
+	}
+	if err := blockModeErr(r.blockMode); err != nil {
+		r.err = err
+		r.buf = r.buf[:0]
+		r.crypted = 0
+		return err
+	}
+	r.observers.crypted(len(src))
+	return nil
+}
+
+// Stats returns statistics about the calls made so far to the wrapped Reader.
+func (r *BlockReader) Stats() IOStats {
+	return r.stats
+}
+
+// Offset returns the number of bytes returned by Read so far.
+func (r *BlockReader) Offset() int64 {
+	return r.offset
+}
+
+// Err returns the error that ended the stream, or nil if it has not ended or if EOF has been
+// reached. Once set, this is the error returned by Read after any remaining (en|de)crypted bytes.
+func (r *BlockReader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// SkipTo advances the Reader to the given offset, as returned by Offset.
+//
+// If the wrapped Reader implements io.Seeker and the BlockMode implements BlockModeSeeker, such as
+// the ones returned by NewSeekableCBCDecrypter and NewInsecureECBDecrypter, the wrapped Reader is
+// seeked to the block preceding offset, and the BlockMode is reinitialized from it. Only the
+// leading bytes of the block containing offset are then (en|de)crypted and discarded. Skipped
+// bytes are not reported to WithProgress. Seeks are relative to the current position, so the
+// wrapped Reader must not be moved by anything else than this Reader.
+//
+// Otherwise, all bytes in between are (en|de)crypted and discarded, and the wrapped Reader is
+// consumed accordingly.
+//
+// An error is returned if offset is behind the current position, and io.EOF is returned if the
+// end of the stream is reached before offset.
+func (r *BlockReader) SkipTo(offset int64) error {
+	if offset < r.offset {
+		return fmt.Errorf("cipherio: cannot skip backwards: %d < %d", offset, r.offset)
+	}
+
+	if err := r.seekBlock(offset / int64(r.blockSize)); err != nil {
+		return err
+	}
+	_, err := io.CopyN(ioutil.Discard, r, offset-r.offset)
+	return err
+}
+
+// seekBlock seeks the wrapped Reader to the start of the given block, if supported and beyond the
+// bytes already consumed. The BlockMode is reinitialized from the preceding block. Nothing is
+// done if the stream ends before.
+func (r *BlockReader) seekBlock(index int64) error {
+	r.guard.acquire(methodSkipTo)
+	defer r.guard.release()
+
+	seeker, ok := r.src.(io.Seeker)
+	if !ok || r.err != nil || index == 0 {
+		return nil
+	}
+	modeSeeker, ok := r.blockMode.(BlockModeSeeker)
+	if !ok {
+		return nil
+	}
+
+	// Bytes consumed from the wrapped Reader are either returned or buffered.
+	consumed := r.offset + int64(len(r.buf))
+	if r.crypted > 0 {
+		consumed = r.offset + int64(r.crypted)
+	}
+	target := index * int64(r.blockSize)
+	if target <= consumed {
+		return nil
+	}
+
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	start := current - consumed
+	if _, err := seeker.Seek(start+target-int64(r.blockSize), io.SeekStart); err != nil {
+		return err
+	}
+	prev := make([]byte, r.blockSize)
+	if _, err := io.ReadFull(r.src, prev); err != nil {
+		// The stream ends before: go back to let Read handle its end.
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			_, err = seeker.Seek(current, io.SeekStart)
+		}
+		return err
+	}
+
+	if r.wipe {
+		wipeBytes(r.buf)
+	}
+	r.blockMode = modeSeeker.SeekBlockMode(prev)
+	r.buf = r.buf[:0]
+	r.crypted = 0
+	r.offset = target
+	r.checkInvariants()
+	return nil
+}
+
+// ReaderFunc allows to implement the io.Reader interface with a read function, such as a callback
+// producing data from a C library or a decoder.
+type ReaderFunc func(p []byte) (int, error)
+
+// Read calls the function.
+func (f ReaderFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// NewBlockReaderFunc is similar to NewBlockReaderWithPadding, except that data is pulled from the
+// given function instead of a Reader. The function follows the io.Reader contract: it is called
+// with the buffer to fill, at most once per call to Read, and returns io.EOF at the end of the
+// data.
+func NewBlockReaderFunc(fn func(p []byte) (int, error), blockMode cipher.BlockMode, padding Padding, opts ...ReaderOption) *BlockReader {
+	return NewBlockReaderWithPadding(ReaderFunc(fn), blockMode, padding, opts...)
+}
+
+// NewBlockReaderWithPrefix is similar to NewBlockReaderWithPadding, except that the given prefix
+// is read before the wrapped Reader. This allows to hand over a stream whose first bytes have
+// already been consumed, for example by a protocol handshake, without losing them.
+//
+// A *bufio.Reader can be passed to NewBlockReader directly, since it returns its buffered bytes
+// first. To read from the underlying Reader instead, pass the buffered bytes as prefix:
+//
+//	prefix, _ := br.Peek(br.Buffered())
+//	r := cipherio.NewBlockReaderWithPrefix(prefix, conn, blockMode, nil)
+//
+// The prefix is not copied, and must not be modified until it has been entirely read. The
+// bufio.Reader must then no longer be used.
+func NewBlockReaderWithPrefix(prefix []byte, src io.Reader, blockMode cipher.BlockMode, padding Padding, opts ...ReaderOption) *BlockReader {
+	if len(prefix) > 0 {
+		src = io.MultiReader(bytes.NewReader(prefix), src)
+	}
+	return NewBlockReaderWithPadding(src, blockMode, padding, opts...)
+}
@@ -1,12 +1,14 @@
 package cipherio_test
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -591,3 +593,383 @@ func TestReader(t *testing.T) {
 		})
 	}
 }
+
+func TestReaderSkipTo(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 32*aesCipher.BlockSize())
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, len(originalBytes))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, originalBytes)
+
+	reader := cipherio.NewBlockReader(bytes.NewReader(originalBytes), cipher.NewCBCEncrypter(aesCipher, iv))
+
+	// Skip to the middle of a block, then read the rest of it.
+	err = reader.SkipTo(21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 11)
+	_, err = io.ReadFull(reader, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, expectedBytes[21:32]) {
+		t.Fatalf("unexpected read bytes")
+	}
+
+	// Skipping to the current offset is a no-op.
+	err = reader.SkipTo(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Offset() != 32 {
+		t.Fatalf("unexpected offset: %d != %d", reader.Offset(), 32)
+	}
+
+	// Skipping backwards is not allowed.
+	err = reader.SkipTo(16)
+	if err == nil {
+		t.Fatalf("unexpected success when skipping backwards")
+	}
+
+	// Skip several blocks at once.
+	err = reader.SkipTo(480)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = make([]byte, 32)
+	_, err = io.ReadFull(reader, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, expectedBytes[480:]) {
+		t.Fatalf("unexpected read bytes")
+	}
+
+	// Skipping beyond the end of the stream returns EOF.
+	err = reader.SkipTo(1000)
+	if err != io.EOF {
+		t.Fatalf("unexpected skip err: %v != %v", err, io.EOF)
+	}
+}
+
+// countingReadSeeker counts the bytes read from a ReadSeeker.
+type countingReadSeeker struct {
+	io.ReadSeeker
+	count int
+}
+
+func (r *countingReadSeeker) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	r.count += n
+	return n, err
+}
+
+func TestReaderSkipToSeek(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 64*aesCipher.BlockSize())
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(ciphertext, plaintext)
+	ecbDecrypter, err := cipherio.NewInsecureECBDecrypter(aesCipher)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	for name, blockMode := range map[string]func() cipher.BlockMode{
+		"CBC": func() cipher.BlockMode { return cipherio.NewSeekableCBCDecrypter(aesCipher, iv) },
+		"ECB": func() cipher.BlockMode { return ecbDecrypter },
+	} {
+		t.Run(name, func(t *testing.T) {
+			expected := plaintext
+			if name == "ECB" {
+				expected = make([]byte, len(ciphertext))
+				ecbDecrypter.CryptBlocks(expected, ciphertext)
+			}
+
+			// The wrapped Reader starts after a header, which must not be taken into account.
+			src := bytes.NewReader(append([]byte("header"), ciphertext...))
+			src.Seek(6, io.SeekStart)
+			counting := &countingReadSeeker{ReadSeeker: src}
+			reader := cipherio.NewBlockReader(counting, blockMode())
+
+			buf := make([]byte, 20)
+			_, err = io.ReadFull(reader, buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Only the preceding block and the leading bytes of the target block are read.
+			counting.count = 0
+			err = reader.SkipTo(500)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if counting.count != 32 {
+				t.Fatalf("unexpected read count: %d != %d", counting.count, 32)
+			}
+			if reader.Offset() != 500 {
+				t.Fatalf("unexpected offset: %d != %d", reader.Offset(), 500)
+			}
+
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if !bytes.Equal(result, expected[500:]) {
+				t.Fatalf("unexpected read bytes")
+			}
+		})
+	}
+
+	t.Run("EOF", func(t *testing.T) {
+		reader := cipherio.NewBlockReader(bytes.NewReader(ciphertext), cipherio.NewSeekableCBCDecrypter(aesCipher, iv))
+		err := reader.SkipTo(2000)
+		if err != io.EOF {
+			t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+		}
+		if reader.Offset() != int64(len(ciphertext)) {
+			t.Fatalf("unexpected offset: %d != %d", reader.Offset(), len(ciphertext))
+		}
+	})
+}
+
+func TestReaderStickyError(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	transientErr := fmt.Errorf("transient error")
+
+	t.Run("Large", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		// The wrapped Reader must not be called again after the error.
+		mock := mocks.NewMockReader(mockCtrl)
+		mock.EXPECT().Read(gomock.Len(64)).Return(20, transientErr)
+
+		reader := cipherio.NewBlockReader(mock, cipher.NewCBCDecrypter(aesCipher, iv))
+		if reader.Err() != nil {
+			t.Fatalf("unexpected err: %v != %v", reader.Err(), nil)
+		}
+
+		buf := make([]byte, 64)
+		n, err := reader.Read(buf)
+		if n != 16 || err != transientErr {
+			t.Fatalf("unexpected result: (%d, %v) != (%d, %v)", n, err, 16, transientErr)
+		}
+		for i := 0; i < 3; i++ {
+			n, err = reader.Read(buf)
+			if n != 0 || err != transientErr {
+				t.Fatalf("unexpected result: (%d, %v) != (%d, %v)", n, err, 0, transientErr)
+			}
+		}
+		if reader.Err() != transientErr {
+			t.Fatalf("unexpected err: %v != %v", reader.Err(), transientErr)
+		}
+	})
+
+	t.Run("Buffered", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mock := mocks.NewMockReader(mockCtrl)
+		mock.EXPECT().Read(gomock.Len(16)).Return(16, transientErr)
+
+		reader := cipherio.NewBlockReader(mock, cipher.NewCBCDecrypter(aesCipher, iv))
+
+		// Crypted bytes are returned before the error, which is already reported by Err.
+		buf := make([]byte, 5)
+		n, err := reader.Read(buf)
+		if n != 5 || err != nil {
+			t.Fatalf("unexpected result: (%d, %v) != (%d, %v)", n, err, 5, nil)
+		}
+		if reader.Err() != transientErr {
+			t.Fatalf("unexpected err: %v != %v", reader.Err(), transientErr)
+		}
+
+		buf = make([]byte, 64)
+		n, err = reader.Read(buf)
+		if n != 11 || err != transientErr {
+			t.Fatalf("unexpected result: (%d, %v) != (%d, %v)", n, err, 11, transientErr)
+		}
+		n, err = reader.Read(buf)
+		if n != 0 || err != transientErr {
+			t.Fatalf("unexpected result: (%d, %v) != (%d, %v)", n, err, 0, transientErr)
+		}
+	})
+
+	t.Run("EOF", func(t *testing.T) {
+		reader := cipherio.NewBlockReader(bytes.NewReader(nil), cipher.NewCBCDecrypter(aesCipher, iv))
+		if _, err := reader.Read(make([]byte, 16)); err != io.EOF {
+			t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+		}
+		if reader.Err() != nil {
+			t.Fatalf("unexpected err: %v != %v", reader.Err(), nil)
+		}
+	})
+}
+
+func TestBlockReaderFunc(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	plaintext := make([]byte, 1000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := cipherio.EncryptBytes(nil, plaintext, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// The callback produces data in small, unaligned pieces, like a decoder would.
+	remaining := plaintext
+	calls := 0
+	produce := func(p []byte) (int, error) {
+		calls++
+		if len(remaining) == 0 {
+			return 0, io.EOF
+		}
+		if len(p) > 7 {
+			p = p[:7]
+		}
+		n := copy(p, remaining)
+		remaining = remaining[n:]
+		return n, nil
+	}
+
+	reader := cipherio.NewBlockReaderFunc(produce, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+	encrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(encrypted, expected) {
+		t.Fatal("encrypted data does not match")
+	}
+	if calls == 0 {
+		t.Fatal("callback was not called")
+	}
+}
+
+func TestBlockReaderWithPrefix(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	plaintext := make([]byte, 1000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := cipherio.EncryptBytes(nil, plaintext, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// A handshake line precedes the encrypted data, and is read through a bufio.Reader which
+	// buffers more than the line.
+	stream := append([]byte("HELLO\n"), encrypted...)
+
+	for _, prefixLen := range []int{0, 5, 16, 100} {
+		src := bytes.NewReader(stream)
+		br := bufio.NewReaderSize(src, 16)
+		line, err := br.ReadString('\n')
+		if err != nil || line != "HELLO\n" {
+			t.Fatalf("unexpected result: (%q, %v)", line, err)
+		}
+		if _, err := br.Peek(prefixLen); err != nil && prefixLen <= 16 {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+
+		prefix, err := br.Peek(br.Buffered())
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		reader := cipherio.NewBlockReaderWithPrefix(prefix, src, cipher.NewCBCDecrypter(aesCipher, iv), nil)
+		decrypted, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(decrypted[:len(plaintext)], plaintext) {
+			t.Fatalf("prefix %d: decrypted data does not match", prefixLen)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"errors"
+	"hash"
+	"io"
+)
+
+// ErrAuthentication is returned by Reencrypt when the MAC of the source does not match, and by
+// MessageReader when a frame fails verification.
+var ErrAuthentication = errors.New("cipherio: message authentication failed")
+
+// DecryptSetup describes how Reencrypt decrypts its source.
+type DecryptSetup struct {
+	// BlockMode decrypts the source, which must be aligned to its block size.
+	BlockMode cipher.BlockMode
+
+	// PlaintextLen is the number of bytes before padding, or -1 if unknown. When known, the padding
+	// is removed before re-encryption, and the length of the source is checked against
+	// EncryptedSize(PlaintextLen, blockSize, Padding). Otherwise, any padding is re-encrypted as
+	// data.
+	PlaintextLen int64
+	Padding      Padding
+
+	// MAC, if not nil, is computed over the source ciphertext, which is then authenticated against
+	// ExpectedMAC, as in encrypt-then-MAC schemes.
+	MAC         hash.Hash
+	ExpectedMAC []byte
+}
+
+// EncryptSetup describes how Reencrypt encrypts its destination.
+type EncryptSetup struct {
+	// BlockMode encrypts the destination. Any incomplete block is filled with Padding, or leads to
+	// an AlignmentError if Padding is nil.
+	BlockMode cipher.BlockMode
+	Padding   Padding
+
+	// MAC, if not nil, is computed over the destination ciphertext. Its Sum is to be stored
+	// alongside the destination once Reencrypt succeeds.
+	MAC hash.Hash
+
+	// WriterOptions configure the BlockWriter encrypting the destination.
+	WriterOptions []WriterOption
+}
+
+// ReencryptOptions configures Reencrypt. The zero value is valid.
+type ReencryptOptions struct {
+	// BufferSize is the size of the buffer shared by decryption and encryption. Defaults to 32 KiB.
+	BufferSize int
+}
+
+// defaultReencryptBufferSize is the buffer size used by Reencrypt if none is given.
+const defaultReencryptBufferSize = 32 << 10
+
+// Reencrypt decrypts src as described by decryptSetup, and encrypts the result to dst as described
+// by encryptSetup, in a single streaming pass. Data is decrypted into a single buffer, from which
+// it is encrypted, so that plaintext never leaves memory. This suits key rotation jobs. It returns
+// the number of bytes written to dst.
+//
+// When a source MAC is given, it is verified once the whole source has been read, since data is
+// streamed: ErrAuthentication is then returned, and dst must be discarded, like on any other
+// error. Writing to a temporary location renamed on success is recommended.
+func Reencrypt(dst io.Writer, src io.Reader, decryptSetup DecryptSetup, encryptSetup EncryptSetup, opts ReencryptOptions) (int64, error) {
+	if err := checkPolicy("Reencrypt without MAC", true, decryptSetup.MAC != nil && encryptSetup.MAC != nil); err != nil {
+		return 0, err
+	}
+	if decryptSetup.MAC != nil {
+		src = io.TeeReader(src, decryptSetup.MAC)
+	}
+	var reader io.Reader = NewBlockReader(src, decryptSetup.BlockMode)
+	if decryptSetup.PlaintextLen >= 0 {
+		size := EncryptedSize(decryptSetup.PlaintextLen, decryptSetup.BlockMode.BlockSize(), decryptSetup.Padding)
+		if size < 0 {
+			return 0, ErrLengthMismatch
+		}
+		reader = &exactReader{
+			src:       reader,
+			remaining: decryptSetup.PlaintextLen,
+			trailing:  size - decryptSetup.PlaintextLen,
+		}
+	}
+
+	out := dst
+	if encryptSetup.MAC != nil {
+		out = io.MultiWriter(dst, encryptSetup.MAC)
+	}
+	writer := NewBlockWriterWithPadding(out, encryptSetup.BlockMode, encryptSetup.Padding, encryptSetup.WriterOptions...)
+
+	bufSize := opts.BufferSize
+	if bufSize <= 0 {
+		bufSize = defaultReencryptBufferSize
+	}
+	buf := make([]byte, bufSize)
+	defer wipeBytes(buf)
+
+	// Hide the ReadFrom and WriteTo methods, if any, so that the shared buffer is always used.
+	_, err := io.CopyBuffer(struct{ io.Writer }{writer}, struct{ io.Reader }{reader}, buf)
+	if err != nil {
+		writer.Close()
+		return writer.Written(), err
+	}
+	if err := writer.Close(); err != nil {
+		return writer.Written(), err
+	}
+
+	if decryptSetup.MAC != nil && !EqualTags(decryptSetup.MAC.Sum(nil), decryptSetup.ExpectedMAC) {
+		return writer.Written(), ErrAuthentication
+	}
+	return writer.Written(), nil
+}
@@ -0,0 +1,107 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestReencrypt(t *testing.T) {
+	// Generate random AES keys, IVs and MAC keys
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	oldKey, newKey := random(32), random(32)
+	oldIV, newIV := random(aes.BlockSize), random(aes.BlockSize)
+	oldMACKey, newMACKey := random(32), random(32)
+
+	// Initialize the AES ciphers
+	oldCipher, err := aes.NewCipher(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCipher, err := aes.NewCipher(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := random(1000)
+
+	// Encrypt-then-MAC with the old key.
+	var source bytes.Buffer
+	writer := cipherio.NewBlockWriterWithPadding(&source, cipher.NewCBCEncrypter(oldCipher, oldIV), cipherio.PKCS7Padding)
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldMAC := hmac.New(sha256.New, oldMACKey)
+	oldMAC.Write(source.Bytes())
+	expectedMAC := oldMAC.Sum(nil)
+
+	reencrypt := func(src []byte, plaintextLen int64) ([]byte, []byte, error) {
+		var dst bytes.Buffer
+		newMAC := hmac.New(sha256.New, newMACKey)
+		_, err := cipherio.Reencrypt(&dst, bytes.NewReader(src), cipherio.DecryptSetup{
+			BlockMode:    cipher.NewCBCDecrypter(oldCipher, oldIV),
+			PlaintextLen: plaintextLen,
+			Padding:      cipherio.PKCS7Padding,
+			MAC:          hmac.New(sha256.New, oldMACKey),
+			ExpectedMAC:  expectedMAC,
+		}, cipherio.EncryptSetup{
+			BlockMode: cipher.NewCBCEncrypter(newCipher, newIV),
+			Padding:   cipherio.PKCS7Padding,
+			MAC:       newMAC,
+		}, cipherio.ReencryptOptions{BufferSize: 100})
+		return dst.Bytes(), newMAC.Sum(nil), err
+	}
+
+	result, resultMAC, err := reencrypt(source.Bytes(), int64(len(plaintext)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, newMACKey)
+	mac.Write(result)
+	if !hmac.Equal(mac.Sum(nil), resultMAC) {
+		t.Fatal("unexpected MAC of the destination")
+	}
+	decrypted, err := ioutil.ReadAll(cipherio.NewBlockReader(bytes.NewReader(result), cipher.NewCBCDecrypter(newCipher, newIV)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted[:len(plaintext)], plaintext) {
+		t.Fatal("re-encrypted data does not match plaintext")
+	}
+	if len(decrypted) != 1008 {
+		t.Fatalf("unexpected padded length: %d != %d", len(decrypted), 1008)
+	}
+
+	// Tampered source.
+	tampered := append([]byte(nil), source.Bytes()...)
+	tampered[500] ^= 1
+	_, _, err = reencrypt(tampered, int64(len(plaintext)))
+	if err != cipherio.ErrAuthentication {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrAuthentication)
+	}
+
+	// Wrong length.
+	_, _, err = reencrypt(source.Bytes(), 900)
+	if err != cipherio.ErrLengthMismatch {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrLengthMismatch)
+	}
+}
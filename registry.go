@@ -0,0 +1,81 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"sync"
+)
+
+// Block ciphers with reserved IDs, whose implementations are not provided by this package. They
+// must be registered with RegisterCipher before use, so that applications agree on their IDs
+// without cipherio importing third-party implementations.
+const (
+	CipherSM4      CipherID = 2
+	CipherCamellia CipherID = 3
+	CipherARIA     CipherID = 4
+	CipherSEED     CipherID = 5
+)
+
+// NewCipherFunc creates a block cipher from a key, like aes.NewCipher.
+type NewCipherFunc func(key []byte) (cipher.Block, error)
+
+type registeredCipher struct {
+	name      string
+	newCipher NewCipherFunc
+}
+
+var (
+	ciphersMu sync.RWMutex
+	ciphers   = map[CipherID]registeredCipher{
+		CipherAES: {"AES", newAESCipher},
+	}
+)
+
+// RegisterCipher makes a block cipher available under the given ID, so that StreamHeader and the
+// functions of this package relying on it can instantiate it. It is typically called from an init
+// function of the application, or of a package providing the implementation. Implementations
+// can be checked beforehand with cipheriovectors.TestBlockAdapter.
+//
+// RegisterCipher panics if newCipher is nil or if the ID is already registered, including
+// CipherAES, which is always available.
+func RegisterCipher(id CipherID, name string, newCipher NewCipherFunc) {
+	if newCipher == nil {
+		panic("cipherio: RegisterCipher with a nil function")
+	}
+
+	ciphersMu.Lock()
+	defer ciphersMu.Unlock()
+
+	if registered, ok := ciphers[id]; ok {
+		panic(fmt.Sprintf("cipherio: cipher ID %d already registered as %s", id, registered.name))
+	}
+	ciphers[id] = registeredCipher{name, newCipher}
+}
+
+// NewCipher creates the block cipher identified by id with the given key. An error is returned if
+// no cipher has been registered under this ID.
+func (id CipherID) NewCipher(key []byte) (cipher.Block, error) {
+	ciphersMu.RLock()
+	registered, ok := ciphers[id]
+	ciphersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("cipherio: unknown cipher ID: %d", id)
+	}
+	if err := checkPolicy(registered.name, id == CipherAES, true); err != nil {
+		return nil, err
+	}
+	return registered.newCipher(key)
+}
+
+// String returns the registered name of the cipher, or its numeric value if unknown.
+func (id CipherID) String() string {
+	ciphersMu.RLock()
+	registered, ok := ciphers[id]
+	ciphersMu.RUnlock()
+
+	if !ok {
+		return fmt.Sprintf("CipherID(%d)", uint8(id))
+	}
+	return registered.name
+}
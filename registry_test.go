@@ -0,0 +1,140 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// reversedCipher is a toy block cipher, registered to check that headers use the registry.
+type reversedCipher struct {
+	cipher.Block
+}
+
+func (c reversedCipher) Encrypt(dst, src []byte) {
+	c.Block.Encrypt(dst, src)
+	for i, j := 0, len(dst)-1; i < j; i, j = i+1, j-1 {
+		dst[i], dst[j] = dst[j], dst[i]
+	}
+}
+
+func (c reversedCipher) Decrypt(dst, src []byte) {
+	reversed := make([]byte, len(src))
+	for i := range src {
+		reversed[len(src)-1-i] = src[i]
+	}
+	c.Block.Decrypt(dst, reversed)
+}
+
+const cipherReversed cipherio.CipherID = 200
+
+func init() {
+	cipherio.RegisterCipher(cipherReversed, "Reversed", func(key []byte) (cipher.Block, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return reversedCipher{block}, nil
+	})
+}
+
+func TestRegisterCipher(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 100)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(id cipherio.CipherID) []byte {
+		t.Helper()
+		header := cipherio.StreamHeader{
+			Cipher:       id,
+			Mode:         cipherio.ModeCBC,
+			Padding:      cipherio.PaddingPKCS7,
+			IV:           iv,
+			PlaintextLen: int64(len(plaintext)),
+		}
+		var encrypted bytes.Buffer
+		writer, err := cipherio.NewStreamWriter(&encrypted, &header, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encrypted.Bytes()
+	}
+
+	encrypted := encrypt(cipherReversed)
+	if bytes.Equal(encrypted, encrypt(cipherio.CipherAES)) {
+		t.Fatal("the registered cipher has not been used")
+	}
+
+	reader, header, err := cipherio.NewStreamReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Cipher != cipherReversed {
+		t.Fatalf("unexpected cipher: %v != %v", header.Cipher, cipherReversed)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatal("decrypted data does not match plaintext")
+	}
+}
+
+func TestCipherIDString(t *testing.T) {
+	testCases := []struct {
+		id       cipherio.CipherID
+		expected string
+	}{
+		{cipherio.CipherAES, "AES"},
+		{cipherReversed, "Reversed"},
+		{cipherio.CipherSM4, "CipherID(2)"},
+	}
+	for _, testCase := range testCases {
+		if testCase.id.String() != testCase.expected {
+			t.Fatalf("unexpected name: %s != %s", testCase.id.String(), testCase.expected)
+		}
+	}
+
+	_, err := cipherio.CipherSM4.NewCipher(make([]byte, 16))
+	if err == nil {
+		t.Fatal("expected an error for an unregistered cipher")
+	}
+}
+
+func TestRegisterCipherTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	cipherio.RegisterCipher(cipherio.CipherAES, "AES", aes.NewCipher)
+}
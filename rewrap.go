@@ -0,0 +1,96 @@
+package cipherio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Rewrap unwraps the data key of the given envelope header with the current recipient, then
+// replaces all slots by the data key wrapped for the new recipients. The data key, and therefore
+// any key commitment, is left unchanged.
+//
+// This allows to rotate KEKs, or to change the recipients of an envelope, without decrypting and
+// encrypting its body again. See also RewrapTo and RewrapInPlace.
+//
+// The slots are wrapped with random bytes read from rand, or from crypto/rand.Reader if nil.
+func (h *StreamHeader) Rewrap(ctx context.Context, rand io.Reader, current Recipient, recipients []Recipient) error {
+	if len(recipients) == 0 {
+		return errors.New("cipherio: envelope requires at least one recipient")
+	}
+
+	dataKey, err := h.UnwrapKeyContext(ctx, current)
+	if err != nil {
+		return err
+	}
+	slots, err := wrapRecipients(ctx, randOrDefault(rand), recipients, dataKey)
+	if err != nil {
+		return err
+	}
+	h.Recipients = slots
+	return nil
+}
+
+// RewrapTo copies the envelope read from src to dst, with its header rewrapped like
+// StreamHeader.Rewrap. The body is copied as is. It returns the number of bytes written to dst.
+//
+// Unknown header fields, written by a newer version of this package, are not preserved.
+func RewrapTo(ctx context.Context, dst io.Writer, src io.Reader, current Recipient, recipients []Recipient) (int64, error) {
+	header, err := ReadStreamHeader(src)
+	if err != nil {
+		return 0, err
+	}
+	if err := header.Rewrap(ctx, nil, current, recipients); err != nil {
+		return 0, err
+	}
+
+	data, err := header.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	n, err := dst.Write(data)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	copied, err := io.Copy(dst, src)
+	return written + copied, err
+}
+
+// RewrapInPlace rewrites the header found at the start of the given file, rewrapped like
+// StreamHeader.Rewrap. The body is left untouched.
+//
+// Since the body cannot be moved, the new header must be exactly as long as the current one. This
+// holds when each slot is replaced by a slot with a key ID of the same length, wrapped with the
+// same kind of KEK. Otherwise, an error is returned and nothing is written.
+func RewrapInPlace(ctx context.Context, file interface {
+	io.ReaderAt
+	io.WriterAt
+}, current Recipient, recipients []Recipient) error {
+	section := io.NewSectionReader(file, 0, math.MaxInt64)
+	header, err := ReadStreamHeader(section)
+	if err != nil {
+		return err
+	}
+	headerLen, err := section.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if err := header.Rewrap(ctx, nil, current, recipients); err != nil {
+		return err
+	}
+	data, err := header.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != headerLen {
+		return fmt.Errorf("cipherio: rewrapped header length must equal current length: %d != %d", len(data), headerLen)
+	}
+
+	_, err = file.WriteAt(data, 0)
+	return err
+}
@@ -0,0 +1,170 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestRewrap(t *testing.T) {
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	dataKey := randomBytes(32)
+	oldRecipient := cipherio.Recipient{KeyID: []byte("key-2019"), KEK: randomBytes(32)}
+	newRecipient := cipherio.Recipient{KeyID: []byte("key-2020"), KEK: randomBytes(32)}
+	plaintext := randomBytes(1000)
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           randomBytes(aes.BlockSize),
+		PlaintextLen: int64(len(plaintext)),
+	}
+	header.SetCommitment(dataKey)
+
+	var envelope bytes.Buffer
+	writer, err := cipherio.NewEnvelopeWriter(&envelope, &header, dataKey, []cipherio.Recipient{oldRecipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checkEnvelope verifies that the envelope can only be decrypted by the new recipient.
+	checkEnvelope := func(t *testing.T, data []byte) {
+		reader, _, err := cipherio.NewEnvelopeReader(bytes.NewReader(data), newRecipient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatalf("unexpected decrypted bytes")
+		}
+
+		_, _, err = cipherio.NewEnvelopeReader(bytes.NewReader(data), oldRecipient)
+		if err != cipherio.ErrNoRecipient {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNoRecipient)
+		}
+	}
+
+	t.Run("Rand", func(t *testing.T) {
+		// The slot nonce is read from the given random source.
+		rewrapped, err := cipherio.ReadStreamHeader(bytes.NewReader(envelope.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce := bytes.Repeat([]byte{42}, 64)
+		err = rewrapped.Rewrap(context.Background(), bytes.NewReader(nonce), oldRecipient, []cipherio.Recipient{newRecipient})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wrapped := rewrapped.Recipients[0].WrappedKey; !bytes.HasPrefix(wrapped, nonce[:12]) {
+			t.Fatalf("unexpected nonce: %x", wrapped[:12])
+		}
+
+		expectedErr := errors.New("rand failed")
+		err = rewrapped.Rewrap(context.Background(), &failingReader{err: expectedErr}, newRecipient, []cipherio.Recipient{newRecipient})
+		if err != expectedErr {
+			t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+		}
+	})
+
+	t.Run("RewrapTo", func(t *testing.T) {
+		var dst bytes.Buffer
+		n, err := cipherio.RewrapTo(context.Background(), &dst, bytes.NewReader(envelope.Bytes()), oldRecipient, []cipherio.Recipient{newRecipient})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(dst.Len()) {
+			t.Fatalf("unexpected written length: %d != %d", n, dst.Len())
+		}
+		checkEnvelope(t, dst.Bytes())
+	})
+
+	t.Run("RewrapInPlace", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "cipherio")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		_, err = file.Write(envelope.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cipherio.RewrapInPlace(context.Background(), file, oldRecipient, []cipherio.Recipient{newRecipient})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != envelope.Len() {
+			t.Fatalf("unexpected file length: %d != %d", len(data), envelope.Len())
+		}
+		checkEnvelope(t, data)
+	})
+
+	t.Run("RewrapInPlaceLengthChanged", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "cipherio")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		_, err = file.Write(envelope.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Adding a recipient makes the header longer.
+		err = cipherio.RewrapInPlace(context.Background(), file, oldRecipient, []cipherio.Recipient{oldRecipient, newRecipient})
+		if err == nil {
+			t.Fatal("longer header accepted")
+		}
+
+		data, err := ioutil.ReadFile(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, envelope.Bytes()) {
+			t.Fatalf("file modified despite the error")
+		}
+	})
+
+	t.Run("WrongRecipient", func(t *testing.T) {
+		_, err := cipherio.RewrapTo(context.Background(), ioutil.Discard, bytes.NewReader(envelope.Bytes()), newRecipient, []cipherio.Recipient{newRecipient})
+		if err != cipherio.ErrNoRecipient {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrNoRecipient)
+		}
+	})
+}
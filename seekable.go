@@ -0,0 +1,211 @@
+package cipherio
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SeekableReader decrypts CBC data with random access. It implements io.Reader, io.ReaderAt,
+// io.Seeker and io.Closer, as expected by http.ServeContent and most storage SDKs.
+//
+// This relies on each CBC block only depending on the previous ciphertext block, so that any
+// offset can be decrypted without reading what precedes it.
+//
+// Like BlockReader, a SeekableReader is not safe for concurrent use, except for ReadAt.
+type SeekableReader struct {
+	src    io.ReaderAt
+	block  cipher.Block
+	iv     []byte
+	size   int64
+	offset int64
+}
+
+// seekableChunkSize is the maximum number of bytes decrypted at once by ReadAt.
+const seekableChunkSize = 32 << 10
+
+// NewSeekableReader returns a SeekableReader decrypting src with the given block cipher in CBC
+// mode, starting with the given IV.
+//
+// The size is the number of plaintext bytes, which is also returned by Size. Any padding beyond it
+// is ignored. ErrLengthMismatch is returned by reads if src is shorter.
+func NewSeekableReader(src io.ReaderAt, block cipher.Block, iv []byte, size int64) (*SeekableReader, error) {
+	if err := checkPolicy("CBC", true, false); err != nil {
+		return nil, err
+	}
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("cipherio: invalid size: %d", size)
+	}
+	return &SeekableReader{
+		src:   src,
+		block: block,
+		iv:    append([]byte(nil), iv...),
+		size:  size,
+	}, nil
+}
+
+// NewStreamReadSeekCloser reads a stream header from the start of src, then returns a
+// SeekableReader decrypting the rest of the stream, along with the header. Offsets are relative
+// to the start of the plaintext.
+//
+// The header must specify the plaintext length and hold a key commitment, see SetCommitment.
+// Closing the SeekableReader closes src if it implements io.Closer.
+func NewStreamReadSeekCloser(src io.ReaderAt, key []byte) (*SeekableReader, *StreamHeader, error) {
+	section := io.NewSectionReader(src, 0, 1<<63-1)
+	header, err := ReadStreamHeader(section)
+	if err != nil {
+		return nil, nil, err
+	}
+	headerLen, err := section.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if header.Mode != ModeCBC {
+		return nil, nil, fmt.Errorf("cipherio: random access requires CBC mode: %d", header.Mode)
+	}
+	if header.PlaintextLen < 0 {
+		return nil, nil, errors.New("cipherio: random access requires a known plaintext length")
+	}
+	if err := header.checkCommitment(key, true); err != nil {
+		return nil, nil, err
+	}
+	block, err := header.newBlock(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := NewSeekableReader(&offsetReaderAt{src: src, offset: headerLen}, block, header.IV, header.PlaintextLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, header, nil
+}
+
+// Size returns the number of plaintext bytes.
+func (r *SeekableReader) Size() int64 {
+	return r.size
+}
+
+func (r *SeekableReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker. Seeking beyond the end is allowed, subsequent reads then return EOF.
+func (r *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("cipherio: invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("cipherio: negative offset: %d", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("cipherio: negative offset: %d", off)
+	}
+
+	count := 0
+	for len(p) > 0 {
+		if off >= r.size {
+			return count, io.EOF
+		}
+		chunk := p
+		if int64(len(chunk)) > r.size-off {
+			chunk = chunk[:r.size-off]
+		}
+		if len(chunk) > seekableChunkSize {
+			chunk = chunk[:seekableChunkSize]
+		}
+
+		n, err := r.readChunk(chunk, off)
+		count += n
+		if err != nil {
+			return count, err
+		}
+		p = p[n:]
+		off += int64(n)
+	}
+	return count, nil
+}
+
+// readChunk decrypts len(p) bytes at off into p.
+func (r *SeekableReader) readChunk(p []byte, off int64) (int, error) {
+	if err := decryptCBCRange(p, r.src, 0, r.block, r.iv, off); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// decryptCBCRange decrypts len(dst) plaintext bytes at the given position of the CBC ciphertext
+// stored at offset in src, whose first block is chained to iv. Only the blocks covering the range
+// are read, along with the previous ciphertext block, since each CBC block only depends on it.
+// ErrLengthMismatch is returned if src is too short.
+func decryptCBCRange(dst []byte, src io.ReaderAt, offset int64, block cipher.Block, iv []byte, pos int64) error {
+	blockSize := int64(block.BlockSize())
+	first := pos / blockSize * blockSize
+	last := alignedSize(pos+int64(len(dst)), blockSize)
+
+	// Read the previous ciphertext block, if any, followed by the covered blocks.
+	prevLen := int64(0)
+	if first > 0 {
+		prevLen = blockSize
+	}
+	buf := make([]byte, prevLen+last-first)
+	if n, err := src.ReadAt(buf, offset+first-prevLen); n < len(buf) {
+		if err == io.EOF || err == nil {
+			err = ErrLengthMismatch
+		}
+		return err
+	}
+
+	if prevLen > 0 {
+		iv = buf[:prevLen]
+	}
+	blocks := buf[prevLen:]
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(blocks, blocks)
+
+	copy(dst, blocks[pos-first:])
+	return nil
+}
+
+// Close closes the wrapped ReaderAt if it implements io.Closer.
+func (r *SeekableReader) Close() error {
+	src := r.src
+	if offset, ok := src.(*offsetReaderAt); ok {
+		src = offset.src
+	}
+	if closer, ok := src.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// offsetReaderAt shifts the offsets of ReadAt.
+type offsetReaderAt struct {
+	src    io.ReaderAt
+	offset int64
+}
+
+func (r *offsetReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.src.ReadAt(p, off+r.offset)
+}
@@ -0,0 +1,172 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// closingReaderAt records whether it has been closed.
+type closingReaderAt struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (r *closingReaderAt) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestStreamReadSeekCloser(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, 16)
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 100000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           iv,
+		PlaintextLen: int64(len(plaintext)),
+	}
+
+	// A stream without commitment is rejected.
+	var uncommitted bytes.Buffer
+	writer, err := cipherio.NewStreamWriter(&uncommitted, &header, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = cipherio.NewStreamReadSeekCloser(bytes.NewReader(uncommitted.Bytes()), key)
+	if err != cipherio.ErrMissingCommitment {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrMissingCommitment)
+	}
+
+	header.SetCommitment(key)
+	var stream bytes.Buffer
+	writer, err = cipherio.NewStreamWriter(&stream, &header, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	src := &closingReaderAt{Reader: bytes.NewReader(stream.Bytes())}
+	reader, decoded, err := cipherio.NewStreamReadSeekCloser(src, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.PlaintextLen != header.PlaintextLen {
+		t.Fatalf("unexpected header: %+v", decoded)
+	}
+	if reader.Size() != int64(len(plaintext)) {
+		t.Fatalf("unexpected size: %d != %d", reader.Size(), len(plaintext))
+	}
+
+	// Read everything sequentially.
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, plaintext) {
+		t.Fatal("unexpected read bytes")
+	}
+
+	// Seek to various positions.
+	seeks := []struct {
+		Offset   int64
+		Whence   int
+		Expected int64
+	}{
+		{Offset: 0, Whence: io.SeekStart, Expected: 0},
+		{Offset: 17, Whence: io.SeekStart, Expected: 17},
+		{Offset: 10000, Whence: io.SeekCurrent, Expected: 17 + 40000 + 10000},
+		{Offset: -33, Whence: io.SeekEnd, Expected: 100000 - 33},
+	}
+	for _, seek := range seeks {
+		offset, err := reader.Seek(seek.Offset, seek.Whence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != seek.Expected {
+			t.Fatalf("unexpected offset: %d != %d", offset, seek.Expected)
+		}
+		buf := make([]byte, 40000)
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		expected := plaintext[offset:]
+		if len(expected) > len(buf) {
+			expected = expected[:len(buf)]
+		}
+		if !bytes.Equal(buf[:n], expected) {
+			t.Fatalf("unexpected read bytes at offset %d", offset)
+		}
+	}
+
+	// Reading at the end returns EOF.
+	if _, err := reader.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := reader.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Fatalf("unexpected result: (%d, %v) != (0, %v)", n, err, io.EOF)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !src.closed {
+		t.Fatal("wrapped ReaderAt has not been closed")
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		truncated := bytes.NewReader(stream.Bytes()[:stream.Len()-32])
+		reader, _, err := cipherio.NewStreamReadSeekCloser(truncated, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(reader)
+		if err != cipherio.ErrLengthMismatch {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrLengthMismatch)
+		}
+	})
+
+	t.Run("UnknownLength", func(t *testing.T) {
+		unknown := header
+		unknown.PlaintextLen = -1
+		data, err := unknown.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = cipherio.NewStreamReadSeekCloser(bytes.NewReader(data), key)
+		if err == nil || err.Error() != "cipherio: random access requires a known plaintext length" {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+}
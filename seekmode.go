@@ -0,0 +1,37 @@
+package cipherio
+
+import "crypto/cipher"
+
+// BlockModeSeeker is implemented by BlockModes which can resume at any block, given only the input
+// block preceding it. This is the case of ECB, and of CBC decryption, whose IV is the previous
+// ciphertext block.
+//
+// BlockReader.SkipTo uses it to seek the wrapped Reader instead of (en|de)crypting the skipped
+// bytes.
+type BlockModeSeeker interface {
+	// SeekBlockMode returns a BlockMode (en|de)crypting from the block following prev, which is
+	// the input block preceding it, as read from the wrapped Reader.
+	SeekBlockMode(prev []byte) cipher.BlockMode
+}
+
+// seekableCBCDecrypter is a CBC decrypter implementing BlockModeSeeker.
+type seekableCBCDecrypter struct {
+	cipher.BlockMode
+	block cipher.Block
+}
+
+// NewSeekableCBCDecrypter is similar to cipher.NewCBCDecrypter, except that the returned
+// BlockMode implements BlockModeSeeker, so that BlockReader.SkipTo can seek past the skipped
+// blocks.
+func NewSeekableCBCDecrypter(block cipher.Block, iv []byte) cipher.BlockMode {
+	return seekableCBCDecrypter{cipher.NewCBCDecrypter(block, iv), block}
+}
+
+func (x seekableCBCDecrypter) SeekBlockMode(prev []byte) cipher.BlockMode {
+	return NewSeekableCBCDecrypter(x.block, prev)
+}
+
+// SeekBlockMode implements BlockModeSeeker: ECB blocks are independent.
+func (x ecb) SeekBlockMode(prev []byte) cipher.BlockMode {
+	return x
+}
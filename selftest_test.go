@@ -0,0 +1,31 @@
+package cipherio_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestSelfTest(t *testing.T) {
+	err := cipherio.SelfTest()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+}
+
+func TestSelfTestError(t *testing.T) {
+	cause := errors.New("boom")
+	err := error(cipherio.SelfTestError{Test: "AES-CBC/BlockWriter", Err: cause})
+	if !errors.Is(err, cause) {
+		t.Fatalf("unexpected err: %v != %v", err, cause)
+	}
+	if err.Error() != "cipherio: self-test AES-CBC/BlockWriter failed: boom" {
+		t.Fatalf("unexpected message: %q", err.Error())
+	}
+
+	err = cipherio.SelfTestError{Test: "AES-ECB", Got: []byte{1}, Expected: []byte{2}}
+	if err.Error() != "cipherio: self-test AES-ECB failed: got 01, expected 02" {
+		t.Fatalf("unexpected message: %q", err.Error())
+	}
+}
@@ -0,0 +1,175 @@
+package cipherio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var errSplitKey = errors.New("cipherio: envelope key is split into shares, see NewEnvelopeReaderWithShares")
+
+// SplitSecret splits the given secret into n shares, so that any threshold of them allow to
+// recover it with CombineShares, while fewer reveal nothing about it. This is Shamir's Secret
+// Sharing over GF(2^8), applied to each byte independently.
+//
+// Each share is one byte longer than the secret: its first byte is the X coordinate of the share,
+// between 1 and n. Random coefficients are read from rand, or from crypto/rand.Reader if nil.
+func SplitSecret(rand io.Reader, secret []byte, n, threshold int) ([][]byte, error) {
+	return splitSecret(randOrDefault(rand), secret, n, threshold)
+}
+
+// splitSecret is similar to SplitSecret, except that random coefficients are read from rand.
+func splitSecret(rand io.Reader, secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 1 || n < threshold || n > 255 {
+		return nil, fmt.Errorf("cipherio: invalid secret sharing parameters: %d of %d", threshold, n)
+	}
+
+	// Each byte of the secret is the constant term of its own random polynomial.
+	coefficients := make([]byte, len(secret)*(threshold-1))
+	if _, err := io.ReadFull(rand, coefficients); err != nil {
+		return nil, err
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		x := byte(i + 1)
+		share := make([]byte, 1+len(secret))
+		share[0] = x
+		for b, constant := range secret {
+			// Evaluate the polynomial with Horner's method.
+			var y byte
+			for c := threshold - 2; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[b*(threshold-1)+c]
+			}
+			share[1+b] = gfMul(y, x) ^ constant
+		}
+		shares[i] = share
+	}
+	return shares, nil
+}
+
+// CombineShares recovers a secret split by SplitSecret. At least as many shares as the threshold
+// must be given, otherwise the result is meaningless.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("cipherio: no share to combine")
+	}
+	length := len(shares[0])
+	if length < 2 {
+		return nil, errors.New("cipherio: invalid share")
+	}
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != length || share[0] == 0 || seen[share[0]] {
+			return nil, errors.New("cipherio: invalid share")
+		}
+		seen[share[0]] = true
+	}
+
+	// Interpolate each polynomial at x = 0 with Lagrange basis polynomials.
+	secret := make([]byte, length-1)
+	for i, share := range shares {
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other[0], other[0]^share[0]))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(share[1+b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// gfMul multiplies two elements of GF(2^8) with the AES reduction polynomial, in constant time.
+func gfMul(a, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		product ^= -(b & 1) & a
+		b >>= 1
+		a = (a << 1) ^ (-(a >> 7) & 0x1b)
+	}
+	return product
+}
+
+// gfDiv divides two elements of GF(2^8). The divisor must not be zero.
+func gfDiv(a, b byte) byte {
+	// The inverse of b is b^254.
+	inverse := byte(1)
+	for i := 0; i < 254; i++ {
+		inverse = gfMul(inverse, b)
+	}
+	return gfMul(a, inverse)
+}
+
+// NewSplitEnvelopeWriter is similar to NewEnvelopeWriter, except that the data key is split into
+// one share per recipient, threshold of which are needed to recover it. Each recipient only gets
+// its own share, wrapped with its KEK. This enforces split custody of the decryption capability.
+//
+// A key commitment is added to the header if missing, so that wrong shares are detected before
+// decryption.
+func NewSplitEnvelopeWriter(ctx context.Context, dst io.Writer, header *StreamHeader, dataKey []byte, recipients []Recipient, threshold int, opts ...WriterOption) (*BlockWriter, error) {
+	random := randOrDefault(newWriterOptions(opts).rand)
+	shares, err := splitSecret(random, dataKey, len(recipients), threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([]RecipientSlot, 0, len(recipients))
+	for i, recipient := range recipients {
+		wrapped, err := wrapKey(ctx, random, recipient, shares[i])
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, RecipientSlot{
+			KeyID:      recipient.KeyID,
+			WrappedKey: wrapped,
+		})
+	}
+	header.Recipients = slots
+	header.Threshold = threshold
+	if len(header.Commitment) == 0 {
+		header.SetCommitment(dataKey)
+	}
+
+	return NewStreamWriter(dst, header, dataKey, opts...)
+}
+
+// UnwrapShare returns the share of the data key stored in the slot matching the key ID of the
+// given recipient. It is typically called by each custodian, before the shares are gathered.
+func (h *StreamHeader) UnwrapShare(ctx context.Context, recipient Recipient) ([]byte, error) {
+	if h.Threshold == 0 {
+		return nil, errors.New("cipherio: envelope key is not split into shares")
+	}
+	return h.unwrapSlot(ctx, recipient)
+}
+
+// NewEnvelopeReaderWithShares reads a header from src, recovers the data key from the given shares
+// as returned by UnwrapShare, then returns a Reader like NewStreamReader.
+//
+// An error is returned if fewer shares than the threshold are given. If the recovered key does not
+// match the commitment of the header, ErrKeyCommitment is returned.
+func NewEnvelopeReaderWithShares(src io.Reader, shares [][]byte, opts ...ReaderOption) (io.Reader, *StreamHeader, error) {
+	header, err := ReadStreamHeader(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Threshold == 0 {
+		return nil, nil, errors.New("cipherio: envelope key is not split into shares")
+	}
+	if len(shares) < header.Threshold {
+		return nil, nil, fmt.Errorf("cipherio: not enough shares: %d < %d", len(shares), header.Threshold)
+	}
+
+	dataKey, err := CombineShares(shares)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := newStreamReader(src, header, dataKey, withRequiredCommitment(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, header, nil
+}
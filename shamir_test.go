@@ -0,0 +1,204 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestSplitSecret(t *testing.T) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, params := range [][2]int{{1, 1}, {3, 1}, {3, 2}, {5, 3}, {5, 5}, {255, 10}} {
+		n, threshold := params[0], params[1]
+		t.Run(fmt.Sprintf("%dOf%d", threshold, n), func(t *testing.T) {
+			shares, err := cipherio.SplitSecret(nil, secret, n, threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(shares) != n {
+				t.Fatalf("unexpected share count: %d != %d", len(shares), n)
+			}
+
+			// Any threshold shares recover the secret, here the last ones.
+			combined, err := cipherio.CombineShares(shares[n-threshold:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(combined, secret) {
+				t.Fatalf("unexpected combined secret")
+			}
+
+			// All shares too.
+			combined, err = cipherio.CombineShares(shares)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(combined, secret) {
+				t.Fatalf("unexpected combined secret with all shares")
+			}
+
+			// Fewer shares do not.
+			if threshold > 1 {
+				combined, err = cipherio.CombineShares(shares[:threshold-1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Equal(combined, secret) {
+					t.Fatalf("secret recovered with too few shares")
+				}
+			}
+		})
+	}
+
+	t.Run("InvalidParameters", func(t *testing.T) {
+		for _, params := range [][2]int{{0, 0}, {2, 3}, {256, 2}} {
+			_, err := cipherio.SplitSecret(nil, secret, params[0], params[1])
+			if err == nil {
+				t.Fatalf("invalid parameters accepted: %v", params)
+			}
+		}
+	})
+
+	t.Run("Rand", func(t *testing.T) {
+		// The same random source gives the same shares.
+		random := bytes.Repeat([]byte{42}, 1024)
+		first, err := cipherio.SplitSecret(bytes.NewReader(random), secret, 3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := cipherio.SplitSecret(bytes.NewReader(random), secret, 3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range first {
+			if !bytes.Equal(first[i], second[i]) {
+				t.Fatalf("unexpected share %d: %x != %x", i, second[i], first[i])
+			}
+		}
+	})
+
+	t.Run("InvalidShares", func(t *testing.T) {
+		shares, err := cipherio.SplitSecret(nil, secret, 3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, invalid := range [][][]byte{
+			nil,
+			{shares[0], shares[0]},
+			{shares[0], shares[1][:10]},
+		} {
+			_, err := cipherio.CombineShares(invalid)
+			if err == nil {
+				t.Fatal("invalid shares accepted")
+			}
+		}
+	})
+}
+
+func TestSplitEnvelope(t *testing.T) {
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	ctx := context.Background()
+	dataKey := randomBytes(32)
+	recipients := []cipherio.Recipient{
+		{KeyID: []byte("alice"), KEK: randomBytes(32)},
+		{KeyID: []byte("bob"), KEK: randomBytes(32)},
+		{KeyID: []byte("carol"), KEK: randomBytes(32)},
+	}
+	plaintext := randomBytes(1000)
+
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		Padding:      cipherio.PaddingPKCS7,
+		IV:           randomBytes(aes.BlockSize),
+		PlaintextLen: int64(len(plaintext)),
+	}
+
+	var stream bytes.Buffer
+	writer, err := cipherio.NewSplitEnvelopeWriter(ctx, &stream, &header, dataKey, recipients, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each custodian unwraps its own share.
+	decoded, err := cipherio.ReadStreamHeader(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Threshold != 2 {
+		t.Fatalf("unexpected threshold: %d != %d", decoded.Threshold, 2)
+	}
+	var shares [][]byte
+	for _, recipient := range recipients {
+		share, err := decoded.UnwrapShare(ctx, recipient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shares = append(shares, share)
+	}
+
+	t.Run("EnoughShares", func(t *testing.T) {
+		reader, _, err := cipherio.NewEnvelopeReaderWithShares(bytes.NewReader(stream.Bytes()), [][]byte{shares[2], shares[0]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatalf("unexpected decrypted bytes")
+		}
+	})
+
+	t.Run("NotEnoughShares", func(t *testing.T) {
+		_, _, err := cipherio.NewEnvelopeReaderWithShares(bytes.NewReader(stream.Bytes()), shares[:1])
+		if err == nil || err.Error() != "cipherio: not enough shares: 1 < 2" {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	t.Run("WrongShare", func(t *testing.T) {
+		forged := append([]byte(nil), shares[1]...)
+		forged[5] ^= 1
+		_, _, err := cipherio.NewEnvelopeReaderWithShares(bytes.NewReader(stream.Bytes()), [][]byte{shares[0], forged})
+		if err != cipherio.ErrKeyCommitment {
+			t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrKeyCommitment)
+		}
+	})
+
+	t.Run("SingleRecipient", func(t *testing.T) {
+		// A single share is never mistaken for the data key.
+		_, _, err := cipherio.NewEnvelopeReader(bytes.NewReader(stream.Bytes()), recipients[0])
+		if err == nil {
+			t.Fatal("split envelope opened with a single recipient")
+		}
+	})
+}
@@ -0,0 +1,392 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ShardConfig configures ShardWriter and ShardReader. The zero value uses AES-256-CBC with
+// stripes of 64 KiB.
+type ShardConfig struct {
+	// StripeSize is the number of bytes sent to a lane before switching to the next one. It must
+	// be a multiple of the block size. Defaults to 64 KiB.
+	StripeSize int
+
+	// NewCipher creates the block cipher of each lane from its derived key. Defaults to
+	// aes.NewCipher.
+	NewCipher func(key []byte) (cipher.Block, error)
+
+	// KeySize is the length of the key derived for each lane. Defaults to 32.
+	KeySize int
+
+	// Rand is the source of the random salt generated by ShardWriter. Defaults to
+	// crypto/rand.Reader.
+	Rand io.Reader
+}
+
+// DefaultStripeSize is the stripe size used by ShardWriter when none is specified.
+const DefaultStripeSize = 64 << 10
+
+func (c *ShardConfig) withDefaults() ShardConfig {
+	config := *c
+	if config.StripeSize <= 0 {
+		config.StripeSize = DefaultStripeSize
+	}
+	if config.NewCipher == nil {
+		config.NewCipher = newAESCipher
+	}
+	if config.KeySize <= 0 {
+		config.KeySize = 32
+	}
+	return config
+}
+
+// laneBlock derives the key and IV of the given lane, then returns the corresponding cipher and
+// IV.
+func (c *ShardConfig) laneBlock(masterKey, salt []byte, lane int) (cipher.Block, []byte, error) {
+	block, err := c.NewCipher(hkdf(masterKey, salt, shardLaneInfo("key", lane), c.KeySize))
+	if err != nil {
+		return nil, nil, err
+	}
+	iv := hkdf(masterKey, salt, shardLaneInfo("iv", lane), block.BlockSize())
+
+	if c.StripeSize%block.BlockSize() != 0 {
+		return nil, nil, fmt.Errorf("cipherio: stripe size must be a multiple of the block size: %d %% %d != 0", c.StripeSize, block.BlockSize())
+	}
+	return block, iv, nil
+}
+
+// shardLaneInfo returns the HKDF info used to derive the given kind of lane secret.
+func shardLaneInfo(kind string, lane int) []byte {
+	info := []byte("cipherio shard lane " + kind + " ")
+	return append(info, byte(lane>>24), byte(lane>>16), byte(lane>>8), byte(lane))
+}
+
+// ShardManifest describes how a stream has been split into lanes by a ShardWriter. It is needed
+// to reassemble the stream with a ShardReader.
+type ShardManifest struct {
+	Salt       []byte  // random salt used to derive lane keys
+	StripeSize int64   // number of bytes per stripe
+	Size       int64   // total number of plaintext bytes
+	LaneSizes  []int64 // number of ciphertext bytes written to each lane
+}
+
+var shardManifestMagic = []byte("CIOSHRD\x01")
+
+// MarshalBinary encodes the manifest in a compact binary format.
+func (m *ShardManifest) MarshalBinary() ([]byte, error) {
+	if len(m.Salt) > 255 {
+		return nil, fmt.Errorf("cipherio: shard salt is too long: %d > 255", len(m.Salt))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(shardManifestMagic)
+	buf.WriteByte(byte(len(m.Salt)))
+	buf.Write(m.Salt)
+	binary.Write(&buf, binary.BigEndian, m.StripeSize)
+	binary.Write(&buf, binary.BigEndian, m.Size)
+	binary.Write(&buf, binary.BigEndian, uint32(len(m.LaneSizes)))
+	binary.Write(&buf, binary.BigEndian, m.LaneSizes)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a manifest encoded by MarshalBinary.
+func (m *ShardManifest) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	magic := make([]byte, len(shardManifestMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, shardManifestMagic) {
+		return errors.New("cipherio: invalid shard manifest")
+	}
+
+	saltLen, err := r.ReadByte()
+	if err != nil {
+		return errors.New("cipherio: truncated shard manifest")
+	}
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return errors.New("cipherio: truncated shard manifest")
+	}
+
+	var stripeSize, size int64
+	var lanes uint32
+	for _, v := range []interface{}{&stripeSize, &size, &lanes} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return errors.New("cipherio: truncated shard manifest")
+		}
+	}
+	if stripeSize <= 0 || size < 0 || (lanes == 0 && size > 0) || int64(lanes)*8 != int64(r.Len()) {
+		return errors.New("cipherio: invalid shard manifest")
+	}
+	laneSizes := make([]int64, lanes)
+	if err := binary.Read(r, binary.BigEndian, laneSizes); err != nil {
+		return errors.New("cipherio: truncated shard manifest")
+	}
+
+	m.Salt = salt
+	m.StripeSize = stripeSize
+	m.Size = size
+	m.LaneSizes = laneSizes
+	return nil
+}
+
+// ShardWriter splits a stream into stripes distributed round-robin over several lanes, each one
+// being encrypted concurrently with its own key and IV derived from a master key with HKDF.
+type ShardWriter struct {
+	config   ShardConfig
+	salt     []byte
+	lanes    []*shardLane
+	stripe   *[]byte // current incomplete stripe
+	stripes  int     // number of stripes sent so far
+	size     int64
+	wg       sync.WaitGroup
+	errOnce  sync.Once
+	err      error
+	failed   chan struct{}
+	closed   bool
+	manifest *ShardManifest
+}
+
+type shardLane struct {
+	writer  *BlockWriter
+	stripes chan *[]byte
+}
+
+var stripePool sync.Pool
+
+// NewShardWriter creates a ShardWriter encrypting to the given lanes with AES-CBC (or the cipher
+// configured by config) and keys derived from masterKey.
+//
+// Each lane ends with a zero-padded block if needed. The exact plaintext size is recorded in the
+// manifest, which is available from Manifest once Close has succeeded.
+func NewShardWriter(lanes []io.Writer, masterKey []byte, config ShardConfig) (*ShardWriter, error) {
+	if len(lanes) == 0 {
+		return nil, errors.New("cipherio: at least one lane is required")
+	}
+
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(randOrDefault(config.Rand), salt); err != nil {
+		return nil, err
+	}
+
+	w := &ShardWriter{
+		config: config.withDefaults(),
+		salt:   salt,
+		failed: make(chan struct{}),
+	}
+
+	for index, dst := range lanes {
+		block, iv, err := w.config.laneBlock(masterKey, salt, index)
+		if err != nil {
+			return nil, err
+		}
+		w.lanes = append(w.lanes, &shardLane{
+			writer:  NewBlockWriterWithPadding(dst, cipher.NewCBCEncrypter(block, iv), ZeroPadding),
+			stripes: make(chan *[]byte, 2),
+		})
+	}
+
+	for _, lane := range w.lanes {
+		w.wg.Add(1)
+		go w.runLane(lane)
+	}
+
+	return w, nil
+}
+
+// runLane encrypts the stripes of a lane until its channel is closed.
+func (w *ShardWriter) runLane(lane *shardLane) {
+	defer w.wg.Done()
+
+	var err error
+	for stripe := range lane.stripes {
+		if err == nil {
+			_, err = lane.writer.Write(*stripe)
+		}
+		*stripe = (*stripe)[:0]
+		stripePool.Put(stripe)
+	}
+	if err == nil {
+		err = lane.writer.Close()
+	}
+	if err != nil {
+		w.fail(err)
+	}
+}
+
+func (w *ShardWriter) fail(err error) {
+	w.errOnce.Do(func() {
+		w.err = err
+		close(w.failed)
+	})
+}
+
+func (w *ShardWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("cipherio: write to closed ShardWriter")
+	}
+
+	count := 0
+	for len(p) > 0 {
+		select {
+		case <-w.failed:
+			return count, w.err
+		default:
+		}
+
+		if w.stripe == nil {
+			if pooled, ok := stripePool.Get().(*[]byte); ok && cap(*pooled) >= w.config.StripeSize {
+				w.stripe = pooled
+			} else {
+				stripe := make([]byte, 0, w.config.StripeSize)
+				w.stripe = &stripe
+			}
+		}
+
+		n := w.config.StripeSize - len(*w.stripe)
+		if n > len(p) {
+			n = len(p)
+		}
+		*w.stripe = append(*w.stripe, p[:n]...)
+		p = p[n:]
+		count += n
+		w.size += int64(n)
+
+		if len(*w.stripe) == w.config.StripeSize {
+			if err := w.sendStripe(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// sendStripe sends the current stripe to its lane.
+func (w *ShardWriter) sendStripe() error {
+	lane := w.lanes[w.stripes%len(w.lanes)]
+	select {
+	case lane.stripes <- w.stripe:
+	case <-w.failed:
+		return w.err
+	}
+	w.stripe = nil
+	w.stripes++
+	return nil
+}
+
+// Close sends the last stripe, waits for all lanes to be encrypted and builds the manifest.
+func (w *ShardWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+
+	var err error
+	if w.stripe != nil && len(*w.stripe) > 0 {
+		err = w.sendStripe()
+	}
+	for _, lane := range w.lanes {
+		close(lane.stripes)
+	}
+	w.wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	laneSizes := make([]int64, len(w.lanes))
+	for index, lane := range w.lanes {
+		laneSizes[index] = lane.writer.Written()
+	}
+	w.manifest = &ShardManifest{
+		Salt:       w.salt,
+		StripeSize: int64(w.config.StripeSize),
+		Size:       w.size,
+		LaneSizes:  laneSizes,
+	}
+	return nil
+}
+
+// Manifest returns the manifest describing the written lanes, or nil if Close has not succeeded.
+func (w *ShardWriter) Manifest() *ShardManifest {
+	return w.manifest
+}
+
+// ShardReader reassembles a stream written by a ShardWriter.
+type ShardReader struct {
+	lanes      []*BlockReader
+	stripeSize int64
+	remaining  int64 // number of plaintext bytes not yet returned
+	offset     int64 // number of plaintext bytes returned so far
+}
+
+// NewShardReader decrypts the given lanes, in the same order as given to NewShardWriter, and
+// reassembles the original stream according to the manifest.
+func NewShardReader(lanes []io.Reader, masterKey []byte, manifest *ShardManifest, config ShardConfig) (*ShardReader, error) {
+	if manifest == nil {
+		return nil, errors.New("cipherio: missing shard manifest")
+	}
+	if manifest.StripeSize <= 0 || manifest.Size < 0 || (len(manifest.LaneSizes) == 0 && manifest.Size > 0) {
+		return nil, errors.New("cipherio: invalid shard manifest")
+	}
+	if len(lanes) != len(manifest.LaneSizes) {
+		return nil, fmt.Errorf("cipherio: lane count does not match manifest: %d != %d", len(lanes), len(manifest.LaneSizes))
+	}
+
+	config.StripeSize = int(manifest.StripeSize)
+	config = config.withDefaults()
+
+	r := &ShardReader{
+		stripeSize: manifest.StripeSize,
+		remaining:  manifest.Size,
+	}
+	for index, src := range lanes {
+		block, iv, err := config.laneBlock(masterKey, manifest.Salt, index)
+		if err != nil {
+			return nil, err
+		}
+		r.lanes = append(r.lanes, NewBlockReader(src, cipher.NewCBCDecrypter(block, iv)))
+	}
+
+	return r, nil
+}
+
+func (r *ShardReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	// Read at most until the end of the current stripe or of the stream.
+	stripe := r.offset / r.stripeSize
+	available := r.stripeSize - r.offset%r.stripeSize
+	if available > r.remaining {
+		available = r.remaining
+	}
+	if int64(len(p)) > available {
+		p = p[:available]
+	}
+
+	n, err := r.lanes[stripe%int64(len(r.lanes))].Read(p)
+	r.offset += int64(n)
+	r.remaining -= int64(n)
+
+	// Ignore the end of a lane as long as the requested bytes have been read, since other lanes
+	// may still contain data. Otherwise, the lane is shorter than expected.
+	if err == io.EOF {
+		if n == len(p) {
+			err = nil
+		} else {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
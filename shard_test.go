@@ -0,0 +1,165 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+type shardTest struct {
+	Name    string
+	Lanes   int
+	DataLen int
+}
+
+func TestShard(t *testing.T) {
+	// Generate a random master key
+	masterKey := make([]byte, 32)
+	_, err := rand.Read(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := cipherio.ShardConfig{
+		StripeSize: 64,
+	}
+
+	// Prepare test cases
+	testCases := []shardTest{
+		{Name: "Empty", Lanes: 3, DataLen: 0},
+		{Name: "SingleLane", Lanes: 1, DataLen: 1000},
+		{Name: "ExactStripes", Lanes: 4, DataLen: 64 * 12},
+		{Name: "PartialStripe", Lanes: 4, DataLen: 64*13 + 21},
+		{Name: "FewerStripesThanLanes", Lanes: 8, DataLen: 130},
+	}
+
+	// Run test cases
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			originalBytes := make([]byte, testCase.DataLen)
+			_, err := rand.Read(originalBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lanes := make([]*bytes.Buffer, testCase.Lanes)
+			dsts := make([]io.Writer, testCase.Lanes)
+			for lane := range lanes {
+				lanes[lane] = &bytes.Buffer{}
+				dsts[lane] = lanes[lane]
+			}
+
+			writer, err := cipherio.NewShardWriter(dsts, masterKey, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for offset := 0; offset < len(originalBytes); offset += 50 {
+				end := offset + 50
+				if end > len(originalBytes) {
+					end = len(originalBytes)
+				}
+				_, err = writer.Write(originalBytes[offset:end])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The manifest should survive a round-trip through its binary encoding.
+			data, err := writer.Manifest().MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var manifest cipherio.ShardManifest
+			err = manifest.UnmarshalBinary(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&manifest, writer.Manifest()) {
+				t.Fatalf("unexpected manifest: %+v != %+v", manifest, writer.Manifest())
+			}
+			if manifest.Size != int64(len(originalBytes)) {
+				t.Fatalf("unexpected manifest size: %d != %d", manifest.Size, len(originalBytes))
+			}
+
+			srcs := make([]io.Reader, testCase.Lanes)
+			for lane := range lanes {
+				if int64(lanes[lane].Len()) != manifest.LaneSizes[lane] {
+					t.Fatalf("unexpected lane size: %d != %d", lanes[lane].Len(), manifest.LaneSizes[lane])
+				}
+				if lanes[lane].Len() > 0 && bytes.Contains(originalBytes, lanes[lane].Bytes()[:16]) {
+					t.Fatalf("lane %d is not encrypted", lane)
+				}
+				srcs[lane] = bytes.NewReader(lanes[lane].Bytes())
+			}
+
+			reader, err := cipherio.NewShardReader(srcs, masterKey, &manifest, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, originalBytes) {
+				t.Fatalf("unexpected read bytes")
+			}
+		})
+	}
+
+	t.Run("TruncatedLane", func(t *testing.T) {
+		lanes := []*bytes.Buffer{{}, {}}
+		writer, err := cipherio.NewShardWriter([]io.Writer{lanes[0], lanes[1]}, masterKey, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write(make([]byte, 500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srcs := []io.Reader{bytes.NewReader(lanes[0].Bytes()[:64]), bytes.NewReader(lanes[1].Bytes())}
+		reader, err := cipherio.NewShardReader(srcs, masterKey, writer.Manifest(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(reader)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("unexpected read err: %v != %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+
+	t.Run("InvalidManifest", func(t *testing.T) {
+		// A non-empty stream needs at least one lane.
+		noLanes := &cipherio.ShardManifest{StripeSize: 64, Size: 100}
+		data, err := noLanes.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest cipherio.ShardManifest
+		if err := manifest.UnmarshalBinary(data); err == nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		for _, manifest := range []*cipherio.ShardManifest{nil, noLanes, {StripeSize: 0, Size: 0}} {
+			_, err := cipherio.NewShardReader(nil, masterKey, manifest, config)
+			if err == nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,73 @@
+//go:build go1.21
+// +build go1.21
+
+package cipherio
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// SlogObserver is an Observer logging the lifecycle of streams with log/slog, for example to audit
+// the movement of encrypted data. It is only available with Go 1.21 or later.
+//
+// Each stream is given a sequence number, logged as "stream" along with its "operation". The
+// following events are logged at the Info level, except failures which are logged at the Error
+// level:
+//
+//	"cipherio stream created"
+//	"cipherio stream rekeyed"    with "offset", the number of bytes (en|de)crypted so far
+//	"cipherio stream finalized"  with "bytes", the total number of bytes (en|de)crypted
+//	"cipherio stream failed"     with "offset", "error" and "kind", as returned by ErrorKind
+//
+// The context given to WithObserver or WithWriteObserver is passed to the Handler, which may
+// extract values such as trace identifiers from it.
+type SlogObserver struct {
+	logger *slog.Logger
+	count  uint64
+}
+
+// NewSlogObserver returns a SlogObserver logging with the given Logger, or with slog.Default if nil.
+func NewSlogObserver(logger *slog.Logger) *SlogObserver {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogObserver{
+		logger: logger,
+	}
+}
+
+// ObserveStream logs the creation of a stream.
+func (o *SlogObserver) ObserveStream(ctx context.Context, op Operation) StreamObserver {
+	stream := &slogStream{
+		logger: o.logger.With(slog.Uint64("stream", atomic.AddUint64(&o.count, 1)), slog.String("operation", op.String())),
+		ctx:    ctx,
+	}
+	stream.logger.LogAttrs(ctx, slog.LevelInfo, "cipherio stream created")
+	return stream
+}
+
+// slogStream logs the events of a single stream.
+type slogStream struct {
+	logger *slog.Logger
+	ctx    context.Context
+	offset int64 // number of bytes (en|de)crypted so far
+}
+
+func (s *slogStream) Crypted(n int) {
+	s.offset += int64(n)
+}
+
+func (s *slogStream) Rekeyed() {
+	s.logger.LogAttrs(s.ctx, slog.LevelInfo, "cipherio stream rekeyed", slog.Int64("offset", s.offset))
+}
+
+func (s *slogStream) Failed(err error) {
+	s.logger.LogAttrs(s.ctx, slog.LevelError, "cipherio stream failed",
+		slog.Int64("offset", s.offset), slog.String("error", err.Error()), slog.String("kind", ErrorKind(err)))
+}
+
+func (s *slogStream) Ended() {
+	s.logger.LogAttrs(s.ctx, slog.LevelInfo, "cipherio stream finalized", slog.Int64("bytes", s.offset))
+}
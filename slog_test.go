@@ -0,0 +1,84 @@
+//go:build go1.21
+// +build go1.21
+
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestSlogObserver(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	observer := cipherio.NewSlogObserver(logger)
+
+	var encrypted bytes.Buffer
+	writer := cipherio.NewBlockWriterWithPadding(&encrypted, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding,
+		cipherio.WithWriteObserver(context.Background(), observer, cipherio.Encryption))
+	_, err = writer.Write(make([]byte, 20))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.FinalizeRecord(iv)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write(make([]byte, 16))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	reader := cipherio.NewBlockReader(bytes.NewReader(encrypted.Bytes()[:40]), cipher.NewCBCDecrypter(aesCipher, iv),
+		cipherio.WithObserver(context.Background(), observer, cipherio.Decryption))
+	_, err = ioutil.ReadAll(reader)
+	if err == nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := []string{
+		`level=INFO msg="cipherio stream created" stream=1 operation=encryption`,
+		`level=INFO msg="cipherio stream rekeyed" stream=1 operation=encryption offset=32`,
+		`level=INFO msg="cipherio stream finalized" stream=1 operation=encryption bytes=48`,
+		`level=INFO msg="cipherio stream created" stream=2 operation=decryption`,
+		`level=ERROR msg="cipherio stream failed" stream=2 operation=decryption offset=32 error="unexpected EOF" kind=alignment`,
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected logs:\n%s\n!=\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
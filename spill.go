@@ -0,0 +1,217 @@
+package cipherio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// defaultSpillThreshold is the threshold used by EncryptedBuffer if none is given.
+const defaultSpillThreshold = 1 << 20
+
+// EncryptedBufferOptions configures an EncryptedBuffer. The zero value is valid.
+type EncryptedBufferOptions struct {
+	// Threshold is the number of bytes kept in memory before spilling to a temporary file. If zero,
+	// 1 MiB is used.
+	Threshold int64
+	// Dir is the directory of the temporary file. If empty, the default directory for temporary
+	// files is used, as by ioutil.TempFile.
+	Dir string
+	// Rand is the source of the ephemeral key. If nil, crypto/rand.Reader is used.
+	Rand io.Reader
+}
+
+// EncryptedBuffer stages data in memory, then transparently spills it to a temporary file once it
+// grows beyond a threshold. Only ciphertext is ever written to disk: the file is encrypted with
+// AES-CTR under an ephemeral key, which is only kept in memory and lost on Close.
+//
+// Writes always append to the end of the buffer, while Read and Seek move a separate read offset,
+// so that data can be staged, then read back any number of times.
+//
+// An EncryptedBuffer is not safe for concurrent use. It must be closed to remove the temporary
+// file.
+type EncryptedBuffer struct {
+	options EncryptedBufferOptions
+	mem     []byte
+	file    *os.File
+	block   cipher.Block
+	iv      []byte
+	size    int64
+	offset  int64
+	closed  bool
+}
+
+// ErrBufferClosed is returned when using an EncryptedBuffer after Close.
+var ErrBufferClosed = errors.New("cipherio: use of closed EncryptedBuffer")
+
+// NewEncryptedBuffer returns an empty EncryptedBuffer.
+func NewEncryptedBuffer(opts EncryptedBufferOptions) *EncryptedBuffer {
+	if opts.Threshold == 0 {
+		opts.Threshold = defaultSpillThreshold
+	}
+	return &EncryptedBuffer{options: opts}
+}
+
+// Size returns the number of bytes written to the buffer.
+func (b *EncryptedBuffer) Size() int64 {
+	return b.size
+}
+
+// Spilled reports whether the buffer has been spilled to a temporary file.
+func (b *EncryptedBuffer) Spilled() bool {
+	return b.file != nil
+}
+
+// Write appends p to the buffer, spilling it to a temporary file if it exceeds the threshold.
+func (b *EncryptedBuffer) Write(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBufferClosed
+	}
+	if b.file == nil {
+		if b.size+int64(len(p)) <= b.options.Threshold {
+			b.mem = append(b.mem, p...)
+			b.size += int64(len(p))
+			return len(p), nil
+		}
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+	if err := b.writeFile(p, b.size); err != nil {
+		return 0, err
+	}
+	b.size += int64(len(p))
+	return len(p), nil
+}
+
+// spill moves the data kept in memory to a new temporary file.
+func (b *EncryptedBuffer) spill() error {
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	rand := randOrDefault(b.options.Rand)
+	if _, err := io.ReadFull(rand, key); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return err
+	}
+	block, err := newAESCipher(key)
+	wipeBytes(key)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(b.options.Dir, "cipherio-")
+	if err != nil {
+		return err
+	}
+	b.file = file
+	b.block = block
+	b.iv = iv
+
+	if err := b.writeFile(b.mem, 0); err != nil {
+		return err
+	}
+	wipeBytes(b.mem)
+	b.mem = nil
+	return nil
+}
+
+// writeFile encrypts p and writes it to the temporary file at the given offset.
+func (b *EncryptedBuffer) writeFile(p []byte, offset int64) error {
+	encrypted := make([]byte, len(p))
+	ctrAt(b.block, b.iv, offset).XORKeyStream(encrypted, p)
+	_, err := b.file.WriteAt(encrypted, offset)
+	return err
+}
+
+// Read reads data from the read offset.
+func (b *EncryptedBuffer) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBufferClosed
+	}
+	if b.offset >= b.size {
+		return 0, io.EOF
+	}
+	if remaining := b.size - b.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	if b.file == nil {
+		n := copy(p, b.mem[b.offset:])
+		b.offset += int64(n)
+		return n, nil
+	}
+
+	n, err := b.file.ReadAt(p, b.offset)
+	ctrAt(b.block, b.iv, b.offset).XORKeyStream(p[:n], p[:n])
+	b.offset += int64(n)
+	if err == io.EOF && n == len(p) {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the read offset, as defined by io.Seeker. Seeking beyond the end is allowed, in which
+// case Read returns io.EOF.
+func (b *EncryptedBuffer) Seek(offset int64, whence int) (int64, error) {
+	if b.closed {
+		return 0, ErrBufferClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.size
+	default:
+		return 0, fmt.Errorf("cipherio: invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("cipherio: negative offset: %d", offset)
+	}
+	b.offset = offset
+	return offset, nil
+}
+
+// Close wipes the data kept in memory, then closes and removes the temporary file, if any.
+func (b *EncryptedBuffer) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	wipeBytes(b.mem)
+	b.mem = nil
+	b.block = nil
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	if removeErr := os.Remove(b.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// ctrAt returns a CTR stream positioned at the given offset of the key stream starting with iv.
+func ctrAt(block cipher.Block, iv []byte, offset int64) cipher.Stream {
+	blockSize := block.BlockSize()
+	counter := append([]byte(nil), iv...)
+	carry := uint64(offset / int64(blockSize))
+	for i := len(counter) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(counter[i]) + carry&0xff
+		counter[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+
+	stream := cipher.NewCTR(block, counter)
+	if skip := int(offset % int64(blockSize)); skip > 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+	return stream
+}
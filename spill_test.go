@@ -0,0 +1,159 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestEncryptedBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cipherio-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plaintext := bytes.Repeat([]byte("untrusted upload "), 100)
+
+	testCases := []struct {
+		name      string
+		threshold int64
+		spilled   bool
+	}{
+		{"Memory", 4096, false},
+		{"Exact", int64(len(plaintext)), false},
+		{"Spilled", 100, true},
+		{"SpilledImmediately", 1, true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			buffer := cipherio.NewEncryptedBuffer(cipherio.EncryptedBufferOptions{Threshold: testCase.threshold, Dir: dir})
+
+			// Write with various sizes, so that the spill happens in the middle of a write.
+			for offset, size := 0, 1; offset < len(plaintext); offset, size = offset+size, size*3 {
+				end := offset + size
+				if end > len(plaintext) {
+					end = len(plaintext)
+				}
+				n, err := buffer.Write(plaintext[offset:end])
+				if err != nil {
+					t.Fatalf("unexpected err: %v != %v", err, nil)
+				}
+				if n != end-offset {
+					t.Fatalf("unexpected write length: %d != %d", n, end-offset)
+				}
+			}
+			if buffer.Spilled() != testCase.spilled {
+				t.Fatalf("unexpected spill: %v != %v", buffer.Spilled(), testCase.spilled)
+			}
+			if buffer.Size() != int64(len(plaintext)) {
+				t.Fatalf("unexpected size: %d != %d", buffer.Size(), len(plaintext))
+			}
+
+			// No plaintext must reach the disk.
+			files, err := filepath.Glob(filepath.Join(dir, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				content, err := ioutil.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Contains(content, []byte("untrusted")) {
+					t.Fatalf("plaintext found in %s", file)
+				}
+			}
+			if testCase.spilled && len(files) != 1 {
+				t.Fatalf("unexpected number of temporary files: %d != 1", len(files))
+			}
+
+			result, err := ioutil.ReadAll(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatal("read data does not match written data")
+			}
+
+			for _, offset := range []int64{0, 1, 15, 16, 17, 1000, int64(len(plaintext)) - 1} {
+				_, err = buffer.Seek(offset, io.SeekStart)
+				if err != nil {
+					t.Fatal(err)
+				}
+				part := make([]byte, 40)
+				n, err := io.ReadFull(buffer, part)
+				if err != nil && err != io.ErrUnexpectedEOF {
+					t.Fatalf("unexpected err: %v != %v", err, nil)
+				}
+				if !bytes.Equal(part[:n], plaintext[offset:offset+int64(n)]) {
+					t.Fatalf("unexpected data at offset %d", offset)
+				}
+			}
+
+			err = buffer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err = filepath.Glob(filepath.Join(dir, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 0 {
+				t.Fatalf("temporary files left after Close: %v", files)
+			}
+			_, err = buffer.Read(make([]byte, 1))
+			if err != cipherio.ErrBufferClosed {
+				t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrBufferClosed)
+			}
+		})
+	}
+}
+
+func TestEncryptedBufferEphemeralKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cipherio-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plaintext := make([]byte, 256)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two buffers with the same content must produce different files.
+	var contents [][]byte
+	for i := 0; i < 2; i++ {
+		buffer := cipherio.NewEncryptedBuffer(cipherio.EncryptedBufferOptions{Threshold: 1, Dir: dir})
+		_, err = buffer.Write(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, content)
+		err = buffer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bytes.Equal(contents[0], contents[1]) {
+		t.Fatal("the same key stream has been used twice")
+	}
+}
@@ -0,0 +1,121 @@
+package cipherio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats is an Observer collecting counters about the Readers and Writers it is attached to, for
+// example with WithStats and WithWriteStats. A single Stats is typically shared by all the streams
+// of an application, and exposed with a metrics adapter such as the cipherioexpvar package.
+//
+// The zero value is ready to use. A Stats is safe for concurrent use, and must not be copied.
+type Stats struct {
+	// Accessed atomically, hence first for 64-bit alignment on 32-bit platforms.
+	streams [2]int64 // number of streams opened, by operation
+	bytes   [2]int64 // number of bytes (en|de)crypted, by operation
+
+	mu     sync.Mutex
+	errors map[string]int64
+}
+
+// StatsSnapshot holds the values of the counters of a Stats at a given time.
+type StatsSnapshot struct {
+	EncryptionStreams int64 // number of encrypting streams opened
+	DecryptionStreams int64 // number of decrypting streams opened
+	BytesEncrypted    int64 // number of bytes encrypted, including any padding
+	BytesDecrypted    int64 // number of bytes decrypted, including any padding
+
+	// Errors counts the streams that failed, by kind of error: "alignment", "verification",
+	// "accounting", or "other" for the errors of the wrapped Reader, Writer or BlockMode. Each
+	// stream is counted at most once.
+	Errors map[string]int64
+}
+
+// Snapshot returns the current values of the counters.
+func (s *Stats) Snapshot() StatsSnapshot {
+	snapshot := StatsSnapshot{
+		EncryptionStreams: atomic.LoadInt64(&s.streams[0]),
+		DecryptionStreams: atomic.LoadInt64(&s.streams[1]),
+		BytesEncrypted:    atomic.LoadInt64(&s.bytes[0]),
+		BytesDecrypted:    atomic.LoadInt64(&s.bytes[1]),
+		Errors:            make(map[string]int64),
+	}
+	s.mu.Lock()
+	for kind, count := range s.errors {
+		snapshot.Errors[kind] = count
+	}
+	s.mu.Unlock()
+	return snapshot
+}
+
+// ObserveStream counts a new stream, and returns a StreamObserver counting its bytes and errors.
+func (s *Stats) ObserveStream(ctx context.Context, op Operation) StreamObserver {
+	index := 0
+	if op == Decryption {
+		index = 1
+	}
+	atomic.AddInt64(&s.streams[index], 1)
+	return &statsStream{
+		stats: s,
+		index: index,
+	}
+}
+
+// WithStats counts the Reader and the bytes it (en|de)crypts in the given Stats, for the given
+// operation. Errors returned by Read, other than io.EOF, are counted too. This is a shorthand for
+// WithObserver.
+func WithStats(stats *Stats, op Operation) ReaderOption {
+	return WithObserver(context.Background(), stats, op)
+}
+
+// WithWriteStats is similar to WithStats, for a Writer. Errors returned by any of its methods are
+// counted.
+func WithWriteStats(stats *Stats, op Operation) WriterOption {
+	return WithWriteObserver(context.Background(), stats, op)
+}
+
+// statsStream updates a Stats on behalf of a single stream.
+type statsStream struct {
+	stats *Stats
+	index int // index of the operation in the counters of stats
+}
+
+func (s *statsStream) Crypted(n int) {
+	atomic.AddInt64(&s.stats.bytes[s.index], int64(n))
+}
+
+func (s *statsStream) Failed(err error) {
+	kind := ErrorKind(err)
+	s.stats.mu.Lock()
+	if s.stats.errors == nil {
+		s.stats.errors = make(map[string]int64)
+	}
+	s.stats.errors[kind]++
+	s.stats.mu.Unlock()
+}
+
+func (s *statsStream) Ended() {}
+
+// ErrorKind returns the kind of an error returned by a Reader or Writer, as reported by
+// StatsSnapshot: "alignment", "verification", "accounting" or "other".
+func ErrorKind(err error) string {
+	var (
+		verificationErr VerificationError
+		accountingErr   AccountingError
+	)
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// Data ending in the middle of a block, as reported by an AlignmentError or by a Reader.
+		return "alignment"
+	case errors.As(err, &verificationErr):
+		return "verification"
+	case errors.As(err, &accountingErr):
+		return "accounting"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,87 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestStats(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	plaintext := make([]byte, 1000)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := new(cipherio.Stats)
+
+	// Streams are counted concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var encrypted bytes.Buffer
+			writer := cipherio.NewBlockWriterWithPadding(&encrypted, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding, cipherio.WithWriteStats(stats, cipherio.Encryption))
+			if _, err := writer.Write(plaintext); err != nil {
+				t.Errorf("unexpected err: %v != %v", err, nil)
+			}
+			if err := writer.Close(); err != nil {
+				t.Errorf("unexpected err: %v != %v", err, nil)
+			}
+
+			reader := cipherio.NewBlockReader(&encrypted, cipher.NewCBCDecrypter(aesCipher, iv), cipherio.WithStats(stats, cipherio.Decryption))
+			if _, err := ioutil.ReadAll(reader); err != nil {
+				t.Errorf("unexpected err: %v != %v", err, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A failed stream is counted once, whatever the number of errors returned.
+	reader := cipherio.NewBlockReader(bytes.NewReader(make([]byte, 20)), cipher.NewCBCDecrypter(aesCipher, iv), cipherio.WithStats(stats, cipherio.Decryption))
+	for i := 0; i < 3; i++ {
+		if _, err := ioutil.ReadAll(reader); err == nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	writer := cipherio.NewBlockWriter(&failingWriter{errors.New("write failed")}, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithWriteStats(stats, cipherio.Encryption))
+	_, err = writer.Write(make([]byte, 32))
+	if err == nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := cipherio.StatsSnapshot{
+		EncryptionStreams: 11,
+		DecryptionStreams: 11,
+		BytesEncrypted:    10*1008 + 32,
+		BytesDecrypted:    10*1008 + 16,
+		Errors:            map[string]int64{"alignment": 1, "other": 1},
+	}
+	if snapshot := stats.Snapshot(); fmt.Sprint(snapshot) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected snapshot: %+v != %+v", snapshot, expected)
+	}
+}
@@ -0,0 +1,77 @@
+package cipherio
+
+import (
+	"context"
+	"crypto/cipher"
+	"io"
+	"sync"
+)
+
+// EncryptStream copies src to dst, encrypting it with the given BlockMode, and returns the number
+// of bytes written to dst. Any incomplete block at the end of src is filled with padding, or leads
+// to io.ErrUnexpectedEOF if padding is nil.
+//
+// Reading from src happens in a background goroutine, so that cancelling ctx stops the copy even
+// if src is slow. The first error encountered is returned, or ctx.Err() if ctx has been
+// cancelled. The background goroutine is always stopped before returning, which requires any
+// pending Read on src to complete.
+func EncryptStream(ctx context.Context, dst io.Writer, src io.Reader, blockMode cipher.BlockMode, padding Padding) (int64, error) {
+	return runStream(ctx, dst, src, func(r io.Reader) io.Reader {
+		return NewBlockReaderWithPadding(r, blockMode, padding)
+	})
+}
+
+// DecryptStream is similar to EncryptStream, except that src is decrypted with the given BlockMode
+// and must be aligned to the block size.
+func DecryptStream(ctx context.Context, dst io.Writer, src io.Reader, blockMode cipher.BlockMode) (int64, error) {
+	return runStream(ctx, dst, src, func(r io.Reader) io.Reader {
+		return NewBlockReader(r, blockMode)
+	})
+}
+
+// runStream runs the pipeline src -> background copy -> pipe -> wrap -> dst.
+func runStream(ctx context.Context, dst io.Writer, src io.Reader, wrap func(io.Reader) io.Reader) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	pr, pw := io.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// Background stage: read from src.
+	go func() {
+		defer wg.Done()
+		_, err := io.Copy(pw, src)
+		pw.CloseWithError(err)
+	}()
+
+	// Stop both stages on cancellation.
+	done := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			pr.CloseWithError(ctx.Err())
+		case <-done:
+		}
+	}()
+
+	written, err := io.Copy(dst, wrap(pr))
+
+	// Stop the background stage, then wait for it.
+	close(done)
+	if err != nil {
+		pr.CloseWithError(err)
+	} else {
+		pr.Close()
+	}
+	wg.Wait()
+
+	// Report the cancellation rather than its consequences.
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return written, err
+}
@@ -0,0 +1,126 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/connesc/cipherio"
+)
+
+// blockingReader returns some data, then blocks until unblocked.
+type blockingReader struct {
+	data    []byte
+	unblock chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	<-r.unblock
+	return 0, io.EOF
+}
+
+// failingWriter fails on every write.
+type failingWriter struct {
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestStream(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 100003)
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		var encrypted bytes.Buffer
+		n, err := cipherio.EncryptStream(context.Background(), &encrypted, bytes.NewReader(originalBytes), cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 100016 {
+			t.Fatalf("unexpected written length: %d", n)
+		}
+
+		var decrypted bytes.Buffer
+		_, err = cipherio.DecryptStream(context.Background(), &decrypted, &encrypted, cipher.NewCBCDecrypter(aesCipher, iv))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted.Bytes()[:len(originalBytes)], originalBytes) {
+			t.Fatalf("unexpected decrypted bytes")
+		}
+	})
+
+	t.Run("Unaligned", func(t *testing.T) {
+		var decrypted bytes.Buffer
+		_, err := cipherio.DecryptStream(context.Background(), &decrypted, bytes.NewReader(originalBytes), cipher.NewCBCDecrypter(aesCipher, iv))
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("unexpected err: %v != %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+
+	t.Run("WriteError", func(t *testing.T) {
+		testErr := fmt.Errorf("test error")
+		_, err := cipherio.EncryptStream(context.Background(), &failingWriter{testErr}, bytes.NewReader(originalBytes), cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+		if err != testErr {
+			t.Fatalf("unexpected err: %v != %v", err, testErr)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		src := &blockingReader{
+			data:    originalBytes[:40],
+			unblock: make(chan struct{}),
+		}
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+			// The blocked Read must eventually return so that the background stage stops.
+			time.Sleep(50 * time.Millisecond)
+			close(src.unblock)
+		}()
+
+		var encrypted bytes.Buffer
+		_, err := cipherio.EncryptStream(ctx, &encrypted, src, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+		if err != context.Canceled {
+			t.Fatalf("unexpected err: %v != %v", err, context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package cipherio
+
+// WithStrictSource makes the Reader verify that each call to the wrapped Reader reports a number of
+// bytes between 0 and the length of the given buffer, as required by io.Reader. Any violation is
+// returned as an AccountingError, and the reported bytes are discarded.
+func WithStrictSource() ReaderOption {
+	return func(o *readerOptions) {
+		o.strict = true
+	}
+}
+
+// WithStrictDestination makes the Writer verify that each call to the wrapped Writer reports a
+// number of bytes between 0 and the length of the given buffer, as required by io.Writer. Any
+// violation is returned as an AccountingError, and the reported bytes are not counted as flushed.
+func WithStrictDestination() WriterOption {
+	return func(o *writerOptions) {
+		o.strict = true
+	}
+}
+
+// readSrc calls Read on the wrapped Reader, and checks the result in strict mode.
+func (r *BlockReader) readSrc(p []byte) (n int, err error) {
+	if r.profiler == nil {
+		n, err = r.src.Read(p)
+	} else {
+		r.profiler.do("read", func() {
+			n, err = r.src.Read(p)
+		})
+	}
+	if r.strict && (n < 0 || n > len(p)) {
+		return 0, AccountingError{Op: "read", Requested: len(p), Reported: n}
+	}
+	r.stats.record(n, n)
+	return n, err
+}
+
+// writeDst calls Write on the wrapped Writer, and checks the result in strict mode.
+func (w *BlockWriter) writeDst(p []byte) (n int, err error) {
+	if w.profiler == nil {
+		n, err = w.dst.Write(p)
+	} else {
+		w.profiler.do("write", func() {
+			n, err = w.dst.Write(p)
+		})
+	}
+	if w.strict && (n < 0 || n > len(p)) {
+		return 0, AccountingError{Op: "write", Requested: len(p), Reported: n}
+	}
+	w.stats.record(len(p), n)
+	return n, err
+}
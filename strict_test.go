@@ -0,0 +1,171 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// overreportingReader fills the given buffer, but reports a different number of bytes.
+type overreportingReader struct {
+	delta int
+}
+
+func (r *overreportingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(i)
+	}
+	return len(p) + r.delta, nil
+}
+
+// overreportingWriter accepts everything, but reports a different number of bytes.
+type overreportingWriter struct {
+	delta int
+}
+
+func (w *overreportingWriter) Write(p []byte) (int, error) {
+	return len(p) + w.delta, nil
+}
+
+type strictTest struct {
+	Name     string
+	Delta    int
+	ReadSize int
+}
+
+var strictTests = []strictTest{
+	{Name: "OneMoreSmall", Delta: 1, ReadSize: 5},
+	{Name: "OneMoreLarge", Delta: 1, ReadSize: 100},
+	{Name: "NegativeSmall", Delta: -100, ReadSize: 5},
+	{Name: "NegativeLarge", Delta: -1000, ReadSize: 100},
+}
+
+func TestStrictSource(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, block.BlockSize())
+
+	for _, test := range strictTests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			src := &overreportingReader{delta: test.Delta}
+			reader := cipherio.NewBlockReader(src, cipher.NewCBCDecrypter(block, iv), cipherio.WithStrictSource())
+
+			buf := make([]byte, test.ReadSize)
+			n, err := reader.Read(buf)
+			expectedErr := cipherio.AccountingError{Op: "read", Requested: test.ReadSize, Reported: test.ReadSize + test.Delta}
+			if test.ReadSize < block.BlockSize() {
+				expectedErr.Requested = block.BlockSize()
+				expectedErr.Reported = block.BlockSize() + test.Delta
+			}
+			var accountingErr cipherio.AccountingError
+			if !errors.As(err, &accountingErr) || accountingErr != expectedErr {
+				t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+			}
+			if n != 0 {
+				t.Fatalf("unexpected count: %d != 0", n)
+			}
+
+			// The error must be sticky.
+			if _, err := reader.Read(buf); !errors.As(err, &accountingErr) {
+				t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+			}
+		})
+	}
+}
+
+func TestStrictDestination(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, block.BlockSize())
+
+	for _, test := range strictTests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			dst := &overreportingWriter{delta: test.Delta}
+			writer := cipherio.NewBlockWriter(dst, cipher.NewCBCEncrypter(block, iv), cipherio.WithStrictDestination())
+
+			data := make([]byte, test.ReadSize-test.ReadSize%block.BlockSize()+block.BlockSize())
+			_, err := writer.Write(data)
+			expectedErr := cipherio.AccountingError{Op: "write", Requested: len(data), Reported: len(data) + test.Delta}
+			var accountingErr cipherio.AccountingError
+			if !errors.As(err, &accountingErr) || accountingErr != expectedErr {
+				t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+			}
+			if writer.Written() != 0 {
+				t.Fatalf("unexpected written count: %d != 0", writer.Written())
+			}
+
+			// The error must be sticky.
+			if err := writer.Close(); !errors.As(err, &accountingErr) {
+				t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+			}
+		})
+	}
+}
+
+func TestStrictWellBehaved(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, block.BlockSize())
+
+	data := make([]byte, 1000*block.BlockSize())
+	_, err = rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encrypted bytes.Buffer
+	writer := cipherio.NewBlockWriter(&encrypted, cipher.NewCBCEncrypter(block, iv), cipherio.WithStrictDestination())
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := cipherio.NewBlockReader(&encrypted, cipher.NewCBCDecrypter(block, iv), cipherio.WithStrictSource())
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Fatal("decrypted data does not match")
+	}
+}
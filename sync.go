@@ -0,0 +1,64 @@
+package cipherio
+
+import (
+	"io"
+	"sync"
+)
+
+// SyncReader serializes calls to Read on the wrapped Reader, so that it can be shared between
+// goroutines.
+//
+// Note that concurrent readers receive interleaved parts of the stream.
+type SyncReader struct {
+	mu  sync.Mutex
+	src io.Reader
+}
+
+// NewSyncReader wraps the given Reader, typically a BlockReader, with a mutex.
+func NewSyncReader(src io.Reader) *SyncReader {
+	return &SyncReader{src: src}
+}
+
+func (r *SyncReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.src.Read(p)
+}
+
+// SyncWriter serializes calls to Write, Flush and Close on the wrapped WriteCloser, so that it can
+// be shared between goroutines.
+//
+// Each call to Write is atomic with regard to other calls, but the order between concurrent writes
+// is unspecified. Writers that need record boundaries should write whole records at once.
+type SyncWriter struct {
+	mu  sync.Mutex
+	dst io.WriteCloser
+}
+
+// NewSyncWriter wraps the given WriteCloser, typically a BlockWriter, with a mutex.
+func NewSyncWriter(dst io.WriteCloser) *SyncWriter {
+	return &SyncWriter{dst: dst}
+}
+
+func (w *SyncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dst.Write(p)
+}
+
+// Flush calls Flush on the wrapped WriteCloser if it provides such a method, like BlockWriter.
+// Otherwise, it does nothing.
+func (w *SyncWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if flusher, ok := w.dst.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+func (w *SyncWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dst.Close()
+}
@@ -0,0 +1,94 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestSyncWriter(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines = 8
+	const records = 100
+
+	var dst bytes.Buffer
+	writer := cipherio.NewSyncWriter(cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithHighWaterMark(256)))
+
+	// Each goroutine writes records of two blocks, filled with its own index.
+	var wg sync.WaitGroup
+	for index := 0; index < goroutines; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			record := bytes.Repeat([]byte{byte(index)}, 32)
+			for i := 0; i < records; i++ {
+				_, err := writer.Write(record)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if i%10 == 0 {
+					err = writer.Flush()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(index)
+	}
+	wg.Wait()
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every record should be found intact in the decrypted output.
+	reader := cipherio.NewSyncReader(cipherio.NewBlockReader(&dst, cipher.NewCBCDecrypter(aesCipher, iv)))
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != goroutines*records*32 {
+		t.Fatalf("unexpected read length: %d != %d", len(result), goroutines*records*32)
+	}
+
+	counts := make([]int, goroutines)
+	for offset := 0; offset < len(result); offset += 32 {
+		record := result[offset : offset+32]
+		if !bytes.Equal(record, bytes.Repeat(record[:1], 32)) || int(record[0]) >= goroutines {
+			t.Fatalf("corrupted record at offset %d", offset)
+		}
+		counts[record[0]]++
+	}
+	for index, count := range counts {
+		if count != records {
+			t.Fatalf("unexpected record count for goroutine %d: %d != %d", index, count, records)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cipherio_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/connesc/cipherio"
+)
+
+// tickingClock is a fakeClock advancing by one second each time it is read.
+type tickingClock struct {
+	*fakeClock
+}
+
+func (c tickingClock) Now() time.Time {
+	c.Advance(time.Second)
+	return c.fakeClock.Now()
+}
+
+func TestMeasureThroughput(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+	encrypter := func(chunkIndex int64) (cipher.BlockMode, error) {
+		return cipher.NewCBCEncrypter(aesCipher, iv), nil
+	}
+	decrypter := func(chunkIndex int64) (cipher.BlockMode, error) {
+		return cipher.NewCBCDecrypter(aesCipher, iv), nil
+	}
+
+	testCases := []struct {
+		name   string
+		config cipherio.ThroughputConfig
+		size   int64
+	}{
+		{"Default", cipherio.ThroughputConfig{}, 1 << 20},
+		{"Padded", cipherio.ThroughputConfig{Encrypter: encrypter, Decrypter: decrypter, Padding: cipherio.ZeroPadding}, 1000},
+		{"Parallel", cipherio.ThroughputConfig{Parallel: &cipherio.ParallelOptions{ChunkSize: 64 << 10, Workers: 4}, Padding: cipherio.ZeroPadding}, 1<<20 + 5},
+		{"LowMemory", cipherio.ThroughputConfig{WriterOptions: []cipherio.WriterOption{cipherio.WithLowMemory()}}, 64 << 10},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			// Each direction takes exactly one second according to the clock.
+			config := testCase.config
+			config.Clock = tickingClock{&fakeClock{}}
+			throughput, err := cipherio.MeasureThroughput(config, testCase.size)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			expected := float64(testCase.size) / 1e6
+			if throughput.Encrypt != expected || throughput.Decrypt != expected {
+				t.Fatalf("unexpected throughput: %+v != %v", throughput, expected)
+			}
+
+			// With the system clock, only check that a positive value is obtained.
+			config.Clock = nil
+			throughput, err = cipherio.MeasureThroughput(config, testCase.size)
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			if throughput.Encrypt <= 0 || throughput.Decrypt <= 0 {
+				t.Fatalf("unexpected throughput: %+v", throughput)
+			}
+		})
+	}
+
+	_, err = cipherio.MeasureThroughput(cipherio.ThroughputConfig{}, 1000)
+	if _, ok := err.(cipherio.AlignmentError); !ok {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	_, err = cipherio.MeasureThroughput(cipherio.ThroughputConfig{}, 0)
+	if err == nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
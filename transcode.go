@@ -0,0 +1,50 @@
+package cipherio
+
+import (
+	"io"
+)
+
+// TranscodeOptions configures Transcode. The zero value is valid.
+type TranscodeOptions struct {
+	// ReaderOptions are given to the Reader of the source format.
+	ReaderOptions []ReaderOption
+	// WriterOptions are given to the Writer of the destination format.
+	WriterOptions []WriterOption
+}
+
+// Transcode decrypts src, in any format registered with RegisterFormat, and encrypts the
+// plaintext to dst in the given format, in a single pass. It returns the number of plaintext bytes
+// transcoded.
+//
+// This allows to migrate data away from legacy formats, such as "openssl-enc", without storing
+// the plaintext. The plaintext length must be given if known, or -1, since formats like "stream"
+// need it to pad unaligned data: see OpenSSLPlaintextLen. ErrLengthMismatch is returned if the
+// actual length differs.
+//
+// None of the built-in formats is authenticated yet: "stream" only commits to its key, so the
+// output can still be tampered with. Applications needing integrity must authenticate it
+// separately, or register an authenticated format with RegisterFormat.
+//
+// The plaintext is preserved exactly: any decryption error, such as an invalid padding, stops the
+// transcoding and is returned. The output must then be discarded.
+func Transcode(dst io.Writer, src io.Reader, srcKey []byte, dstFormat string, dstKey []byte, plaintextLen int64, opts TranscodeOptions) (int64, error) {
+	reader, _, err := Open(src, srcKey, opts.ReaderOptions...)
+	if err != nil {
+		return 0, err
+	}
+	writer, err := Create(dst, dstFormat, dstKey, plaintextLen, opts.WriterOptions...)
+	if err != nil {
+		return 0, err
+	}
+
+	copied, err := io.Copy(writer, reader)
+	if err != nil {
+		writer.Close()
+		return copied, err
+	}
+	if plaintextLen >= 0 && copied != plaintextLen {
+		writer.Close()
+		return copied, ErrLengthMismatch
+	}
+	return copied, writer.Close()
+}
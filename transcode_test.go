@@ -0,0 +1,124 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestTranscode(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 100000+7)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encrypt the plaintext as "openssl enc -aes-256-cbc -pbkdf2" would.
+	var legacy bytes.Buffer
+	writer, err := cipherio.NewOpenSSLWriter(&legacy, []byte("secret"), cipherio.OpenSSLOptions{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	size, err := cipherio.OpenSSLPlaintextLen(bytes.NewReader(legacy.Bytes()), int64(legacy.Len()), []byte("secret"), cipherio.OpenSSLOptions{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	var converted bytes.Buffer
+	n, err := cipherio.Transcode(&converted, &legacy, []byte("secret"), "stream", key, size, cipherio.TranscodeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if n != int64(len(plaintext)) {
+		t.Fatalf("unexpected length: %d != %d", n, len(plaintext))
+	}
+
+	reader, header, err := cipherio.NewStreamReader(&converted, key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if header.PlaintextLen != int64(len(plaintext)) {
+		t.Fatalf("unexpected header length: %d != %d", header.PlaintextLen, len(plaintext))
+	}
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(result, plaintext) {
+		t.Fatal("transcoded data does not match plaintext")
+	}
+}
+
+func TestTranscodeLengthMismatch(t *testing.T) {
+	var legacy bytes.Buffer
+	writer, err := cipherio.Create(&legacy, "openssl-enc", []byte("secret"), -1)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write(make([]byte, 100))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	_, err = cipherio.Transcode(ioutil.Discard, &legacy, []byte("secret"), "stream", make([]byte, 16), 96, cipherio.TranscodeOptions{})
+	if err != cipherio.ErrLengthMismatch {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrLengthMismatch)
+	}
+}
+
+func TestTranscodeOptions(t *testing.T) {
+	var legacy bytes.Buffer
+	writer, err := cipherio.Create(&legacy, "openssl-enc", []byte("secret"), -1)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	_, err = writer.Write(make([]byte, 100))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// The writer options reach the destination format, which takes its IV from the given source.
+	iv := bytes.Repeat([]byte{0x42}, 16)
+	var converted bytes.Buffer
+	_, err = cipherio.Transcode(&converted, &legacy, []byte("secret"), "stream", make([]byte, 16), 100, cipherio.TranscodeOptions{
+		WriterOptions: []cipherio.WriterOption{cipherio.WithRand(bytes.NewReader(iv))},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	_, header, err := cipherio.NewStreamReader(&converted, make([]byte, 16))
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(header.IV, iv) {
+		t.Fatalf("unexpected IV: %x != %x", header.IV, iv)
+	}
+}
@@ -0,0 +1,124 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// ErrDESParity is returned by NewTripleDESCipher with StrictParity when a key byte does not have
+// odd parity.
+var ErrDESParity = errors.New("cipherio: DES key bytes must have odd parity")
+
+// ErrDegenerateKey is returned by NewTripleDESCipher when two consecutive DES keys are equal, which
+// reduces Triple-DES to single DES.
+var ErrDegenerateKey = errors.New("cipherio: Triple-DES keys are degenerate")
+
+// TripleDESOptions configures the keying of Triple-DES. The zero value is valid.
+type TripleDESOptions struct {
+	// StrictParity rejects keys whose bytes do not have odd parity, as HSMs usually do. By default,
+	// parity bits are ignored, as they are by DES itself.
+	StrictParity bool
+	// AllowSingleDES accepts degenerate keys, whose consecutive DES keys are equal. This makes
+	// Triple-DES equivalent to single DES, which is only useful for compatibility with legacy
+	// single-DES systems.
+	AllowSingleDES bool
+}
+
+// NewTripleDESCipher returns a Triple-DES (EDE) block cipher. The key is either 24 bytes long for
+// 3-key Triple-DES (keying option 1), or 16 bytes long for 2-key Triple-DES (keying option 2), in
+// which case the first DES key is reused as the third one.
+//
+// The block cipher can be used with any BlockMode, such as CBC with NewBlockReader and
+// NewBlockWriter.
+func NewTripleDESCipher(key []byte, opts TripleDESOptions) (cipher.Block, error) {
+	var expanded []byte
+	switch len(key) {
+	case 24:
+		expanded = append([]byte(nil), key...)
+	case 16:
+		expanded = append(append([]byte(nil), key...), key[:8]...)
+	default:
+		return nil, fmt.Errorf("%w: Triple-DES requires 16 or 24 bytes: %d", ErrInvalidKeySize, len(key))
+	}
+
+	if opts.StrictParity && !CheckDESParity(key) {
+		return nil, ErrDESParity
+	}
+	if !opts.AllowSingleDES {
+		k1, k2, k3 := desKeyBits(expanded[:8]), desKeyBits(expanded[8:16]), desKeyBits(expanded[16:])
+		if bytes.Equal(k1, k2) || bytes.Equal(k2, k3) {
+			return nil, ErrDegenerateKey
+		}
+	}
+
+	block, err := des.NewTripleDESCipher(expanded)
+	wipeBytes(expanded)
+	return block, err
+}
+
+// NewTripleDESCBCEncrypter returns a BlockMode encrypting with Triple-DES in CBC mode, keyed as by
+// NewTripleDESCipher. The IV must be 8 bytes long.
+func NewTripleDESCBCEncrypter(key, iv []byte, opts TripleDESOptions) (cipher.BlockMode, error) {
+	if err := checkPolicy("Triple-DES encryption", false, false); err != nil {
+		return nil, err
+	}
+	block, err := NewTripleDESCipher(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	return cipher.NewCBCEncrypter(block, iv), nil
+}
+
+// NewTripleDESCBCDecrypter is similar to NewTripleDESCBCEncrypter, except that the BlockMode
+// decrypts.
+func NewTripleDESCBCDecrypter(key, iv []byte, opts TripleDESOptions) (cipher.BlockMode, error) {
+	if err := checkPolicy("Triple-DES-CBC", true, false); err != nil {
+		return nil, err
+	}
+	block, err := NewTripleDESCipher(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIV(iv, block.BlockSize()); err != nil {
+		return nil, err
+	}
+	return cipher.NewCBCDecrypter(block, iv), nil
+}
+
+// CheckDESParity reports whether every byte of the given DES or Triple-DES key has odd parity.
+func CheckDESParity(key []byte) bool {
+	for _, b := range key {
+		if bits.OnesCount8(b)%2 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FixDESParity sets the least significant bit of every byte of the given DES or Triple-DES key,
+// in place, so that it has odd parity.
+func FixDESParity(key []byte) {
+	for i, b := range key {
+		b &^= 1
+		if bits.OnesCount8(b)%2 == 0 {
+			b |= 1
+		}
+		key[i] = b
+	}
+}
+
+// desKeyBits returns the given DES key without its parity bits, which DES ignores.
+func desKeyBits(key []byte) []byte {
+	stripped := make([]byte, len(key))
+	for i, b := range key {
+		stripped[i] = b &^ 1
+	}
+	return stripped
+}
@@ -0,0 +1,139 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestTripleDESKeying(t *testing.T) {
+	// Generate random DES keys
+	key := make([]byte, 24)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipherio.FixDESParity(key)
+	if !cipherio.CheckDESParity(key) {
+		t.Fatal("parity has not been fixed")
+	}
+
+	src := make([]byte, des.BlockSize)
+	_, err = rand.Read(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A 2-key Triple-DES cipher must match the 3-key cipher with K3 = K1.
+	twoKey, err := cipherio.NewTripleDESCipher(key[:16], cipherio.TripleDESOptions{StrictParity: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded := append(append([]byte(nil), key[:16]...), key[:8]...)
+	threeKey, err := des.NewTripleDESCipher(expanded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make([]byte, des.BlockSize)
+	expected := make([]byte, des.BlockSize)
+	twoKey.Encrypt(result, src)
+	threeKey.Encrypt(expected, src)
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected 2-key result: %x != %x", result, expected)
+	}
+
+	testCases := []struct {
+		name        string
+		key         []byte
+		opts        cipherio.TripleDESOptions
+		expectedErr error
+	}{
+		{"ThreeKey", key, cipherio.TripleDESOptions{StrictParity: true}, nil},
+		{"TwoKey", key[:16], cipherio.TripleDESOptions{}, nil},
+		{"ShortKey", key[:8], cipherio.TripleDESOptions{}, cipherio.ErrInvalidKeySize},
+		{"BadParity", append([]byte{key[0] ^ 1}, key[1:]...), cipherio.TripleDESOptions{StrictParity: true}, cipherio.ErrDESParity},
+		{"IgnoredParity", append([]byte{key[0] ^ 1}, key[1:]...), cipherio.TripleDESOptions{}, nil},
+		{"Degenerate", append(append([]byte(nil), key[:8]...), key[:16]...), cipherio.TripleDESOptions{}, cipherio.ErrDegenerateKey},
+		{"DegenerateParity", append(append([]byte(nil), key[:8]...), key[0]^1, key[1], key[2], key[3], key[4], key[5], key[6], key[7]), cipherio.TripleDESOptions{}, cipherio.ErrDegenerateKey},
+		{"SingleDES", append(append([]byte(nil), key[:8]...), key[:16]...), cipherio.TripleDESOptions{AllowSingleDES: true}, nil},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := cipherio.NewTripleDESCipher(testCase.key, testCase.opts)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("unexpected err: %v != %v", err, testCase.expectedErr)
+			}
+		})
+	}
+}
+
+func TestTripleDESCBC(t *testing.T) {
+	// Generate a random 2-key Triple-DES key
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, des.BlockSize)
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("PIN block and other banking data")
+
+	encrypter, err := cipherio.NewTripleDESCBCEncrypter(key, iv, cipherio.TripleDESOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encrypted bytes.Buffer
+	writer := cipherio.NewBlockWriterWithPadding(&encrypted, encrypter, cipherio.PKCS7Padding)
+	_, err = writer.Write(plaintext[:5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write(plaintext[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := cipherio.NewTripleDESCipher(key, cipherio.TripleDESOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(expected, plaintext)
+	if !bytes.Equal(encrypted.Bytes(), expected) {
+		t.Fatalf("unexpected ciphertext: %x != %x", encrypted.Bytes(), expected)
+	}
+
+	decrypter, err := cipherio.NewTripleDESCBCDecrypter(key, iv, cipherio.TripleDESOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ioutil.ReadAll(cipherio.NewBlockReader(&encrypted, decrypter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("unexpected plaintext: %q != %q", decrypted, plaintext)
+	}
+
+	_, err = cipherio.NewTripleDESCBCEncrypter(key, iv[:4], cipherio.TripleDESOptions{})
+	if !errors.Is(err, cipherio.ErrInvalidIV) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidIV)
+	}
+}
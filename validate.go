@@ -0,0 +1,35 @@
+package cipherio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidIV is returned, possibly wrapped, when an IV does not match the block size of the
+// cipher. Use errors.Is to detect it.
+var ErrInvalidIV = errors.New("cipherio: invalid IV")
+
+// ErrInvalidKeySize is returned, possibly wrapped, when a key does not match the key sizes
+// supported by the cipher. Use errors.Is to detect it.
+var ErrInvalidKeySize = errors.New("cipherio: invalid key size")
+
+// checkIV returns an error wrapping ErrInvalidIV if iv is not blockSize bytes long, instead of
+// letting crypto/cipher panic.
+func checkIV(iv []byte, blockSize int) error {
+	if len(iv) != blockSize {
+		return fmt.Errorf("%w: length must equal block size: %d != %d", ErrInvalidIV, len(iv), blockSize)
+	}
+	return nil
+}
+
+// newAESCipher is similar to aes.NewCipher, except that an invalid key size is reported with an
+// error wrapping ErrInvalidKeySize.
+func newAESCipher(key []byte) (cipher.Block, error) {
+	switch len(key) {
+	case 16, 24, 32:
+		return aes.NewCipher(key)
+	}
+	return nil, fmt.Errorf("%w: AES requires 16, 24 or 32 bytes: %d", ErrInvalidKeySize, len(key))
+}
@@ -0,0 +1,58 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func TestInvalidKeySize(t *testing.T) {
+	header := cipherio.StreamHeader{
+		Cipher:       cipherio.CipherAES,
+		Mode:         cipherio.ModeCBC,
+		IV:           make([]byte, 16),
+		PlaintextLen: -1,
+	}
+	key := make([]byte, 20)
+
+	_, err := cipherio.NewStreamWriter(ioutil.Discard, &header, key)
+	if !errors.Is(err, cipherio.ErrInvalidKeySize) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidKeySize)
+	}
+
+	_, err = cipherio.NewAESKeyWrapper(key)
+	if !errors.Is(err, cipherio.ErrInvalidKeySize) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidKeySize)
+	}
+
+	_, err = cipherio.NewEnvelopeWriter(ioutil.Discard, &header, make([]byte, 32), []cipherio.Recipient{
+		{KeyID: []byte("alice"), KEK: key},
+	})
+	if !errors.Is(err, cipherio.ErrInvalidKeySize) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidKeySize)
+	}
+}
+
+func TestInvalidIV(t *testing.T) {
+	aesCipher, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	writer := cipherio.NewBlockWriter(&buf, cipher.NewCBCEncrypter(aesCipher, make([]byte, 16)))
+	err = writer.FinalizeRecord(make([]byte, 12))
+	if !errors.Is(err, cipherio.ErrInvalidIV) {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrInvalidIV)
+	}
+
+	// The Writer is left untouched.
+	if err := writer.FinalizeRecord(make([]byte, 16)); err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+}
@@ -0,0 +1,71 @@
+package cipherio
+
+import (
+	"bytes"
+	"crypto/cipher"
+)
+
+// WithVerification makes the Writer decrypt each (en|de)crypted block with the given independent
+// BlockMode, and compare the result against its input before writing it. This catches faulty
+// hardware or cipher implementations, at the cost of doubling the work.
+//
+// If every > 1, only one call to CryptBlocks out of every is verified. In that case, the decrypter
+// should provide a SetIV method, like the CBC decrypter of crypto/cipher: skipped blocks are then
+// not decrypted at all, and the IV is set to the last skipped block, as CBC requires. Otherwise,
+// all blocks are verified.
+//
+// A mismatch is reported as a VerificationError, and the faulty blocks are not written.
+func WithVerification(decrypter cipher.BlockMode, every int) WriterOption {
+	return func(o *writerOptions) {
+		o.verifier = &verifier{
+			blockMode: decrypter,
+			every:     every,
+		}
+	}
+}
+
+type verifier struct {
+	blockMode cipher.BlockMode
+	every     int
+	calls     int    // number of calls to crypt so far
+	offset    int64  // number of bytes crypted so far
+	plain     []byte // copy of the input, in case it is crypted inplace
+	decrypted []byte
+}
+
+// crypt calls CryptBlocks on the given BlockMode, then verifies the result if sampled.
+func (v *verifier) crypt(blockMode cipher.BlockMode, dst, src []byte) error {
+	sampled := v.every <= 1 || v.calls%v.every == 0
+	v.calls++
+
+	// Like CryptBlocks, only consider the length of src.
+	dst = dst[:len(src)]
+
+	if setter, ok := v.blockMode.(ivSetter); ok && !sampled {
+		blockMode.CryptBlocks(dst, src)
+		setter.SetIV(dst[len(dst)-v.blockMode.BlockSize():])
+		v.offset += int64(len(dst))
+		return nil
+	}
+
+	v.plain = append(v.plain[:0], src...)
+	blockMode.CryptBlocks(dst, src)
+
+	if cap(v.decrypted) < len(dst) {
+		v.decrypted = make([]byte, len(dst))
+	}
+	decrypted := v.decrypted[:len(dst)]
+	v.blockMode.CryptBlocks(decrypted, dst)
+
+	if !bytes.Equal(decrypted, v.plain) {
+		blockSize := v.blockMode.BlockSize()
+		for index := 0; index < len(decrypted); index += blockSize {
+			if !bytes.Equal(decrypted[index:index+blockSize], v.plain[index:index+blockSize]) {
+				return VerificationError{Offset: v.offset + int64(index)}
+			}
+		}
+	}
+
+	v.offset += int64(len(dst))
+	return nil
+}
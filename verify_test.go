@@ -0,0 +1,144 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+// faultyBlockMode corrupts the output of a given block.
+type faultyBlockMode struct {
+	cipher.BlockMode
+	faultyBlock int
+	blocks      int
+}
+
+func (m *faultyBlockMode) CryptBlocks(dst, src []byte) {
+	m.BlockMode.CryptBlocks(dst, src)
+	for offset := 0; offset < len(dst); offset += m.BlockSize() {
+		if m.blocks == m.faultyBlock {
+			dst[offset] ^= 0x01
+		}
+		m.blocks++
+	}
+}
+
+type verificationTest struct {
+	Name        string
+	Every       int
+	FaultyBlock int
+	ExpectedErr *cipherio.VerificationError
+}
+
+func TestVerification(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 20*aesCipher.BlockSize())
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, len(originalBytes))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, originalBytes)
+
+	// Prepare test cases
+	testCases := []verificationTest{
+		{
+			Name:        "Valid",
+			Every:       1,
+			FaultyBlock: -1,
+			ExpectedErr: nil,
+		},
+		{
+			Name:        "ValidSampled",
+			Every:       3,
+			FaultyBlock: -1,
+			ExpectedErr: nil,
+		},
+		{
+			Name:        "Faulty",
+			Every:       1,
+			FaultyBlock: 7,
+			ExpectedErr: &cipherio.VerificationError{Offset: 7 * 16},
+		},
+		{
+			Name:        "FaultySampled",
+			Every:       2,
+			FaultyBlock: 8,
+			ExpectedErr: &cipherio.VerificationError{Offset: 8 * 16},
+		},
+		// With CBC, a faulty block that is not verified is still detected by the next verified one,
+		// because the IV of the latter is the faulty block.
+		{
+			Name:        "FaultySkipped",
+			Every:       2,
+			FaultyBlock: 7,
+			ExpectedErr: &cipherio.VerificationError{Offset: 8 * 16},
+		},
+	}
+
+	// Run test cases
+	for index := range testCases {
+		testCase := testCases[index]
+
+		t.Run(testCase.Name, func(t *testing.T) {
+			blockMode := &faultyBlockMode{
+				BlockMode:   cipher.NewCBCEncrypter(aesCipher, iv),
+				faultyBlock: testCase.FaultyBlock,
+			}
+
+			var dst bytes.Buffer
+			writer := cipherio.NewBlockWriter(&dst, blockMode, cipherio.WithVerification(cipher.NewCBCDecrypter(aesCipher, iv), testCase.Every))
+
+			// Write block by block, so that each block is crypted by its own call.
+			var err error
+			for offset := 0; offset < len(originalBytes) && err == nil; offset += 16 {
+				_, err = writer.Write(originalBytes[offset : offset+16])
+			}
+			if err == nil {
+				err = writer.Close()
+			}
+
+			if testCase.ExpectedErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(dst.Bytes(), expectedBytes) {
+					t.Fatalf("unexpected written bytes")
+				}
+				return
+			}
+
+			if err != *testCase.ExpectedErr {
+				t.Fatalf("unexpected err: %v != %v", err, *testCase.ExpectedErr)
+			}
+			// Faulty blocks must not be written.
+			if int64(dst.Len()) != testCase.ExpectedErr.Offset {
+				t.Fatalf("unexpected written length: %d != %d", dst.Len(), testCase.ExpectedErr.Offset)
+			}
+		})
+	}
+}
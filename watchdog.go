@@ -0,0 +1,184 @@
+package cipherio
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrStalled is wrapped by the StalledError returned by WatchdogReader and WatchdogWriter.
+var ErrStalled = errors.New("cipherio: stalled IO")
+
+// WatchdogReader wraps a Reader to abort any Read which does not return within a given duration,
+// so that a copy from a dead network mount or peer fails instead of hanging forever.
+//
+// A stalled Read is aborted by setting a read deadline in the past if the wrapped Reader has a
+// SetReadDeadline method, like net.Conn and os.File, or else by closing it if it is an io.Closer.
+// Closing is also the fallback when the deadline cannot be set, as with an os.File opened on a
+// regular file, including on network mounts.
+// The call then returns a StalledError, and so does any subsequent call.
+//
+// A WatchdogReader is not safe for concurrent use, like the Reader it wraps.
+type WatchdogReader struct {
+	src      io.Reader
+	watchdog watchdog
+}
+
+// NewWatchdogReader wraps the given Reader so that each call to its Read method is aborted after
+// the given timeout, which must therefore exceed the time needed to fill a buffer on a slow but
+// healthy source. Timers are created by the given Clock, or by SystemClock if nil.
+//
+// If the wrapped Reader can be neither given a deadline nor closed, a stalled Read cannot be
+// aborted: the StalledError is only returned once it eventually returns.
+func NewWatchdogReader(src io.Reader, timeout time.Duration, clock Clock) *WatchdogReader {
+	var setDeadline func(t time.Time) error
+	if src, ok := src.(interface{ SetReadDeadline(t time.Time) error }); ok {
+		setDeadline = src.SetReadDeadline
+	}
+	closer, _ := src.(io.Closer)
+
+	return &WatchdogReader{
+		src: src,
+		watchdog: watchdog{
+			op:      "read",
+			timeout: timeout,
+			clock:   clockOrDefault(clock),
+			abort:   abortFunc(setDeadline, closer),
+		},
+	}
+}
+
+func (r *WatchdogReader) Read(p []byte) (int, error) {
+	if err := r.watchdog.start(); err != nil {
+		return 0, err
+	}
+	n, err := r.src.Read(p)
+	if stalledErr := r.watchdog.stop(); stalledErr != nil {
+		return n, stalledErr
+	}
+	return n, err
+}
+
+// WatchdogWriter is similar to WatchdogReader, for a Writer. A stalled Write is aborted with
+// SetWriteDeadline or Close.
+type WatchdogWriter struct {
+	dst      io.Writer
+	watchdog watchdog
+}
+
+// NewWatchdogWriter is similar to NewWatchdogReader, for a Writer.
+func NewWatchdogWriter(dst io.Writer, timeout time.Duration, clock Clock) *WatchdogWriter {
+	var setDeadline func(t time.Time) error
+	if dst, ok := dst.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		setDeadline = dst.SetWriteDeadline
+	}
+	closer, _ := dst.(io.Closer)
+
+	return &WatchdogWriter{
+		dst: dst,
+		watchdog: watchdog{
+			op:      "write",
+			timeout: timeout,
+			clock:   clockOrDefault(clock),
+			abort:   abortFunc(setDeadline, closer),
+		},
+	}
+}
+
+func (w *WatchdogWriter) Write(p []byte) (int, error) {
+	if err := w.watchdog.start(); err != nil {
+		return 0, err
+	}
+	n, err := w.dst.Write(p)
+	if stalledErr := w.watchdog.stop(); stalledErr != nil {
+		return n, stalledErr
+	}
+	return n, err
+}
+
+// pastDeadline is used to make pending and future IO fail immediately.
+var pastDeadline = time.Unix(1, 0)
+
+// abortFunc returns a function aborting a stalled call by setting a deadline in the past, or by
+// closing if that fails, as for an *os.File opened on a regular file. Either may be nil. It returns
+// nil if neither is possible.
+func abortFunc(setDeadline func(t time.Time) error, closer io.Closer) func() {
+	if setDeadline == nil && closer == nil {
+		return nil
+	}
+	return func() {
+		if setDeadline != nil && setDeadline(pastDeadline) == nil {
+			return
+		}
+		if closer != nil {
+			_ = closer.Close()
+		}
+	}
+}
+
+// watchdog aborts a call which does not return before its timer fires.
+type watchdog struct {
+	op      string
+	timeout time.Duration
+	clock   Clock
+	abort   func() // nil if the call cannot be aborted
+
+	mu         sync.Mutex
+	timer      Timer
+	generation uint64 // incremented by each start and stop, so that stale timers are ignored
+	stalled    bool
+}
+
+// start arms a timer before a call, unless a previous call has stalled.
+func (d *watchdog) start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stalled {
+		return d.err()
+	}
+	// A Timer cannot tell which call it was armed for, so each call gets its own.
+	d.generation++
+	generation := d.generation
+	d.timer = d.clock.AfterFunc(d.timeout, func() { d.fire(generation) })
+	return nil
+}
+
+// stop disarms the timer after a call, and returns a StalledError if it has fired meanwhile.
+//
+// The timer may already be running, and only acquire the lock after stop has returned: it then
+// finds a newer generation and does nothing.
+func (d *watchdog) stop() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.timer.Stop()
+	d.generation++
+	if d.stalled {
+		return d.err()
+	}
+	return nil
+}
+
+// fire is called by the timer armed for the given generation.
+func (d *watchdog) fire(generation uint64) {
+	d.mu.Lock()
+	if generation != d.generation {
+		d.mu.Unlock()
+		return
+	}
+	d.stalled = true
+	d.mu.Unlock()
+
+	if d.abort != nil {
+		d.abort()
+	}
+}
+
+func (d *watchdog) err() error {
+	return StalledError{
+		Op:      d.op,
+		Timeout: d.timeout,
+	}
+}
@@ -0,0 +1,213 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/connesc/cipherio"
+)
+
+// advanceUntil advances the given clock step by step until fn returns, and returns its error.
+func advanceUntil(t *testing.T, clock *fakeClock, step time.Duration, fn func() error) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(time.Millisecond):
+			clock.Advance(step)
+		}
+	}
+	t.Fatalf("call not aborted")
+	return nil
+}
+
+// lateClock is a Clock whose timers cannot be stopped, as when their function is already running.
+// The functions are only called by fireAll.
+type lateClock struct {
+	fns []func()
+}
+
+type lateTimer struct{}
+
+func (lateTimer) Stop() bool                 { return false }
+func (lateTimer) Reset(d time.Duration) bool { return false }
+
+func (c *lateClock) Now() time.Time { return time.Time{} }
+
+func (c *lateClock) AfterFunc(d time.Duration, f func()) cipherio.Timer {
+	c.fns = append(c.fns, f)
+	return lateTimer{}
+}
+
+func (c *lateClock) fireAll() {
+	for _, fn := range c.fns {
+		fn()
+	}
+}
+
+// closeCounter counts the calls to Close.
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestWatchdogReader(t *testing.T) {
+	const timeout = 10 * time.Second
+
+	t.Run("Healthy", func(t *testing.T) {
+		plaintext := make([]byte, 1000)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+		reader := cipherio.NewWatchdogReader(bytes.NewReader(plaintext), timeout, &fakeClock{})
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatalf("unexpected result")
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		// Nothing is ever written to the other end.
+		conn, other := net.Pipe()
+		defer conn.Close()
+		defer other.Close()
+
+		clock := &fakeClock{}
+		reader := cipherio.NewWatchdogReader(conn, timeout, clock)
+		err := advanceUntil(t, clock, time.Second, func() error {
+			_, err := reader.Read(make([]byte, 16))
+			return err
+		})
+		expectedErr := cipherio.StalledError{Op: "read", Timeout: timeout}
+		if err != expectedErr {
+			t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+		}
+		if !errors.Is(err, cipherio.ErrStalled) {
+			t.Fatalf("unexpected err: %v is not %v", err, cipherio.ErrStalled)
+		}
+
+		// The error is sticky.
+		_, err = reader.Read(make([]byte, 16))
+		if err != expectedErr {
+			t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+		}
+	})
+
+	t.Run("LateTimer", func(t *testing.T) {
+		// Timers firing once their call has returned are ignored.
+		clock := &lateClock{}
+		src := &closeCounter{Reader: bytes.NewReader(make([]byte, 100))}
+		reader := cipherio.NewWatchdogReader(src, timeout, clock)
+		_, err := reader.Read(make([]byte, 50))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+		clock.fireAll()
+		if src.closed != 0 {
+			t.Fatalf("source aborted by a stale timer")
+		}
+		_, err = reader.Read(make([]byte, 50))
+		if err != nil {
+			t.Fatalf("unexpected err: %v != %v", err, nil)
+		}
+	})
+
+	t.Run("RegularFile", func(t *testing.T) {
+		// Regular files do not support deadlines, and are closed instead.
+		file, err := ioutil.TempFile("", "cipherio-watchdog-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		reader := cipherio.NewWatchdogReader(file, timeout, &fakeClock{})
+		cipherio.AbortWatchdog(reader)
+		_, err = file.Read(make([]byte, 16))
+		if !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("unexpected err: %v is not %v", err, os.ErrClosed)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		// An io.PipeReader has no deadline, and is closed instead.
+		pipeReader, pipeWriter := io.Pipe()
+		defer pipeWriter.Close()
+
+		clock := &fakeClock{}
+		reader := cipherio.NewWatchdogReader(pipeReader, timeout, clock)
+		err := advanceUntil(t, clock, time.Second, func() error {
+			_, err := reader.Read(make([]byte, 16))
+			return err
+		})
+		if !errors.Is(err, cipherio.ErrStalled) {
+			t.Fatalf("unexpected err: %v is not %v", err, cipherio.ErrStalled)
+		}
+		_, err = pipeWriter.Write([]byte{0})
+		if err != io.ErrClosedPipe {
+			t.Fatalf("unexpected err: %v != %v", err, io.ErrClosedPipe)
+		}
+	})
+}
+
+func TestWatchdogWriter(t *testing.T) {
+	const timeout = 10 * time.Second
+
+	t.Run("Healthy", func(t *testing.T) {
+		var dst bytes.Buffer
+		clock := &fakeClock{}
+		writer := cipherio.NewWatchdogWriter(&dst, timeout, clock)
+		for i := 0; i < 10; i++ {
+			_, err := writer.Write(make([]byte, 100))
+			if err != nil {
+				t.Fatalf("unexpected err: %v != %v", err, nil)
+			}
+			// Time elapsed between calls does not count.
+			clock.Advance(timeout)
+		}
+		if dst.Len() != 1000 {
+			t.Fatalf("unexpected size: %d != %d", dst.Len(), 1000)
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		// Nothing is ever read from the other end.
+		conn, other := net.Pipe()
+		defer conn.Close()
+		defer other.Close()
+
+		clock := &fakeClock{}
+		writer := cipherio.NewWatchdogWriter(conn, timeout, clock)
+		err := advanceUntil(t, clock, time.Second, func() error {
+			_, err := writer.Write(make([]byte, 16))
+			return err
+		})
+		expectedErr := cipherio.StalledError{Op: "write", Timeout: timeout}
+		if err != expectedErr {
+			t.Fatalf("unexpected err: %v != %v", err, expectedErr)
+		}
+		if err.Error() != "cipherio: wrapped write made no progress for 10s" {
+			t.Fatalf("unexpected message: %q", err.Error())
+		}
+	})
+}
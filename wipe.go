@@ -0,0 +1,80 @@
+package cipherio
+
+import (
+	"errors"
+	"runtime"
+)
+
+// ErrWiped is returned by the Readers and Writers of this package once their Wipe method has been
+// called.
+var ErrWiped = errors.New("cipherio: use of wiped Reader or Writer")
+
+// WithWipeOnEOF makes the Reader zero its internal buffer as soon as Read returns an error,
+// including EOF, so that no plaintext remains in memory once the stream ends.
+func WithWipeOnEOF() ReaderOption {
+	return func(o *readerOptions) {
+		o.wipe = true
+	}
+}
+
+// WithWipeOnClose makes the Writer zero its internal buffers once closed or failed, and at the end
+// of each record written with FinalizeRecord, so that no plaintext remains in memory. The pooled
+// buffer of large writes is zeroed as soon as each of them returns.
+func WithWipeOnClose() WriterOption {
+	return func(o *writerOptions) {
+		o.wipe = true
+	}
+}
+
+// wipeBytes zeroes the whole capacity of the given slice.
+func wipeBytes(b []byte) {
+	FillBytes(b[:cap(b)], 0)
+}
+
+// Wipe zeroes the internal buffer and discards any buffered byte. Unless an error has already been
+// returned, such as EOF, any subsequent call to Read returns ErrWiped.
+func (r *BlockReader) Wipe() {
+	r.guard.acquire(methodWipe)
+	defer r.guard.release()
+
+	wipeBytes(r.buf)
+	r.buf = r.buf[:0]
+	r.crypted = 0
+	if r.err == nil {
+		r.err = ErrWiped
+	}
+}
+
+// Wipe zeroes the internal buffers and discards any buffered byte, without writing them. It is
+// typically called after Close, or instead of it to abandon the stream. Unless the Writer has
+// already been closed or an error has already been returned, any subsequent call to Write, Flush
+// or Close returns ErrWiped. After a successful Close, Close remains a no-op.
+func (w *BlockWriter) Wipe() {
+	w.guard.acquire(methodWipe)
+	defer w.guard.release()
+
+	// The internal buffer is only released by Close once the Writer is done.
+	closed := w.buf == nil
+	w.wipe = true
+	w.releaseBuf()
+	if w.err == nil && !closed {
+		w.err = ErrWiped
+	}
+}
+
+// releaseBuf frees the internal buffer, after having wiped it if requested. Any finalizer set by
+// WithCloseCheck is cleared, since nothing remains to be written.
+func (w *BlockWriter) releaseBuf() {
+	if w.wipe {
+		wipeBytes(w.buf)
+		if w.verifier != nil {
+			wipeBytes(w.verifier.plain)
+			wipeBytes(w.verifier.decrypted)
+		}
+	}
+	w.buf = nil
+	if w.finalizer {
+		runtime.SetFinalizer(w, nil)
+		w.finalizer = false
+	}
+}
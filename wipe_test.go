@@ -0,0 +1,221 @@
+package cipherio_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/connesc/cipherio"
+)
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func newWipeTestCipher(t *testing.T) (cipher.Block, []byte) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block, make([]byte, block.BlockSize())
+}
+
+func TestReaderWipeOnEOF(t *testing.T) {
+	block, iv := newWipeTestCipher(t)
+
+	// Use a non-zero plaintext, so that leftovers are detected.
+	plaintext := bytes.Repeat([]byte{0xaa}, 4*block.BlockSize())
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	for _, wipe := range []bool{false, true} {
+		var opts []cipherio.ReaderOption
+		if wipe {
+			opts = append(opts, cipherio.WithWipeOnEOF())
+		}
+		reader := cipherio.NewBlockReader(bytes.NewReader(ciphertext), cipher.NewCBCDecrypter(block, iv), opts...)
+		buf := cipherio.ReaderBuf(reader)
+
+		// Small reads make the Reader decrypt into its internal buffer.
+		var result []byte
+		small := make([]byte, 3)
+		var err error
+		for err == nil {
+			var n int
+			n, err = reader.Read(small)
+			result = append(result, small[:n]...)
+		}
+		if err != io.EOF {
+			t.Fatalf("unexpected err: %v != %v", err, io.EOF)
+		}
+		if !bytes.Equal(result, plaintext) {
+			t.Fatal("decrypted data does not match")
+		}
+
+		if isZero(buf) != wipe {
+			t.Fatalf("unexpected internal buffer with wipe=%v: %x", wipe, buf)
+		}
+	}
+}
+
+func TestReaderWipe(t *testing.T) {
+	block, iv := newWipeTestCipher(t)
+
+	plaintext := bytes.Repeat([]byte{0xaa}, 4*block.BlockSize())
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	reader := cipherio.NewBlockReader(bytes.NewReader(ciphertext), cipher.NewCBCDecrypter(block, iv))
+	buf := cipherio.ReaderBuf(reader)
+
+	small := make([]byte, 3)
+	if _, err := reader.Read(small); err != nil {
+		t.Fatal(err)
+	}
+	if isZero(buf) {
+		t.Fatal("internal buffer should hold the remaining plaintext")
+	}
+
+	reader.Wipe()
+	if !isZero(buf) {
+		t.Fatalf("internal buffer should be wiped: %x", buf)
+	}
+	if n, err := reader.Read(small); n != 0 || err != cipherio.ErrWiped {
+		t.Fatalf("unexpected result: (%d, %v) != (0, %v)", n, err, cipherio.ErrWiped)
+	}
+}
+
+func TestWriterWipeOnClose(t *testing.T) {
+	block, iv := newWipeTestCipher(t)
+
+	for _, wipe := range []bool{false, true} {
+		opts := []cipherio.WriterOption{cipherio.WithHighWaterMark(4 * block.BlockSize())}
+		if wipe {
+			opts = append(opts, cipherio.WithWipeOnClose())
+		}
+		var encrypted bytes.Buffer
+		writer := cipherio.NewBlockWriterWithPadding(&encrypted, cipher.NewCBCEncrypter(block, iv), cipherio.PKCS7Padding, opts...)
+		buf := cipherio.WriterBuf(writer)
+
+		if _, err := writer.Write(bytes.Repeat([]byte{0xaa}, 2*block.BlockSize()+5)); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if encrypted.Len() != 3*block.BlockSize() {
+			t.Fatalf("unexpected output length: %d != %d", encrypted.Len(), 3*block.BlockSize())
+		}
+
+		if isZero(buf) != wipe {
+			t.Fatalf("unexpected internal buffer with wipe=%v: %x", wipe, buf)
+		}
+	}
+}
+
+func TestWriterWipe(t *testing.T) {
+	block, iv := newWipeTestCipher(t)
+
+	var encrypted bytes.Buffer
+	writer := cipherio.NewBlockWriter(&encrypted, cipher.NewCBCEncrypter(block, iv))
+	buf := cipherio.WriterBuf(writer)
+
+	if _, err := writer.Write(bytes.Repeat([]byte{0xaa}, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if isZero(buf) {
+		t.Fatal("internal buffer should hold the incomplete block")
+	}
+
+	writer.Wipe()
+	if !isZero(buf) {
+		t.Fatalf("internal buffer should be wiped: %x", buf)
+	}
+	if _, err := writer.Write([]byte{1}); err != cipherio.ErrWiped {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrWiped)
+	}
+	if err := writer.Close(); err != cipherio.ErrWiped {
+		t.Fatalf("unexpected err: %v != %v", err, cipherio.ErrWiped)
+	}
+	if encrypted.Len() != 0 {
+		t.Fatalf("unexpected output length: %d != 0", encrypted.Len())
+	}
+}
+
+func TestWriterWipeAfterClose(t *testing.T) {
+	block, iv := newWipeTestCipher(t)
+
+	var encrypted bytes.Buffer
+	writer := cipherio.NewBlockWriter(&encrypted, cipher.NewCBCEncrypter(block, iv))
+	if _, err := writer.Write(bytes.Repeat([]byte{0xaa}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// Wiping a closed Writer leaves Close a no-op.
+	writer.Wipe()
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if encrypted.Len() != 32 {
+		t.Fatalf("unexpected output length: %d != 32", encrypted.Len())
+	}
+}
+
+// retainingWriter keeps a reference to the last buffer passed to Write.
+type retainingWriter struct {
+	last []byte
+}
+
+func (w *retainingWriter) Write(p []byte) (int, error) {
+	w.last = p
+	return len(p), nil
+}
+
+func TestWriterWipeLargeWrite(t *testing.T) {
+	block, iv := newWipeTestCipher(t)
+
+	// Decrypt a write larger than the internal buffer, which goes through a pooled buffer.
+	plaintext := bytes.Repeat([]byte{0xaa}, 2048*block.BlockSize())
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	for _, wipe := range []bool{false, true} {
+		var opts []cipherio.WriterOption
+		if wipe {
+			opts = append(opts, cipherio.WithWipeOnClose())
+		}
+		var dst retainingWriter
+		writer := cipherio.NewBlockWriter(&dst, cipher.NewCBCDecrypter(block, iv), opts...)
+		if _, err := writer.Write(ciphertext); err != nil {
+			t.Fatal(err)
+		}
+		if len(dst.last) != len(plaintext) {
+			t.Fatalf("unexpected write length: %d != %d", len(dst.last), len(plaintext))
+		}
+		if isZero(dst.last) != wipe {
+			t.Fatalf("unexpected pooled buffer with wipe=%v", wipe)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
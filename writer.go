@@ -2,49 +2,159 @@ package cipherio
 
 import (
 	"crypto/cipher"
+	"errors"
+	"fmt"
 	"io"
+	"sync"
 )
 
-type blockWriter struct {
+// BlockWriter is the WriteCloser returned by NewBlockWriter and NewBlockWriterWithPadding.
+//
+// A BlockWriter is not safe for concurrent use: calls to its methods must be serialized, for
+// example with a SyncWriter. Violations can be detected with WithWriteConcurrencyCheck.
+type BlockWriter struct {
 	dst       io.Writer
 	blockMode cipher.BlockMode
 	padding   Padding
 	blockSize int
 	buf       []byte // used to store both incomplete and crypted blocks
+	crypted   int    // number of crypted bytes at the start of buf, not yet written to dst
+	highWater int    // if > 0, crypted bytes are only written to dst once reaching this amount
+	large     bool   // if true, large writes are crypted at once into a pooled buffer
 	err       error
+	accepted  int64 // number of bytes acknowledged by Write so far
+	flushed   int64 // number of bytes written to dst so far, excluding any reserved header
+	progress  writeProgress
+	header    *headerReservation
+	verifier  *verifier
+	strict    bool
+	wipe      bool
+	clock     Clock
+	profiler  *profiler
+	observers *streamObservers
+	stats     IOStats
+	finalizer bool // if true, a finalizer set by WithCloseCheck must be cleared
+	guard     exclusiveGuard
 }
 
 // NewBlockWriter wraps the given Writer to add on-the-fly encryption or decryption using the
 // given BlockMode.
 //
-// Data must be aligned to the cipher block size: ErrUnexpectedEOF is returned if Close is called
+// Data must be aligned to the cipher block size: an AlignmentError is returned if Close is called
 // in the middle of a block.
 //
-// This Writer allocates an internal buffer of 1024 blocks, which is freed when an error is
-// encountered or when Close is called. Other than that, there is no dynamic allocation.
+// This Writer allocates an internal buffer of 1024 blocks (16 with TinyGo), which is freed when an
+// error is encountered or when Close is called. Larger writes made of complete blocks are
+// (en|de)crypted at once into a pooled buffer and written with a single call, except with TinyGo.
+// Other than that, there is no dynamic allocation.
 //
 // Close must be called at least once. After that, Close becomes a no-op and Write must not be
 // called anymore.
-func NewBlockWriter(dst io.Writer, blockMode cipher.BlockMode) io.WriteCloser {
-	return NewBlockWriterWithPadding(dst, blockMode, nil)
+//
+// Optional behaviours can be enabled with WriterOption values, such as WithWriteProgress.
+func NewBlockWriter(dst io.Writer, blockMode cipher.BlockMode, opts ...WriterOption) *BlockWriter {
+	return NewBlockWriterWithPadding(dst, blockMode, nil, opts...)
 }
 
 // NewBlockWriterWithPadding is similar to NewBlockWriter, except that Close fills any incomplete
-// block with the given padding instead of returning ErrUnexpectedEOF.
-func NewBlockWriterWithPadding(dst io.Writer, blockMode cipher.BlockMode, padding Padding) io.WriteCloser {
+// block with the given padding instead of returning an AlignmentError.
+func NewBlockWriterWithPadding(dst io.Writer, blockMode cipher.BlockMode, padding Padding, opts ...WriterOption) *BlockWriter {
 	blockSize := blockMode.BlockSize()
+	options := newWriterOptions(opts)
+
+	var header *headerReservation
+	if options.headerFn != nil {
+		header = &headerReservation{
+			size: options.headerSize,
+			fn:   options.headerFn,
+		}
+	}
 
-	return &blockWriter{
+	w := &BlockWriter{
 		dst:       dst,
 		blockMode: blockMode,
 		padding:   padding,
 		blockSize: blockSize,
-		buf:       make([]byte, 0, 1024*blockSize),
+		buf:       make([]byte, 0, writerBufferSize(blockSize, options.highWater, options.lowMemory)),
+		crypted:   0,
+		highWater: options.highWater,
+		large:     largeWrites && !options.lowMemory,
 		err:       nil,
+		progress: writeProgress{
+			every: options.progressEvery,
+			fn:    options.progressFn,
+		},
+		header:    header,
+		verifier:  options.verifier,
+		strict:    options.strict,
+		wipe:      options.wipe,
+		clock:     clockOrDefault(options.clock),
+		profiler:  options.profiler,
+		observers: observeStream(options.observers),
+		guard:     newExclusiveGuard(options.exclusive, "BlockWriter", "SyncWriter"),
+	}
+	if options.closeCheck {
+		setCloseCheck(w, options.closeCheckFn)
+	}
+	return w
+}
+
+// writerBufferSize returns the size of the internal buffer of a BlockWriter. It must be able to
+// hold crypted bytes up to the high-water mark, followed by an incomplete block.
+func writerBufferSize(blockSize, highWater int, lowMemory bool) int {
+	if lowMemory && highWater == 0 {
+		return blockSize
+	}
+	if highWater > 0 {
+		return ((highWater+blockSize-1)/blockSize + 1) * blockSize
+	}
+	return defaultBufferBlocks * blockSize
+}
+
+// WithLowMemory makes the Writer use an internal buffer of a single block, and never allocate
+// according to the size of a write, for constrained devices handling many streams. Each complete
+// block is then (en|de)crypted and written on its own, at the cost of throughput.
+//
+// With a BlockReader, whose internal buffer is always a single block, the steady-state overhead of
+// a stream is then below 1 KiB with 16-byte blocks. Neither of them starts any goroutine, unlike
+// CopyParallel, EncryptFile or PrefetchReader, which should be avoided in this case.
+//
+// WithHighWaterMark takes precedence, since it requires a larger buffer.
+func WithLowMemory() WriterOption {
+	return func(o *writerOptions) {
+		o.lowMemory = true
+	}
+}
+
+// WithHighWaterMark makes the Writer accumulate complete blocks in its internal buffer until at
+// least size bytes are available, instead of writing them immediately. The internal buffer is
+// sized accordingly. Buffered blocks can be written earlier with Flush, and are always written on
+// Close.
+//
+// This allows to coalesce many small writes into few large ones, for destinations with a high
+// per-request overhead. Use an IdleFlushWriter to bound the time blocks may stay buffered.
+func WithHighWaterMark(size int) WriterOption {
+	return func(o *writerOptions) {
+		o.highWater = size
 	}
 }
 
-func (w *blockWriter) Write(p []byte) (int, error) {
+func (w *BlockWriter) Write(p []byte) (int, error) {
+	w.guard.acquire(methodWrite)
+	defer w.guard.release()
+
+	n, err := w.write(p)
+	w.accepted += int64(n)
+	if n > 0 && w.pending() > 0 {
+		w.stats.PartialBlocks++
+	}
+	w.checkInvariants()
+	w.progress.update(w.accepted, w.flushed)
+	w.observers.fail(err)
+	return n, err
+}
+
+func (w *BlockWriter) write(p []byte) (int, error) {
 	count := 0
 
 	// Return the previously saved error, if any.
@@ -52,6 +162,23 @@ func (w *blockWriter) Write(p []byte) (int, error) {
 		return count, w.err
 	}
 
+	// Reserve the header before writing anything else.
+	if err := w.reserveHeader(); err != nil {
+		w.releaseBuf()
+		return count, err
+	}
+
+	// If the internal buffer is empty and the source is made of more complete blocks than the
+	// internal buffer can hold, then crypt them all at once to a pooled buffer.
+	if w.large && len(w.buf) == 0 && len(p) > cap(w.buf) && len(p)%w.blockSize == 0 {
+		return w.writeLarge(p)
+	}
+
+	// If a high-water mark is defined, then accumulate crypted blocks in the internal buffer.
+	if w.highWater > 0 {
+		return w.writeBuffered(p)
+	}
+
 	// While complete blocks are available, crypt as many as possible in the internal buffer and
 	// write the result to the destination writer.
 	for len(w.buf)+len(p) >= w.blockSize {
@@ -69,7 +196,9 @@ func (w *blockWriter) Write(p []byte) (int, error) {
 			copied := copy(src[remaining:], p)
 			p = p[copied:]
 
-			w.blockMode.CryptBlocks(src, src)
+			if err := w.cryptBlocks(src, src); err != nil {
+				return count, err
+			}
 		}
 
 		// Otherwise, determine how many complete blocks can be stored in src.
@@ -81,13 +210,16 @@ func (w *blockWriter) Write(p []byte) (int, error) {
 		// If any, crypt them and store the result in src at the same time. This avoids a
 		// preliminary copy.
 		if cryptable > 0 {
-			w.blockMode.CryptBlocks(src[len(src):cap(src)], p[:cryptable])
+			if err := w.cryptBlocks(src[len(src):cap(src)], p[:cryptable]); err != nil {
+				return count, err
+			}
 			p = p[cryptable:]
 			src = src[:len(src)+cryptable]
 		}
 
 		// Now that src is filled with crypted blocks, write them to the destination writer.
-		n, err := w.dst.Write(src)
+		n, err := w.writeDst(src)
+		w.flushed += int64(n)
 
 		// Count written bytes, except those that come from the internal buffer, because they have
 		// already been aknowledged by the previous call.
@@ -98,7 +230,7 @@ func (w *blockWriter) Write(p []byte) (int, error) {
 		// If any error is encountered, save it, free the internal buffer and stop immediately.
 		if err != nil {
 			w.err = err
-			w.buf = nil
+			w.releaseBuf()
 			return count, err
 		}
 	}
@@ -114,38 +246,381 @@ func (w *blockWriter) Write(p []byte) (int, error) {
 	return count, nil
 }
 
-func (w *blockWriter) Close() error {
+// Stats returns statistics about the calls made so far to the wrapped Writer.
+func (w *BlockWriter) Stats() IOStats {
+	return w.stats
+}
+
+// Written returns the number of bytes successfully written to the wrapped Writer so far, excluding
+// any reserved header.
+//
+// Once Close has succeeded, this is the total size of the output, which can be checked against
+// EncryptedSize.
+func (w *BlockWriter) Written() int64 {
+	return w.flushed
+}
+
+// writeBuffered crypts complete blocks in the internal buffer and writes them to the destination
+// writer only once the high-water mark is reached.
+func (w *BlockWriter) writeBuffered(p []byte) (int, error) {
+	count := 0
+
+	for {
+		// Append as many bytes as possible to the internal buffer and consider them as written.
+		remaining := len(w.buf)
+		w.buf = w.buf[:cap(w.buf)]
+		copied := copy(w.buf[remaining:], p)
+		w.buf = w.buf[:remaining+copied]
+		p = p[copied:]
+		count += copied
+
+		// Crypt all complete blocks following the already crypted ones.
+		cryptable := (len(w.buf) - w.crypted) / w.blockSize * w.blockSize
+		if cryptable > 0 {
+			src := w.buf[w.crypted : w.crypted+cryptable]
+			if err := w.cryptBlocks(src, src); err != nil {
+				return count, err
+			}
+			w.crypted += cryptable
+		}
+
+		// Write crypted blocks to the destination writer if the high-water mark is reached.
+		if w.crypted >= w.highWater {
+			if err := w.flushCrypted(); err != nil {
+				return count, err
+			}
+		}
+
+		if len(p) == 0 {
+			return count, nil
+		}
+	}
+}
+
+// flushCrypted writes the crypted blocks stored in the internal buffer to the destination writer,
+// then moves any incomplete block to the start of the internal buffer. Any error is saved and
+// frees the internal buffer.
+func (w *BlockWriter) flushCrypted() error {
+	// Stop early if there is no crypted block.
+	if w.crypted == 0 {
+		return nil
+	}
+
+	n, err := w.writeDst(w.buf[:w.crypted])
+	w.flushed += int64(n)
+	if err != nil {
+		w.err = err
+		w.releaseBuf()
+		return err
+	}
+
+	remaining := copy(w.buf, w.buf[w.crypted:])
+	w.buf = w.buf[:remaining]
+	w.crypted = 0
+	return nil
+}
+
+// Flush writes all complete blocks stored in the internal buffer to the wrapped Writer. Only an
+// incomplete block may remain buffered.
+//
+// This is only useful with WithHighWaterMark, since complete blocks are otherwise written
+// immediately.
+func (w *BlockWriter) Flush() error {
+	w.guard.acquire(methodFlush)
+	defer w.guard.release()
+
 	// Return the previously saved error, if any.
 	if w.err != nil {
 		return w.err
 	}
 
-	// Initialize src with remaining bytes.
-	src := w.buf
-	remaining := len(src)
+	err := w.flushCrypted()
+	w.checkInvariants()
+	w.progress.update(w.accepted, w.flushed)
+	w.observers.fail(err)
+	return err
+}
 
-	// Free the internal buffer.
-	w.buf = nil
+// largeBufPool stores the buffers used by writeLarge.
+var largeBufPool sync.Pool
 
-	// Stop early if the internal buffer does not contain an incomplete block.
-	if remaining == 0 {
-		return nil
+// writeLarge crypts the given complete blocks with a single call to CryptBlocks, then writes them
+// to the destination writer with a single call to Write.
+func (w *BlockWriter) writeLarge(p []byte) (int, error) {
+	var buf []byte
+	if pooled, ok := largeBufPool.Get().(*[]byte); ok && cap(*pooled) >= len(p) {
+		buf = (*pooled)[:len(p)]
+	} else {
+		buf = make([]byte, len(p))
+	}
+	defer func() {
+		// The pooled buffer holds the output, which is plaintext when decrypting.
+		if w.wipe {
+			wipeBytes(buf)
+		}
+		largeBufPool.Put(&buf)
+	}()
+
+	if err := w.cryptBlocks(buf, p); err != nil {
+		return 0, err
+	}
+
+	n, err := w.writeDst(buf)
+	w.flushed += int64(n)
+
+	// If any error is encountered, save it and free the internal buffer.
+	if err != nil {
+		w.err = err
+		w.releaseBuf()
+	}
+	return n, err
+}
+
+// WriteByte writes a single byte. Unless it completes a block, the byte is only appended to the
+// internal buffer.
+func (w *BlockWriter) WriteByte(c byte) error {
+	w.guard.acquire(methodWriteByte)
+	defer w.guard.release()
+
+	// Return the previously saved error, if any.
+	if w.err != nil {
+		return w.err
+	}
+
+	// Store the byte in the internal buffer, then flush it only if a block has been completed.
+	w.buf = append(w.buf, c)
+	w.accepted++
+	var err error
+	if w.pending() == w.blockSize {
+		_, err = w.write(nil)
 	}
+	w.checkInvariants()
+	w.progress.update(w.accepted, w.flushed)
+	w.observers.fail(err)
+	return err
+}
+
+// TruncatePending discards the bytes written since the last complete block, which are still
+// stored in the internal buffer, and returns their count. Blocks already written to the wrapped
+// Writer are not affected.
+//
+// This allows to abandon a partly written message without ending the stream, as long as the
+// message started at a block boundary.
+func (w *BlockWriter) TruncatePending() int {
+	w.guard.acquire(methodTruncatePending)
+	defer w.guard.release()
+
+	n := w.pending()
+	w.buf = w.buf[:w.crypted]
+	w.accepted -= int64(n)
+	w.checkInvariants()
+	return n
+}
+
+// SetPadding replaces the padding used by Close and FinalizeRecord to fill any incomplete block,
+// for protocols which only learn it once most of the data has been written. A nil padding makes
+// them return an AlignmentError instead, as with NewBlockWriter.
+//
+// An error is returned if the Writer has already been closed, since the last block has then been
+// written with the previous padding.
+func (w *BlockWriter) SetPadding(padding Padding) error {
+	w.guard.acquire(methodSetPadding)
+	defer w.guard.release()
+
+	// Return the previously saved error, if any.
+	if w.err != nil {
+		return w.err
+	}
+
+	// The internal buffer is only released by Close once the Writer is done.
+	if w.buf == nil {
+		return errors.New("cipherio: SetPadding on closed BlockWriter")
+	}
+
+	w.padding = padding
+	return nil
+}
+
+// pending returns the number of bytes of the incomplete block stored in the internal buffer.
+func (w *BlockWriter) pending() int {
+	return len(w.buf) - w.crypted
+}
+
+func (w *BlockWriter) Close() error {
+	w.guard.acquire(methodClose)
+	defer w.guard.release()
 
-	// Return ErrUnexpectedEOF if no padding is defined.
-	if w.padding == nil {
-		w.err = io.ErrUnexpectedEOF
+	err := w.close()
+	w.checkInvariants()
+	if err == nil {
+		w.progress.finish(w.accepted, w.flushed)
+		w.observers.end()
+	}
+	w.observers.fail(err)
+	return err
+}
+
+func (w *BlockWriter) close() error {
+	// Return the previously saved error, if any.
+	if w.err != nil {
 		return w.err
 	}
 
-	// Fill the incomplete block with padding.
-	src = src[:w.blockSize]
-	w.padding.Fill(src[remaining:])
+	// Return an AlignmentError if an incomplete block remains and no padding is defined, after
+	// having written any complete block.
+	if w.pending() > 0 && w.padding == nil {
+		if err := w.flushCrypted(); err != nil {
+			return err
+		}
+		w.err = w.alignmentError()
+		w.releaseBuf()
+		return w.err
+	}
+
+	// Reserve the header if nothing has been written yet.
+	if err := w.reserveHeader(); err != nil {
+		w.releaseBuf()
+		return err
+	}
 
-	// Crypt the last block inplace.
-	w.blockMode.CryptBlocks(src, src)
+	// Write the last block, if any, then free the internal buffer.
+	err := w.writePadded()
+	w.releaseBuf()
+	if err != nil {
+		return err
+	}
+
+	return w.patchHeader()
+}
+
+// FinalizeRecord ends the current record by padding and writing any incomplete block, then
+// reinitializes the BlockMode with the given IV so that a new record can be written.
+//
+// The BlockMode must provide a SetIV method, like the CBC implementations of crypto/cipher.
+//
+// If an incomplete block remains and no padding is defined, an AlignmentError is returned and the
+// Writer is left untouched, so that the record can still be completed.
+func (w *BlockWriter) FinalizeRecord(newIV []byte) error {
+	w.guard.acquire(methodFinalizeRecord)
+	defer w.guard.release()
+
+	// Return the previously saved error, if any.
+	if w.err != nil {
+		return w.err
+	}
+
+	setter, ok := w.blockMode.(ivSetter)
+	if !ok {
+		return fmt.Errorf("cipherio: BlockMode does not support IV reinitialization: %T", w.blockMode)
+	}
+	var verifierSetter ivSetter
+	if w.verifier != nil {
+		verifierSetter, ok = w.verifier.blockMode.(ivSetter)
+		if !ok {
+			return fmt.Errorf("cipherio: BlockMode does not support IV reinitialization: %T", w.verifier.blockMode)
+		}
+	}
+	if err := checkIV(newIV, w.blockSize); err != nil {
+		return err
+	}
+
+	// Return an AlignmentError if an incomplete block remains and no padding is defined.
+	if w.pending() > 0 && w.padding == nil {
+		return w.alignmentError()
+	}
+
+	// Reserve the header if nothing has been written yet.
+	if err := w.reserveHeader(); err != nil {
+		w.releaseBuf()
+		return err
+	}
+
+	// Write the last block of the record, if any.
+	err := w.writePadded()
+	w.checkInvariants()
+	w.progress.update(w.accepted, w.flushed)
+	if err != nil {
+		w.observers.fail(err)
+		return err
+	}
+
+	// The internal buffer is empty, but may still hold plaintext bytes beyond its length.
+	if w.wipe {
+		wipeBytes(w.buf)
+	}
+
+	setter.SetIV(newIV)
+	if verifierSetter != nil {
+		verifierSetter.SetIV(newIV)
+	}
+	w.observers.rekeyed()
+	return nil
+}
+
+func (w *BlockWriter) alignmentError() error {
+	return AlignmentError{
+		Buffered: w.pending(),
+		Missing:  w.blockSize - w.pending(),
+	}
+}
+
+// ivSetter is implemented by the CBC BlockModes of crypto/cipher.
+type ivSetter interface {
+	SetIV(iv []byte)
+}
+
+// crypt crypts complete blocks, with verification if enabled.
+func (w *BlockWriter) crypt(dst, src []byte) error {
+	if w.verifier == nil {
+		w.blockMode.CryptBlocks(dst, src)
+		return nil
+	}
+	return w.verifier.crypt(w.blockMode, dst, src)
+}
+
+// cryptBlocks crypts complete blocks, with verification if enabled, then checks for a failure of a
+// FallibleBlockMode. Any error is saved and frees the internal buffer.
+func (w *BlockWriter) cryptBlocks(dst, src []byte) error {
+	var err error
+	if w.profiler != nil {
+		w.profiler.do("crypt", func() {
+			err = w.crypt(dst, src)
+		})
+	} else {
+		err = w.crypt(dst, src)
+	}
+
+	// A failure of the BlockMode itself takes precedence over any verification error.
+	if modeErr := blockModeErr(w.blockMode); modeErr != nil {
+		err = modeErr
+	}
+	if err != nil {
+		w.err = err
+		w.releaseBuf()
+		return err
+	}
+	w.observers.crypted(len(src))
+	return nil
+}
+
+// writePadded fills the incomplete block stored in the internal buffer, if any, then crypts it and
+// writes it to the destination writer along with any other crypted block. Any error is saved and
+// frees the internal buffer.
+func (w *BlockWriter) writePadded() error {
+	remaining := w.pending()
+
+	// If the internal buffer contains an incomplete block, then fill it with padding and crypt it
+	// inplace.
+	if remaining > 0 {
+		src := w.buf[w.crypted : w.crypted+w.blockSize]
+		w.padding.Fill(src[remaining:])
+		if err := w.cryptBlocks(src, src); err != nil {
+			return err
+		}
+		w.buf = w.buf[:w.crypted+w.blockSize]
+		w.crypted += w.blockSize
+	}
 
-	// Write the last block to the destination writer.
-	_, w.err = w.dst.Write(src)
-	return w.err
+	// Write the last blocks to the destination writer.
+	return w.flushCrypted()
 }
@@ -5,8 +5,10 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -207,13 +209,13 @@ func TestWriter(t *testing.T) {
 				},
 				{
 					Action: closeAction{
-						ExpectedErr: io.ErrUnexpectedEOF,
+						ExpectedErr: cipherio.AlignmentError{Buffered: 3, Missing: 13},
 					},
 					MockCalls: []writerMockCall{},
 				},
 				{
 					Action: closeAction{
-						ExpectedErr: io.ErrUnexpectedEOF,
+						ExpectedErr: cipherio.AlignmentError{Buffered: 3, Missing: 13},
 					},
 					MockCalls: []writerMockCall{},
 				},
@@ -494,3 +496,502 @@ func TestWriter(t *testing.T) {
 		})
 	}
 }
+
+func TestWriterWriteByte(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 4*aesCipher.BlockSize())
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, len(originalBytes))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, originalBytes)
+
+	var dst bytes.Buffer
+	writer := cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv))
+
+	// Mix single bytes and regular writes.
+	for _, b := range originalBytes[:21] {
+		err = writer.WriteByte(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dst.Len() != 16 {
+		t.Fatalf("unexpected written length: %d != %d", dst.Len(), 16)
+	}
+
+	_, err = writer.Write(originalBytes[21:40])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range originalBytes[40:] {
+		err = writer.WriteByte(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.Bytes(), expectedBytes) {
+		t.Fatalf("unexpected written bytes")
+	}
+	if writer.Written() != int64(len(expectedBytes)) {
+		t.Fatalf("unexpected written count: %d != %d", writer.Written(), len(expectedBytes))
+	}
+}
+
+func TestWriterFinalizeRecord(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ivs := make([][]byte, 3)
+	for index := range ivs {
+		ivs[index] = make([]byte, aesCipher.BlockSize())
+		_, err = rand.Read(ivs[index])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Generate random records, either aligned or not
+	records := [][]byte{
+		make([]byte, 21),
+		make([]byte, 32),
+		make([]byte, 5),
+	}
+	var expectedBytes []byte
+	for index, record := range records {
+		_, err = rand.Read(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		padded := make([]byte, (len(record)+15)/16*16)
+		copy(padded, record)
+		cipher.NewCBCEncrypter(aesCipher, ivs[index]).CryptBlocks(padded, padded)
+		expectedBytes = append(expectedBytes, padded...)
+	}
+
+	var dst bytes.Buffer
+	writer := cipherio.NewBlockWriterWithPadding(&dst, cipher.NewCBCEncrypter(aesCipher, ivs[0]), cipherio.ZeroPadding)
+
+	for index, record := range records {
+		_, err = writer.Write(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if index+1 < len(records) {
+			err = writer.FinalizeRecord(ivs[index+1])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.Bytes(), expectedBytes) {
+		t.Fatalf("unexpected written bytes")
+	}
+
+	// An invalid IV is rejected.
+	writer = cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, ivs[0]))
+	err = writer.FinalizeRecord(ivs[0][:8])
+	if err == nil {
+		t.Fatalf("unexpected success with an invalid IV")
+	}
+
+	// An incomplete record cannot be finalized without padding, but can still be completed.
+	_, err = writer.Write(records[0][:5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.FinalizeRecord(ivs[1])
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected finalize err: %v", err)
+	}
+	_, err = writer.Write(records[0][5:16])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.FinalizeRecord(ivs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterTruncatePending(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 3*aesCipher.BlockSize())
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, len(originalBytes))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, originalBytes)
+
+	var dst bytes.Buffer
+	writer := cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv))
+
+	// Write one block and a half, then abandon the incomplete block.
+	_, err = writer.Write(originalBytes[:24])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := writer.TruncatePending()
+	if n != 8 {
+		t.Fatalf("unexpected truncated length: %d != %d", n, 8)
+	}
+
+	// Nothing remains to be truncated.
+	n = writer.TruncatePending()
+	if n != 0 {
+		t.Fatalf("unexpected truncated length: %d != %d", n, 0)
+	}
+
+	// Resume at the block boundary.
+	_, err = writer.Write(originalBytes[16:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.Bytes(), expectedBytes) {
+		t.Fatalf("unexpected written bytes")
+	}
+}
+
+// countingWriter records the length of each Write.
+type countingWriter struct {
+	bytes.Buffer
+	Writes []int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.Writes = append(w.Writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestWriterLargeWrite(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 4096*aesCipher.BlockSize())
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, len(originalBytes))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, originalBytes)
+
+	dst := &countingWriter{}
+	writer := cipherio.NewBlockWriter(dst, cipher.NewCBCEncrypter(aesCipher, iv))
+
+	// Aligned writes larger than the internal buffer should lead to a single downstream write.
+	buf := append([]byte(nil), originalBytes...)
+	offset := 0
+	for _, size := range []int{2048 * 16, 16, 2047 * 16} {
+		n, err := writer.Write(buf[offset : offset+size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != size {
+			t.Fatalf("unexpected write length: %d != %d", n, size)
+		}
+		offset += size
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedWrites := []int{2048 * 16, 16, 2047 * 16}
+	if fmt.Sprint(dst.Writes) != fmt.Sprint(expectedWrites) {
+		t.Fatalf("unexpected writes: %v != %v", dst.Writes, expectedWrites)
+	}
+	if !bytes.Equal(dst.Bytes(), expectedBytes) {
+		t.Fatalf("unexpected written bytes")
+	}
+	if !bytes.Equal(buf, originalBytes) {
+		t.Fatalf("unexpected modification in write buffer")
+	}
+}
+
+func TestWriterLowMemory(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 64*aesCipher.BlockSize())
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, len(originalBytes))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, originalBytes)
+
+	dst := &countingWriter{}
+	writer := cipherio.NewBlockWriter(dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithLowMemory())
+	if size := len(cipherio.WriterBuf(writer)); size != aesCipher.BlockSize() {
+		t.Fatalf("unexpected buffer size: %d != %d", size, aesCipher.BlockSize())
+	}
+
+	// Large aligned writes are split into single blocks instead of being crypted at once.
+	offset := 0
+	for _, size := range []int{32 * 16, 5, 27, 30 * 16} {
+		_, err := writer.Write(originalBytes[offset : offset+size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset += size
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range dst.Writes {
+		if size != aesCipher.BlockSize() {
+			t.Fatalf("unexpected writes: %v", dst.Writes)
+		}
+	}
+	if !bytes.Equal(dst.Bytes(), expectedBytes) {
+		t.Fatalf("unexpected written bytes")
+	}
+}
+
+func TestWriterHighWaterMark(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES-CBC encrypter
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, aesCipher.BlockSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate random test data
+	originalBytes := make([]byte, 200)
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := make([]byte, 208)
+	copy(expectedBytes, originalBytes)
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(expectedBytes, expectedBytes)
+
+	dst := &countingWriter{}
+	writer := cipherio.NewBlockWriterWithPadding(dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding, cipherio.WithHighWaterMark(64))
+
+	// Many small writes should be coalesced once the high-water mark is reached.
+	for offset := 0; offset < len(originalBytes); offset += 20 {
+		_, err = writer.Write(originalBytes[offset : offset+20])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Flush should only write complete blocks, Close should write the padded one.
+	err = writer.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedWrites := []int{80, 80, 32, 16}
+	if fmt.Sprint(dst.Writes) != fmt.Sprint(expectedWrites) {
+		t.Fatalf("unexpected writes: %v != %v", dst.Writes, expectedWrites)
+	}
+	if !bytes.Equal(dst.Bytes(), expectedBytes) {
+		t.Fatalf("unexpected written bytes")
+	}
+
+	// Without padding, complete blocks should still be written before failing on Close.
+	dst = &countingWriter{}
+	writer = cipherio.NewBlockWriter(dst, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.WithHighWaterMark(64))
+	_, err = writer.Write(originalBytes[:40])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != (cipherio.AlignmentError{Buffered: 8, Missing: 8}) {
+		t.Fatalf("unexpected close err: %v", err)
+	}
+	if !bytes.Equal(dst.Bytes(), expectedBytes[:32]) {
+		t.Fatalf("unexpected written bytes")
+	}
+}
+
+func TestWriterSetPadding(t *testing.T) {
+	// Generate a random AES key
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Initialize the AES cipher
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aesCipher.BlockSize())
+
+	originalBytes := make([]byte, 100)
+	_, err = rand.Read(originalBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedBytes, err := cipherio.EncryptBytes(nil, originalBytes, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.BitPadding)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+
+	// The padding is only chosen after most of the data has been written.
+	var dst bytes.Buffer
+	writer := cipherio.NewBlockWriter(&dst, cipher.NewCBCEncrypter(aesCipher, iv))
+	_, err = writer.Write(originalBytes)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.SetPadding(cipherio.BitPadding)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	if !bytes.Equal(dst.Bytes(), expectedBytes) {
+		t.Fatalf("unexpected written bytes")
+	}
+
+	// The padding can no longer be changed once closed.
+	err = writer.SetPadding(cipherio.ZeroPadding)
+	if err == nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// Removing the padding makes Close fail on an incomplete block.
+	writer = cipherio.NewBlockWriterWithPadding(ioutil.Discard, cipher.NewCBCEncrypter(aesCipher, iv), cipherio.ZeroPadding)
+	_, err = writer.Write(originalBytes)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.SetPadding(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v != %v", err, nil)
+	}
+	err = writer.Close()
+	if err != (cipherio.AlignmentError{Buffered: 4, Missing: 12}) {
+		t.Fatalf("unexpected close err: %v", err)
+	}
+}